@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+// householdHeader selects the household a request acts on for users in
+// more than one household.
+const householdHeader = "X-Txns-Household"
+
+type householdKey struct{}
+
+type householdLister interface {
+	UserHouseholds(ctx context.Context, user int64) ([]storage.Household, error)
+}
+
+// withHousehold returns ctx for a request acting on the given household.
+func withHousehold(ctx context.Context, household int64) context.Context {
+	return context.WithValue(ctx, householdKey{}, household)
+}
+
+// householdOf returns the household the request acts on, which is only set
+// for requests that passed householdAccess.
+func householdOf(r *http.Request) int64 {
+	h, ok := r.Context().Value(householdKey{}).(int64)
+	if !ok {
+		panic(fmt.Sprintf("no household for request %v %v, the route is missing householdAccess", r.Method, r.URL.Path))
+	}
+	return h
+}
+
+// txnStore returns the transactions of the household the request acts on.
+func (s *txnsServer) txnStore(r *http.Request) storage.TxnStore {
+	return s.txns(householdOf(r))
+}
+
+// store returns the storage of the household the request acts on.
+func (s *txnsServer) store(r *http.Request) storage.Store {
+	return s.db.ForHousehold(householdOf(r))
+}
+
+// userHouseholds returns the households the user of the request's token is
+// a member of.
+func userHouseholds(r *http.Request, households householdLister) ([]storage.Household, int, error) {
+	tok, ok := tokenOf(r)
+	if !ok {
+		return nil, http.StatusUnauthorized, fmt.Errorf("request had no API token")
+	}
+	hs, err := households.UserHouseholds(r.Context(), tok.UserID)
+	if err != nil {
+		log.Printf("Error looking up households of user %v: %v", tok.UserID, err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("error looking up households")
+	}
+	return hs, http.StatusOK, nil
+}
+
+// householdAccess returns middleware choosing the household a request acts
+// on and checking the user of the request's token is a member of it. The
+// household is given by the X-Txns-Household header and defaults to the
+// user's only household. Without authentication every household can be
+// accessed and the default household is used.
+func householdAccess(households householdLister) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var requested int64
+			if v := r.Header.Get(householdHeader); v != "" {
+				var err error
+				if requested, err = strconv.ParseInt(v, 10, 64); err != nil || requested <= 0 {
+					respondf(w, http.StatusBadRequest, "invalid %v header '%v', want a household ID", householdHeader, v)
+					return
+				}
+			}
+			if _, ok := tokenOf(r); !ok {
+				if requested == 0 {
+					requested = storage.DefaultHousehold
+				}
+				next.ServeHTTP(w, r.WithContext(withHousehold(r.Context(), requested)))
+				return
+			}
+			hs, status, err := userHouseholds(r, households)
+			if err != nil {
+				respondf(w, status, "%v", err)
+				return
+			}
+			isMember := func(h storage.Household) bool { return h.ID == requested }
+			switch {
+			case requested != 0 && !slices.ContainsFunc(hs, isMember):
+				respondf(w, http.StatusForbidden, "not a member of household %v", requested)
+				return
+			case requested != 0:
+			case len(hs) == 1:
+				requested = hs[0].ID
+			case len(hs) == 0:
+				respondf(w, http.StatusForbidden, "not a member of any household")
+				return
+			default:
+				respondf(w, http.StatusBadRequest, "member of %v households, choose one with the %v header", len(hs), householdHeader)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withHousehold(r.Context(), requested)))
+		})
+	}
+}
+
+type household struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type householdsResp struct {
+	Households []household `json:"households"`
+}
+
+// getHouseholds lists the households the caller can choose from with the
+// X-Txns-Household header.
+func (s *txnsServer) getHouseholds(w http.ResponseWriter, r *http.Request) {
+	var hs []storage.Household
+	if _, ok := tokenOf(r); ok {
+		var status int
+		var err error
+		if hs, status, err = userHouseholds(r, s.db); err != nil {
+			respondf(w, status, "%v", err)
+			return
+		}
+	} else {
+		var err error
+		if hs, err = s.db.ListHouseholds(r.Context()); err != nil {
+			respondf(w, http.StatusInternalServerError, "error listing households: %v", err)
+			return
+		}
+	}
+	resp := householdsResp{Households: []household{}}
+	for _, h := range hs {
+		resp.Households = append(resp.Households, household{ID: fmt.Sprint(h.ID), Name: h.Name})
+	}
+	respBody, err := json.Marshal(&resp)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error generating JSON response: %v", err)
+		return
+	}
+	respond(w, http.StatusOK, respBody)
+}
+
+type postHouseholdReq struct {
+	Name string `json:"name"`
+}
+
+// postHousehold creates a household with the caller as its only member.
+func (s *txnsServer) postHousehold(w http.ResponseWriter, r *http.Request) {
+	var req postHouseholdReq
+	if err := readJSONBody(r, "household", &req); err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err := storage.ValidateAccountName("household", req.Name); err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	id, err := s.db.CreateHousehold(r.Context(), req.Name)
+	if err != nil {
+		respondStorageErr(w, err, "error creating household '%v'", req.Name)
+		return
+	}
+	if tok, ok := tokenOf(r); ok {
+		if err := s.db.AddHouseholdMember(r.Context(), id, tok.UserID); err != nil {
+			respondStorageErr(w, err, "error adding user %v to household '%v'", tok.UserID, req.Name)
+			return
+		}
+	}
+	respondJSON(w, &household{ID: fmt.Sprint(id), Name: req.Name})
+}
+
+type householdMember struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type householdMembersResp struct {
+	Members []householdMember `json:"members"`
+}
+
+// getHouseholdMembers lists the users in the household the request acts
+// on.
+func (s *txnsServer) getHouseholdMembers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.db.HouseholdMembers(r.Context(), householdOf(r))
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing household members: %v", err)
+		return
+	}
+	resp := householdMembersResp{Members: []householdMember{}}
+	for _, u := range users {
+		resp.Members = append(resp.Members, householdMember{ID: fmt.Sprint(u.ID), Name: u.Name})
+	}
+	respondJSON(w, &resp)
+}
+
+// putHouseholdMember adds the user named in the url to the household the
+// request acts on.
+func (s *txnsServer) putHouseholdMember(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "user")
+	u, err := s.db.UserByName(r.Context(), name)
+	if err != nil {
+		respondStorageErr(w, err, "error looking up user '%v'", name)
+		return
+	}
+	if err := s.db.AddHouseholdMember(r.Context(), householdOf(r), u.ID); err != nil {
+		respondStorageErr(w, err, "error adding user '%v' to household %v", name, householdOf(r))
+		return
+	}
+	respondf(w, http.StatusOK, "user '%v' added to household %v", name, householdOf(r))
+}
+
+// deleteHouseholdMember removes the user named in the url from the
+// household the request acts on.
+func (s *txnsServer) deleteHouseholdMember(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "user")
+	u, err := s.db.UserByName(r.Context(), name)
+	if err != nil {
+		respondStorageErr(w, err, "error looking up user '%v'", name)
+		return
+	}
+	if err := s.db.RemoveHouseholdMember(r.Context(), householdOf(r), u.ID); err != nil {
+		respondStorageErr(w, err, "error removing user '%v' from household %v", name, householdOf(r))
+		return
+	}
+	respondf(w, http.StatusOK, "user '%v' removed from household %v", name, householdOf(r))
+}
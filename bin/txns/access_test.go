@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+type fakeHouseholds map[int64][]storage.Household
+
+func (f fakeHouseholds) UserHouseholds(_ context.Context, user int64) ([]storage.Household, error) {
+	return f[user], nil
+}
+
+func TestHouseholdAccess(t *testing.T) {
+	households := fakeHouseholds{
+		1: {{ID: 1, Name: "default"}},
+		2: {{ID: 1, Name: "default"}, {ID: 2, Name: "shared"}},
+	}
+	h := householdAccess(households)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, householdOf(r))
+	}))
+	for _, tc := range []struct {
+		name          string
+		user          int64
+		noToken       bool
+		header        string
+		wantCode      int
+		wantHousehold string
+	}{
+		{name: "no auth", noToken: true, wantCode: http.StatusOK, wantHousehold: "1"},
+		{name: "no auth with header", noToken: true, header: "5", wantCode: http.StatusOK, wantHousehold: "5"},
+		{name: "only household", user: 1, wantCode: http.StatusOK, wantHousehold: "1"},
+		{name: "only household with header", user: 1, header: "1", wantCode: http.StatusOK, wantHousehold: "1"},
+		{name: "not a member", user: 1, header: "2", wantCode: http.StatusForbidden},
+		{name: "ambiguous", user: 2, wantCode: http.StatusBadRequest},
+		{name: "chosen", user: 2, header: "2", wantCode: http.StatusOK, wantHousehold: "2"},
+		{name: "invalid header", user: 2, header: "shared", wantCode: http.StatusBadRequest},
+		{name: "no households", user: 3, wantCode: http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/txns", nil)
+		if !tc.noToken {
+			req = req.WithContext(context.WithValue(req.Context(), tokenKey{}, storage.Token{UserID: tc.user}))
+		}
+		if tc.header != "" {
+			req.Header.Set(householdHeader, tc.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.wantCode {
+			t.Errorf("%v got status %v with body %q, want %v", tc.name, rec.Code, rec.Body.String(), tc.wantCode)
+			continue
+		}
+		if tc.wantHousehold != "" && rec.Body.String() != tc.wantHousehold {
+			t.Errorf("%v got household %v, want %v", tc.name, rec.Body.String(), tc.wantHousehold)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/anomalies"
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+type anomalyFlag struct {
+	Kind        string  `json:"kind"`
+	Score       float64 `json:"score"`
+	Explanation string  `json:"explanation"`
+}
+
+type anomaly struct {
+	Txn   txn           `json:"txn"`
+	Score float64       `json:"score"`
+	Flags []anomalyFlag `json:"flags"`
+}
+
+type anomaliesResp struct {
+	Anomalies []anomaly `json:"anomalies"`
+}
+
+// getAnomalies flags the charges matching the txns query parameters that
+// are out of character compared to the transactions of the household in
+// the year before them, up to limit anomalies by decreasing score. Without
+// fromDate the charges of the last 90 days before toDate are scored.
+func (s *txnsServer) getAnomalies(w http.ResponseWriter, r *http.Request) {
+	tq, err := txnQueryFromRequest(r)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "error validating request parameters: %v", err)
+		return
+	}
+	if tq.FromDate == nil {
+		to := time.Now().UTC().Truncate(24 * time.Hour)
+		if tq.ToDate != nil {
+			to = *tq.ToDate
+		}
+		from := to.AddDate(0, 0, -anomalies.DefaultRangeDays)
+		tq.FromDate = &from
+	}
+	since := tq.FromDate.AddDate(0, 0, -anomalies.LookbackDays)
+	store := s.store(r)
+	var history, txns []storage.Txn
+	collect := func(dst *[]storage.Txn) func(t *storage.Txn) error {
+		return func(t *storage.Txn) error {
+			*dst = append(*dst, *t)
+			return nil
+		}
+	}
+	if err := store.ForEachTxn(r.Context(), &storage.TxnQuery{FromDate: &since, ToDate: tq.ToDate}, collect(&history)); err != nil {
+		respondf(w, http.StatusInternalServerError, "error querying txns: %v", err)
+		return
+	}
+	if err := store.ForEachTxn(r.Context(), tq, collect(&txns)); err != nil {
+		respondf(w, http.StatusInternalServerError, "error querying txns: %v", err)
+		return
+	}
+	novelty, err := store.DescriptionNovelty(r.Context(), tq, since)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error computing description novelty: %v", err)
+		return
+	}
+	// The history includes the scored charges.
+	merchants := map[int64]string{}
+	for _, t := range history {
+		if t.Merchant != "" {
+			merchants[t.ID] = t.Merchant
+		}
+	}
+	found := anomalies.Score(history, txns, merchants, novelty)
+	resp := anomaliesResp{Anomalies: []anomaly{}}
+	for _, a := range found[:min(int64(len(found)), tq.Limit)] {
+		an := anomaly{Txn: txnsStorageToResp([]storage.Txn{a.Txn}).Txns[0], Score: a.Score}
+		for _, f := range a.Flags {
+			an.Flags = append(an.Flags, anomalyFlag{Kind: f.Kind, Score: f.Score, Explanation: f.Explanation})
+		}
+		resp.Anomalies = append(resp.Anomalies, an)
+	}
+	respondJSON(w, &resp)
+}
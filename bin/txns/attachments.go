@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/smukherj1/expenses/pkg/blobstore"
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+const (
+	maxAttachmentSize = 20 << 20
+	attachmentField   = "file"
+)
+
+type attachment struct {
+	ID          string `json:"id"`
+	TxnID       string `json:"txn_id"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Digest      string `json:"digest"`
+	CreatedAt   string `json:"created_at"`
+}
+
+type attachmentsResp struct {
+	Attachments []attachment `json:"attachments"`
+}
+
+func attachmentStorageToResp(a *storage.Attachment) attachment {
+	return attachment{
+		ID:          fmt.Sprint(a.ID),
+		TxnID:       fmt.Sprint(a.TxnID),
+		Name:        a.Name,
+		ContentType: a.ContentType,
+		Size:        a.SizeBytes,
+		Digest:      a.Digest,
+		CreatedAt:   a.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// allowedAttachmentType reports whether the sniffed content type is a receipt
+// format we accept, i.e., an image or a PDF.
+func allowedAttachmentType(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/") || contentType == "application/pdf"
+}
+
+func urlParamID(r *http.Request, name string) (int64, error) {
+	s := chi.URLParam(r, name)
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid value for url path parameter %v=%v, want number >= 0", name, s)
+	}
+	return id, nil
+}
+
+func (s *txnsServer) postAttachment(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	// Look the txn up before storing the blob so an attachment for a txn
+	// that doesn't exist or belongs to another household doesn't leave an
+	// unreferenced blob behind.
+	store := s.store(r)
+	page, err := store.QueryTxns(r.Context(), &storage.TxnQuery{StartID: txnID, Limit: 1})
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error fetching txn %v: %v", txnID, err)
+		return
+	}
+	if len(page.Txns) == 0 || page.Txns[0].ID != txnID {
+		respondf(w, http.StatusNotFound, "txn %v not found", txnID)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+1<<20)
+	file, header, err := r.FormFile(attachmentField)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "error reading multipart form field '%v': %v", attachmentField, err)
+		return
+	}
+	defer file.Close()
+	if header.Size > maxAttachmentSize {
+		respondf(w, http.StatusRequestEntityTooLarge, "attachment too large, got %v bytes, want <= %v", header.Size, maxAttachmentSize)
+		return
+	}
+	br := bufio.NewReader(file)
+	head, err := br.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondf(w, http.StatusBadRequest, "error reading attachment: %v", err)
+		return
+	}
+	contentType := http.DetectContentType(head)
+	if !allowedAttachmentType(contentType) {
+		respondf(w, http.StatusUnsupportedMediaType, "unsupported attachment type %q, only images and PDFs are allowed", contentType)
+		return
+	}
+	name := filepath.Base(header.Filename)
+	if name == "." || name == string(filepath.Separator) {
+		name = "attachment"
+	}
+	digest, size, err := s.blobs.Put(r.Context(), br)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error storing attachment: %v", err)
+		return
+	}
+	a := storage.Attachment{
+		TxnID:       txnID,
+		Name:        name,
+		ContentType: contentType,
+		SizeBytes:   size,
+		Digest:      digest,
+	}
+	id, err := store.CreateAttachment(r.Context(), &a)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondf(w, http.StatusNotFound, "error creating attachment: %v", err)
+		return
+	} else if err != nil {
+		respondf(w, http.StatusInternalServerError, "error creating attachment: %v", err)
+		return
+	}
+	a.ID = id
+	respBody, err := json.Marshal(attachmentStorageToResp(&a))
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error generating JSON response: %v", err)
+		return
+	}
+	respond(w, http.StatusOK, respBody)
+}
+
+func (s *txnsServer) listAttachments(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	as, err := s.store(r).ListAttachments(r.Context(), txnID)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing attachments: %v", err)
+		return
+	}
+	resp := attachmentsResp{Attachments: []attachment{}}
+	for i := range as {
+		resp.Attachments = append(resp.Attachments, attachmentStorageToResp(&as[i]))
+	}
+	respBody, err := json.Marshal(&resp)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error generating JSON response: %v", err)
+		return
+	}
+	respond(w, http.StatusOK, respBody)
+}
+
+func (s *txnsServer) getAttachment(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	id, err := urlParamID(r, "attachmentID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	a, err := s.store(r).GetAttachment(r.Context(), txnID, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondf(w, http.StatusNotFound, "%v", err)
+		return
+	} else if err != nil {
+		respondf(w, http.StatusInternalServerError, "error fetching attachment: %v", err)
+		return
+	}
+	blob, err := s.blobs.Get(r.Context(), a.Digest)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error reading attachment contents: %v", err)
+		return
+	}
+	defer blob.Close()
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", fmt.Sprint(a.SizeBytes))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("Error streaming attachment %v of txn %v: %v", a.ID, a.TxnID, err)
+	}
+}
+
+func (s *txnsServer) deleteAttachment(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	id, err := urlParamID(r, "attachmentID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	a, referenced, err := s.store(r).DeleteAttachment(r.Context(), txnID, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondf(w, http.StatusNotFound, "%v", err)
+		return
+	} else if err != nil {
+		respondf(w, http.StatusInternalServerError, "error deleting attachment: %v", err)
+		return
+	}
+	if !referenced {
+		if err := s.blobs.Delete(r.Context(), a.Digest); err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+			log.Printf("Error deleting unreferenced blob %v for attachment %v: %v", a.Digest, a.ID, err)
+		}
+	}
+	respondf(w, http.StatusOK, "attachment %v deleted", a.ID)
+}
+
+// unreferencedBlobs returns the digests of the blobs no attachment
+// references that were stored at least minAge before now. Younger blobs are
+// left alone since their attachment may still be being created.
+func unreferencedBlobs(ctx context.Context, blobs *blobstore.Local, referenced map[string]bool, minAge time.Duration, now time.Time) ([]string, error) {
+	var result []string
+	err := blobs.Walk(ctx, func(digest string, modTime time.Time) error {
+		if !referenced[digest] && now.Sub(modTime) >= minAge {
+			result = append(result, digest)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// attachmentsCmd implements the attachments command. "attachments gc"
+// deletes the blobs of attachments that are gone, e.g., because their
+// transaction was deleted from the database, which cascades to the
+// attachments but can't reach the attachments directory.
+func attachmentsCmd(args []string) {
+	if len(args) == 0 || args[0] != "gc" {
+		log.Fatalf("Missing or unknown attachments command, want gc")
+	}
+	fs := flag.NewFlagSet("attachments gc", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "List the unreferenced blobs without deleting them.")
+	minAge := fs.Duration("min-age", time.Hour, "Only delete blobs stored at least this long ago.")
+	fs.Parse(args[1:])
+
+	db, err := openStore()
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	blobs, err := blobstore.NewLocal(*attachmentsDir)
+	if err != nil {
+		log.Fatalf("Error initializing attachments storage: %v", err)
+	}
+	ctx := context.Background()
+	referenced, err := db.AttachmentDigests(ctx)
+	if err != nil {
+		log.Fatalf("Error listing attachments: %v", err)
+	}
+	digests, err := unreferencedBlobs(ctx, blobs, referenced, *minAge, time.Now())
+	if err != nil {
+		log.Fatalf("Error listing blobs: %v", err)
+	}
+	for _, d := range digests {
+		if *dryRun {
+			log.Printf("Would delete unreferenced blob %v.", d)
+			continue
+		}
+		if err := blobs.Delete(ctx, d); err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+			log.Fatalf("Error deleting blob: %v", err)
+		}
+		log.Printf("Deleted unreferenced blob %v.", d)
+	}
+	log.Printf("Found %v unreferenced blobs.", len(digests))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/blobstore"
+)
+
+func TestUnreferencedBlobs(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	blobs, err := blobstore.NewLocal(root)
+	if err != nil {
+		t.Fatalf("NewLocal got error: %v", err)
+	}
+	put := func(contents string, age time.Duration) string {
+		d, _, err := blobs.Put(ctx, strings.NewReader(contents))
+		if err != nil {
+			t.Fatalf("Put got error: %v", err)
+		}
+		old := time.Now().Add(-age)
+		if err := os.Chtimes(filepath.Join(root, d[:2], d), old, old); err != nil {
+			t.Fatalf("Chtimes got error: %v", err)
+		}
+		return d
+	}
+	kept := put("receipt", 2*time.Hour)
+	orphan := put("deleted txn receipt", 2*time.Hour)
+	put("upload in progress", time.Minute)
+
+	got, err := unreferencedBlobs(ctx, blobs, map[string]bool{kept: true}, time.Hour, time.Now())
+	if err != nil {
+		t.Fatalf("unreferencedBlobs got error: %v", err)
+	}
+	if want := []string{orphan}; !slices.Equal(got, want) {
+		t.Errorf("unreferencedBlobs got %v, want %v", got, want)
+	}
+}
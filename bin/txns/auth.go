@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+var (
+	authEnabled = flag.Bool("auth", true, "Require a bearer API token created with 'txns token create' on every request. Disable only when the server isn't reachable by others.")
+)
+
+type tokenFinder interface {
+	TokenByHash(ctx context.Context, hash string) (storage.Token, error)
+}
+
+type tokenKey struct{}
+
+// tokenOf returns the API token the request was authenticated with.
+func tokenOf(r *http.Request) (storage.Token, bool) {
+	tok, ok := r.Context().Value(tokenKey{}).(storage.Token)
+	return tok, ok
+}
+
+// requiredScope returns the token scope needed for requests with the given
+// method.
+func requiredScope(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return storage.ScopeRead
+	default:
+		return storage.ScopeWrite
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, secret, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	secret = strings.TrimSpace(secret)
+	return secret, secret != ""
+}
+
+// requireToken returns middleware rejecting requests without an unrevoked
+// bearer token that has the scope needed for the request. CORS preflight
+// requests are let through since browsers send them without credentials.
+func requireToken(tokens tokenFinder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			secret, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="txns"`)
+				respondf(w, http.StatusUnauthorized, "missing bearer token in Authorization header")
+				return
+			}
+			tok, err := tokens.TokenByHash(r.Context(), storage.HashTokenSecret(secret))
+			if errors.Is(err, storage.ErrNotFound) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="txns", error="invalid_token"`)
+				respondf(w, http.StatusUnauthorized, "invalid or revoked bearer token")
+				return
+			} else if err != nil {
+				log.Printf("Error looking up API token: %v", err)
+				respondf(w, http.StatusInternalServerError, "error verifying bearer token")
+				return
+			}
+			if scope := requiredScope(r.Method); !tok.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="txns", error="insufficient_scope", scope="`+scope+`"`)
+				respondf(w, http.StatusForbidden, "token '%v' doesn't have the %v scope needed for %v requests", tok.Name, scope, r.Method)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, tok)))
+		})
+	}
+}
+
+// requireScope returns middleware rejecting requests whose token doesn't
+// have the given scope, for routes needing more than their method does.
+// Requests are let through when authentication is disabled.
+func requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tok, ok := tokenOf(r); ok && !tok.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="txns", error="insufficient_scope", scope="`+scope+`"`)
+				respondf(w, http.StatusForbidden, "token '%v' doesn't have the %v scope needed for %v %v", tok.Name, scope, r.Method, r.URL.Path)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
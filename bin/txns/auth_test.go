@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+type fakeTokens map[string]storage.Token
+
+func (f fakeTokens) TokenByHash(_ context.Context, hash string) (storage.Token, error) {
+	t, ok := f[hash]
+	if !ok {
+		return storage.Token{}, fmt.Errorf("%w: token", storage.ErrNotFound)
+	}
+	return t, nil
+}
+
+func TestRequireToken(t *testing.T) {
+	tokens := fakeTokens{
+		storage.HashTokenSecret("reader"): {Name: "reader", Scopes: []string{storage.ScopeRead}},
+		storage.HashTokenSecret("writer"): {Name: "writer", Scopes: []string{storage.ScopeWrite}},
+	}
+	h := requireToken(tokens)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for _, tc := range []struct {
+		name     string
+		method   string
+		auth     string
+		wantCode int
+	}{
+		{name: "missing token", method: http.MethodGet, wantCode: http.StatusUnauthorized},
+		{name: "not bearer", method: http.MethodGet, auth: "Basic cmVhZGVy", wantCode: http.StatusUnauthorized},
+		{name: "unknown token", method: http.MethodGet, auth: "Bearer nobody", wantCode: http.StatusUnauthorized},
+		{name: "read", method: http.MethodGet, auth: "Bearer reader", wantCode: http.StatusOK},
+		{name: "read cannot write", method: http.MethodPatch, auth: "Bearer reader", wantCode: http.StatusForbidden},
+		{name: "write can read", method: http.MethodGet, auth: "bearer writer", wantCode: http.StatusOK},
+		{name: "write", method: http.MethodPost, auth: "Bearer writer", wantCode: http.StatusOK},
+		{name: "preflight", method: http.MethodOptions, wantCode: http.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, "/txns", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.wantCode {
+			t.Errorf("%v got status %v with body %q, want %v", tc.name, rec.Code, rec.Body.String(), tc.wantCode)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%v got no WWW-Authenticate header with status %v", tc.name, rec.Code)
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	h := requireScope(storage.ScopeAdmin)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for _, tc := range []struct {
+		name     string
+		tok      *storage.Token
+		wantCode int
+	}{
+		{name: "writer", tok: &storage.Token{Name: "writer", Scopes: []string{storage.ScopeWrite}}, wantCode: http.StatusForbidden},
+		{name: "admin", tok: &storage.Token{Name: "admin", Scopes: []string{storage.ScopeAdmin}}, wantCode: http.StatusOK},
+		{name: "auth disabled", wantCode: http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/households", nil)
+		if tc.tok != nil {
+			req = req.WithContext(context.WithValue(req.Context(), tokenKey{}, *tc.tok))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.wantCode {
+			t.Errorf("%v got status %v with body %q, want %v", tc.name, rec.Code, rec.Body.String(), tc.wantCode)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/blobstore"
+)
+
+// backupCmd implements the backup command which writes a compressed
+// archive of the database.
+func backupCmd(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("o", fmt.Sprintf("expenses-backup-%v.jsonl.gz", time.Now().Format("20060102-150405")), "Output file or - for stdout.")
+	fs.Parse(args)
+
+	db, err := openStorage()
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if *out != "-" {
+		f, err = os.Create(*out)
+		if err != nil {
+			log.Fatalf("Error creating backup file: %v", err)
+		}
+		w = f
+	}
+	if err := db.Backup(context.Background(), w); err != nil {
+		if f != nil {
+			f.Close()
+			os.Remove(*out)
+		}
+		log.Fatalf("Error backing up database: %v", err)
+	}
+	if f != nil {
+		if err := f.Close(); err != nil {
+			log.Fatalf("Error closing backup file: %v", err)
+		}
+		log.Printf("Wrote backup to %v.", *out)
+	}
+}
+
+// restoreCmd implements the restore command which loads an archive written
+// by the backup command into an empty database. Backups don't include the
+// attachments directory, which has to be restored first.
+func restoreCmd(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := fs.String("i", "", "Backup file to restore or - for stdin.")
+	fs.Parse(args)
+	if *in == "" {
+		log.Fatalf("Flag -i is required.")
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			log.Fatalf("Error opening backup file: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	db, err := openStorage()
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	blobs, err := blobstore.NewLocal(*attachmentsDir)
+	if err != nil {
+		log.Fatalf("Error initializing attachments storage: %v", err)
+	}
+	if err := db.Restore(context.Background(), r, blobs); err != nil {
+		log.Fatalf("Error restoring backup: %v", err)
+	}
+	log.Printf("Restored backup from %v.", *in)
+}
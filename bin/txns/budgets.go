@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/smukherj1/expenses/pkg/budgets"
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+type budget struct {
+	Tag    string `json:"tag,omitempty"`
+	Period string `json:"period,omitempty"`
+	Amount string `json:"amount"`
+	// Rollover carries what's left of or overspent in the budget over to the
+	// next period, starting with the period containing Since.
+	Rollover  bool   `json:"rollover"`
+	Since     string `json:"since,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+type budgetsResp struct {
+	Budgets []budget `json:"budgets"`
+}
+
+type budgetStatus struct {
+	budget
+	PeriodStart string `json:"period_start"`
+	PeriodEnd   string `json:"period_end"`
+	CarriedOver string `json:"carried_over"`
+	Available   string `json:"available"`
+	Spent       string `json:"spent"`
+	Remaining   string `json:"remaining"`
+	// Projected is the spending by the end of the period if it keeps up the
+	// pace so far.
+	Projected string `json:"projected"`
+}
+
+type budgetStatusResp struct {
+	Date     string         `json:"date"`
+	Statuses []budgetStatus `json:"statuses"`
+}
+
+func budgetStorageToResp(b *storage.Budget) budget {
+	return budget{
+		Tag:       b.Tag,
+		Period:    b.Period,
+		Amount:    formatAmount(b.AmountCents),
+		Rollover:  b.Rollover,
+		Since:     b.Since.Format(dateFmt),
+		CreatedAt: b.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: b.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func (s *txnsServer) listBudgets(w http.ResponseWriter, r *http.Request) {
+	bs, err := s.store(r).ListBudgets(r.Context())
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing budgets: %v", err)
+		return
+	}
+	resp := budgetsResp{Budgets: []budget{}}
+	for i := range bs {
+		resp.Budgets = append(resp.Budgets, budgetStorageToResp(&bs[i]))
+	}
+	respondJSON(w, &resp)
+}
+
+func (s *txnsServer) getBudget(w http.ResponseWriter, r *http.Request) {
+	b, err := s.store(r).GetBudget(r.Context(), chi.URLParam(r, "tag"), chi.URLParam(r, "period"))
+	if err != nil {
+		respondStorageErr(w, err, "error fetching budget")
+		return
+	}
+	resp := budgetStorageToResp(&b)
+	respondJSON(w, &resp)
+}
+
+// putBudget creates or replaces the budget for a tag and period. Without a
+// since date, a new budget starts with the current period and an existing
+// one keeps its start.
+func (s *txnsServer) putBudget(w http.ResponseWriter, r *http.Request) {
+	var req budget
+	if err := readJSONBody(r, "budget", &req); err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	b := storage.Budget{Tag: chi.URLParam(r, "tag"), Period: chi.URLParam(r, "period"), Rollover: req.Rollover}
+	if err := storage.ValidateTags([]string{b.Tag}); err != nil {
+		respondf(w, http.StatusBadRequest, "invalid budget tag: %v", err)
+		return
+	}
+	if err := storage.ValidatePeriod(b.Period); err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	var err error
+	if b.AmountCents, err = storage.ParseAmount(req.Amount); err != nil {
+		respondf(w, http.StatusBadRequest, "invalid budget amount '%v': %v", req.Amount, err)
+		return
+	}
+	if b.AmountCents <= 0 {
+		respondf(w, http.StatusBadRequest, "invalid budget amount '%v', want > 0", req.Amount)
+		return
+	}
+	store := s.store(r)
+	if req.Since != "" {
+		since, status, err := validateDate(req.Since)
+		if err != nil {
+			respondf(w, status, "invalid budget start: %v", err)
+			return
+		}
+		b.Since = budgets.PeriodStart(b.Period, since)
+	} else if old, err := store.GetBudget(r.Context(), b.Tag, b.Period); err == nil {
+		b.Since = old.Since
+	} else if errors.Is(err, storage.ErrNotFound) {
+		b.Since = budgets.PeriodStart(b.Period, time.Now())
+	} else {
+		respondf(w, http.StatusInternalServerError, "error fetching budget: %v", err)
+		return
+	}
+	if err := store.SetBudget(r.Context(), &b); err != nil {
+		respondStorageErr(w, err, "error setting budget")
+		return
+	}
+	respondf(w, http.StatusOK, "%v budget for tag '%v' set", b.Period, b.Tag)
+}
+
+func (s *txnsServer) deleteBudget(w http.ResponseWriter, r *http.Request) {
+	tag, period := chi.URLParam(r, "tag"), chi.URLParam(r, "period")
+	if err := s.store(r).DeleteBudget(r.Context(), tag, period); err != nil {
+		respondStorageErr(w, err, "error deleting budget")
+		return
+	}
+	respondf(w, http.StatusOK, "%v budget for tag '%v' deleted", period, tag)
+}
+
+// getBudgetStatus returns how the spending in the current period of every
+// budget tracks against it on the day in the date url parameter, or today.
+func (s *txnsServer) getBudgetStatus(w http.ResponseWriter, r *http.Request) {
+	asOf := time.Now().UTC()
+	if v := r.URL.Query().Get("date"); v != "" {
+		d, status, err := validateDate(v)
+		if err != nil {
+			respondf(w, status, "invalid value for url parameter date=%v: %v", v, err)
+			return
+		}
+		asOf = d
+	}
+	asOf = time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+	store := s.store(r)
+	bs, err := store.ListBudgets(r.Context())
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing budgets: %v", err)
+		return
+	}
+	resp := budgetStatusResp{Date: asOf.Format(dateFmt), Statuses: []budgetStatus{}}
+	if len(bs) == 0 {
+		respondJSON(w, &resp)
+		return
+	}
+	from := asOf
+	var tags []string
+	for i := range bs {
+		if t := budgets.TrackedFrom(&bs[i], asOf); t.Before(from) {
+			from = t
+		}
+		tags = append(tags, bs[i].Tag)
+	}
+	spending, err := store.SpendingByTagMonth(r.Context(), tags, from, asOf)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error fetching spending: %v", err)
+		return
+	}
+	byTag := budgets.ByTag(spending)
+	for i := range bs {
+		st := budgets.Compute(&bs[i], byTag[bs[i].Tag], asOf)
+		resp.Statuses = append(resp.Statuses, budgetStatus{
+			budget:      budgetStorageToResp(&bs[i]),
+			PeriodStart: st.Start.Format(dateFmt),
+			PeriodEnd:   st.End.Format(dateFmt),
+			CarriedOver: formatAmount(st.CarriedOverCents),
+			Available:   formatAmount(st.AvailableCents),
+			Spent:       formatAmount(st.SpentCents),
+			Remaining:   formatAmount(st.RemainingCents),
+			Projected:   formatAmount(st.ProjectedCents),
+		})
+	}
+	respondJSON(w, &resp)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+var (
+	dbConfigFile = flag.String("db-config", "", fmt.Sprintf("Optional JSON file with database settings keyed by the -db-* flag names without the prefix. Also read from %v.", storage.EnvName("config")))
+	dbFlags      = map[string]*string{}
+)
+
+func init() {
+	for _, k := range storage.ConfigKeys {
+		dbFlags[k.Name] = flag.String("db-"+k.Name, "", fmt.Sprintf("%v Also read from %v.", k.Usage, storage.EnvName(k.Name)))
+	}
+}
+
+// dbConfig builds the database config from, in increasing precedence, the
+// defaults, the config file, environment variables and flags.
+func dbConfig() (*storage.Config, error) {
+	c := storage.DefaultConfig()
+	path := *dbConfigFile
+	if path == "" {
+		path = os.Getenv(storage.EnvName("config"))
+	}
+	if path != "" {
+		if err := c.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.LoadEnv(); err != nil {
+		return nil, err
+	}
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		name, ok := strings.CutPrefix(f.Name, "db-")
+		if _, isKey := dbFlags[name]; !ok || !isKey || err != nil {
+			return
+		}
+		if serr := c.Set(name, f.Value.String()); serr != nil {
+			err = fmt.Errorf("invalid flag -%v: %w", f.Name, serr)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// openStore opens the database selected by the -db-driver flag.
+func openStore() (storage.Backend, error) {
+	c, err := dbConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading database config: %w", err)
+	}
+	if c.Driver == storage.DriverSQLite {
+		if err := os.MkdirAll(filepath.Dir(c.SQLiteFile), 0o755); err != nil {
+			return nil, fmt.Errorf("error creating directory for sqlite database: %w", err)
+		}
+		return storage.NewSQLite(context.Background(), c.SQLiteFile)
+	}
+	return storage.New(storage.WithConfig(c), storage.WithLogf(log.Printf))
+}
+
+// openStorage connects to the postgres database configured by flags,
+// environment variables and the config file for commands that only
+// support postgres.
+func openStorage(opts ...storage.NewOption) (*storage.Storage, error) {
+	c, err := dbConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading database config: %w", err)
+	}
+	if c.Driver != storage.DriverPostgres {
+		return nil, fmt.Errorf("only supported with the %v database driver, got %v", storage.DriverPostgres, c.Driver)
+	}
+	opts = append([]storage.NewOption{storage.WithConfig(c), storage.WithLogf(log.Printf)}, opts...)
+	return storage.New(opts...)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+const (
+	defaultTagsDelimiter = ";"
+	tagsDelimiterLimit   = 5
+)
+
+// csvColumns maps the columns that can be exported to functions rendering
+// them for a txn.
+var csvColumns = map[string]func(t *storage.Txn, tagsDelim string) string{
+	"id":          func(t *storage.Txn, _ string) string { return fmt.Sprint(t.ID) },
+	"date":        func(t *storage.Txn, _ string) string { return t.Date.Format(dateFmt) },
+	"description": func(t *storage.Txn, _ string) string { return t.Description },
+	"amount":      func(t *storage.Txn, _ string) string { return formatAmount(t.AmountCents) },
+	"source":      func(t *storage.Txn, _ string) string { return t.Source },
+	"tags":        func(t *storage.Txn, d string) string { return strings.Join(t.Tags, d) },
+	"notes":       func(t *storage.Txn, _ string) string { return t.Notes },
+	"merchant":    func(t *storage.Txn, _ string) string { return t.Merchant },
+}
+
+var defaultCSVColumns = []string{"id", "date", "description", "amount", "source", "tags", "notes", "merchant"}
+
+// exportCSV streams every txn matching the query in the request as RFC 4180
+// CSV. The columns url parameter is a comma separated list of columns to
+// export and tagsDelimiter is the separator used to join tags.
+func (s *txnsServer) exportCSV(w http.ResponseWriter, r *http.Request) {
+	tq, err := txnQueryFromRequest(r)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "error validating request parameters: %v", err)
+		return
+	}
+	if tq.Limit != 0 {
+		respondf(w, http.StatusBadRequest, "url parameter limit can't be specified when exporting txns")
+		return
+	}
+	columns := defaultCSVColumns
+	if c := r.URL.Query().Get("columns"); c != "" {
+		columns = strings.Split(c, ",")
+		for _, col := range columns {
+			if _, ok := csvColumns[col]; !ok {
+				respondf(w, http.StatusBadRequest, "invalid value for url parameter columns=%v, unknown column '%v', want any of %v", c, col, strings.Join(defaultCSVColumns, ","))
+				return
+			}
+		}
+	}
+	tagsDelim := defaultTagsDelimiter
+	if r.URL.Query().Has("tagsDelimiter") {
+		tagsDelim = r.URL.Query().Get("tagsDelimiter")
+		if l := len(tagsDelim); l == 0 || l > tagsDelimiterLimit {
+			respondf(w, http.StatusBadRequest, "invalid value for url parameter tagsDelimiter=%v, want length > 0 and <= %v", tagsDelim, tagsDelimiterLimit)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="txns.csv"`)
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	headerWritten := false
+	writeHeader := func() error {
+		headerWritten = true
+		return cw.Write(columns)
+	}
+	record := make([]string, len(columns))
+	err = s.store(r).ForEachTxn(r.Context(), tq, func(t *storage.Txn) error {
+		if !headerWritten {
+			if err := writeHeader(); err != nil {
+				return err
+			}
+		}
+		for i, col := range columns {
+			record[i] = csvColumns[col](t, tagsDelim)
+		}
+		return cw.Write(record)
+	})
+	if err != nil && !headerWritten {
+		respondf(w, http.StatusInternalServerError, "error exporting transactions: %v", err)
+		return
+	} else if err != nil {
+		// The response status was already sent so the best we can do is
+		// truncate the response.
+		log.Printf("Error exporting transactions as CSV: %v", err)
+		return
+	}
+	if !headerWritten {
+		if err := writeHeader(); err != nil {
+			log.Printf("Error writing CSV header: %v", err)
+			return
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Error flushing CSV export: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// defaultAccountName is the name of storage.DefaultUser and
+// storage.DefaultHousehold.
+const defaultAccountName = "default"
+
+// userCmd implements the user command which creates and lists the users
+// API tokens are created for.
+func userCmd(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Missing user command, want create|list")
+	}
+	switch sub := args[0]; sub {
+	case "create":
+		userCreateCmd(args[1:])
+	case "list":
+		userListCmd(args[1:])
+	default:
+		log.Fatalf("Unknown user command %q, want create|list", sub)
+	}
+}
+
+func userCreateCmd(args []string) {
+	fs := flag.NewFlagSet("user create", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatalf("Want the name of the user to create, usage: txns user create <name>")
+	}
+
+	db, err := openStore()
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	id, err := db.CreateUser(context.Background(), fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Error creating user: %v", err)
+	}
+	log.Printf("Created user %v named '%v'.", id, fs.Arg(0))
+}
+
+func userListCmd(args []string) {
+	fs := flag.NewFlagSet("user list", flag.ExitOnError)
+	fs.Parse(args)
+
+	db, err := openStore()
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	ctx := context.Background()
+	users, err := db.ListUsers(ctx)
+	if err != nil {
+		log.Fatalf("Error listing users: %v", err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tHOUSEHOLDS\tCREATED AT")
+	for _, u := range users {
+		hs, err := db.UserHouseholds(ctx, u.ID)
+		if err != nil {
+			log.Fatalf("Error listing households of user '%v': %v", u.Name, err)
+		}
+		var names []string
+		for _, h := range hs {
+			names = append(names, h.Name)
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", u.ID, u.Name, joinOrDash(names), u.CreatedAt.Format(tokenTimeFmt))
+	}
+	tw.Flush()
+}
+
+// householdCmd implements the household command which creates and lists
+// households and manages their members.
+func householdCmd(args []string) {
+	const usage = "create|list|add-member|remove-member"
+	if len(args) == 0 {
+		log.Fatalf("Missing household command, want %v", usage)
+	}
+	switch sub := args[0]; sub {
+	case "create":
+		householdCreateCmd(args[1:])
+	case "list":
+		householdListCmd(args[1:])
+	case "add-member":
+		householdMemberCmd(sub, args[1:])
+	case "remove-member":
+		householdMemberCmd(sub, args[1:])
+	default:
+		log.Fatalf("Unknown household command %q, want %v", sub, usage)
+	}
+}
+
+func householdCreateCmd(args []string) {
+	fs := flag.NewFlagSet("household create", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatalf("Want the name of the household to create, usage: txns household create <name>")
+	}
+
+	db, err := openStore()
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	id, err := db.CreateHousehold(context.Background(), fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Error creating household: %v", err)
+	}
+	log.Printf("Created household %v named '%v'. Add users to it with 'txns household add-member'.", id, fs.Arg(0))
+}
+
+func householdListCmd(args []string) {
+	fs := flag.NewFlagSet("household list", flag.ExitOnError)
+	fs.Parse(args)
+
+	db, err := openStore()
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	ctx := context.Background()
+	hs, err := db.ListHouseholds(ctx)
+	if err != nil {
+		log.Fatalf("Error listing households: %v", err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tMEMBERS\tCREATED AT")
+	for _, h := range hs {
+		members, err := db.HouseholdMembers(ctx, h.ID)
+		if err != nil {
+			log.Fatalf("Error listing members of household '%v': %v", h.Name, err)
+		}
+		var names []string
+		for _, u := range members {
+			names = append(names, u.Name)
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", h.ID, h.Name, joinOrDash(names), h.CreatedAt.Format(tokenTimeFmt))
+	}
+	tw.Flush()
+}
+
+// householdMemberCmd implements the add-member and remove-member household
+// commands.
+func householdMemberCmd(sub string, args []string) {
+	fs := flag.NewFlagSet("household "+sub, flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		log.Fatalf("Want a household and a user, usage: txns household %v <household> <user>", sub)
+	}
+
+	db, err := openStore()
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	ctx := context.Background()
+	h, err := db.HouseholdByName(ctx, fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Error looking up household: %v", err)
+	}
+	u, err := db.UserByName(ctx, fs.Arg(1))
+	if err != nil {
+		log.Fatalf("Error looking up user: %v", err)
+	}
+	if sub == "add-member" {
+		err = db.AddHouseholdMember(ctx, h.ID, u.ID)
+	} else {
+		err = db.RemoveHouseholdMember(ctx, h.ID, u.ID)
+	}
+	if err != nil {
+		log.Fatalf("Error updating members of household '%v': %v", h.Name, err)
+	}
+	log.Printf("Updated members of household '%v'.", h.Name)
+}
+
+// joinOrDash joins names for a table cell, showing "-" when there are none.
+func joinOrDash(names []string) string {
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
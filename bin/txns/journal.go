@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/smukherj1/expenses/pkg/journal"
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+var (
+	journalMapping = flag.String("journal-mapping", "", "Optional JSON file mapping sources and tags to accounts when exporting journals.")
+)
+
+func loadJournalMapping(path string) (*journal.Mapping, error) {
+	if path == "" {
+		return journal.DefaultMapping(), nil
+	}
+	return journal.LoadMapping(path)
+}
+
+func writeJournal(ctx context.Context, db storage.Store, jw *journal.Writer, tq *storage.TxnQuery) error {
+	if err := db.ForEachTxn(ctx, tq, jw.Write); err != nil {
+		return err
+	}
+	return jw.Close()
+}
+
+// exportJournal streams every txn matching the query in the request as a
+// journal in the format given by the format url parameter.
+func (s *txnsServer) exportJournal(w http.ResponseWriter, r *http.Request) {
+	tq, err := txnQueryFromRequest(r)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "error validating request parameters: %v", err)
+		return
+	}
+	format, err := journal.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "invalid value for url parameter format: %v", err)
+		return
+	}
+	jw, err := journal.NewWriter(w, format, s.journalMapping)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error exporting transactions as a %v journal: %v", format, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="txns.%v"`, format))
+	if err := writeJournal(r.Context(), s.store(r), jw, tq); err != nil {
+		// The response status was most likely already sent so the best we
+		// can do is truncate the response.
+		log.Printf("Error exporting transactions as a %v journal: %v", format, err)
+	}
+}
+
+// journalCmd implements the journal command which writes transactions as a
+// journal to stdout or a file.
+func journalCmd(args []string) {
+	fs := flag.NewFlagSet("journal", flag.ExitOnError)
+	formatStr := fs.String("format", string(journal.FormatLedger), fmt.Sprintf("Journal format, one of %v.", journal.ValidFormats))
+	mappingPath := fs.String("mapping", *journalMapping, "Optional JSON file mapping sources and tags to accounts.")
+	query := fs.String("query", "", "Optional url encoded GET /txns parameters selecting the txns to export, e.g., fromDate=2024/01/01&tags=dining.")
+	out := fs.String("o", "", "Output file. Defaults to stdout.")
+	householdName := fs.String("household", defaultAccountName, "Name of the household whose txns to export.")
+	fs.Parse(args)
+
+	format, err := journal.ParseFormat(*formatStr)
+	if err != nil {
+		log.Fatalf("Invalid -format: %v", err)
+	}
+	m, err := loadJournalMapping(*mappingPath)
+	if err != nil {
+		log.Fatalf("Error loading journal mapping: %v", err)
+	}
+	vals, err := url.ParseQuery(*query)
+	if err != nil {
+		log.Fatalf("Invalid -query %q: %v", *query, err)
+	}
+	tq, err := txnQueryFromValues(vals)
+	if err != nil {
+		log.Fatalf("Invalid -query %q: %v", *query, err)
+	}
+	db, err := openStore()
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	h, err := db.HouseholdByName(context.Background(), *householdName)
+	if err != nil {
+		log.Fatalf("Error looking up household: %v", err)
+	}
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Error creating output file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	jw, err := journal.NewWriter(w, format, m)
+	if err != nil {
+		log.Fatalf("Invalid journal mapping: %v", err)
+	}
+	if err := writeJournal(context.Background(), db.ForHousehold(h.ID), jw, tq); err != nil {
+		log.Fatalf("Error exporting journal: %v", err)
+	}
+}
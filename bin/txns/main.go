@@ -3,16 +3,20 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/smukherj1/expenses/pkg/blobstore"
+	"github.com/smukherj1/expenses/pkg/journal"
 	"github.com/smukherj1/expenses/pkg/storage"
 )
 
@@ -20,8 +24,19 @@ const (
 	dateFmt = "2006/01/02"
 )
 
+var (
+	attachmentsDir = flag.String("attachments-dir", "data/attachments", "Directory where transaction attachments are stored.")
+)
+
 type txnsServer struct {
-	db *storage.Storage
+	// txns serves the core transaction APIs so they can run against
+	// storage.Memory in tests while db serves everything else. Handlers
+	// reach the data of the household of a request through txnStore and
+	// store.
+	txns           func(household int64) storage.TxnStore
+	db             storage.Backend
+	blobs          blobstore.Store
+	journalMapping *journal.Mapping
 }
 
 type txn struct {
@@ -31,7 +46,10 @@ type txn struct {
 	Amount        string   `json:"amount,omitempty"`
 	Source        string   `json:"source,omitempty"`
 	Tags          []string `json:"tags,omitempty"`
+	Notes         string   `json:"notes,omitempty"`
 	DescEmbedding string   `json:"desc_embedding,omitempty"`
+	MerchantID    string   `json:"merchant_id,omitempty"`
+	Merchant      string   `json:"merchant,omitempty"`
 }
 
 type postTxnsResp struct {
@@ -45,6 +63,7 @@ type validatedTxn struct {
 	amountCents   int64
 	source        string
 	tags          []string
+	notes         string
 	descEmbedding string
 }
 
@@ -97,7 +116,7 @@ func skipDescEmbedding() validateTxnOption {
 
 var commonHeaders = map[string]string{
 	// "Access-Control-Allow-Origin":  "*",
-	"Access-Control-Allow-Headers": "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization",
+	"Access-Control-Allow-Headers": "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Txns-Household",
 	"Content-Type":                 "application/json",
 	"Access-Control-Allow-Methods": "POST, GET, OPTIONS, PUT, DELETE",
 }
@@ -127,15 +146,15 @@ func validateDate(dateStr string) (time.Time, int, error) {
 }
 
 func validateDescription(desc string) error {
-	if len(desc) == 0 || len(desc) > storage.DescLimit {
-		return fmt.Errorf("invalid description, got length %v, want 0 < length <= %v", desc, storage.DescLimit)
+	if err := storage.ValidateDescription(desc); err != nil {
+		return fmt.Errorf("invalid description: %w", err)
 	}
 	return nil
 }
 
 func validateSource(source string) error {
-	if len(source) == 0 || len(source) > storage.SourceLimit {
-		return fmt.Errorf("invalid source, got length %v, want 0 < length <= %v", len(source), storage.SourceLimit)
+	if err := storage.ValidateSource(source); err != nil {
+		return fmt.Errorf("invalid source: %w", err)
 	}
 	if source == "all" {
 		return fmt.Errorf("invalid source, got %v which is a reserved source name", source)
@@ -143,34 +162,6 @@ func validateSource(source string) error {
 	return nil
 }
 
-func convertAmount(amount string) (int64, error) {
-	splitAmount := strings.Split(amount, ".")
-	var dollars, cents string
-	if len(splitAmount) == 1 {
-		dollars = splitAmount[0]
-		cents = "0"
-	} else if len(splitAmount) == 2 {
-		dollars, cents = splitAmount[0], splitAmount[1]
-	} else {
-		return 0, fmt.Errorf("invalid amount %q, want <dollars>.<cents>", amount)
-	}
-	d, err := strconv.ParseInt(dollars, 10, 64)
-	if err != nil {
-		return 0, fmt.Errorf("invalid dollar portion %q in amount %q, expected base 10 64-bit integer: %v", dollars, amount, err)
-	}
-	c, err := strconv.ParseInt(cents, 10, 64)
-	if err != nil {
-		return 0, fmt.Errorf("invalid cents portion %q in amount %q, expected base 10 64-bit integer: %v", cents, amount, err)
-	}
-	if c > 100 {
-		return 0, fmt.Errorf("invalid cents portion %q in amount %q, must be < 100", cents, amount)
-	}
-	if d < 0 {
-		c = -c
-	}
-	return d*100 + c, nil
-}
-
 func validateTxn(tx *txn, vopts ...validateTxnOption) (*validatedTxn, int, error) {
 	var opts validateTxnOpts
 	for _, o := range vopts {
@@ -207,7 +198,7 @@ func validateTxn(tx *txn, vopts ...validateTxnOption) (*validatedTxn, int, error
 		result.source = tx.Source
 	}
 	if !opts.skipAmount {
-		a, err := convertAmount(tx.Amount)
+		a, err := storage.ParseAmount(tx.Amount)
 		if err != nil {
 			return nil, http.StatusBadRequest, fmt.Errorf("invalid amount '%v': %w", tx.Amount, err)
 		}
@@ -227,6 +218,10 @@ func validateTxn(tx *txn, vopts ...validateTxnOption) (*validatedTxn, int, error
 		return nil, http.StatusBadRequest, err
 	}
 	result.tags = tx.Tags
+	if err := storage.ValidateNotes(tx.Notes); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	result.notes = tx.Notes
 	return &result, http.StatusOK, nil
 }
 
@@ -252,13 +247,15 @@ func (s *txnsServer) post(w http.ResponseWriter, r *http.Request) {
 	vtxn, code, err := validateTxn(&tx, vopts...)
 	if err != nil {
 		respondf(w, code, "invalid transaction: %v", err)
+		return
 	}
-	tid, err := s.db.CreateTxn(r.Context(), &storage.Txn{
+	tid, err := s.txnStore(r).CreateTxn(r.Context(), &storage.Txn{
 		Date:          vtxn.date,
 		Description:   vtxn.description,
 		AmountCents:   vtxn.amountCents,
 		Source:        vtxn.source,
 		Tags:          vtxn.tags,
+		Notes:         vtxn.notes,
 		DescEmbedding: vtxn.descEmbedding,
 	})
 	if err != nil {
@@ -274,17 +271,31 @@ func (s *txnsServer) post(w http.ResponseWriter, r *http.Request) {
 }
 
 func txnQueryFromRequest(r *http.Request) (*storage.TxnQuery, error) {
-	fromDateStr := r.URL.Query().Get("fromDate")
-	toDateStr := r.URL.Query().Get("toDate")
-	desc := r.URL.Query().Get("description")
-	descOp := r.URL.Query().Get("descriptionOp")
-	source := r.URL.Query().Get("source")
-	sourceOp := r.URL.Query().Get("sourceOp")
-	tagsStr := r.URL.Query().Get("tags")
-	tagsOp := r.URL.Query().Get("tagsOp")
-	amount := r.URL.Query().Get("amount")
-	startIDStr := r.URL.Query().Get("startId")
-	limitStr := r.URL.Query().Get("limit")
+	return txnQueryFromValues(r.URL.Query())
+}
+
+func txnQueryFromValues(v url.Values) (*storage.TxnQuery, error) {
+	fromDateStr := v.Get("fromDate")
+	toDateStr := v.Get("toDate")
+	desc := v.Get("description")
+	descOp := v.Get("descriptionOp")
+	source := v.Get("source")
+	sourceOp := v.Get("sourceOp")
+	tagsStr := v.Get("tags")
+	tagsOp := v.Get("tagsOp")
+	notes := v.Get("notes")
+	notesOp := v.Get("notesOp")
+	amount := v.Get("amount")
+	minAmount := v.Get("minAmount")
+	maxAmount := v.Get("maxAmount")
+	amountAbsStr := v.Get("amountAbs")
+	amountType := v.Get("amountType")
+	startIDStr := v.Get("startId")
+	limitStr := v.Get("limit")
+	sort := v.Get("sort")
+	order := v.Get("order")
+	cursorStr := v.Get("cursor")
+	q := v.Get("q")
 
 	var fromDate *time.Time
 	if fromDateStr != "" {
@@ -307,8 +318,8 @@ func txnQueryFromRequest(r *http.Request) (*storage.TxnQuery, error) {
 	if tagsStr != "" {
 		t := strings.Split(tagsStr, " ")
 		tags = &t
-		if ok := storage.ValidateOp(tagsOp); !ok {
-			return nil, fmt.Errorf("invalid value for url parameter tagsOp=%v, must be %v", tagsOp, storage.ValidOps)
+		if ok := storage.ValidateTagsOp(tagsOp); !ok {
+			return nil, fmt.Errorf("invalid value for url parameter tagsOp=%v, must be %v", tagsOp, storage.ValidTagsOps)
 		}
 	}
 	var startID int64
@@ -347,42 +358,148 @@ func txnQueryFromRequest(r *http.Request) (*storage.TxnQuery, error) {
 		}
 		sourcePtr = &source
 	}
+	var notesPtr *string
+	if notes != "" {
+		if err := storage.ValidateNotes(notes); err != nil {
+			return nil, fmt.Errorf("invalid value for url parameter notes=%v: %w", notes, err)
+		}
+		if notesOp != storage.OpMatch && notesOp != storage.OpNotMatch {
+			return nil, fmt.Errorf("invalid value for url parameter notesOp=%v, must be %v|%v", notesOp, storage.OpMatch, storage.OpNotMatch)
+		}
+		notesPtr = &notes
+	}
 	var amountCents *int64
 	if amount != "" {
-		a, err := convertAmount(amount)
+		a, err := storage.ParseAmount(amount)
 		if err != nil {
 			return nil, fmt.Errorf("invalid value for url parameter amount=%v: %w", amount, err)
 		}
 		amountCents = &a
 	}
+	var minAmountCents *int64
+	if minAmount != "" {
+		a, err := storage.ParseAmount(minAmount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for url parameter minAmount=%v: %w", minAmount, err)
+		}
+		minAmountCents = &a
+	}
+	var maxAmountCents *int64
+	if maxAmount != "" {
+		a, err := storage.ParseAmount(maxAmount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for url parameter maxAmount=%v: %w", maxAmount, err)
+		}
+		maxAmountCents = &a
+	}
+	if minAmountCents != nil && maxAmountCents != nil && *minAmountCents > *maxAmountCents {
+		return nil, fmt.Errorf("invalid amount range, url parameter minAmount=%v is greater than maxAmount=%v", minAmount, maxAmount)
+	}
+	var amountAbs bool
+	if amountAbsStr != "" {
+		var err error
+		amountAbs, err = strconv.ParseBool(amountAbsStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for url parameter amountAbs=%v, want true|false", amountAbsStr)
+		}
+	}
+	if amountType != "" && amountType != storage.AmountDebit && amountType != storage.AmountCredit {
+		return nil, fmt.Errorf("invalid value for url parameter amountType=%v, must be %v|%v", amountType, storage.AmountDebit, storage.AmountCredit)
+	}
+	if sort != "" && !storage.ValidateSort(sort) {
+		return nil, fmt.Errorf("invalid value for url parameter sort=%v, must be %v", sort, storage.ValidSorts)
+	}
+	var sortDesc bool
+	switch order {
+	case "", "asc":
+	case "desc":
+		sortDesc = true
+	default:
+		return nil, fmt.Errorf("invalid value for url parameter order=%v, must be asc|desc", order)
+	}
+	var expr storage.Expr
+	if q != "" {
+		var err error
+		expr, err = storage.ParseExpr(q)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for url parameter q=%v: %w", q, err)
+		}
+	}
+	var cursor *storage.Cursor
+	if cursorStr != "" {
+		var err error
+		cursor, err = storage.DecodeCursor(cursorStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for url parameter cursor=%v: %w", cursorStr, err)
+		}
+	}
 
 	return &storage.TxnQuery{
-		FromDate:    fromDate,
-		ToDate:      toDate,
-		Tags:        tags,
-		TagsOp:      tagsOp,
-		StartID:     startID,
-		Limit:       limit,
-		Description: descPtr,
-		DescOp:      descOp,
-		Source:      sourcePtr,
-		SourceOp:    sourceOp,
-		AmountCents: amountCents,
+		FromDate:       fromDate,
+		ToDate:         toDate,
+		Tags:           tags,
+		TagsOp:         tagsOp,
+		StartID:        startID,
+		Limit:          limit,
+		Description:    descPtr,
+		DescOp:         descOp,
+		Source:         sourcePtr,
+		SourceOp:       sourceOp,
+		Notes:          notesPtr,
+		NotesOp:        notesOp,
+		AmountCents:    amountCents,
+		MinAmountCents: minAmountCents,
+		MaxAmountCents: maxAmountCents,
+		AmountAbs:      amountAbs,
+		AmountType:     amountType,
+		Sort:           sort,
+		SortDesc:       sortDesc,
+		After:          cursor,
+		Expr:           expr,
 	}, nil
 }
 
 func (s *txnsServer) get(w http.ResponseWriter, r *http.Request) {
-	tq, err := txnQueryFromRequest(r)
+	s.queryTxns(w, r, r.URL.Query())
+}
+
+// queryTxns responds with the transactions matching the query in the given
+// url parameters.
+func (s *txnsServer) queryTxns(w http.ResponseWriter, r *http.Request, v url.Values) {
+	tq, err := txnQueryFromValues(v)
 	if err != nil {
 		respondf(w, http.StatusBadRequest, "error validating request parameters: %v", err)
 		return
 	}
-	txns, err := s.db.QueryTxns(r.Context(), tq)
+	countStr := v.Get("count")
+	var withCount bool
+	if countStr != "" {
+		withCount, err = strconv.ParseBool(countStr)
+		if err != nil {
+			respondf(w, http.StatusBadRequest, "invalid value for url parameter count=%v, want true|false", countStr)
+			return
+		}
+	}
+	page, err := s.txnStore(r).QueryTxns(r.Context(), tq)
 	if err != nil {
 		respondf(w, http.StatusInternalServerError, "error fetching transactions: %v", err)
 		return
 	}
-	respBody, err := json.Marshal(txnsStorageToResp(txns))
+	resp := txnsStorageToResp(page.Txns)
+	resp.HasMore = page.HasMore
+	if page.HasMore {
+		resp.Cursor = tq.NextCursor(&page.Txns[len(page.Txns)-1]).Encode()
+	}
+	if withCount {
+		count, err := s.store(r).CountTxns(r.Context(), tq)
+		if err != nil {
+			respondf(w, http.StatusInternalServerError, "error counting transactions: %v", err)
+			return
+		}
+		resp.TotalCount = &count
+	}
+	resp.Query = txnQueryToResp(tq)
+	respBody, err := json.Marshal(&resp)
 	if err != nil {
 		respondf(w, http.StatusInternalServerError, "error converting fetched transactions to JSON: %v", err)
 		return
@@ -391,8 +508,96 @@ func (s *txnsServer) get(w http.ResponseWriter, r *http.Request) {
 }
 
 type txnsResp struct {
-	Txns   []txn  `json:"txns,omitempty"`
-	NextID string `json:"nextId,omitempty"`
+	Txns       []txn         `json:"txns,omitempty"`
+	NextID     string        `json:"nextId,omitempty"`
+	Cursor     string        `json:"cursor,omitempty"`
+	HasMore    bool          `json:"hasMore"`
+	TotalCount *int64        `json:"totalCount,omitempty"`
+	Query      *txnQueryResp `json:"query,omitempty"`
+}
+
+// txnQueryResp echoes the filters that were applied to a query using the
+// same names and formats as the url parameters.
+type txnQueryResp struct {
+	FromDate      string   `json:"fromDate,omitempty"`
+	ToDate        string   `json:"toDate,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	DescriptionOp string   `json:"descriptionOp,omitempty"`
+	Source        string   `json:"source,omitempty"`
+	SourceOp      string   `json:"sourceOp,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	TagsOp        string   `json:"tagsOp,omitempty"`
+	Notes         string   `json:"notes,omitempty"`
+	NotesOp       string   `json:"notesOp,omitempty"`
+	Amount        string   `json:"amount,omitempty"`
+	MinAmount     string   `json:"minAmount,omitempty"`
+	MaxAmount     string   `json:"maxAmount,omitempty"`
+	AmountAbs     bool     `json:"amountAbs,omitempty"`
+	AmountType    string   `json:"amountType,omitempty"`
+	Q             string   `json:"q,omitempty"`
+	StartID       string   `json:"startId,omitempty"`
+	Sort          string   `json:"sort,omitempty"`
+	Order         string   `json:"order,omitempty"`
+	Limit         string   `json:"limit,omitempty"`
+}
+
+func txnQueryToResp(tq *storage.TxnQuery) *txnQueryResp {
+	result := &txnQueryResp{
+		DescriptionOp: tq.DescOp,
+		SourceOp:      tq.SourceOp,
+		TagsOp:        tq.TagsOp,
+		NotesOp:       tq.NotesOp,
+		AmountAbs:     tq.AmountAbs,
+		AmountType:    tq.AmountType,
+		Sort:          tq.Sort,
+		Limit:         fmt.Sprint(tq.Limit),
+	}
+	if tq.FromDate != nil {
+		result.FromDate = tq.FromDate.Format(dateFmt)
+	}
+	if tq.ToDate != nil {
+		result.ToDate = tq.ToDate.Format(dateFmt)
+	}
+	if tq.Description != nil {
+		result.Description = *tq.Description
+	}
+	if tq.Source != nil {
+		result.Source = *tq.Source
+	}
+	if tq.Tags != nil {
+		result.Tags = *tq.Tags
+	}
+	if tq.Notes != nil {
+		result.Notes = *tq.Notes
+	}
+	if tq.AmountCents != nil {
+		result.Amount = formatAmount(*tq.AmountCents)
+	}
+	if tq.MinAmountCents != nil {
+		result.MinAmount = formatAmount(*tq.MinAmountCents)
+	}
+	if tq.MaxAmountCents != nil {
+		result.MaxAmount = formatAmount(*tq.MaxAmountCents)
+	}
+	if tq.Expr != nil {
+		result.Q = tq.Expr.String()
+	}
+	if tq.StartID != 0 {
+		result.StartID = fmt.Sprint(tq.StartID)
+	}
+	if tq.SortDesc {
+		result.Order = "desc"
+	}
+	return result
+}
+
+func formatAmount(amountCents int64) string {
+	sign := ""
+	if amountCents < 0 {
+		sign = "-"
+		amountCents = -amountCents
+	}
+	return fmt.Sprintf("%v%v.%02d", sign, amountCents/100, amountCents%100)
 }
 
 func txnsStorageToResp(sts []storage.Txn) txnsResp {
@@ -400,18 +605,19 @@ func txnsStorageToResp(sts []storage.Txn) txnsResp {
 	var nextID int64
 	for _, s := range sts {
 		nextID = max(nextID, s.ID+1)
-		cents := s.AmountCents % 100
-		if cents < 0 {
-			cents = -cents
-		}
 		result.Txns = append(result.Txns, txn{
 			ID:          fmt.Sprint(s.ID),
 			Date:        s.Date.Format(dateFmt),
 			Description: s.Description,
-			Amount:      fmt.Sprintf("%v.%v", s.AmountCents/100, cents),
+			Amount:      formatAmount(s.AmountCents),
 			Source:      s.Source,
 			Tags:        s.Tags,
+			Notes:       s.Notes,
+			Merchant:    s.Merchant,
 		})
+		if s.MerchantID != 0 {
+			result.Txns[len(result.Txns)-1].MerchantID = fmt.Sprint(s.MerchantID)
+		}
 	}
 	result.NextID = fmt.Sprint(nextID)
 	return result
@@ -454,7 +660,7 @@ func (s *txnsServer) getSimilar(w http.ResponseWriter, r *http.Request) {
 		respondf(w, http.StatusBadRequest, "error validating request parameters: %v", err)
 		return
 	}
-	txns, err := s.db.QuerySimilarTxns(r.Context(), ids, tq)
+	txns, err := s.txnStore(r).QuerySimilarTxns(r.Context(), ids, tq)
 	if err != nil {
 		respondf(w, http.StatusInternalServerError, "error finding similar txns: %v", err)
 		return
@@ -473,6 +679,7 @@ func (s *txnsServer) getSimilar(w http.ResponseWriter, r *http.Request) {
 type patchTxn struct {
 	IDs           []string `json:"ids,omitempty"`
 	Tags          []string `json:"tags,omitempty"`
+	Notes         *string  `json:"notes,omitempty"`
 	DescEmbedding string   `json:"desc_embedding,omitempty"`
 }
 
@@ -504,6 +711,9 @@ func (s *txnsServer) patch(w http.ResponseWriter, r *http.Request) {
 		Tags:          ptx.Tags,
 		DescEmbedding: ptx.DescEmbedding,
 	}
+	if ptx.Notes != nil {
+		tx.Notes = *ptx.Notes
+	}
 	vopts := []validateTxnOption{skipID(), skipDate(), skipDescription(), skipAmount(), skipSource()}
 	if len(ptx.DescEmbedding) == 0 {
 		vopts = append(vopts, skipDescEmbedding())
@@ -517,11 +727,14 @@ func (s *txnsServer) patch(w http.ResponseWriter, r *http.Request) {
 	if len(vtx.tags) != 0 {
 		tu.Tags = &vtx.tags
 	}
+	if ptx.Notes != nil {
+		tu.Notes = &vtx.notes
+	}
 	if len(vtx.descEmbedding) != 0 {
 		tu.DescEmbedding = &vtx.descEmbedding
 	}
-	if err := s.db.UpdateTxns(r.Context(), ids, tu); err != nil {
-		respondf(w, http.StatusInternalServerError, fmt.Sprintf("error patching txn %v: %v", vtx.id, err))
+	if err := s.txnStore(r).UpdateTxns(r.Context(), ids, tu); err != nil {
+		respondStorageErr(w, err, "error patching txn %v", vtx.id)
 		return
 	}
 	respondf(w, http.StatusOK, "txn %v updated", vtx.id)
@@ -531,6 +744,17 @@ type patchTagsRequest struct {
 	IDs  []string `json:"ids,omitempty"`
 	Tags []string `json:"tags,omitempty"`
 	Op   string   `json:"op,omitempty"`
+	// Query selects the txns to update using the url parameters of GET /txns
+	// instead of IDs.
+	Query       map[string]string `json:"query,omitempty"`
+	DryRun      bool              `json:"dryRun,omitempty"`
+	MaxAffected int               `json:"maxAffected,omitempty"`
+}
+
+type patchTagsByQueryResp struct {
+	IDs    []string `json:"ids"`
+	Count  int      `json:"count"`
+	DryRun bool     `json:"dryRun"`
 }
 
 func (s *txnsServer) patchTags(w http.ResponseWriter, r *http.Request) {
@@ -544,11 +768,6 @@ func (s *txnsServer) patchTags(w http.ResponseWriter, r *http.Request) {
 		respondf(w, http.StatusBadRequest, "error parsing body as a JSON transaction: %v", err)
 		return
 	}
-	ids, err := convertIDs(ptx.IDs)
-	if err != nil {
-		respondf(w, http.StatusBadRequest, "error validating ids in request: %v", err)
-		return
-	}
 	if ptx.Op == "clear" && len(ptx.Tags) != 0 {
 		respondf(w, http.StatusBadRequest, "field 'tags' can't be specified when 'op' is clear")
 		return
@@ -565,42 +784,152 @@ func (s *txnsServer) patchTags(w http.ResponseWriter, r *http.Request) {
 		respondf(w, http.StatusBadRequest, "request body missing field 'op'")
 		return
 	}
+	if ptx.Query != nil {
+		s.patchTagsByQuery(w, r, &ptx)
+		return
+	}
+	if ptx.DryRun || ptx.MaxAffected != 0 {
+		respondf(w, http.StatusBadRequest, "fields 'dryRun' and 'maxAffected' can only be specified with field 'query'")
+		return
+	}
+	ids, err := convertIDs(ptx.IDs)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "error validating ids in request: %v", err)
+		return
+	}
 	switch ptx.Op {
 	case "add":
-		if err := s.db.TxnAddTags(r.Context(), ids, ptx.Tags); err != nil {
+		if err := s.txnStore(r).TxnAddTags(r.Context(), ids, ptx.Tags); err != nil {
 			respondf(w, http.StatusInternalServerError, "error adding tags: %v", err)
 			return
 		}
 	case "remove":
-		if err := s.db.TxnRemoveTags(r.Context(), ids, ptx.Tags); err != nil {
+		if err := s.txnStore(r).TxnRemoveTags(r.Context(), ids, ptx.Tags); err != nil {
 			respondf(w, http.StatusInternalServerError, "error removing tags: %v", err)
 			return
 		}
 	case "clear":
-		if err := s.db.UpdateTxns(r.Context(), ids, &storage.TxnUpdates{
+		if err := s.txnStore(r).UpdateTxns(r.Context(), ids, &storage.TxnUpdates{
 			Tags: &[]string{},
 		}); err != nil {
-			respondf(w, http.StatusInternalServerError, "error clearing tags: %v", err)
+			respondStorageErr(w, err, "error clearing tags")
 			return
 		}
 	default:
-		respondf(w, http.StatusBadRequest, "unknown op '%v', supported ops are add|remove|clear", err)
+		respondf(w, http.StatusBadRequest, "unknown op '%v', supported ops are add|remove|clear", ptx.Op)
 		return
 	}
 
 	respondf(w, http.StatusOK, "OK")
 }
 
+// patchTagsByQuery updates the tags on every txn matching the query in the
+// request and responds with the IDs of the affected txns.
+func (s *txnsServer) patchTagsByQuery(w http.ResponseWriter, r *http.Request, ptx *patchTagsRequest) {
+	if len(ptx.IDs) != 0 {
+		respondf(w, http.StatusBadRequest, "fields 'ids' and 'query' can't both be specified")
+		return
+	}
+	vals := url.Values{}
+	for k, v := range ptx.Query {
+		if k == "startId" || k == "cursor" || k == "limit" || k == "sort" || k == "order" {
+			respondf(w, http.StatusBadRequest, "pagination parameter '%v' can't be specified in field 'query'", k)
+			return
+		}
+		vals.Set(k, v)
+	}
+	tq, err := txnQueryFromValues(vals)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "error validating field 'query': %v", err)
+		return
+	}
+	// Empty values are ignored like in GET /txns, so check what's left
+	// rather than the field itself to avoid retagging everything.
+	if !tq.HasFilter() {
+		respondf(w, http.StatusBadRequest, "field 'query' must specify at least one filter")
+		return
+	}
+	maxAffected := ptx.MaxAffected
+	if maxAffected == 0 {
+		maxAffected = storage.MaxIDs
+	}
+	if maxAffected < 0 || maxAffected > storage.MaxBulkTxns {
+		respondf(w, http.StatusBadRequest, "invalid maxAffected, got %v, want > 0 and <= %v", maxAffected, storage.MaxBulkTxns)
+		return
+	}
+	if ptx.Op != storage.TagsOpAdd && ptx.Op != storage.TagsOpRemove && ptx.Op != storage.TagsOpClear {
+		respondf(w, http.StatusBadRequest, "unknown op '%v', supported ops are add|remove|clear", ptx.Op)
+		return
+	}
+	res, err := s.store(r).TxnTagsByQuery(r.Context(), tq, ptx.Op, ptx.Tags, maxAffected, ptx.DryRun)
+	if errors.Is(err, storage.ErrTooManyTxns) {
+		respondf(w, http.StatusUnprocessableEntity, "error updating tags: %v", err)
+		return
+	} else if err != nil {
+		respondf(w, http.StatusInternalServerError, "error updating tags: %v", err)
+		return
+	}
+	resp := patchTagsByQueryResp{IDs: []string{}, Count: len(res.IDs), DryRun: res.DryRun}
+	for _, id := range res.IDs {
+		resp.IDs = append(resp.IDs, fmt.Sprint(id))
+	}
+	respBody, err := json.Marshal(&resp)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error generating JSON response: %v", err)
+		return
+	}
+	respond(w, http.StatusOK, respBody)
+}
+
 func corsHandler(w http.ResponseWriter, _ *http.Request) {
 	respondf(w, http.StatusOK, "")
 }
 
 func main() {
-	db, err := storage.New()
+	flag.Parse()
+	switch cmd := flag.Arg(0); cmd {
+	case "", "serve":
+		serve()
+	case "journal":
+		journalCmd(flag.Args()[1:])
+	case "backup":
+		backupCmd(flag.Args()[1:])
+	case "restore":
+		restoreCmd(flag.Args()[1:])
+	case "migrate":
+		migrateCmd(flag.Args()[1:])
+	case "token":
+		tokenCmd(flag.Args()[1:])
+	case "user":
+		userCmd(flag.Args()[1:])
+	case "household":
+		householdCmd(flag.Args()[1:])
+	case "attachments":
+		attachmentsCmd(flag.Args()[1:])
+	default:
+		log.Fatalf("Unknown command %q, want serve|journal|backup|restore|migrate|token|user|household|attachments", cmd)
+	}
+}
+
+func serve() {
+	db, err := openStore()
 	if err != nil {
 		log.Fatalf("Error initializing connection to the database: %v", err)
 	}
-	ts := txnsServer{db: db}
+	blobs, err := blobstore.NewLocal(*attachmentsDir)
+	if err != nil {
+		log.Fatalf("Error initializing attachments storage: %v", err)
+	}
+	jm, err := loadJournalMapping(*journalMapping)
+	if err != nil {
+		log.Fatalf("Error loading journal mapping: %v", err)
+	}
+	ts := txnsServer{
+		txns:           func(household int64) storage.TxnStore { return db.ForHousehold(household) },
+		db:             db,
+		blobs:          blobs,
+		journalMapping: jm,
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.Timeout(60 * time.Second))
@@ -609,16 +938,96 @@ func main() {
 	for k, v := range commonHeaders {
 		r.Use(middleware.SetHeader(k, v))
 	}
+	if *authEnabled {
+		r.Use(requireToken(db))
+	} else {
+		log.Println("WARNING: API token authentication is disabled, anyone who can reach the server can change transactions.")
+	}
 
-	r.Route("/txns", func(r chi.Router) {
-		r.Get("/", ts.get)
-		r.Post("/", ts.post)
-		r.Patch("/", ts.patch)
-		r.Options("/", corsHandler)
-		r.Route("/tags", func(r chi.Router) {
-			r.Patch("/", ts.patchTags)
+	r.Get("/households", ts.getHouseholds)
+	r.With(requireScope(storage.ScopeAdmin)).Post("/households", ts.postHousehold)
+	r.Group(func(r chi.Router) {
+		r.Use(householdAccess(db))
+		r.Route("/households/members", func(r chi.Router) {
+			r.Get("/", ts.getHouseholdMembers)
+			r.With(requireScope(storage.ScopeAdmin)).Put("/{user}", ts.putHouseholdMember)
+			r.With(requireScope(storage.ScopeAdmin)).Delete("/{user}", ts.deleteHouseholdMember)
+		})
+		r.Route("/txns", func(r chi.Router) {
+			r.Get("/", ts.get)
+			r.Post("/", ts.post)
+			r.Patch("/", ts.patch)
+			r.Options("/", corsHandler)
+			r.Route("/tags", func(r chi.Router) {
+				r.Patch("/", ts.patchTags)
+			})
+			r.Get("/similar", ts.getSimilar)
+			r.Get("/anomalies", ts.getAnomalies)
+			r.Get("/export.csv", ts.exportCSV)
+			r.Get("/export/journal", ts.exportJournal)
+			r.Route("/{txnID}/attachments", func(r chi.Router) {
+				r.Get("/", ts.listAttachments)
+				r.Post("/", ts.postAttachment)
+				r.Get("/{attachmentID}", ts.getAttachment)
+				r.Delete("/{attachmentID}", ts.deleteAttachment)
+			})
+			r.Route("/{txnID}/split", func(r chi.Router) {
+				r.Get("/", ts.getSplit)
+				r.Put("/", ts.putSplit)
+				r.Delete("/", ts.deleteSplit)
+			})
+			r.Route("/{txnID}/reimbursement", func(r chi.Router) {
+				r.Get("/", ts.getReimbursement)
+				r.Put("/", ts.putReimbursement)
+				r.Delete("/", ts.deleteReimbursement)
+				r.Put("/credit", ts.putReimbursementCredit)
+				r.Delete("/credit", ts.deleteReimbursementCredit)
+				r.Get("/candidates", ts.getReimbursementCandidates)
+			})
+			r.Get("/{txnID}/merchant", ts.getTxnMerchant)
+			r.Put("/{txnID}/merchant", ts.putTxnMerchant)
+		})
+		r.Route("/views", func(r chi.Router) {
+			r.Get("/", ts.listViews)
+			r.Post("/", ts.postView)
+			r.Options("/", corsHandler)
+			r.Get("/{name}", ts.getView)
+			r.Put("/{name}", ts.putView)
+			r.Delete("/{name}", ts.deleteView)
+			r.Get("/{name}/txns", ts.getViewTxns)
+		})
+		r.Route("/splits", func(r chi.Router) {
+			r.Get("/", ts.listSplits)
+			r.Get("/balances", ts.getBalances)
+			r.Get("/settle", ts.getSettle)
+		})
+		r.Route("/reimbursements", func(r chi.Router) {
+			r.Get("/", ts.listReimbursements)
+			r.Post("/match", ts.postMatchReimbursements)
+		})
+		r.Route("/budgets", func(r chi.Router) {
+			r.Get("/", ts.listBudgets)
+			r.Get("/status", ts.getBudgetStatus)
+			r.Get("/{tag}/{period}", ts.getBudget)
+			r.Put("/{tag}/{period}", ts.putBudget)
+			r.Delete("/{tag}/{period}", ts.deleteBudget)
+		})
+		r.Route("/recurring", func(r chi.Router) {
+			r.Get("/", ts.listRecurring)
+			r.Get("/alerts", ts.listRecurringAlerts)
+			r.Post("/detect", ts.postDetectRecurring)
+		})
+		r.Route("/merchants", func(r chi.Router) {
+			r.Get("/", ts.listMerchants)
+			r.Post("/", ts.postMerchant)
+			r.Get("/mappings", ts.listMerchantMappings)
+			r.Get("/spending", ts.getMerchantSpending)
+			r.Post("/assign", ts.postAssignMerchants)
+			r.Get("/{merchantID}", ts.getMerchant)
+			r.Put("/{merchantID}", ts.putMerchant)
+			r.Delete("/{merchantID}", ts.deleteMerchant)
+			r.Post("/{merchantID}/merge", ts.postMergeMerchant)
 		})
-		r.Get("/similar", ts.getSimilar)
 	})
 	addr := ":4000"
 	log.Println("Running txns server at", addr)
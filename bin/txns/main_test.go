@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+// newTestServer returns a txnsServer with in-memory txns.
+func newTestServer() *txnsServer {
+	mem := storage.NewMemory()
+	return &txnsServer{txns: func(household int64) storage.TxnStore { return mem.ForHousehold(household) }}
+}
+
+// householdRequest returns a request acting on the given household as if it
+// passed householdAccess.
+func householdRequest(household int64, method, target, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	return r.WithContext(withHousehold(r.Context(), household))
+}
+
+func TestTxnsHandlers(t *testing.T) {
+	s := newTestServer()
+	for _, tc := range []struct {
+		name     string
+		handler  http.HandlerFunc
+		method   string
+		target   string
+		body     string
+		wantCode int
+	}{
+		{
+			name:     "post",
+			handler:  s.post,
+			method:   http.MethodPost,
+			target:   "/txns",
+			body:     `{"date": "2024/01/02", "description": "COFFEE SHOP", "amount": "-4.50", "source": "AMEX"}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "post second",
+			handler:  s.post,
+			method:   http.MethodPost,
+			target:   "/txns",
+			body:     `{"date": "2024/01/03", "description": "PAYROLL", "amount": "2500", "source": "RBC"}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "post invalid date",
+			handler:  s.post,
+			method:   http.MethodPost,
+			target:   "/txns",
+			body:     `{"date": "2024-01-02", "description": "COFFEE SHOP", "amount": "-4.50", "source": "AMEX"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "add tags",
+			handler:  s.patchTags,
+			method:   http.MethodPatch,
+			target:   "/txns/tags",
+			body:     `{"ids": ["1"], "tags": ["coffee"], "op": "add"}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "add tags missing txn",
+			handler:  s.patchTags,
+			method:   http.MethodPatch,
+			target:   "/txns/tags",
+			body:     `{"ids": ["1", "3"], "tags": ["coffee"], "op": "add"}`,
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "tags by query without query",
+			handler:  s.patchTags,
+			method:   http.MethodPatch,
+			target:   "/txns/tags",
+			body:     `{"query": {}, "tags": ["coffee"], "op": "add"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "tags by query with empty filter values",
+			handler:  s.patchTags,
+			method:   http.MethodPatch,
+			target:   "/txns/tags",
+			body:     `{"query": {"description": "", "descriptionOp": "match", "amountAbs": "true"}, "tags": ["coffee"], "op": "add"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid query",
+			handler:  s.get,
+			method:   http.MethodGet,
+			target:   "/txns?amountType=refund",
+			wantCode: http.StatusBadRequest,
+		},
+	} {
+		rec := httptest.NewRecorder()
+		tc.handler(rec, householdRequest(storage.DefaultHousehold, tc.method, tc.target, tc.body))
+		if rec.Code != tc.wantCode {
+			t.Errorf("%v got status %v with body %q, want %v", tc.name, rec.Code, rec.Body.String(), tc.wantCode)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.get(rec, householdRequest(storage.DefaultHousehold, http.MethodGet, "/txns?tags=coffee&tagsOp=match", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get got status %v with body %q, want %v", rec.Code, rec.Body.String(), http.StatusOK)
+	}
+	var resp txnsResp
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("get got invalid JSON response %q: %v", rec.Body.String(), err)
+	}
+	if len(resp.Txns) != 1 {
+		t.Fatalf("get got %v txns, want 1", len(resp.Txns))
+	}
+	got := resp.Txns[0]
+	if got.ID != "1" || got.Date != "2024/01/02" || got.Amount != "-4.50" || !slices.Equal(got.Tags, []string{"coffee"}) {
+		t.Errorf("get got txn %+v, want txn 1 dated 2024/01/02 for -4.50 tagged coffee", got)
+	}
+}
+
+func TestTxnsHandlersHouseholds(t *testing.T) {
+	s := newTestServer()
+	other := storage.DefaultHousehold + 1
+	rec := httptest.NewRecorder()
+	s.post(rec, householdRequest(other, http.MethodPost, "/txns", `{"date": "2024/01/02", "description": "RENT", "amount": "-1500", "source": "RBC"}`))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("post got status %v with body %q, want %v", rec.Code, rec.Body.String(), http.StatusOK)
+	}
+	for _, tc := range []struct {
+		household int64
+		wantTxns  int
+	}{
+		{household: storage.DefaultHousehold, wantTxns: 0},
+		{household: other, wantTxns: 1},
+	} {
+		rec := httptest.NewRecorder()
+		s.get(rec, householdRequest(tc.household, http.MethodGet, "/txns", ""))
+		var resp txnsResp
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("get for household %v got invalid JSON response %q: %v", tc.household, rec.Body.String(), err)
+		}
+		if len(resp.Txns) != tc.wantTxns {
+			t.Errorf("get for household %v got %v txns, want %v", tc.household, len(resp.Txns), tc.wantTxns)
+		}
+	}
+}
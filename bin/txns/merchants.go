@@ -0,0 +1,451 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/merchants"
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+type merchant struct {
+	ID        string   `json:"id,omitempty"`
+	Name      string   `json:"name"`
+	Patterns  []string `json:"patterns"`
+	TxnCount  int64    `json:"txn_count"`
+	CreatedAt string   `json:"created_at,omitempty"`
+}
+
+type merchantsResp struct {
+	Merchants []merchant `json:"merchants"`
+}
+
+type txnMerchant struct {
+	TxnID        string `json:"txn_id,omitempty"`
+	Date         string `json:"date,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Amount       string `json:"amount,omitempty"`
+	MerchantID   string `json:"merchant_id"`
+	MerchantName string `json:"merchant_name,omitempty"`
+	Source       string `json:"source,omitempty"`
+	UpdatedAt    string `json:"updated_at,omitempty"`
+}
+
+type txnMerchantsResp struct {
+	Mappings []txnMerchant `json:"mappings"`
+}
+
+type mergeMerchantRequest struct {
+	Into string `json:"into"`
+}
+
+type merchantSpending struct {
+	MerchantID string `json:"merchant_id"`
+	Name       string `json:"name"`
+	TxnCount   int64  `json:"txn_count"`
+	Amount     string `json:"amount"`
+}
+
+type merchantSpendingResp struct {
+	Merchants []merchantSpending `json:"merchants"`
+	Total     string             `json:"total"`
+}
+
+type assignMerchantsRequest struct {
+	MaxDistance float64 `json:"maxDistance,omitempty"`
+}
+
+type assignMerchantsResp struct {
+	// Pattern, Description and Embedding are how many transactions were
+	// mapped by each source.
+	Pattern     int `json:"pattern"`
+	Description int `json:"description"`
+	Embedding   int `json:"embedding"`
+	// CreatedMerchants are the merchants created for the descriptions of
+	// the transactions nothing else mapped.
+	CreatedMerchants []string `json:"created_merchants"`
+	// Unmapped is how many transactions still have no merchant, those
+	// whose description has nothing but numbers and punctuation.
+	Unmapped int `json:"unmapped"`
+}
+
+func merchantStorageToResp(m *storage.Merchant) merchant {
+	result := merchant{
+		ID:        fmt.Sprint(m.ID),
+		Name:      m.Name,
+		Patterns:  m.Patterns,
+		TxnCount:  m.TxnCount,
+		CreatedAt: m.CreatedAt.Format(time.RFC3339),
+	}
+	if result.Patterns == nil {
+		result.Patterns = []string{}
+	}
+	return result
+}
+
+func txnMerchantStorageToResp(tm *storage.TxnMerchant) txnMerchant {
+	return txnMerchant{
+		TxnID:        fmt.Sprint(tm.TxnID),
+		Date:         tm.Date.Format(dateFmt),
+		Description:  tm.Description,
+		Amount:       formatAmount(tm.AmountCents),
+		MerchantID:   fmt.Sprint(tm.MerchantID),
+		MerchantName: tm.MerchantName,
+		Source:       tm.Source,
+		UpdatedAt:    tm.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func parseMerchantID(name, v string) (int64, error) {
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid %v '%v', want number >= 0", name, v)
+	}
+	return id, nil
+}
+
+// readMerchantRequest reads and validates the merchant in the request body.
+func readMerchantRequest(r *http.Request) (*storage.Merchant, error) {
+	var m merchant
+	if err := readJSONBody(r, "merchant", &m); err != nil {
+		return nil, err
+	}
+	if err := storage.ValidateMerchantName(m.Name); err != nil {
+		return nil, fmt.Errorf("invalid merchant: %w", err)
+	}
+	if len(m.Patterns) > storage.MaxMerchantPatterns {
+		return nil, fmt.Errorf("too many merchant patterns, got %v, want <= %v", len(m.Patterns), storage.MaxMerchantPatterns)
+	}
+	for _, p := range m.Patterns {
+		if _, err := storage.CompileMerchantPattern(p); err != nil {
+			return nil, err
+		}
+	}
+	return &storage.Merchant{Name: m.Name, Patterns: m.Patterns}, nil
+}
+
+func (s *txnsServer) listMerchants(w http.ResponseWriter, r *http.Request) {
+	ms, err := s.store(r).ListMerchants(r.Context())
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing merchants: %v", err)
+		return
+	}
+	resp := merchantsResp{Merchants: []merchant{}}
+	for i := range ms {
+		resp.Merchants = append(resp.Merchants, merchantStorageToResp(&ms[i]))
+	}
+	respondJSON(w, &resp)
+}
+
+// postMerchant creates a merchant and responds with it. Its patterns only
+// apply to transactions on the next POST /merchants/assign.
+func (s *txnsServer) postMerchant(w http.ResponseWriter, r *http.Request) {
+	m, err := readMerchantRequest(r)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	store := s.store(r)
+	if m.ID, err = store.CreateMerchant(r.Context(), m); err != nil {
+		respondStorageErr(w, err, "error creating merchant")
+		return
+	}
+	created, err := store.GetMerchant(r.Context(), m.ID)
+	if err != nil {
+		respondStorageErr(w, err, "error fetching created merchant")
+		return
+	}
+	resp := merchantStorageToResp(&created)
+	respondJSON(w, &resp)
+}
+
+func (s *txnsServer) getMerchant(w http.ResponseWriter, r *http.Request) {
+	id, err := urlParamID(r, "merchantID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	m, err := s.store(r).GetMerchant(r.Context(), id)
+	if err != nil {
+		respondStorageErr(w, err, "error fetching merchant")
+		return
+	}
+	resp := merchantStorageToResp(&m)
+	respondJSON(w, &resp)
+}
+
+// putMerchant renames a merchant and replaces its patterns.
+func (s *txnsServer) putMerchant(w http.ResponseWriter, r *http.Request) {
+	id, err := urlParamID(r, "merchantID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	m, err := readMerchantRequest(r)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	m.ID = id
+	if err := s.store(r).UpdateMerchant(r.Context(), m); err != nil {
+		respondStorageErr(w, err, "error updating merchant")
+		return
+	}
+	respondf(w, http.StatusOK, "merchant %v updated", id)
+}
+
+// deleteMerchant deletes a merchant. Its transactions are mapped again on
+// the next POST /merchants/assign.
+func (s *txnsServer) deleteMerchant(w http.ResponseWriter, r *http.Request) {
+	id, err := urlParamID(r, "merchantID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err := s.store(r).DeleteMerchant(r.Context(), id); err != nil {
+		respondStorageErr(w, err, "error deleting merchant")
+		return
+	}
+	respondf(w, http.StatusOK, "merchant %v deleted", id)
+}
+
+// postMergeMerchant merges a merchant into the one given by the into field
+// of the body, e.g., when the same merchant was created for two different
+// descriptions.
+func (s *txnsServer) postMergeMerchant(w http.ResponseWriter, r *http.Request) {
+	id, err := urlParamID(r, "merchantID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	var req mergeMerchantRequest
+	if err := readJSONBody(r, "merge request", &req); err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	into, err := parseMerchantID("into", req.Into)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if into == id {
+		respondf(w, http.StatusBadRequest, "can't merge merchant %v into itself", id)
+		return
+	}
+	if err := s.store(r).MergeMerchants(r.Context(), id, into); err != nil {
+		respondStorageErr(w, err, "error merging merchants")
+		return
+	}
+	respondf(w, http.StatusOK, "merchant %v merged into merchant %v", id, into)
+}
+
+// listMerchantMappings lists the transactions mapped to merchants for
+// review, optionally only those of the merchant given by the merchantId url
+// parameter or mapped by the given source.
+func (s *txnsServer) listMerchantMappings(w http.ResponseWriter, r *http.Request) {
+	var merchantID int64
+	if v := r.URL.Query().Get("merchantId"); v != "" {
+		var err error
+		if merchantID, err = parseMerchantID("url parameter merchantId", v); err != nil {
+			respondf(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+	}
+	source := r.URL.Query().Get("source")
+	if source != "" {
+		if err := storage.ValidateMappingSource(source); err != nil {
+			respondf(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+	}
+	mappings, err := s.store(r).ListTxnMerchants(r.Context(), merchantID, source)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing merchants of txns: %v", err)
+		return
+	}
+	resp := txnMerchantsResp{Mappings: []txnMerchant{}}
+	for i := range mappings {
+		resp.Mappings = append(resp.Mappings, txnMerchantStorageToResp(&mappings[i]))
+	}
+	respondJSON(w, &resp)
+}
+
+// getMerchantSpending totals the transactions matching the txns query
+// parameters by merchant. Transactions without a merchant are left out.
+func (s *txnsServer) getMerchantSpending(w http.ResponseWriter, r *http.Request) {
+	tq, err := txnQueryFromRequest(r)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "error validating request parameters: %v", err)
+		return
+	}
+	spending, err := s.store(r).MerchantSpending(r.Context(), tq)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error querying spending by merchant: %v", err)
+		return
+	}
+	resp := merchantSpendingResp{Merchants: []merchantSpending{}}
+	var total int64
+	for _, ms := range spending {
+		resp.Merchants = append(resp.Merchants, merchantSpending{
+			MerchantID: fmt.Sprint(ms.MerchantID),
+			Name:       ms.Name,
+			TxnCount:   ms.TxnCount,
+			Amount:     formatAmount(ms.AmountCents),
+		})
+		total += ms.AmountCents
+	}
+	resp.Total = formatAmount(total)
+	respondJSON(w, &resp)
+}
+
+// postAssignMerchants maps every transaction of the household that wasn't
+// mapped manually to a merchant. Merchant patterns come first, then the
+// merchant named after the description, then the merchant of the
+// transaction with the closest description embedding within maxDistance.
+// A merchant is created for the description of whatever is left.
+func (s *txnsServer) postAssignMerchants(w http.ResponseWriter, r *http.Request) {
+	var req assignMerchantsRequest
+	if err := readJSONBody(r, "assign request", &req); err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	maxDistance := req.MaxDistance
+	if maxDistance == 0 {
+		maxDistance = merchants.DefaultMaxDistance
+	}
+	if maxDistance < 0 || maxDistance > 2 {
+		respondf(w, http.StatusBadRequest, "invalid max distance, got %v, want > 0 and <= 2", maxDistance)
+		return
+	}
+	ctx := r.Context()
+	store := s.store(r)
+	var txns []storage.Txn
+	if err := store.ForEachTxn(ctx, &storage.TxnQuery{}, func(t *storage.Txn) error {
+		txns = append(txns, *t)
+		return nil
+	}); err != nil {
+		respondf(w, http.StatusInternalServerError, "error querying txns: %v", err)
+		return
+	}
+	ms, err := store.ListMerchants(ctx)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing merchants: %v", err)
+		return
+	}
+	existing, err := store.ListTxnMerchants(ctx, 0, "")
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing merchants of txns: %v", err)
+		return
+	}
+	mapped := map[int64]storage.TxnMerchant{}
+	for _, tm := range existing {
+		mapped[tm.TxnID] = tm
+	}
+	resp := assignMerchantsResp{CreatedMerchants: []string{}}
+	count := func(mappings []storage.TxnMerchant) {
+		for _, tm := range mappings {
+			mapped[tm.TxnID] = tm
+			switch tm.Source {
+			case storage.MappedByPattern:
+				resp.Pattern++
+			case storage.MappedByDescription:
+				resp.Description++
+			case storage.MappedByEmbedding:
+				resp.Embedding++
+			}
+		}
+	}
+
+	planned, err := merchants.Plan(txns, ms, mapped)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error matching merchant patterns: %v", err)
+		return
+	}
+	if err := store.SetTxnMerchants(ctx, planned); err != nil {
+		respondStorageErr(w, err, "error mapping txns to merchants")
+		return
+	}
+	count(planned)
+
+	// The nearest embeddings are looked up in storage so they need the
+	// mappings above to be set first.
+	nearest, err := store.NearestMerchants(ctx, maxDistance)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error querying nearest merchants: %v", err)
+		return
+	}
+	if err := store.SetTxnMerchants(ctx, nearest); err != nil {
+		respondStorageErr(w, err, "error mapping txns to merchants")
+		return
+	}
+	count(nearest)
+
+	unmapped := merchants.Unmapped(txns, mapped)
+	var names []string
+	for name := range unmapped {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var created []storage.TxnMerchant
+	for _, name := range names {
+		id, err := store.CreateMerchant(ctx, &storage.Merchant{Name: name})
+		if err != nil {
+			respondStorageErr(w, err, "error creating merchant")
+			return
+		}
+		for _, txnID := range unmapped[name] {
+			created = append(created, storage.TxnMerchant{TxnID: txnID, MerchantID: id, Source: storage.MappedByDescription})
+		}
+		resp.CreatedMerchants = append(resp.CreatedMerchants, name)
+	}
+	if err := store.SetTxnMerchants(ctx, created); err != nil {
+		respondStorageErr(w, err, "error mapping txns to merchants")
+		return
+	}
+	count(created)
+	resp.Unmapped = len(txns) - len(mapped)
+	respondJSON(w, &resp)
+}
+
+func (s *txnsServer) getTxnMerchant(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	tm, err := s.store(r).GetTxnMerchant(r.Context(), txnID)
+	if err != nil {
+		respondStorageErr(w, err, "error fetching merchant of txn")
+		return
+	}
+	resp := txnMerchantStorageToResp(&tm)
+	respondJSON(w, &resp)
+}
+
+// putTxnMerchant corrects the merchant of a transaction. Manual mappings
+// are kept by POST /merchants/assign.
+func (s *txnsServer) putTxnMerchant(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	var req txnMerchant
+	if err := readJSONBody(r, "txn merchant", &req); err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	merchantID, err := parseMerchantID("merchant_id", req.MerchantID)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err := s.store(r).SetTxnMerchants(r.Context(), []storage.TxnMerchant{{TxnID: txnID, MerchantID: merchantID, Source: storage.MappedManually}}); err != nil {
+		respondStorageErr(w, err, "error setting merchant of txn")
+		return
+	}
+	respondf(w, http.StatusOK, "txn %v mapped to merchant %v", txnID, merchantID)
+}
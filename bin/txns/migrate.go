@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+// parseMigrateArgs parses the arguments of the migrate command, the
+// subcommand followed by its flags, e.g., "down -steps 2".
+func parseMigrateArgs(args []string) (sub string, steps int, err error) {
+	if len(args) == 0 {
+		return "", 0, errors.New("missing migrate command, want up|down|status")
+	}
+	sub = args[0]
+	if sub != "up" && sub != "down" && sub != "status" {
+		return "", 0, fmt.Errorf("unknown migrate command %q, want up|down|status", sub)
+	}
+	fs := flag.NewFlagSet("migrate "+sub, flag.ContinueOnError)
+	fs.IntVar(&steps, "steps", 1, "Number of migrations to revert with down.")
+	if err := fs.Parse(args[1:]); err != nil {
+		return "", 0, err
+	}
+	if fs.NArg() != 0 {
+		return "", 0, fmt.Errorf("unexpected arguments %q after migrate %v", fs.Args(), sub)
+	}
+	if steps < 1 {
+		return "", 0, fmt.Errorf("invalid -steps %v, want >= 1", steps)
+	}
+	return sub, steps, nil
+}
+
+// migrateCmd implements the migrate command which applies, reverts or
+// lists database schema migrations.
+func migrateCmd(args []string) {
+	sub, steps, err := parseMigrateArgs(args)
+	if err != nil {
+		log.Fatalf("Error parsing migrate command: %v", err)
+	}
+
+	db, err := openStorage(storage.WithoutMigrations())
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	ctx := context.Background()
+	switch sub {
+	case "up":
+		applied, err := db.MigrateUp(ctx)
+		for _, m := range applied {
+			log.Printf("Applied migration %04d_%v.", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Error applying migrations: %v", err)
+		}
+		if len(applied) == 0 {
+			log.Printf("Database schema is up to date.")
+		}
+	case "down":
+		reverted, err := db.MigrateDown(ctx, steps)
+		for _, m := range reverted {
+			log.Printf("Reverted migration %04d_%v.", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Error reverting migrations: %v", err)
+		}
+		if len(reverted) == 0 {
+			log.Printf("No applied migrations to revert.")
+		}
+	case "status":
+		statuses, err := db.MigrationStatus(ctx)
+		if err != nil {
+			log.Fatalf("Error getting migration status: %v", err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, st := range statuses {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(tw, "%04d\t%v\t%v\n", st.Version, st.Name, applied)
+		}
+		tw.Flush()
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMigrateArgs(t *testing.T) {
+	for _, tc := range []struct {
+		args      []string
+		wantSub   string
+		wantSteps int
+		wantErr   string
+	}{
+		{args: []string{"up"}, wantSub: "up", wantSteps: 1},
+		{args: []string{"down"}, wantSub: "down", wantSteps: 1},
+		// Flags come after the subcommand like in the docs.
+		{args: []string{"down", "-steps", "2"}, wantSub: "down", wantSteps: 2},
+		{args: []string{"down", "-steps=3"}, wantSub: "down", wantSteps: 3},
+		{args: []string{"status"}, wantSub: "status", wantSteps: 1},
+		{args: nil, wantErr: "missing migrate command"},
+		{args: []string{"-steps", "2", "down"}, wantErr: `unknown migrate command "-steps"`},
+		{args: []string{"sideways"}, wantErr: `unknown migrate command "sideways"`},
+		{args: []string{"down", "2"}, wantErr: "unexpected arguments"},
+		{args: []string{"down", "-steps", "0"}, wantErr: "invalid -steps 0"},
+		{args: []string{"down", "-steps", "two"}, wantErr: "invalid value"},
+	} {
+		sub, steps, err := parseMigrateArgs(tc.args)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("parseMigrateArgs(%q) got error %v, want error containing %q", tc.args, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || sub != tc.wantSub || steps != tc.wantSteps {
+			t.Errorf("parseMigrateArgs(%q) got %q, %v, %v, want %q, %v", tc.args, sub, steps, err, tc.wantSub, tc.wantSteps)
+		}
+	}
+}
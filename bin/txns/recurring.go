@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/recurring"
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+type recurringAlert struct {
+	SeriesID string `json:"series_id"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Date     string `json:"date"`
+	TxnID    string `json:"txn_id,omitempty"`
+	Expected string `json:"expected"`
+	Amount   string `json:"amount,omitempty"`
+	Message  string `json:"message"`
+}
+
+type recurringSeries struct {
+	ID        string           `json:"id"`
+	Name      string           `json:"name"`
+	Period    string           `json:"period"`
+	Amount    string           `json:"amount"`
+	TxnIDs    []string         `json:"txn_ids"`
+	LastDate  string           `json:"last_date"`
+	NextDate  string           `json:"next_date"`
+	Active    bool             `json:"active"`
+	Alerts    []recurringAlert `json:"alerts"`
+	UpdatedAt string           `json:"updated_at,omitempty"`
+}
+
+type recurringResp struct {
+	Series []recurringSeries `json:"series"`
+}
+
+type recurringAlertsResp struct {
+	Alerts []recurringAlert `json:"alerts"`
+}
+
+type detectRecurringRequest struct {
+	// Date is the day missing charges are flagged on, today by default.
+	Date            string  `json:"date,omitempty"`
+	AmountTolerance float64 `json:"amountTolerance,omitempty"`
+	DryRun          bool    `json:"dryRun,omitempty"`
+}
+
+type detectRecurringResp struct {
+	Series []recurringSeries `json:"series"`
+	DryRun bool              `json:"dryRun"`
+}
+
+func recurringAlertStorageToResp(rs *storage.RecurringSeries, a *storage.RecurringAlert) recurringAlert {
+	result := recurringAlert{
+		SeriesID: fmt.Sprint(rs.ID),
+		Name:     rs.Name,
+		Kind:     a.Kind,
+		Date:     a.Date.Format(dateFmt),
+		Expected: formatAmount(a.ExpectedCents),
+	}
+	switch a.Kind {
+	case storage.AlertMissing:
+		result.Message = fmt.Sprintf("%v charge of %v from %v expected on %v is missing", rs.Period, result.Expected, rs.Name, result.Date)
+	case storage.AlertAmountChanged:
+		result.TxnID = fmt.Sprint(a.TxnID)
+		result.Amount = formatAmount(a.AmountCents)
+		result.Message = fmt.Sprintf("%v charged %v on %v instead of %v", rs.Name, result.Amount, result.Date, result.Expected)
+	}
+	return result
+}
+
+func recurringStorageToResp(rs *storage.RecurringSeries) recurringSeries {
+	result := recurringSeries{
+		ID:       fmt.Sprint(rs.ID),
+		Name:     rs.Name,
+		Period:   rs.Period,
+		Amount:   formatAmount(rs.AmountCents),
+		TxnIDs:   []string{},
+		LastDate: rs.LastDate.Format(dateFmt),
+		NextDate: rs.NextDate.Format(dateFmt),
+		Active:   rs.Active,
+		Alerts:   []recurringAlert{},
+	}
+	for _, id := range rs.TxnIDs {
+		result.TxnIDs = append(result.TxnIDs, fmt.Sprint(id))
+	}
+	for i := range rs.Alerts {
+		result.Alerts = append(result.Alerts, recurringAlertStorageToResp(rs, &rs.Alerts[i]))
+	}
+	if !rs.UpdatedAt.IsZero() {
+		result.UpdatedAt = rs.UpdatedAt.Format(time.RFC3339)
+	}
+	return result
+}
+
+// listRecurring lists the recurring series found by the last detection, or
+// only the active ones with the active url parameter.
+func (s *txnsServer) listRecurring(w http.ResponseWriter, r *http.Request) {
+	activeOnly := false
+	if v := r.URL.Query().Get("active"); v != "" {
+		var err error
+		if activeOnly, err = strconv.ParseBool(v); err != nil {
+			respondf(w, http.StatusBadRequest, "invalid value for url parameter active=%v: %v", v, err)
+			return
+		}
+	}
+	series, err := s.store(r).ListRecurringSeries(r.Context())
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing recurring series: %v", err)
+		return
+	}
+	resp := recurringResp{Series: []recurringSeries{}}
+	for i := range series {
+		if activeOnly && !series[i].Active {
+			continue
+		}
+		resp.Series = append(resp.Series, recurringStorageToResp(&series[i]))
+	}
+	respondJSON(w, &resp)
+}
+
+// listRecurringAlerts lists the missing and changed charges of the recurring
+// series found by the last detection.
+func (s *txnsServer) listRecurringAlerts(w http.ResponseWriter, r *http.Request) {
+	series, err := s.store(r).ListRecurringSeries(r.Context())
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing recurring series: %v", err)
+		return
+	}
+	resp := recurringAlertsResp{Alerts: []recurringAlert{}}
+	for i := range series {
+		for j := range series[i].Alerts {
+			resp.Alerts = append(resp.Alerts, recurringAlertStorageToResp(&series[i], &series[i].Alerts[j]))
+		}
+	}
+	respondJSON(w, &resp)
+}
+
+// postDetectRecurring detects recurring series in every transaction of the
+// household and replaces the ones found before unless it's a dry run.
+func (s *txnsServer) postDetectRecurring(w http.ResponseWriter, r *http.Request) {
+	var req detectRecurringRequest
+	if err := readJSONBody(r, "detect request", &req); err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	opts := recurring.Options{AmountTolerance: req.AmountTolerance, AsOf: time.Now().UTC()}
+	if opts.AmountTolerance == 0 {
+		opts.AmountTolerance = recurring.DefaultAmountTolerance
+	}
+	if opts.AmountTolerance < 0 || opts.AmountTolerance >= 1 {
+		respondf(w, http.StatusBadRequest, "invalid amount tolerance, got %v, want > 0 and < 1", opts.AmountTolerance)
+		return
+	}
+	if req.Date != "" {
+		d, status, err := validateDate(req.Date)
+		if err != nil {
+			respondf(w, status, "invalid detection date: %v", err)
+			return
+		}
+		opts.AsOf = d
+	}
+	store := s.store(r)
+	var txns []storage.Txn
+	if err := store.ForEachTxn(r.Context(), &storage.TxnQuery{}, func(t *storage.Txn) error {
+		txns = append(txns, *t)
+		return nil
+	}); err != nil {
+		respondf(w, http.StatusInternalServerError, "error querying txns: %v", err)
+		return
+	}
+	series := recurring.Detect(txns, opts)
+	if !req.DryRun {
+		if err := store.ReplaceRecurringSeries(r.Context(), series); err != nil {
+			respondStorageErr(w, err, "error saving recurring series")
+			return
+		}
+	}
+	resp := detectRecurringResp{Series: []recurringSeries{}, DryRun: req.DryRun}
+	for i := range series {
+		resp.Series = append(resp.Series, recurringStorageToResp(&series[i]))
+	}
+	respondJSON(w, &resp)
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+const (
+	// defaultMatchWindowDays is how many days after a reimbursable debit
+	// the credit reimbursing it is looked for by default.
+	defaultMatchWindowDays = 90
+	maxMatchWindowDays     = 366
+)
+
+type reimbursement struct {
+	TxnID        string `json:"txn_id,omitempty"`
+	Date         string `json:"date,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Amount       string `json:"amount,omitempty"`
+	ExpectedFrom string `json:"expected_from"`
+	CreditTxnID  string `json:"credit_txn_id,omitempty"`
+	CreditAmount string `json:"credit_amount,omitempty"`
+	NetCost      string `json:"net_cost,omitempty"`
+	Outstanding  bool   `json:"outstanding"`
+	CreatedAt    string `json:"created_at,omitempty"`
+}
+
+type reimbursementsResp struct {
+	Reimbursements []reimbursement `json:"reimbursements"`
+	// Total is the amount of the listed debits, Reimbursed the amount of
+	// the credits reimbursing them and NetCost what's left after the
+	// reimbursements.
+	Total       string `json:"total"`
+	Reimbursed  string `json:"reimbursed"`
+	Outstanding string `json:"outstanding"`
+	NetCost     string `json:"net_cost"`
+}
+
+type linkCreditRequest struct {
+	CreditTxnID string `json:"credit_txn_id"`
+}
+
+type matchReimbursementsRequest struct {
+	WindowDays int  `json:"windowDays,omitempty"`
+	DryRun     bool `json:"dryRun,omitempty"`
+}
+
+type reimbursementMatch struct {
+	TxnID       string `json:"txn_id"`
+	CreditTxnID string `json:"credit_txn_id"`
+}
+
+type matchReimbursementsResp struct {
+	Matches []reimbursementMatch `json:"matches"`
+	// Ambiguous are the outstanding debits with several credits that could
+	// reimburse them, which need to be linked manually.
+	Ambiguous []string `json:"ambiguous"`
+	DryRun    bool     `json:"dryRun"`
+}
+
+func reimbursementStorageToResp(r *storage.Reimbursement) reimbursement {
+	result := reimbursement{
+		TxnID:        fmt.Sprint(r.TxnID),
+		Date:         r.Date.Format(dateFmt),
+		Description:  r.Description,
+		Amount:       formatAmount(r.AmountCents),
+		ExpectedFrom: r.ExpectedFrom,
+		NetCost:      formatAmount(r.NetCents()),
+		Outstanding:  r.Outstanding(),
+		CreatedAt:    r.CreatedAt.Format(time.RFC3339),
+	}
+	if !r.Outstanding() {
+		result.CreditTxnID = fmt.Sprint(r.CreditTxnID)
+		result.CreditAmount = formatAmount(r.CreditAmountCents)
+	}
+	return result
+}
+
+func readJSONBody(r *http.Request, what string, v any) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("error reading request body: %v", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error parsing body as a JSON %v: %v", what, err)
+	}
+	return nil
+}
+
+// reimbursingCandidates returns the credits from credits that could
+// reimburse r, which have the opposite amount and are dated up to window
+// after it. Credits mentioning the expected payer in their description are
+// preferred when there are several.
+func reimbursingCandidates(r *storage.Reimbursement, credits []storage.Txn, window time.Duration) []storage.Txn {
+	var result, mentioning []storage.Txn
+	from := strings.ToLower(r.ExpectedFrom)
+	for _, c := range credits {
+		if c.AmountCents != -r.AmountCents || c.Date.Before(r.Date) || c.Date.After(r.Date.Add(window)) {
+			continue
+		}
+		result = append(result, c)
+		if strings.Contains(strings.ToLower(c.Description), from) {
+			mentioning = append(mentioning, c)
+		}
+	}
+	if len(result) > 1 && len(mentioning) > 0 {
+		return mentioning
+	}
+	return result
+}
+
+// matchReimbursements pairs outstanding reimbursements, oldest first, with
+// the only credit that could reimburse them. A credit is matched at most
+// once. It returns the matched credits keyed by the reimbursed debit and
+// the debits with several candidates.
+func matchReimbursements(outstanding []storage.Reimbursement, credits []storage.Txn, window time.Duration) (map[int64]int64, []int64) {
+	matches := map[int64]int64{}
+	var ambiguous []int64
+	used := map[int64]bool{}
+	for i := range outstanding {
+		var available []storage.Txn
+		for _, c := range credits {
+			if !used[c.ID] {
+				available = append(available, c)
+			}
+		}
+		switch cs := reimbursingCandidates(&outstanding[i], available, window); len(cs) {
+		case 0:
+		case 1:
+			matches[outstanding[i].TxnID] = cs[0].ID
+			used[cs[0].ID] = true
+		default:
+			ambiguous = append(ambiguous, outstanding[i].TxnID)
+		}
+	}
+	return matches, ambiguous
+}
+
+// unlinkedCredits returns the credits dated from from up to to that don't
+// reimburse anything yet.
+func (s *txnsServer) unlinkedCredits(r *http.Request, from, to time.Time) ([]storage.Txn, error) {
+	store := s.store(r)
+	all, err := store.ListReimbursements(r.Context(), false)
+	if err != nil {
+		return nil, err
+	}
+	linked := map[int64]bool{}
+	for _, rb := range all {
+		linked[rb.CreditTxnID] = true
+	}
+	var result []storage.Txn
+	tq := &storage.TxnQuery{FromDate: &from, ToDate: &to, AmountType: storage.AmountCredit}
+	err = store.ForEachTxn(r.Context(), tq, func(t *storage.Txn) error {
+		if !linked[t.ID] {
+			result = append(result, *t)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func matchWindow(days int) (time.Duration, error) {
+	if days == 0 {
+		days = defaultMatchWindowDays
+	}
+	if days < 0 || days > maxMatchWindowDays {
+		return 0, fmt.Errorf("invalid match window, got %v days, want > 0 and <= %v", days, maxMatchWindowDays)
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+func (s *txnsServer) getReimbursement(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	rb, err := s.store(r).GetReimbursement(r.Context(), txnID)
+	if err != nil {
+		respondStorageErr(w, err, "error fetching reimbursement")
+		return
+	}
+	resp := reimbursementStorageToResp(&rb)
+	respondJSON(w, &resp)
+}
+
+// putReimbursement marks a debit reimbursable by the expected payer.
+func (s *txnsServer) putReimbursement(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	var req reimbursement
+	if err := readJSONBody(r, "reimbursement", &req); err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err := storage.ValidateExpectedFrom(req.ExpectedFrom); err != nil {
+		respondf(w, http.StatusBadRequest, "invalid reimbursement: %v", err)
+		return
+	}
+	if err := s.store(r).SetReimbursable(r.Context(), &storage.Reimbursement{TxnID: txnID, ExpectedFrom: req.ExpectedFrom}); err != nil {
+		respondStorageErr(w, err, "error marking txn reimbursable")
+		return
+	}
+	respondf(w, http.StatusOK, "txn %v marked reimbursable by %v", txnID, req.ExpectedFrom)
+}
+
+func (s *txnsServer) deleteReimbursement(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err := s.store(r).DeleteReimbursement(r.Context(), txnID); err != nil {
+		respondStorageErr(w, err, "error deleting reimbursement")
+		return
+	}
+	respondf(w, http.StatusOK, "txn %v no longer reimbursable", txnID)
+}
+
+// putReimbursementCredit manually links the credit reimbursing a debit.
+func (s *txnsServer) putReimbursementCredit(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	var req linkCreditRequest
+	if err := readJSONBody(r, "credit link", &req); err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	creditID, err := strconv.ParseInt(req.CreditTxnID, 10, 64)
+	if err != nil || creditID < 0 {
+		respondf(w, http.StatusBadRequest, "invalid credit_txn_id '%v', want number >= 0", req.CreditTxnID)
+		return
+	}
+	if err := s.store(r).LinkReimbursement(r.Context(), txnID, creditID); err != nil {
+		respondStorageErr(w, err, "error linking reimbursement")
+		return
+	}
+	respondf(w, http.StatusOK, "txn %v reimbursed by txn %v", txnID, creditID)
+}
+
+func (s *txnsServer) deleteReimbursementCredit(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err := s.store(r).UnlinkReimbursement(r.Context(), txnID); err != nil {
+		respondStorageErr(w, err, "error unlinking reimbursement")
+		return
+	}
+	respondf(w, http.StatusOK, "reimbursement of txn %v outstanding", txnID)
+}
+
+// getReimbursementCandidates lists the credits that could reimburse a debit
+// for linking manually.
+func (s *txnsServer) getReimbursementCandidates(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	var days int
+	if v := r.URL.Query().Get("windowDays"); v != "" {
+		if days, err = strconv.Atoi(v); err != nil {
+			respondf(w, http.StatusBadRequest, "invalid value for url parameter windowDays=%v: %v", v, err)
+			return
+		}
+	}
+	window, err := matchWindow(days)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	rb, err := s.store(r).GetReimbursement(r.Context(), txnID)
+	if err != nil {
+		respondStorageErr(w, err, "error fetching reimbursement")
+		return
+	}
+	credits, err := s.unlinkedCredits(r, rb.Date, rb.Date.Add(window))
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error looking up credits: %v", err)
+		return
+	}
+	respondJSON(w, txnsStorageToResp(reimbursingCandidates(&rb, credits, window)))
+}
+
+// listReimbursements lists reimbursable debits, optionally only the
+// outstanding ones or those in a date range, along with their net cost.
+func (s *txnsServer) listReimbursements(w http.ResponseWriter, r *http.Request) {
+	vals := r.URL.Query()
+	outstandingOnly := false
+	if v := vals.Get("outstanding"); v != "" {
+		var err error
+		if outstandingOnly, err = strconv.ParseBool(v); err != nil {
+			respondf(w, http.StatusBadRequest, "invalid value for url parameter outstanding=%v: %v", v, err)
+			return
+		}
+	}
+	var from, to *time.Time
+	for _, p := range []struct {
+		name string
+		date **time.Time
+	}{{"fromDate", &from}, {"toDate", &to}} {
+		if v := vals.Get(p.name); v != "" {
+			d, status, err := validateDate(v)
+			if err != nil {
+				respondf(w, status, "invalid value for url parameter %v=%v: %v", p.name, v, err)
+				return
+			}
+			*p.date = &d
+		}
+	}
+	rbs, err := s.store(r).ListReimbursements(r.Context(), outstandingOnly)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing reimbursements: %v", err)
+		return
+	}
+	resp := reimbursementsResp{Reimbursements: []reimbursement{}}
+	var total, reimbursed, outstanding int64
+	for i := range rbs {
+		rb := &rbs[i]
+		if (from != nil && rb.Date.Before(*from)) || (to != nil && rb.Date.After(*to)) {
+			continue
+		}
+		total += rb.AmountCents
+		reimbursed += rb.CreditAmountCents
+		if rb.Outstanding() {
+			outstanding += rb.AmountCents
+		}
+		resp.Reimbursements = append(resp.Reimbursements, reimbursementStorageToResp(rb))
+	}
+	resp.Total = formatAmount(total)
+	resp.Reimbursed = formatAmount(reimbursed)
+	resp.Outstanding = formatAmount(outstanding)
+	resp.NetCost = formatAmount(total + reimbursed)
+	respondJSON(w, &resp)
+}
+
+// postMatchReimbursements links outstanding reimbursements to the credits
+// reimbursing them by amount and date.
+func (s *txnsServer) postMatchReimbursements(w http.ResponseWriter, r *http.Request) {
+	var req matchReimbursementsRequest
+	if err := readJSONBody(r, "match request", &req); err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	window, err := matchWindow(req.WindowDays)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	store := s.store(r)
+	outstanding, err := store.ListReimbursements(r.Context(), true)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing reimbursements: %v", err)
+		return
+	}
+	resp := matchReimbursementsResp{Matches: []reimbursementMatch{}, Ambiguous: []string{}, DryRun: req.DryRun}
+	if len(outstanding) == 0 {
+		respondJSON(w, &resp)
+		return
+	}
+	credits, err := s.unlinkedCredits(r, outstanding[0].Date, outstanding[len(outstanding)-1].Date.Add(window))
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error looking up credits: %v", err)
+		return
+	}
+	matches, ambiguous := matchReimbursements(outstanding, credits, window)
+	if !req.DryRun && len(matches) > 0 {
+		if err := store.LinkReimbursements(r.Context(), matches); err != nil {
+			respondStorageErr(w, err, "error linking reimbursements")
+			return
+		}
+	}
+	for _, rb := range outstanding {
+		if creditID, ok := matches[rb.TxnID]; ok {
+			resp.Matches = append(resp.Matches, reimbursementMatch{TxnID: fmt.Sprint(rb.TxnID), CreditTxnID: fmt.Sprint(creditID)})
+		}
+	}
+	for _, id := range ambiguous {
+		resp.Ambiguous = append(resp.Ambiguous, fmt.Sprint(id))
+	}
+	respondJSON(w, &resp)
+}
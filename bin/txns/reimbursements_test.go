@@ -0,0 +1,47 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+func TestMatchReimbursements(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse(dateFmt, s)
+		if err != nil {
+			t.Fatalf("invalid test date %q: %v", s, err)
+		}
+		return d
+	}
+	outstanding := []storage.Reimbursement{
+		{TxnID: 1, ExpectedFrom: "ACME", Date: date("2024/01/10"), AmountCents: -5000},
+		{TxnID: 2, ExpectedFrom: "ACME", Date: date("2024/01/12"), AmountCents: -5000},
+		{TxnID: 3, ExpectedFrom: "Insurer", Date: date("2024/01/15"), AmountCents: -12000},
+		{TxnID: 4, ExpectedFrom: "ACME", Date: date("2024/01/20"), AmountCents: -7000},
+		{TxnID: 5, ExpectedFrom: "ACME", Date: date("2024/03/01"), AmountCents: -900},
+	}
+	credits := []storage.Txn{
+		// Either of the first two debits could be reimbursed by 10 and 11.
+		{ID: 10, Date: date("2024/01/25"), Description: "E-TRANSFER", AmountCents: 5000},
+		{ID: 11, Date: date("2024/01/26"), Description: "E-TRANSFER", AmountCents: 5000},
+		// 13 mentions the insurer so it's preferred over 12.
+		{ID: 12, Date: date("2024/01/20"), Description: "REFUND", AmountCents: 12000},
+		{ID: 13, Date: date("2024/01/21"), Description: "INSURER CLAIM", AmountCents: 12000},
+		// 14 is older than the debit it would reimburse.
+		{ID: 14, Date: date("2024/01/19"), Description: "ACME", AmountCents: 7000},
+		{ID: 15, Date: date("2024/02/01"), Description: "ACME EXPENSES", AmountCents: 7000},
+		// 16 is outside the window.
+		{ID: 16, Date: date("2024/06/01"), Description: "ACME EXPENSES", AmountCents: 900},
+	}
+	matches, ambiguous := matchReimbursements(outstanding, credits, 30*24*time.Hour)
+	if want := map[int64]int64{3: 13, 4: 15}; !maps.Equal(matches, want) {
+		t.Errorf("matchReimbursements got matches %v, want %v", matches, want)
+	}
+	if want := []int64{1, 2}; !slices.Equal(ambiguous, want) {
+		t.Errorf("matchReimbursements got ambiguous %v, want %v", ambiguous, want)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/splits"
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+type share struct {
+	Person string `json:"person"`
+	Amount string `json:"amount"`
+}
+
+type split struct {
+	TxnID  string  `json:"txn_id,omitempty"`
+	Date   string  `json:"date,omitempty"`
+	Amount string  `json:"amount,omitempty"`
+	PaidBy string  `json:"paid_by"`
+	Shares []share `json:"shares,omitempty"`
+	// Even splits the whole amount of the transaction evenly between the
+	// given people instead of giving shares.
+	Even      []string `json:"even,omitempty"`
+	UpdatedAt string   `json:"updated_at,omitempty"`
+	// Balances are the balances of everyone after the split when listing
+	// splits.
+	Balances map[string]string `json:"balances,omitempty"`
+}
+
+type splitsResp struct {
+	Splits []split `json:"splits"`
+}
+
+type balance struct {
+	Person  string `json:"person"`
+	Balance string `json:"balance"`
+}
+
+type balancesResp struct {
+	Balances []balance `json:"balances"`
+}
+
+type payment struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount string `json:"amount"`
+}
+
+type settleResp struct {
+	Payments []payment `json:"payments"`
+}
+
+func splitStorageToResp(sp *storage.Split) split {
+	result := split{
+		TxnID:     fmt.Sprint(sp.TxnID),
+		Date:      sp.Date.Format(dateFmt),
+		Amount:    formatAmount(sp.AmountCents),
+		PaidBy:    sp.PaidBy,
+		UpdatedAt: sp.UpdatedAt.Format(time.RFC3339),
+	}
+	for _, sh := range sp.Shares {
+		result.Shares = append(result.Shares, share{Person: sh.Person, Amount: formatAmount(sh.AmountCents)})
+	}
+	return result
+}
+
+// readSplitRequest parses a split with either shares or people to split
+// evenly between from the request body.
+func readSplitRequest(r *http.Request) (*split, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading request body: %v", err)
+	}
+	var sp split
+	if err := json.Unmarshal(body, &sp); err != nil {
+		return nil, fmt.Errorf("error parsing body as a JSON split: %v", err)
+	}
+	if (len(sp.Shares) == 0) == (len(sp.Even) == 0) {
+		return nil, fmt.Errorf("want exactly one of shares or even in split")
+	}
+	return &sp, nil
+}
+
+// splitsAsOf returns the splits of transactions dated on or before the
+// toDate url parameter, or every split without it.
+func (s *txnsServer) splitsAsOf(r *http.Request) ([]storage.Split, int, error) {
+	var toDate *time.Time
+	if v := r.URL.Query().Get("toDate"); v != "" {
+		d, status, err := validateDate(v)
+		if err != nil {
+			return nil, status, fmt.Errorf("invalid value for url parameter toDate=%v: %w", v, err)
+		}
+		toDate = &d
+	}
+	sps, err := s.store(r).ListSplits(r.Context())
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error listing splits: %w", err)
+	}
+	if toDate != nil {
+		sps = slices.DeleteFunc(sps, func(sp storage.Split) bool { return sp.Date.After(*toDate) })
+	}
+	return sps, http.StatusOK, nil
+}
+
+func respondJSON(w http.ResponseWriter, v any) {
+	respBody, err := json.Marshal(v)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error generating JSON response: %v", err)
+		return
+	}
+	respond(w, http.StatusOK, respBody)
+}
+
+func (s *txnsServer) getSplit(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	sp, err := s.store(r).GetSplit(r.Context(), txnID)
+	if err != nil {
+		respondStorageErr(w, err, "error fetching split")
+		return
+	}
+	resp := splitStorageToResp(&sp)
+	respondJSON(w, &resp)
+}
+
+// putSplit sets how a transaction is split between people, either with
+// explicit shares or evenly.
+func (s *txnsServer) putSplit(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	req, err := readSplitRequest(r)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	sp := storage.Split{TxnID: txnID, PaidBy: req.PaidBy}
+	for i, sh := range req.Shares {
+		a, err := storage.ParseAmount(sh.Amount)
+		if err != nil {
+			respondf(w, http.StatusBadRequest, "invalid amount '%v' of share at index %v: %v", sh.Amount, i, err)
+			return
+		}
+		sp.Shares = append(sp.Shares, storage.Share{Person: sh.Person, AmountCents: a})
+	}
+	store := s.store(r)
+	if len(req.Even) > 0 {
+		page, err := store.QueryTxns(r.Context(), &storage.TxnQuery{StartID: txnID, Limit: 1})
+		if err != nil {
+			respondf(w, http.StatusInternalServerError, "error fetching txn %v: %v", txnID, err)
+			return
+		}
+		if len(page.Txns) == 0 || page.Txns[0].ID != txnID {
+			respondf(w, http.StatusNotFound, "txn %v not found", txnID)
+			return
+		}
+		if sp.Shares, err = splits.Even(page.Txns[0].AmountCents, req.Even); err != nil {
+			respondf(w, http.StatusBadRequest, "invalid even split: %v", err)
+			return
+		}
+	}
+	if err := store.SetSplit(r.Context(), &sp); err != nil {
+		respondStorageErr(w, err, "error setting split")
+		return
+	}
+	respondf(w, http.StatusOK, "split of txn %v set", txnID)
+}
+
+func (s *txnsServer) deleteSplit(w http.ResponseWriter, r *http.Request) {
+	txnID, err := urlParamID(r, "txnID")
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err := s.store(r).DeleteSplit(r.Context(), txnID); err != nil {
+		respondStorageErr(w, err, "error deleting split")
+		return
+	}
+	respondf(w, http.StatusOK, "split of txn %v deleted", txnID)
+}
+
+// listSplits lists splits by date along with the running balance of
+// everyone after each split.
+func (s *txnsServer) listSplits(w http.ResponseWriter, r *http.Request) {
+	sps, status, err := s.splitsAsOf(r)
+	if err != nil {
+		respondf(w, status, "%v", err)
+		return
+	}
+	resp := splitsResp{Splits: []split{}}
+	running := map[string]int64{}
+	for i := range sps {
+		splits.Apply(running, &sps[i])
+		sp := splitStorageToResp(&sps[i])
+		sp.Balances = map[string]string{}
+		for p, b := range running {
+			sp.Balances[p] = formatAmount(b)
+		}
+		resp.Splits = append(resp.Splits, sp)
+	}
+	respondJSON(w, &resp)
+}
+
+// getBalances returns how much everyone is owed, or owes when negative.
+func (s *txnsServer) getBalances(w http.ResponseWriter, r *http.Request) {
+	sps, status, err := s.splitsAsOf(r)
+	if err != nil {
+		respondf(w, status, "%v", err)
+		return
+	}
+	balances := splits.Balances(sps)
+	resp := balancesResp{Balances: []balance{}}
+	for p, b := range balances {
+		resp.Balances = append(resp.Balances, balance{Person: p, Balance: formatAmount(b)})
+	}
+	slices.SortFunc(resp.Balances, func(a, b balance) int { return cmp.Compare(a.Person, b.Person) })
+	respondJSON(w, &resp)
+}
+
+// getSettle returns the fewest payments that settle everyone's balance.
+func (s *txnsServer) getSettle(w http.ResponseWriter, r *http.Request) {
+	sps, status, err := s.splitsAsOf(r)
+	if err != nil {
+		respondf(w, status, "%v", err)
+		return
+	}
+	resp := settleResp{Payments: []payment{}}
+	for _, p := range splits.Settle(splits.Balances(sps)) {
+		resp.Payments = append(resp.Payments, payment{From: p.From, To: p.To, Amount: formatAmount(p.AmountCents)})
+	}
+	respondJSON(w, &resp)
+}
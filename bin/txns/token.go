@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+const tokenTimeFmt = "2006-01-02 15:04:05 MST"
+
+// tokenCmd implements the token command which creates, lists and revokes
+// the API tokens used to authenticate with the server.
+func tokenCmd(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Missing token command, want create|list|revoke")
+	}
+	switch sub := args[0]; sub {
+	case "create":
+		tokenCreateCmd(args[1:])
+	case "list":
+		tokenListCmd(args[1:])
+	case "revoke":
+		tokenRevokeCmd(args[1:])
+	default:
+		log.Fatalf("Unknown token command %q, want create|list|revoke", sub)
+	}
+}
+
+func tokenCreateCmd(args []string) {
+	fs := flag.NewFlagSet("token create", flag.ExitOnError)
+	name := fs.String("name", "", "Name describing who uses the token, e.g. expenses-ui.")
+	userName := fs.String("user", defaultAccountName, "Name of the user the token authenticates as.")
+	scopes := fs.String("scopes", storage.ScopeRead, fmt.Sprintf("Comma separated scopes granted to the token, from %v.", storage.ValidScopes))
+	fs.Parse(args)
+
+	db, err := openStore()
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	u, err := db.UserByName(context.Background(), *userName)
+	if err != nil {
+		log.Fatalf("Error looking up user: %v", err)
+	}
+	secret, hash, err := storage.NewTokenSecret()
+	if err != nil {
+		log.Fatalf("Error creating token: %v", err)
+	}
+	tok := storage.Token{UserID: u.ID, Name: *name, Scopes: strings.Split(*scopes, ",")}
+	id, err := db.CreateToken(context.Background(), &tok, hash)
+	if err != nil {
+		log.Fatalf("Error creating token: %v", err)
+	}
+	log.Printf("Created token %v named '%v' for user '%v' with scopes %v. The token is shown only once.", id, tok.Name, u.Name, strings.Join(tok.Scopes, ","))
+	fmt.Println(secret)
+}
+
+func tokenListCmd(args []string) {
+	fs := flag.NewFlagSet("token list", flag.ExitOnError)
+	fs.Parse(args)
+
+	db, err := openStore()
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	tokens, err := db.ListTokens(context.Background())
+	if err != nil {
+		log.Fatalf("Error listing tokens: %v", err)
+	}
+	users, err := db.ListUsers(context.Background())
+	if err != nil {
+		log.Fatalf("Error listing users: %v", err)
+	}
+	userNames := map[int64]string{}
+	for _, u := range users {
+		userNames[u.ID] = u.Name
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSER\tNAME\tSCOPES\tCREATED AT\tREVOKED AT")
+	for _, t := range tokens {
+		revoked := "-"
+		if t.RevokedAt != nil {
+			revoked = t.RevokedAt.Format(tokenTimeFmt)
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\n", t.ID, userNames[t.UserID], t.Name, strings.Join(t.Scopes, ","), t.CreatedAt.Format(tokenTimeFmt), revoked)
+	}
+	tw.Flush()
+}
+
+func tokenRevokeCmd(args []string) {
+	fs := flag.NewFlagSet("token revoke", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		log.Fatalf("Missing IDs of tokens to revoke, usage: txns token revoke <id>...")
+	}
+
+	db, err := openStore()
+	if err != nil {
+		log.Fatalf("Error initializing connection to the database: %v", err)
+	}
+	for _, arg := range fs.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid token ID '%v': %v", arg, err)
+		}
+		if err := db.RevokeToken(context.Background(), id); err != nil {
+			log.Fatalf("Error revoking token: %v", err)
+		}
+		log.Printf("Revoked token %v.", id)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+// viewParams are the GET /txns url parameters that can be saved in a view.
+// Pagination parameters are left out since they only make sense for a
+// single request.
+var viewParams = []string{
+	"fromDate", "toDate",
+	"description", "descriptionOp",
+	"source", "sourceOp",
+	"tags", "tagsOp",
+	"notes", "notesOp",
+	"amount", "minAmount", "maxAmount", "amountAbs", "amountType",
+	"q", "sort", "order", "limit",
+}
+
+type view struct {
+	Name      string            `json:"name,omitempty"`
+	Params    map[string]string `json:"params"`
+	CreatedAt string            `json:"created_at,omitempty"`
+	UpdatedAt string            `json:"updated_at,omitempty"`
+}
+
+type viewsResp struct {
+	Views []view `json:"views"`
+}
+
+func viewStorageToResp(sv *storage.View) (view, error) {
+	vals, err := url.ParseQuery(sv.Query)
+	if err != nil {
+		return view{}, fmt.Errorf("view '%v' had malformed saved query: %w", sv.Name, err)
+	}
+	result := view{
+		Name:      sv.Name,
+		Params:    map[string]string{},
+		CreatedAt: sv.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: sv.UpdatedAt.Format(time.RFC3339),
+	}
+	for k := range vals {
+		result.Params[k] = vals.Get(k)
+	}
+	return result, nil
+}
+
+// viewParamsToQuery validates the given params and serializes them into the
+// saved query of a view.
+func viewParamsToQuery(params map[string]string) (string, error) {
+	vals := url.Values{}
+	for k, v := range params {
+		if !slices.Contains(viewParams, k) {
+			return "", fmt.Errorf("unsupported view parameter '%v', want one of %v", k, viewParams)
+		}
+		if v != "" {
+			vals.Set(k, v)
+		}
+	}
+	if _, err := txnQueryFromValues(vals); err != nil {
+		return "", err
+	}
+	return vals.Encode(), nil
+}
+
+func readViewRequest(r *http.Request) (*view, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading request body: %v", err)
+	}
+	var v view
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, fmt.Errorf("error parsing body as a JSON view: %v", err)
+	}
+	return &v, nil
+}
+
+func respondStorageErr(w http.ResponseWriter, err error, format string, a ...any) {
+	msg := fmt.Sprintf(format, a...)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		respondf(w, http.StatusNotFound, "%v: %v", msg, err)
+	case errors.Is(err, storage.ErrAlreadyExists):
+		respondf(w, http.StatusConflict, "%v: %v", msg, err)
+	case errors.Is(err, storage.ErrInvalidSplit), errors.Is(err, storage.ErrInvalidReimbursement):
+		respondf(w, http.StatusBadRequest, "%v: %v", msg, err)
+	default:
+		respondf(w, http.StatusInternalServerError, "%v: %v", msg, err)
+	}
+}
+
+func (s *txnsServer) listViews(w http.ResponseWriter, r *http.Request) {
+	svs, err := s.store(r).ListViews(r.Context())
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error listing views: %v", err)
+		return
+	}
+	resp := viewsResp{Views: []view{}}
+	for i := range svs {
+		v, err := viewStorageToResp(&svs[i])
+		if err != nil {
+			respondf(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+		resp.Views = append(resp.Views, v)
+	}
+	respBody, err := json.Marshal(&resp)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error generating JSON response: %v", err)
+		return
+	}
+	respond(w, http.StatusOK, respBody)
+}
+
+func (s *txnsServer) postView(w http.ResponseWriter, r *http.Request) {
+	v, err := readViewRequest(r)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err := storage.ValidateViewName(v.Name); err != nil {
+		respondf(w, http.StatusBadRequest, "invalid view: %v", err)
+		return
+	}
+	q, err := viewParamsToQuery(v.Params)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "invalid view params: %v", err)
+		return
+	}
+	if err := s.store(r).CreateView(r.Context(), &storage.View{Name: v.Name, Query: q}); err != nil {
+		respondStorageErr(w, err, "error creating view")
+		return
+	}
+	respondf(w, http.StatusOK, "view %v created", v.Name)
+}
+
+func (s *txnsServer) getView(w http.ResponseWriter, r *http.Request) {
+	sv, err := s.store(r).GetView(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		respondStorageErr(w, err, "error fetching view")
+		return
+	}
+	v, err := viewStorageToResp(&sv)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	respBody, err := json.Marshal(&v)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "error generating JSON response: %v", err)
+		return
+	}
+	respond(w, http.StatusOK, respBody)
+}
+
+func (s *txnsServer) putView(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	v, err := readViewRequest(r)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if v.Name != "" && v.Name != name {
+		respondf(w, http.StatusBadRequest, "view name in body '%v' doesn't match url '%v', views can't be renamed", v.Name, name)
+		return
+	}
+	q, err := viewParamsToQuery(v.Params)
+	if err != nil {
+		respondf(w, http.StatusBadRequest, "invalid view params: %v", err)
+		return
+	}
+	if err := s.store(r).UpdateView(r.Context(), &storage.View{Name: name, Query: q}); err != nil {
+		respondStorageErr(w, err, "error updating view")
+		return
+	}
+	respondf(w, http.StatusOK, "view %v updated", name)
+}
+
+func (s *txnsServer) deleteView(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := s.store(r).DeleteView(r.Context(), name); err != nil {
+		respondStorageErr(w, err, "error deleting view")
+		return
+	}
+	respondf(w, http.StatusOK, "view %v deleted", name)
+}
+
+// getViewTxns runs the query saved in a view. Url parameters given in the
+// request override the saved ones, e.g., to page through the results or
+// narrow down the date range.
+func (s *txnsServer) getViewTxns(w http.ResponseWriter, r *http.Request) {
+	sv, err := s.store(r).GetView(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		respondStorageErr(w, err, "error fetching view")
+		return
+	}
+	vals, err := url.ParseQuery(sv.Query)
+	if err != nil {
+		respondf(w, http.StatusInternalServerError, "view '%v' had malformed saved query: %v", sv.Name, err)
+		return
+	}
+	for k, v := range r.URL.Query() {
+		vals[k] = v
+	}
+	s.queryTxns(w, r, vals)
+}
@@ -1,6 +1,7 @@
 import { NextRequest } from "next/server";
 import { z, ZodError } from "zod";
 import { StatusCodes } from "http-status-codes";
+import { TxnsAPIHeaders } from "@/lib/transactions";
 
 const RequestSchema = z.object({
   ids: z.array(z.string()),
@@ -49,9 +50,7 @@ export async function POST(request: NextRequest) {
   try {
     const response = await fetch(url, {
       method: "PATCH",
-      headers: {
-        "Content-Type": "application/json",
-      },
+      headers: TxnsAPIHeaders(),
       body: JSON.stringify({
         ids: ids,
         op: op,
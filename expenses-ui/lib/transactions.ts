@@ -1,6 +1,19 @@
 import { z } from "zod";
 import sql from "./db";
 
+// TxnsAPIHeaders returns the headers for requests to the txns server, which
+// authenticates requests with the API token in TXNS_API_TOKEN.
+export function TxnsAPIHeaders(): HeadersInit {
+  const headers: Record<string, string> = {
+    "Content-Type": "application/json",
+  };
+  const token = process.env.TXNS_API_TOKEN;
+  if (token) {
+    headers["Authorization"] = `Bearer ${token}`;
+  }
+  return headers;
+}
+
 export type TxnQueryParams = {
   ids?: string;
   fromDate?: string;
@@ -113,9 +126,7 @@ export async function FetchTransactions(
     console.log(`FetchTransactions url= ${url}`);
     const response = await fetch(url, {
       method: "GET",
-      headers: {
-        "Content-Type": "application/json",
-      },
+      headers: TxnsAPIHeaders(),
     });
     console.log(`FetchTransactions response=${response}`);
     if (!response.ok) {
@@ -153,9 +164,7 @@ export async function FetchSimilarTransactions(
   try {
     const response = await fetch(url, {
       method: "GET",
-      headers: {
-        "Content-Type": "application/json",
-      },
+      headers: TxnsAPIHeaders(),
     });
 
     if (!response.ok) {
@@ -456,7 +465,7 @@ SELECT
     UNNEST(TAGS) AS TAG,
     ROUND(SUM(AMOUNT_CENTS) * -1 / 100) AS AMOUNT
 FROM
-    TRANSACTIONS
+    NET_TRANSACTIONS
 WHERE
     NOT ('transfer' = ANY(TAGS))
     AND NOT ('salary' = ANY(TAGS))
@@ -5,4 +5,5 @@ go 1.22.2
 require (
 	github.com/go-chi/chi/v5 v5.2.1
 	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.33
 )
@@ -18,6 +18,7 @@ export const transactions = pgTable(
     amountCents: bigint("amount_cents", { mode: "number" }).notNull(),
     source: text().notNull(),
     tags: text().array(),
+    notes: text(),
     descEmbedding: vector("desc_embedding", { dimensions: 768 }),
   },
   (table) => [
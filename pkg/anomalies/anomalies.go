@@ -0,0 +1,233 @@
+// Package anomalies flags charges that are out of character for their tags
+// and merchants or unlike anything charged before, explaining why.
+package anomalies
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/recurring"
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+const (
+	KindTagAmount        = "tag_amount"
+	KindMerchantAmount   = "merchant_amount"
+	KindNewMerchant      = "new_merchant"
+	KindNovelDescription = "novel_description"
+
+	// NoveltyThreshold is the cosine distance between the description
+	// embedding of a charge and the closest earlier one above which the
+	// description is novel.
+	NoveltyThreshold = 0.3
+
+	// minSamples is how many other charges a tag or merchant needs before
+	// amounts are compared against them.
+	minSamples = 5
+	// zThreshold is the modified z-score above which an amount is an
+	// outlier, as recommended by Iglewicz and Hoaglin.
+	zThreshold = 3.5
+	// minRatio is how many times the median an outlier must be at least so
+	// tightly clustered amounts don't flag small differences.
+	minRatio = 2.0
+	// largePercentile is the percentile of all charges above which a charge
+	// is large.
+	largePercentile = 0.9
+
+	// LookbackDays is how many days of history before the first charge
+	// scored it's compared against, so scoring doesn't slow down as the
+	// history grows.
+	LookbackDays = 365
+	// DefaultRangeDays is how many days of charges are scored when the
+	// start of the range isn't given.
+	DefaultRangeDays = 90
+)
+
+// Flag is a reason a charge is anomalous. Score is how far past the
+// threshold for the flag the charge is, at least 1.
+type Flag struct {
+	Kind        string
+	Score       float64
+	Explanation string
+}
+
+// Anomaly is a charge with at least one flag. Its Score is the highest of
+// its flags.
+type Anomaly struct {
+	Txn   storage.Txn
+	Score float64
+	Flags []Flag
+}
+
+func formatAmount(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%v%v.%02d", sign, cents/100, cents%100)
+}
+
+// distribution is a sorted list of charge amounts in cents.
+type distribution []int64
+
+// without returns d without one charge of amount, if it has one.
+func (d distribution) without(amount int64) distribution {
+	i, found := slices.BinarySearch(d, amount)
+	if !found {
+		return d
+	}
+	return slices.Delete(slices.Clone(d), i, i+1)
+}
+
+func (d distribution) median() float64 {
+	n := len(d)
+	if n%2 == 1 {
+		return float64(d[n/2])
+	}
+	return float64(d[n/2-1]+d[n/2]) / 2
+}
+
+// mad returns the median absolute deviation of d from med.
+func (d distribution) mad(med float64) float64 {
+	devs := make([]float64, len(d))
+	for i, v := range d {
+		devs[i] = math.Abs(float64(v) - med)
+	}
+	slices.Sort(devs)
+	n := len(devs)
+	if n%2 == 1 {
+		return devs[n/2]
+	}
+	return (devs[n/2-1] + devs[n/2]) / 2
+}
+
+func (d distribution) percentile(p float64) int64 {
+	return d[min(len(d)-1, int(p*float64(len(d))))]
+}
+
+// outlier reports whether amount is much larger than the charges in d along
+// with how many times their median it is.
+func (d distribution) outlier(amount int64) (float64, float64, bool) {
+	if len(d) < minSamples {
+		return 0, 0, false
+	}
+	med := d.median()
+	if med <= 0 {
+		return 0, 0, false
+	}
+	ratio := float64(amount) / med
+	z := math.Inf(1)
+	if mad := d.mad(med); mad > 0 {
+		z = 0.6745 * (float64(amount) - med) / mad
+	}
+	return ratio, med, ratio >= minRatio && z >= zThreshold
+}
+
+func sortAll(byKey map[string]distribution) {
+	for _, d := range byKey {
+		slices.Sort(d)
+	}
+}
+
+// Score flags the charges among txns that are out of character compared to
+// the charges in history, which may include txns. Transactions are compared
+// against the amounts charged with the same tags and by the same merchant.
+// merchants has the merchant names of the transactions mapped to one by ID,
+// the merchant of the others being their normalized description. novelty
+// has the description novelty of txns, see
+// storage.Store.DescriptionNovelty. Anomalies are ordered by decreasing
+// score.
+func Score(history, txns []storage.Txn, merchants map[int64]string, novelty map[int64]float64) []Anomaly {
+	merchant := func(t *storage.Txn) string {
+		if m, ok := merchants[t.ID]; ok {
+			return m
+		}
+		return recurring.NormalizeDescription(t.Description)
+	}
+	var all distribution
+	byTag, byMerchant := map[string]distribution{}, map[string]distribution{}
+	firstCharge := map[string]time.Time{}
+	for _, t := range history {
+		if t.AmountCents >= 0 {
+			continue
+		}
+		a := -t.AmountCents
+		all = append(all, a)
+		for _, tag := range t.Tags {
+			byTag[tag] = append(byTag[tag], a)
+		}
+		m := merchant(&t)
+		byMerchant[m] = append(byMerchant[m], a)
+		if first, ok := firstCharge[m]; !ok || t.Date.Before(first) {
+			firstCharge[m] = t.Date
+		}
+	}
+	slices.Sort(all)
+	sortAll(byTag)
+	sortAll(byMerchant)
+
+	result := []Anomaly{}
+	for _, t := range txns {
+		if t.AmountCents >= 0 {
+			continue
+		}
+		a := -t.AmountCents
+		var flags []Flag
+		for _, tag := range t.Tags {
+			d := byTag[tag].without(a)
+			if ratio, med, ok := d.outlier(a); ok {
+				flags = append(flags, Flag{
+					Kind:        KindTagAmount,
+					Score:       ratio / minRatio,
+					Explanation: fmt.Sprintf("%v is %.1fx the median charge of %v tagged '%v' over %v charges", formatAmount(a), ratio, formatAmount(int64(med)), tag, len(d)),
+				})
+			}
+		}
+		m := merchant(&t)
+		d := byMerchant[m].without(a)
+		if ratio, med, ok := d.outlier(a); ok {
+			flags = append(flags, Flag{
+				Kind:        KindMerchantAmount,
+				Score:       ratio / minRatio,
+				Explanation: fmt.Sprintf("%v is %.1fx the median charge of %v from '%v' over %v charges", formatAmount(a), ratio, formatAmount(int64(med)), m, len(d)),
+			})
+		}
+		others := all.without(a)
+		if first, ok := firstCharge[m]; (!ok || !first.Before(t.Date)) && len(others) >= minSamples {
+			if large := others.percentile(largePercentile); a > large && large > 0 {
+				flags = append(flags, Flag{
+					Kind:        KindNewMerchant,
+					Score:       float64(a) / float64(large),
+					Explanation: fmt.Sprintf("first charge from '%v' and %v is more than %.0f%% of charges, which are up to %v", m, formatAmount(a), largePercentile*100, formatAmount(large)),
+				})
+			}
+		}
+		if d, ok := novelty[t.ID]; ok && d >= NoveltyThreshold && len(others) >= minSamples {
+			// Novel descriptions are common, only those of charges above
+			// the median are worth a look.
+			if med := others.median(); float64(a) > med {
+				flags = append(flags, Flag{
+					Kind:        KindNovelDescription,
+					Score:       d / NoveltyThreshold,
+					Explanation: fmt.Sprintf("description is unlike any earlier one, the closest is %.2f away in cosine distance, and %v is above the median charge of %v", d, formatAmount(a), formatAmount(int64(med))),
+				})
+			}
+		}
+		if len(flags) == 0 {
+			continue
+		}
+		an := Anomaly{Txn: t, Flags: flags}
+		for _, f := range flags {
+			an.Score = max(an.Score, f.Score)
+		}
+		result = append(result, an)
+	}
+	slices.SortStableFunc(result, func(a, b Anomaly) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), b.Txn.Date.Compare(a.Txn.Date), cmp.Compare(a.Txn.ID, b.Txn.ID))
+	})
+	return result
+}
@@ -0,0 +1,94 @@
+package anomalies
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestScore(t *testing.T) {
+	var history []storage.Txn
+	add := func(d, desc string, amountCents int64, tags ...string) storage.Txn {
+		txn := storage.Txn{ID: int64(len(history) + 1), Date: date(d), Description: desc, AmountCents: amountCents, Tags: tags}
+		history = append(history, txn)
+		return txn
+	}
+	for i, a := range []int64{-3000, -4500, -3800, -5200, -4100, -3500} {
+		add(date("2024-01-01").AddDate(0, 0, i*7).Format(time.DateOnly), "BISTRO #12", a, "dining")
+	}
+	for i := range 6 {
+		add(date("2024-01-02").AddDate(0, 0, i*7).Format(time.DateOnly), "SAFEWAY", -9000-int64(i)*500, "groceries")
+	}
+	dinner := add("2024-03-01", "BISTRO #12", -15000, "dining")
+	groceries := add("2024-03-02", "SAFEWAY", -11000, "groceries")
+	jeweller := add("2024-03-03", "FANCY JEWELS", -80000)
+	coffee := add("2024-03-04", "NEW CAFE", -500)
+	refund := add("2024-03-05", "FANCY JEWELS REFUND", 80000)
+	novel := add("2024-03-06", "SAFEWAY", -10000, "groceries")
+	txns := []storage.Txn{dinner, groceries, jeweller, coffee, refund, novel}
+	novelty := map[int64]float64{dinner.ID: 0.05, groceries.ID: 0.1, coffee.ID: 0.6, novel.ID: 0.45}
+
+	got := Score(history, txns, nil, novelty)
+	type summary struct {
+		id    int64
+		kinds []string
+	}
+	var sums []summary
+	for _, a := range got {
+		s := summary{id: a.Txn.ID}
+		for _, f := range a.Flags {
+			s.kinds = append(s.kinds, f.Kind)
+			if f.Score < 1 || f.Explanation == "" {
+				t.Errorf("Score of txn %v got flag %+v, want a score >= 1 and an explanation", a.Txn.ID, f)
+			}
+		}
+		sums = append(sums, s)
+	}
+	want := []summary{
+		// The jewels are over 5 times the 90th percentile of other charges.
+		{id: jeweller.ID, kinds: []string{KindNewMerchant}},
+		{id: dinner.ID, kinds: []string{KindTagAmount, KindMerchantAmount}},
+		{id: novel.ID, kinds: []string{KindNovelDescription}},
+	}
+	if !slices.EqualFunc(sums, want, func(a, b summary) bool { return a.id == b.id && slices.Equal(a.kinds, b.kinds) }) {
+		t.Fatalf("Score got %+v, want %+v", sums, want)
+	}
+	if want := "150.00 is 3.8x the median charge of 39.50 tagged 'dining' over 6 charges"; got[1].Flags[0].Explanation != want {
+		t.Errorf("Score got explanation %q, want %q", got[1].Flags[0].Explanation, want)
+	}
+}
+
+func TestScoreMerchants(t *testing.T) {
+	var history []storage.Txn
+	merchants := map[int64]string{}
+	for i, desc := range []string{"AMZN Mktp CA*2X4", "AMAZON.CA", "AMZN Mktp CA*9Q1", "AMAZON.CA", "AMZN Mktp CA*7Z3", "AMAZON.CA"} {
+		history = append(history, storage.Txn{ID: int64(i + 1), Date: date("2024-01-01").AddDate(0, 0, i), Description: desc, AmountCents: -2000 - int64(i)*100})
+		merchants[int64(i+1)] = "Amazon"
+	}
+	large := storage.Txn{ID: 7, Date: date("2024-02-01"), Description: "AMZN Mktp CA*4K8", AmountCents: -12000}
+	history = append(history, large)
+	merchants[large.ID] = "Amazon"
+
+	got := Score(history, []storage.Txn{large}, merchants, nil)
+	if len(got) != 1 || len(got[0].Flags) != 1 || got[0].Flags[0].Kind != KindMerchantAmount {
+		t.Fatalf("Score got %+v, want a single %v flag", got, KindMerchantAmount)
+	}
+	if want := "120.00 is 5.3x the median charge of 22.50 from 'Amazon' over 6 charges"; got[0].Flags[0].Explanation != want {
+		t.Errorf("Score got explanation %q, want %q", got[0].Flags[0].Explanation, want)
+	}
+	// Without merchants, only the three charges described like it are from
+	// the same merchant, too few to compare against.
+	if got := Score(history, []storage.Txn{large}, nil, nil); len(got) != 0 {
+		t.Errorf("Score without merchants got %+v, want no anomalies", got)
+	}
+}
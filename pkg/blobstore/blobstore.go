@@ -0,0 +1,148 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store is a content-addressed blob store. Blobs are keyed by the hex
+// encoded SHA-256 digest of their contents so storing the same content
+// twice only keeps one copy.
+type Store interface {
+	Put(ctx context.Context, r io.Reader) (digest string, size int64, err error)
+	Get(ctx context.Context, digest string) (io.ReadCloser, error)
+	Delete(ctx context.Context, digest string) error
+}
+
+func ValidateDigest(digest string) error {
+	if l := len(digest); l != sha256.Size*2 {
+		return fmt.Errorf("invalid digest length, got %v, want %v", l, sha256.Size*2)
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return fmt.Errorf("digest %q was not a hex string: %w", digest, err)
+	}
+	return nil
+}
+
+// Local stores blobs on the local filesystem under a root directory,
+// sharded by the first two characters of the digest.
+type Local struct {
+	root string
+}
+
+func NewLocal(root string) (*Local, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create blob store directory %v: %w", root, err)
+	}
+	return &Local{root: root}, nil
+}
+
+func (l *Local) path(digest string) string {
+	return filepath.Join(l.root, digest[:2], digest)
+}
+
+func (l *Local) Put(ctx context.Context, r io.Reader) (string, int64, error) {
+	tmp, err := os.CreateTemp(l.root, ".upload-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("unable to create temporary file for blob: %w", err)
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return "", 0, fmt.Errorf("error writing blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, fmt.Errorf("error closing blob file: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", 0, err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	p := l.path(digest)
+	if _, err := os.Stat(p); err == nil {
+		return digest, size, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", 0, fmt.Errorf("unable to create blob directory: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return "", 0, fmt.Errorf("unable to move blob into place: %w", err)
+	}
+	return digest, size, nil
+}
+
+func (l *Local) Get(_ context.Context, digest string) (io.ReadCloser, error) {
+	if err := ValidateDigest(digest); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(l.path(digest))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, digest)
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to open blob %v: %w", digest, err)
+	}
+	return f, nil
+}
+
+func (l *Local) Delete(_ context.Context, digest string) error {
+	if err := ValidateDigest(digest); err != nil {
+		return err
+	}
+	if err := os.Remove(l.path(digest)); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %v", ErrNotFound, digest)
+	} else if err != nil {
+		return fmt.Errorf("unable to delete blob %v: %w", digest, err)
+	}
+	return nil
+}
+
+// Walk calls fn with the digest and modification time of every blob in the
+// store. Uploads in progress are skipped.
+func (l *Local) Walk(ctx context.Context, fn func(digest string, modTime time.Time) error) error {
+	shards, err := os.ReadDir(l.root)
+	if err != nil {
+		return fmt.Errorf("unable to list blob store directory %v: %w", l.root, err)
+	}
+	for _, shard := range shards {
+		if !shard.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(l.root, shard.Name()))
+		if err != nil {
+			return fmt.Errorf("unable to list blob directory %v: %w", shard.Name(), err)
+		}
+		for _, e := range entries {
+			digest := e.Name()
+			if e.IsDir() || ValidateDigest(digest) != nil || digest[:2] != shard.Name() {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			info, err := e.Info()
+			if errors.Is(err, os.ErrNotExist) {
+				// Deleted since the directory was listed.
+				continue
+			} else if err != nil {
+				return fmt.Errorf("unable to stat blob %v: %w", digest, err)
+			}
+			if err := fn(digest, info.ModTime()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
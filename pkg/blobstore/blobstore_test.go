@@ -0,0 +1,111 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func digestOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	l, err := NewLocal(root)
+	if err != nil {
+		t.Fatalf("NewLocal got error: %v", err)
+	}
+	digest, size, err := l.Put(ctx, strings.NewReader("receipt"))
+	if err != nil {
+		t.Fatalf("Put got error: %v", err)
+	}
+	if want := digestOf("receipt"); digest != want || size != 7 {
+		t.Errorf("Put got digest %v and size %v, want %v and 7", digest, size, want)
+	}
+	// Blobs are sharded by the first two characters of their digest.
+	if _, err := os.Stat(filepath.Join(root, digest[:2], digest)); err != nil {
+		t.Errorf("Put didn't store the blob in its shard: %v", err)
+	}
+	if again, _, err := l.Put(ctx, strings.NewReader("receipt")); err != nil || again != digest {
+		t.Errorf("Put of the same contents got %v, %v, want %v", again, err, digest)
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(root, ".upload-*")); len(tmps) != 0 {
+		t.Errorf("Put left temporary files %v", tmps)
+	}
+
+	rc, err := l.Get(ctx, digest)
+	if err != nil {
+		t.Fatalf("Get got error: %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(got) != "receipt" {
+		t.Errorf("Get got contents %q, %v, want %q", got, err, "receipt")
+	}
+	if _, err := l.Get(ctx, digestOf("missing")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of missing blob got error %v, want %v", err, ErrNotFound)
+	}
+	for _, bad := range []string{"", "../../etc/passwd", strings.Repeat("z", 64)} {
+		if _, err := l.Get(ctx, bad); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) got error %v, want invalid digest", bad, err)
+		}
+	}
+
+	other, _, err := l.Put(ctx, strings.NewReader("invoice"))
+	if err != nil {
+		t.Fatalf("Put got error: %v", err)
+	}
+	var walked []string
+	if err := l.Walk(ctx, func(d string, modTime time.Time) error {
+		if modTime.IsZero() {
+			t.Errorf("Walk got zero modification time for blob %v", d)
+		}
+		walked = append(walked, d)
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk got error: %v", err)
+	}
+	slices.Sort(walked)
+	want := []string{digest, other}
+	slices.Sort(want)
+	if !slices.Equal(walked, want) {
+		t.Errorf("Walk got %v, want %v", walked, want)
+	}
+
+	if err := l.Delete(ctx, digest); err != nil {
+		t.Fatalf("Delete got error: %v", err)
+	}
+	if _, err := l.Get(ctx, digest); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of deleted blob got error %v, want %v", err, ErrNotFound)
+	}
+	if err := l.Delete(ctx, digest); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of deleted blob got error %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestValidateDigest(t *testing.T) {
+	for _, tc := range []struct {
+		digest string
+		ok     bool
+	}{
+		{digest: digestOf("x"), ok: true},
+		{digest: digestOf("x")[:63]},
+		{digest: strings.Repeat("g", 64)},
+		{digest: ""},
+	} {
+		if err := ValidateDigest(tc.digest); (err == nil) != tc.ok {
+			t.Errorf("ValidateDigest(%q) got error %v, want ok %v", tc.digest, err, tc.ok)
+		}
+	}
+}
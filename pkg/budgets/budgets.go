@@ -0,0 +1,113 @@
+// Package budgets computes how the spending on tags tracks against their
+// budgets.
+package budgets
+
+import (
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+// Spending is the spending on a tag keyed by the first day of the month.
+type Spending map[time.Time]int64
+
+// Status is how the spending in the period of a budget containing a day
+// tracks against it.
+type Status struct {
+	// Start and End are the first and last days of the period.
+	Start time.Time
+	End   time.Time
+	// CarriedOverCents is what's left of the budgets of the earlier periods
+	// with rollover, negative when they were overspent.
+	CarriedOverCents int64
+	// AvailableCents is the budget for the period including what was carried
+	// over.
+	AvailableCents int64
+	SpentCents     int64
+	RemainingCents int64
+	// ProjectedCents is the spending by the end of the period if it keeps up
+	// the pace so far.
+	ProjectedCents int64
+}
+
+func day(d time.Time) time.Time {
+	y, m, dd := d.Date()
+	return time.Date(y, m, dd, 0, 0, 0, 0, time.UTC)
+}
+
+// PeriodStart returns the first day of the period containing d.
+func PeriodStart(period string, d time.Time) time.Time {
+	y, m, _ := d.Date()
+	switch period {
+	case storage.PeriodQuarterly:
+		m -= (m - 1) % 3
+	case storage.PeriodYearly:
+		m = time.January
+	}
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// NextPeriodStart returns the first day of the period after the one starting
+// on start.
+func NextPeriodStart(period string, start time.Time) time.Time {
+	switch period {
+	case storage.PeriodQuarterly:
+		return start.AddDate(0, 3, 0)
+	case storage.PeriodYearly:
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// TrackedFrom returns the first day with spending that counts towards the
+// status of a budget on the day asOf.
+func TrackedFrom(b *storage.Budget, asOf time.Time) time.Time {
+	start := PeriodStart(b.Period, asOf)
+	if since := PeriodStart(b.Period, b.Since); b.Rollover && since.Before(start) {
+		return since
+	}
+	return start
+}
+
+// ByTag groups spending by tag and month.
+func ByTag(spending []storage.TagSpending) map[string]Spending {
+	result := map[string]Spending{}
+	for _, ts := range spending {
+		if result[ts.Tag] == nil {
+			result[ts.Tag] = Spending{}
+		}
+		result[ts.Tag][PeriodStart(storage.PeriodMonthly, ts.Month)] += ts.SpentCents
+	}
+	return result
+}
+
+// spentBetween returns the spending in the months from from up to but
+// excluding to.
+func (s Spending) spentBetween(from, to time.Time) int64 {
+	var result int64
+	for m := from; m.Before(to); m = m.AddDate(0, 1, 0) {
+		result += s[m]
+	}
+	return result
+}
+
+// Compute returns the status of a budget on the day asOf given the spending
+// on its tag up to asOf since TrackedFrom.
+func Compute(b *storage.Budget, spending Spending, asOf time.Time) Status {
+	asOf = day(asOf)
+	start := PeriodStart(b.Period, asOf)
+	next := NextPeriodStart(b.Period, start)
+	result := Status{Start: start, End: next.AddDate(0, 0, -1)}
+	if b.Rollover {
+		for p := PeriodStart(b.Period, b.Since); p.Before(start); p = NextPeriodStart(b.Period, p) {
+			result.CarriedOverCents += b.AmountCents - spending.spentBetween(p, NextPeriodStart(b.Period, p))
+		}
+	}
+	result.AvailableCents = b.AmountCents + result.CarriedOverCents
+	result.SpentCents = spending.spentBetween(start, next)
+	result.RemainingCents = result.AvailableCents - result.SpentCents
+	elapsedDays := int64(asOf.Sub(start).Hours()/24) + 1
+	periodDays := int64(next.Sub(start).Hours() / 24)
+	result.ProjectedCents = result.SpentCents * periodDays / elapsedDays
+	return result
+}
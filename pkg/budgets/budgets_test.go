@@ -0,0 +1,104 @@
+package budgets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestPeriodStart(t *testing.T) {
+	for _, tc := range []struct {
+		period string
+		d      string
+		want   string
+		next   string
+	}{
+		{period: storage.PeriodMonthly, d: "2024-02-29", want: "2024-02-01", next: "2024-03-01"},
+		{period: storage.PeriodQuarterly, d: "2024-06-30", want: "2024-04-01", next: "2024-07-01"},
+		{period: storage.PeriodQuarterly, d: "2024-12-01", want: "2024-10-01", next: "2025-01-01"},
+		{period: storage.PeriodYearly, d: "2024-07-04", want: "2024-01-01", next: "2025-01-01"},
+	} {
+		got := PeriodStart(tc.period, date(tc.d))
+		if !got.Equal(date(tc.want)) {
+			t.Errorf("PeriodStart(%v, %v) = %v, want %v", tc.period, tc.d, got, tc.want)
+		}
+		if next := NextPeriodStart(tc.period, got); !next.Equal(date(tc.next)) {
+			t.Errorf("NextPeriodStart(%v, %v) = %v, want %v", tc.period, got, next, tc.next)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	spending := ByTag([]storage.TagSpending{
+		{Tag: "groceries", Month: date("2024-01-01"), SpentCents: 50000},
+		{Tag: "groceries", Month: date("2024-02-01"), SpentCents: 70000},
+		{Tag: "groceries", Month: date("2024-03-01"), SpentCents: 20000},
+		{Tag: "fun", Month: date("2024-03-01"), SpentCents: 1000},
+	})["groceries"]
+	for _, tc := range []struct {
+		name string
+		b    storage.Budget
+		asOf string
+		want Status
+	}{
+		{
+			name: "monthly",
+			b:    storage.Budget{Tag: "groceries", Period: storage.PeriodMonthly, AmountCents: 60000, Since: date("2024-01-01")},
+			asOf: "2024-03-10",
+			want: Status{Start: date("2024-03-01"), End: date("2024-03-31"), AvailableCents: 60000, SpentCents: 20000, RemainingCents: 40000, ProjectedCents: 62000},
+		},
+		{
+			name: "monthly with rollover",
+			b:    storage.Budget{Tag: "groceries", Period: storage.PeriodMonthly, AmountCents: 60000, Rollover: true, Since: date("2024-01-01")},
+			asOf: "2024-03-10",
+			// 10000 left in January and 10000 overspent in February.
+			want: Status{Start: date("2024-03-01"), End: date("2024-03-31"), AvailableCents: 60000, SpentCents: 20000, RemainingCents: 40000, ProjectedCents: 62000},
+		},
+		{
+			name: "rollover since february",
+			b:    storage.Budget{Tag: "groceries", Period: storage.PeriodMonthly, AmountCents: 60000, Rollover: true, Since: date("2024-02-01")},
+			asOf: "2024-03-31",
+			want: Status{Start: date("2024-03-01"), End: date("2024-03-31"), CarriedOverCents: -10000, AvailableCents: 50000, SpentCents: 20000, RemainingCents: 30000, ProjectedCents: 20000},
+		},
+		{
+			name: "quarterly",
+			b:    storage.Budget{Tag: "groceries", Period: storage.PeriodQuarterly, AmountCents: 150000, Since: date("2024-01-01")},
+			asOf: "2024-03-31",
+			want: Status{Start: date("2024-01-01"), End: date("2024-03-31"), AvailableCents: 150000, SpentCents: 140000, RemainingCents: 10000, ProjectedCents: 140000},
+		},
+		{
+			name: "yearly",
+			b:    storage.Budget{Tag: "groceries", Period: storage.PeriodYearly, AmountCents: 500000, Since: date("2024-01-01")},
+			asOf: "2024-03-31",
+			// 91 of the 366 days of 2024 have passed.
+			want: Status{Start: date("2024-01-01"), End: date("2024-12-31"), AvailableCents: 500000, SpentCents: 140000, RemainingCents: 360000, ProjectedCents: 563076},
+		},
+	} {
+		if got := Compute(&tc.b, spending, date(tc.asOf)); got != tc.want {
+			t.Errorf("Compute %v got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTrackedFrom(t *testing.T) {
+	b := storage.Budget{Tag: "groceries", Period: storage.PeriodQuarterly, AmountCents: 1, Since: date("2024-02-15")}
+	if got, want := TrackedFrom(&b, date("2024-08-01")), date("2024-07-01"); !got.Equal(want) {
+		t.Errorf("TrackedFrom without rollover got %v, want %v", got, want)
+	}
+	b.Rollover = true
+	if got, want := TrackedFrom(&b, date("2024-08-01")), date("2024-01-01"); !got.Equal(want) {
+		t.Errorf("TrackedFrom with rollover got %v, want %v", got, want)
+	}
+	if got, want := TrackedFrom(&b, date("2023-12-01")), date("2023-10-01"); !got.Equal(want) {
+		t.Errorf("TrackedFrom before the budget started got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,341 @@
+// Package journal renders transactions as plain text accounting journals
+// for ledger-cli, hledger and beancount.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+type Format string
+
+const (
+	FormatLedger    Format = "ledger"
+	FormatHledger   Format = "hledger"
+	FormatBeancount Format = "beancount"
+
+	ledgerDateFmt    = "2006/01/02"
+	beancountDateFmt = "2006-01-02"
+)
+
+var (
+	ValidFormats = fmt.Sprintf("%v|%v|%v", FormatLedger, FormatHledger, FormatBeancount)
+
+	beancountComponentRegexp = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+	beancountTagRegexp       = regexp.MustCompile(`[^A-Za-z0-9\-_/.]+`)
+	// ledgerTagRegexp matches what ends a tag in a ledger or hledger
+	// comment.
+	ledgerTagRegexp = regexp.MustCompile(`[\s:,]+`)
+
+	// beancountRoots are the account types every beancount account must be
+	// under.
+	beancountRoots = []string{"Assets", "Liabilities", "Equity", "Income", "Expenses"}
+)
+
+func ParseFormat(f string) (Format, error) {
+	switch Format(f) {
+	case FormatLedger, FormatHledger, FormatBeancount:
+		return Format(f), nil
+	}
+	return "", fmt.Errorf("unknown journal format '%v', want %v", f, ValidFormats)
+}
+
+// Mapping maps transaction sources and tags to accounts. A transaction is
+// posted between the account of its source and the account of its first
+// tag that has a mapping. Unmapped sources and tags fall back to
+// accounts named after them under the default parent accounts.
+type Mapping struct {
+	Sources map[string]string `json:"sources,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	// SourceParent is the parent account for unmapped sources.
+	SourceParent string `json:"source_parent,omitempty"`
+	// ExpenseParent and IncomeParent are the parent accounts for unmapped
+	// tags on debits and credits respectively.
+	ExpenseParent string `json:"expense_parent,omitempty"`
+	IncomeParent  string `json:"income_parent,omitempty"`
+	// UncategorizedExpense and UncategorizedIncome are the accounts for
+	// untagged debits and credits respectively.
+	UncategorizedExpense string `json:"uncategorized_expense,omitempty"`
+	UncategorizedIncome  string `json:"uncategorized_income,omitempty"`
+	Currency             string `json:"currency,omitempty"`
+}
+
+func DefaultMapping() *Mapping {
+	m := &Mapping{}
+	m.setDefaults()
+	return m
+}
+
+func (m *Mapping) setDefaults() {
+	if m.SourceParent == "" {
+		m.SourceParent = "Assets"
+	}
+	if m.ExpenseParent == "" {
+		m.ExpenseParent = "Expenses"
+	}
+	if m.IncomeParent == "" {
+		m.IncomeParent = "Income"
+	}
+	if m.UncategorizedExpense == "" {
+		m.UncategorizedExpense = m.ExpenseParent + ":Uncategorized"
+	}
+	if m.UncategorizedIncome == "" {
+		m.UncategorizedIncome = m.IncomeParent + ":Uncategorized"
+	}
+	if m.Currency == "" {
+		m.Currency = "CAD"
+	}
+}
+
+// LoadMapping reads a JSON mapping file. Fields missing in the file are set
+// to the defaults.
+func LoadMapping(path string) (*Mapping, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read journal mapping file: %w", err)
+	}
+	var m Mapping
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("journal mapping file %v was not valid JSON: %w", path, err)
+	}
+	m.setDefaults()
+	return &m, nil
+}
+
+func (m *Mapping) sourceAccount(source string) string {
+	if a, ok := m.Sources[source]; ok {
+		return a
+	}
+	return m.SourceParent + ":" + source
+}
+
+func (m *Mapping) counterAccount(t *storage.Txn) string {
+	for _, tag := range t.Tags {
+		if a, ok := m.Tags[tag]; ok {
+			return a
+		}
+	}
+	credit := t.AmountCents > 0
+	tags := ledgerTags(t.Tags)
+	if len(tags) == 0 {
+		if credit {
+			return m.UncategorizedIncome
+		}
+		return m.UncategorizedExpense
+	}
+	if credit {
+		return m.IncomeParent + ":" + tags[0]
+	}
+	return m.ExpenseParent + ":" + tags[0]
+}
+
+// Writer writes transactions to a journal in a given format. Close must be
+// called once all transactions were written.
+type Writer struct {
+	w       *bufio.Writer
+	format  Format
+	mapping *Mapping
+	// opened tracks the earliest date each account was used on so beancount
+	// open directives can be written when closing.
+	opened map[string]time.Time
+	err    error
+}
+
+// printf writes to the journal and records the first error so writing stops
+// once the underlying writer fails.
+func (jw *Writer) printf(format string, a ...any) {
+	if jw.err != nil {
+		return
+	}
+	_, jw.err = fmt.Fprintf(jw.w, format, a...)
+}
+
+func NewWriter(w io.Writer, format Format, m *Mapping) (*Writer, error) {
+	if _, err := ParseFormat(string(format)); err != nil {
+		return nil, err
+	}
+	var mc Mapping
+	if m != nil {
+		mc = *m
+	}
+	mc.setDefaults()
+	if format == FormatBeancount {
+		if err := mc.checkBeancountRoots(); err != nil {
+			return nil, err
+		}
+	}
+	jw := &Writer{
+		w:       bufio.NewWriter(w),
+		format:  format,
+		mapping: &mc,
+		opened:  map[string]time.Time{},
+	}
+	if format == FormatBeancount {
+		jw.printf("option \"operating_currency\" %v\n\n", beancountString(mc.Currency))
+	}
+	return jw, nil
+}
+
+func formatAmount(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%v%v.%02d %v", sign, cents/100, cents%100, currency)
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func beancountString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(oneLine(s)) + `"`
+}
+
+// beancountAccount makes every component of a start with a capital letter
+// or digit followed by letters, digits or dashes as beancount requires.
+func beancountAccount(a string) string {
+	parts := strings.Split(a, ":")
+	for i, p := range parts {
+		p = strings.Trim(beancountComponentRegexp.ReplaceAllString(p, "-"), "-")
+		if p == "" {
+			p = "Unknown"
+		}
+		parts[i] = strings.ToUpper(p[:1]) + p[1:]
+	}
+	return strings.Join(parts, ":")
+}
+
+// ledgerAccount removes what ends an account name or makes a posting
+// virtual in ledger and hledger, i.e., runs of whitespace, comments and
+// parentheses or brackets around the name.
+func ledgerAccount(a string) string {
+	parts := strings.Split(a, ":")
+	for i, p := range parts {
+		p = oneLine(strings.Trim(strings.ReplaceAll(p, ";", " "), "()[] \t"))
+		if p == "" {
+			p = "Unknown"
+		}
+		parts[i] = p
+	}
+	return strings.Join(parts, ":")
+}
+
+// ledgerTags returns tags with what ends a tag in a ledger or hledger
+// comment replaced by dashes, leaving out tags with nothing else.
+func ledgerTags(tags []string) []string {
+	var result []string
+	for _, tag := range tags {
+		if tag = strings.Trim(ledgerTagRegexp.ReplaceAllString(tag, "-"), "-"); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// checkBeancountRoots returns an error if an account of the mapping isn't
+// under one of the beancount root accounts.
+func (m *Mapping) checkBeancountRoots() error {
+	accounts := []string{m.SourceParent, m.ExpenseParent, m.IncomeParent, m.UncategorizedExpense, m.UncategorizedIncome}
+	for _, a := range m.Sources {
+		accounts = append(accounts, a)
+	}
+	for _, a := range m.Tags {
+		accounts = append(accounts, a)
+	}
+	for _, a := range accounts {
+		if root, _, _ := strings.Cut(beancountAccount(a), ":"); !slices.Contains(beancountRoots, root) {
+			return fmt.Errorf("journal mapping account '%v' must be under one of the beancount root accounts %v", a, strings.Join(beancountRoots, ", "))
+		}
+	}
+	return nil
+}
+
+func (jw *Writer) account(a string, date time.Time) string {
+	if jw.format == FormatBeancount {
+		a = beancountAccount(a)
+	} else {
+		a = ledgerAccount(a)
+	}
+	if d, ok := jw.opened[a]; !ok || date.Before(d) {
+		jw.opened[a] = date
+	}
+	return a
+}
+
+func (jw *Writer) Write(t *storage.Txn) error {
+	src := jw.account(jw.mapping.sourceAccount(t.Source), t.Date)
+	counter := jw.account(jw.mapping.counterAccount(t), t.Date)
+	srcAmount := formatAmount(t.AmountCents, jw.mapping.Currency)
+	counterAmount := formatAmount(-t.AmountCents, jw.mapping.Currency)
+	switch jw.format {
+	case FormatLedger, FormatHledger:
+		dateFmt := ledgerDateFmt
+		if jw.format == FormatHledger {
+			dateFmt = beancountDateFmt
+		}
+		jw.printf("%v %v\n", t.Date.Format(dateFmt), oneLine(t.Description))
+		jw.printf("    ; id: %v\n", t.ID)
+		if tags := ledgerTags(t.Tags); len(tags) > 0 {
+			if jw.format == FormatLedger {
+				jw.printf("    ; :%v:\n", strings.Join(tags, ":"))
+			} else {
+				jw.printf("    ; %v:\n", strings.Join(tags, ":, "))
+			}
+		}
+		if t.Notes != "" {
+			jw.printf("    ; %v\n", oneLine(t.Notes))
+		}
+		jw.printf("    %-50v  %v\n", counter, counterAmount)
+		jw.printf("    %-50v  %v\n\n", src, srcAmount)
+	case FormatBeancount:
+		jw.printf("%v * %v", t.Date.Format(beancountDateFmt), beancountString(t.Description))
+		for _, tag := range t.Tags {
+			if tag = strings.Trim(beancountTagRegexp.ReplaceAllString(tag, "-"), "-"); tag != "" {
+				jw.printf(" #%v", tag)
+			}
+		}
+		jw.printf("\n  id: \"%v\"\n", t.ID)
+		if t.Notes != "" {
+			jw.printf("  notes: %v\n", beancountString(t.Notes))
+		}
+		jw.printf("  %-50v  %v\n", counter, counterAmount)
+		jw.printf("  %-50v  %v\n\n", src, srcAmount)
+	}
+	if jw.err != nil {
+		return fmt.Errorf("error writing journal: %w", jw.err)
+	}
+	return nil
+}
+
+// Close writes any trailing directives and flushes the journal. It doesn't
+// close the underlying writer.
+func (jw *Writer) Close() error {
+	if jw.format == FormatBeancount {
+		var accounts []string
+		for a := range jw.opened {
+			accounts = append(accounts, a)
+		}
+		slices.Sort(accounts)
+		for _, a := range accounts {
+			jw.printf("%v open %v\n", jw.opened[a].Format(beancountDateFmt), a)
+		}
+	}
+	if jw.err != nil {
+		return fmt.Errorf("error writing journal: %w", jw.err)
+	}
+	if err := jw.w.Flush(); err != nil {
+		return fmt.Errorf("error writing journal: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package journal
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+var update = flag.Bool("update", false, "Update the golden journals in testdata.")
+
+func date(s string) time.Time {
+	d, err := time.Parse(beancountDateFmt, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+var testTxns = []storage.Txn{
+	{ID: 1, Date: date("2024-01-02"), Description: "Rent; January", AmountCents: -150000, Source: "RBC  Chequing;main", Tags: []string{"housing"}},
+	{ID: 2, Date: date("2024-01-05"), Description: "Coffee  Shop\tDowntown", AmountCents: -450, Source: "AMEX", Tags: []string{"coffee", "eating out", "a:b,c"}, Notes: "with\nBob"},
+	{ID: 3, Date: date("2024-01-10"), Description: `ACME "Payroll"`, AmountCents: 250000, Source: "RBC  Chequing;main"},
+	{ID: 4, Date: date("2024-01-12"), Description: "Refund", AmountCents: 1200, Source: "(Visa)", Tags: []string{"::", "returns"}},
+}
+
+var testMapping = &Mapping{
+	Sources: map[string]string{"AMEX": "Liabilities:Amex"},
+	Tags:    map[string]string{"housing": "Expenses:Home:Rent"},
+}
+
+func TestWriterGolden(t *testing.T) {
+	for _, format := range []Format{FormatLedger, FormatHledger, FormatBeancount} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			jw, err := NewWriter(&buf, format, testMapping)
+			if err != nil {
+				t.Fatalf("NewWriter got error: %v", err)
+			}
+			for i := range testTxns {
+				if err := jw.Write(&testTxns[i]); err != nil {
+					t.Fatalf("Write got error: %v", err)
+				}
+			}
+			if err := jw.Close(); err != nil {
+				t.Fatalf("Close got error: %v", err)
+			}
+			golden := filepath.Join("testdata", string(format)+".golden")
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatalf("error updating golden journal: %v", err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("error reading golden journal: %v", err)
+			}
+			if got := buf.String(); got != string(want) {
+				t.Errorf("%v journal got:\n%v\nwant:\n%v", format, got, string(want))
+			}
+		})
+	}
+}
+
+func TestNewWriterBeancountRoots(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		m       *Mapping
+		wantErr string
+	}{
+		{name: "default mapping", m: nil},
+		{name: "lower case roots", m: &Mapping{Sources: map[string]string{"RBC": "liabilities:rbc"}}},
+		{
+			name:    "unknown source root",
+			m:       &Mapping{Sources: map[string]string{"RBC": "Bank:RBC"}},
+			wantErr: "journal mapping account 'Bank:RBC' must be under one of the beancount root accounts",
+		},
+		{
+			name:    "unknown parent",
+			m:       &Mapping{ExpenseParent: "Spending"},
+			wantErr: "journal mapping account 'Spending' must be under one of the beancount root accounts",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewWriter(&bytes.Buffer{}, FormatBeancount, tc.m)
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("NewWriter got error: %v", err)
+			} else if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Errorf("NewWriter got error %v, want error containing %q", err, tc.wantErr)
+			}
+			// Ledger and hledger have no fixed root accounts.
+			if _, err := NewWriter(&bytes.Buffer{}, FormatLedger, tc.m); err != nil {
+				t.Errorf("NewWriter for ledger got error: %v", err)
+			}
+		})
+	}
+}
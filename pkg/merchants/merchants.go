@@ -0,0 +1,127 @@
+// Package merchants maps transactions to the merchants they're with, e.g.,
+// "AMZN Mktp CA*2X4" and "AMAZON.CA" to Amazon, by the patterns of the
+// merchants and by description.
+package merchants
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/smukherj1/expenses/pkg/recurring"
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+// DefaultMaxDistance is how far in cosine distance the description
+// embedding of a transaction can be from that of a mapped transaction to
+// map it to the same merchant by default.
+const DefaultMaxDistance = 0.15
+
+// Name returns the name of the merchant of a description matching no
+// merchant, its description without punctuation, case and words with
+// digits. It's empty for descriptions without such words, which have no
+// merchant by name.
+func Name(desc string) string {
+	name := recurring.NormalizeDescription(desc)
+	if rs := []rune(name); len(rs) > storage.MerchantNameLimit {
+		name = strings.TrimSpace(string(rs[:storage.MerchantNameLimit]))
+	}
+	return name
+}
+
+// Matcher matches descriptions against the patterns of merchants.
+type Matcher struct {
+	merchants []storage.Merchant
+	patterns  [][]*regexp.Regexp
+}
+
+// NewMatcher returns a Matcher for the patterns of merchants.
+func NewMatcher(merchants []storage.Merchant) (*Matcher, error) {
+	m := &Matcher{merchants: merchants}
+	for _, mc := range merchants {
+		var patterns []*regexp.Regexp
+		for _, p := range mc.Patterns {
+			re, err := storage.CompileMerchantPattern(p)
+			if err != nil {
+				return nil, err
+			}
+			patterns = append(patterns, re)
+		}
+		m.patterns = append(m.patterns, patterns)
+	}
+	return m, nil
+}
+
+// Match returns the ID of the merchant with the longest, i.e., most
+// specific, pattern matching desc, or false if no pattern does. Ties go to
+// the first merchant.
+func (m *Matcher) Match(desc string) (int64, bool) {
+	var id int64
+	longest := 0
+	for i, patterns := range m.patterns {
+		for j, re := range patterns {
+			if p := m.merchants[i].Patterns[j]; len(p) > longest && re.MatchString(desc) {
+				id, longest = m.merchants[i].ID, len(p)
+			}
+		}
+	}
+	return id, longest > 0
+}
+
+// Plan returns the mappings to set for txns given their current mappings in
+// mapped by transaction ID. Transactions matching the pattern of a merchant
+// are mapped to it unless they were mapped manually. Unmapped transactions
+// matching no pattern are mapped to the merchant with the name of their
+// description, if there's one. Mappings that don't change are left out.
+func Plan(txns []storage.Txn, merchants []storage.Merchant, mapped map[int64]storage.TxnMerchant) ([]storage.TxnMerchant, error) {
+	matcher, err := NewMatcher(merchants)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]int64{}
+	for _, m := range merchants {
+		// Merchants whose name has no words, e.g., "7-11", can't match a
+		// description by name.
+		if name := Name(m.Name); name != "" {
+			if _, ok := byName[name]; !ok {
+				byName[name] = m.ID
+			}
+		}
+	}
+	var result []storage.TxnMerchant
+	for _, t := range txns {
+		current, ok := mapped[t.ID]
+		if ok && current.Source == storage.MappedManually {
+			continue
+		}
+		if id, found := matcher.Match(t.Description); found {
+			if !ok || current.MerchantID != id || current.Source != storage.MappedByPattern {
+				result = append(result, storage.TxnMerchant{TxnID: t.ID, MerchantID: id, Source: storage.MappedByPattern})
+			}
+			continue
+		}
+		if ok {
+			continue
+		}
+		if id, found := byName[Name(t.Description)]; found {
+			result = append(result, storage.TxnMerchant{TxnID: t.ID, MerchantID: id, Source: storage.MappedByDescription})
+		}
+	}
+	return result, nil
+}
+
+// Unmapped groups the transactions among txns without a mapping in mapped
+// by the name of the merchant of their description. Transactions whose
+// description has no name are left out. The transaction IDs of each name
+// are in the order of txns.
+func Unmapped(txns []storage.Txn, mapped map[int64]storage.TxnMerchant) map[string][]int64 {
+	result := map[string][]int64{}
+	for _, t := range txns {
+		if _, ok := mapped[t.ID]; ok {
+			continue
+		}
+		if name := Name(t.Description); name != "" {
+			result[name] = append(result[name], t.ID)
+		}
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+package merchants
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+func TestName(t *testing.T) {
+	for _, tc := range []struct {
+		desc, want string
+	}{
+		{"AMZN Mktp CA*2X4AB1", "AMZN MKTP CA"},
+		{"AMAZON.CA", "AMAZON CA"},
+		{"1234 5678", ""},
+		{"CAFÉ X", "CAFÉ X"},
+		{"Café Crème #42", "CAFÉ CRÈME"},
+		{"東京ガス 0123", "東京ガス"},
+		{"№ 12", ""},
+		{strings.Repeat("É", storage.MerchantNameLimit+1), strings.Repeat("É", storage.MerchantNameLimit)},
+	} {
+		if got := Name(tc.desc); got != tc.want {
+			t.Errorf("Name(%q) got %q, want %q", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	m, err := NewMatcher([]storage.Merchant{
+		{ID: 1, Name: "Amazon", Patterns: []string{`^AMZN`, `^AMAZON`}},
+		{ID: 2, Name: "Amazon Prime", Patterns: []string{`^AMAZON PRIME`}},
+	})
+	if err != nil {
+		t.Fatalf("NewMatcher got error: %v", err)
+	}
+	for _, tc := range []struct {
+		desc   string
+		want   int64
+		wantOK bool
+	}{
+		{"amzn mktp ca*2x4", 1, true},
+		{"AMAZON.CA", 1, true},
+		{"AMAZON PRIME*1A2", 2, true},
+		{"SAFEWAY", 0, false},
+	} {
+		if got, ok := m.Match(tc.desc); got != tc.want || ok != tc.wantOK {
+			t.Errorf("Match(%q) got %v, %v, want %v, %v", tc.desc, got, ok, tc.want, tc.wantOK)
+		}
+	}
+	if _, err := NewMatcher([]storage.Merchant{{Name: "Bad", Patterns: []string{`(`}}}); err == nil {
+		t.Errorf("NewMatcher with invalid pattern got no error")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	merchants := []storage.Merchant{
+		{ID: 1, Name: "Amazon", Patterns: []string{`^AMZN`, `^AMAZON`}},
+		{ID: 2, Name: "Safeway"},
+		{ID: 3, Name: "Bistro"},
+		{ID: 4, Name: "7-11"},
+		{ID: 5, Name: "Café Crème"},
+	}
+	txns := []storage.Txn{
+		{ID: 1, Description: "AMZN Mktp CA*2X4"},
+		{ID: 2, Description: "AMAZON.CA"},
+		{ID: 3, Description: "SAFEWAY #123"},
+		{ID: 4, Description: "AMZN Mktp CA*9Q1"},
+		{ID: 5, Description: "AMAZON GIFT TO BISTRO"},
+		{ID: 6, Description: "BISTRO #12"},
+		{ID: 7, Description: "NEW CAFE"},
+		// Descriptions without a name don't match merchants without one.
+		{ID: 10, Description: "#42 0001"},
+		{ID: 11, Description: "CAFÉ CRÈME 0042"},
+	}
+	mapped := map[int64]storage.TxnMerchant{
+		// Already mapped by the same pattern.
+		1: {TxnID: 1, MerchantID: 1, Source: storage.MappedByPattern},
+		// Patterns take over from embeddings.
+		2: {TxnID: 2, MerchantID: 2, Source: storage.MappedByEmbedding},
+		// Manual mappings are kept.
+		5: {TxnID: 5, MerchantID: 3, Source: storage.MappedManually},
+		// Mapped without a pattern.
+		6: {TxnID: 6, MerchantID: 2, Source: storage.MappedByEmbedding},
+	}
+	got, err := Plan(txns, merchants, mapped)
+	if err != nil {
+		t.Fatalf("Plan got error: %v", err)
+	}
+	want := []storage.TxnMerchant{
+		{TxnID: 2, MerchantID: 1, Source: storage.MappedByPattern},
+		{TxnID: 3, MerchantID: 2, Source: storage.MappedByDescription},
+		{TxnID: 4, MerchantID: 1, Source: storage.MappedByPattern},
+		{TxnID: 11, MerchantID: 5, Source: storage.MappedByDescription},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Plan got %+v, want %+v", got, want)
+	}
+
+	for _, tm := range got {
+		mapped[tm.TxnID] = tm
+	}
+	unmapped := Unmapped(append(txns, storage.Txn{ID: 8, Description: "NEW CAFE #2"}, storage.Txn{ID: 9, Description: "1234"}), mapped)
+	if len(unmapped) != 1 || !slices.Equal(unmapped["NEW CAFE"], []int64{7, 8}) {
+		t.Errorf("Unmapped got %v, want NEW CAFE with txns 7 and 8", unmapped)
+	}
+}
@@ -0,0 +1,236 @@
+// Package recurring detects transactions repeating weekly, monthly or
+// yearly, e.g., subscriptions, and flags charges that are missing or changed
+// amount.
+package recurring
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+const (
+	// DefaultAmountTolerance is how much, as a fraction, the amount of a
+	// charge may differ from the one before it in a series by default.
+	DefaultAmountTolerance = 0.2
+
+	// maxMissedPeriods is how many charges in a row a series can miss before
+	// it's considered stopped.
+	maxMissedPeriods = 3
+)
+
+type period struct {
+	name string
+	// minDays and maxDays bound the days between most charges.
+	minDays, maxDays int
+	// minCharges is how many charges it takes to detect a series.
+	minCharges int
+	// graceDays is how late a charge can be before it's missing.
+	graceDays int
+	next      func(d time.Time) time.Time
+}
+
+var periods = []period{
+	{name: storage.PeriodWeekly, minDays: 6, maxDays: 8, minCharges: 4, graceDays: 3, next: func(d time.Time) time.Time { return d.AddDate(0, 0, 7) }},
+	{name: storage.PeriodMonthly, minDays: 27, maxDays: 34, minCharges: 3, graceDays: 7, next: func(d time.Time) time.Time { return addMonths(d, 1) }},
+	{name: storage.PeriodYearly, minDays: 355, maxDays: 376, minCharges: 2, graceDays: 14, next: func(d time.Time) time.Time { return addMonths(d, 12) }},
+}
+
+// addMonths adds n months to d, keeping the day of the month unless the
+// month is shorter.
+func addMonths(d time.Time, n int) time.Time {
+	y, m, day := d.Date()
+	first := time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	return time.Date(first.Year(), first.Month(), min(day, last), 0, 0, 0, 0, time.UTC)
+}
+
+func days(from, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// isWordRune reports whether r is part of a word in any script, including
+// the marks of scripts like Devanagari that combine with letters.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r)
+}
+
+// NormalizeDescription reduces a transaction description to the words
+// identifying who it's with by dropping punctuation, case and words with
+// digits such as reference numbers.
+func NormalizeDescription(desc string) string {
+	var words []string
+	for _, w := range strings.FieldsFunc(strings.ToUpper(desc), func(r rune) bool { return !isWordRune(r) }) {
+		if strings.IndexFunc(w, unicode.IsNumber) < 0 {
+			words = append(words, w)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Options configure Detect.
+type Options struct {
+	// AmountTolerance is how much, as a fraction, the amount of a charge may
+	// differ from the one before it in a series.
+	AmountTolerance float64
+	// AsOf is the day missing charges are flagged on.
+	AsOf time.Time
+}
+
+// withinTolerance reports whether amount is within tolerance of prev.
+func withinTolerance(amount, prev int64, tolerance float64) bool {
+	return float64(abs(amount-prev)) <= tolerance*float64(abs(prev))
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// chains groups transactions with the same normalized description into
+// chains whose amounts are each within tolerance of the one before. txns
+// must be sorted by date.
+func chains(txns []storage.Txn, tolerance float64) [][]storage.Txn {
+	var result [][]storage.Txn
+	for _, t := range txns {
+		best := -1
+		for i, c := range result {
+			last := c[len(c)-1].AmountCents
+			if !withinTolerance(t.AmountCents, last, tolerance) {
+				continue
+			}
+			if best == -1 || abs(t.AmountCents-last) < abs(t.AmountCents-result[best][len(result[best])-1].AmountCents) {
+				best = i
+			}
+		}
+		if best == -1 {
+			result = append(result, []storage.Txn{t})
+		} else {
+			result[best] = append(result[best], t)
+		}
+	}
+	return result
+}
+
+// periodOf returns the period charges in chain repeat at, if any. At least
+// two thirds of the gaps between charges must fit the period.
+func periodOf(chain []storage.Txn) (period, bool) {
+	if len(chain) < 2 {
+		return period{}, false
+	}
+	var gaps []int
+	for i := 1; i < len(chain); i++ {
+		gaps = append(gaps, days(chain[i-1].Date, chain[i].Date))
+	}
+	sorted := slices.Clone(gaps)
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+	for _, p := range periods {
+		if median < p.minDays || median > p.maxDays || len(chain) < p.minCharges {
+			continue
+		}
+		fit := 0
+		for _, g := range gaps {
+			if g >= p.minDays && g <= p.maxDays {
+				fit++
+			}
+		}
+		return p, fit*3 >= len(gaps)*2
+	}
+	return period{}, false
+}
+
+// series builds the recurring series of chain repeating every p.
+func series(name string, chain []storage.Txn, p period, asOf time.Time) storage.RecurringSeries {
+	last := chain[len(chain)-1]
+	rs := storage.RecurringSeries{
+		ID:          chain[0].ID,
+		Name:        name,
+		Period:      p.name,
+		AmountCents: last.AmountCents,
+		LastDate:    last.Date,
+		NextDate:    p.next(last.Date),
+		Active:      true,
+		Alerts:      []storage.RecurringAlert{},
+	}
+	for _, t := range chain {
+		rs.TxnIDs = append(rs.TxnIDs, t.ID)
+	}
+	// A series charging the same amount at least twice in a row changed
+	// amount when the latest charge is different.
+	if n := len(chain); n >= 3 && chain[n-2].AmountCents == chain[n-3].AmountCents && last.AmountCents != chain[n-2].AmountCents {
+		rs.Alerts = append(rs.Alerts, storage.RecurringAlert{
+			Kind:          storage.AlertAmountChanged,
+			Date:          last.Date,
+			TxnID:         last.ID,
+			ExpectedCents: chain[n-2].AmountCents,
+			AmountCents:   last.AmountCents,
+		})
+	}
+	stopped := rs.NextDate
+	for range maxMissedPeriods - 1 {
+		stopped = p.next(stopped)
+	}
+	switch {
+	case asOf.After(stopped.AddDate(0, 0, p.graceDays)):
+		rs.Active = false
+	case asOf.After(rs.NextDate.AddDate(0, 0, p.graceDays)):
+		rs.Alerts = append(rs.Alerts, storage.RecurringAlert{
+			Kind:          storage.AlertMissing,
+			Date:          rs.NextDate,
+			ExpectedCents: last.AmountCents,
+		})
+	}
+	return rs
+}
+
+// Detect finds the recurring series in txns as of opts.AsOf. Transactions
+// are grouped by normalized description and whether they're debits or
+// credits, then chained by amount. Series are ordered by next expected date.
+func Detect(txns []storage.Txn, opts Options) []storage.RecurringSeries {
+	type key struct {
+		name   string
+		credit bool
+	}
+	groups := map[key][]storage.Txn{}
+	var keys []key
+	for _, t := range txns {
+		name := NormalizeDescription(t.Description)
+		if name == "" || t.AmountCents == 0 {
+			continue
+		}
+		k := key{name, t.AmountCents > 0}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], t)
+	}
+	result := []storage.RecurringSeries{}
+	for _, k := range keys {
+		group := groups[k]
+		slices.SortStableFunc(group, func(a, b storage.Txn) int {
+			if c := a.Date.Compare(b.Date); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.ID, b.ID)
+		})
+		for _, c := range chains(group, opts.AmountTolerance) {
+			if p, ok := periodOf(c); ok {
+				result = append(result, series(k.name, c, p, opts.AsOf))
+			}
+		}
+	}
+	slices.SortFunc(result, func(a, b storage.RecurringSeries) int {
+		if c := a.NextDate.Compare(b.NextDate); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return result
+}
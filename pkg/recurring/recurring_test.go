@@ -0,0 +1,129 @@
+package recurring
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestNormalizeDescription(t *testing.T) {
+	for desc, want := range map[string]string{
+		"NETFLIX.COM 866-579-7172": "NETFLIX COM",
+		"Spotify P1A2B3C4D":        "SPOTIFY",
+		"AMZN Mktp CA*2X4AB1":      "AMZN MKTP CA",
+		"12345":                    "",
+		"CAFÉ X":                   "CAFÉ X",
+		"Müller & Söhne GmbH":      "MÜLLER SÖHNE GMBH",
+		"東京ガス 0123":                "東京ガス",
+		"नेटफ्लिक्स":               "नेटफ्लिक्स",
+		"Лента №45":                "ЛЕНТА",
+		"PAY ٣٤٥":                  "PAY",
+	} {
+		if got := NormalizeDescription(desc); got != want {
+			t.Errorf("NormalizeDescription(%q) = %q, want %q", desc, got, want)
+		}
+	}
+}
+
+func TestAddMonths(t *testing.T) {
+	for _, tc := range []struct {
+		d    string
+		n    int
+		want string
+	}{
+		{d: "2024-01-31", n: 1, want: "2024-02-29"},
+		{d: "2024-02-29", n: 12, want: "2025-02-28"},
+		{d: "2024-12-15", n: 1, want: "2025-01-15"},
+	} {
+		if got := addMonths(date(tc.d), tc.n); !got.Equal(date(tc.want)) {
+			t.Errorf("addMonths(%v, %v) = %v, want %v", tc.d, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	var txns []storage.Txn
+	add := func(d, desc string, amountCents int64) int64 {
+		id := int64(len(txns) + 1)
+		txns = append(txns, storage.Txn{ID: id, Date: date(d), Description: desc, AmountCents: amountCents})
+		return id
+	}
+	// A monthly subscription whose price went up.
+	netflix := add("2024-01-05", "NETFLIX.COM 1111", -1549)
+	add("2024-02-06", "NETFLIX.COM 2222", -1549)
+	add("2024-03-05", "NETFLIX.COM 3333", -1549)
+	netflixHike := add("2024-04-05", "NETFLIX.COM 4444", -1799)
+	// A weekly charge that stopped two weeks ago.
+	for _, d := range []string{"2024-03-15", "2024-03-22", "2024-03-29", "2024-04-05"} {
+		add(d, "CITY PARKING", -1000)
+	}
+	parking := txns[len(txns)-4].ID
+	// A yearly charge long stopped.
+	domain := add("2019-04-20", "DOMAINS INC", -2000)
+	add("2020-04-21", "DOMAINS INC", -2000)
+	// Monthly pay with a raise.
+	pay := add("2024-02-15", "ACME PAYROLL", 500000)
+	add("2024-03-15", "ACME PAYROLL", 500000)
+	add("2024-04-15", "ACME PAYROLL", 510000)
+	// Purchases at the same store with irregular amounts and dates.
+	add("2024-01-02", "SAFEWAY #123", -8000)
+	add("2024-01-20", "SAFEWAY #123", -2500)
+	add("2024-03-30", "SAFEWAY #123", -15000)
+	// The same store without a pattern in the amount.
+	add("2024-02-01", "COFFEE", -500)
+	add("2024-03-01", "COFFEE", -1500)
+	add("2024-04-01", "COFFEE", -5000)
+	// A monthly bill described only in non-Latin letters.
+	gas := add("2024-02-10", "東京ガス", -5000)
+	add("2024-03-11", "東京ガス", -5000)
+	add("2024-04-10", "東京ガス", -5000)
+
+	got := Detect(txns, Options{AmountTolerance: DefaultAmountTolerance, AsOf: date("2024-04-20")})
+	type summary struct {
+		id     int64
+		period string
+		next   string
+		active bool
+		alerts []string
+	}
+	var sums []summary
+	for _, rs := range got {
+		s := summary{id: rs.ID, period: rs.Period, next: rs.NextDate.Format(time.DateOnly), active: rs.Active}
+		for _, a := range rs.Alerts {
+			s.alerts = append(s.alerts, a.Kind)
+		}
+		sums = append(sums, s)
+	}
+	want := []summary{
+		{id: domain, period: storage.PeriodYearly, next: "2021-04-21"},
+		{id: parking, period: storage.PeriodWeekly, next: "2024-04-12", active: true, alerts: []string{storage.AlertMissing}},
+		{id: netflix, period: storage.PeriodMonthly, next: "2024-05-05", active: true, alerts: []string{storage.AlertAmountChanged}},
+		{id: gas, period: storage.PeriodMonthly, next: "2024-05-10", active: true},
+		{id: pay, period: storage.PeriodMonthly, next: "2024-05-15", active: true, alerts: []string{storage.AlertAmountChanged}},
+	}
+	if !slices.EqualFunc(sums, want, func(a, b summary) bool {
+		return a.id == b.id && a.period == b.period && a.next == b.next && a.active == b.active && slices.Equal(a.alerts, b.alerts)
+	}) {
+		t.Fatalf("Detect got %+v, want %+v", sums, want)
+	}
+	hike := got[2].Alerts[0]
+	if hike.TxnID != netflixHike || hike.ExpectedCents != -1549 || hike.AmountCents != -1799 {
+		t.Errorf("Detect got amount change alert %+v, want txn %v from -1549 to -1799 cents", hike, netflixHike)
+	}
+	if missing := got[1].Alerts[0]; !missing.Date.Equal(date("2024-04-12")) || missing.ExpectedCents != -1000 {
+		t.Errorf("Detect got missing alert %+v, want -1000 cents on 2024-04-12", missing)
+	}
+	if n := len(got[2].TxnIDs); n != 4 {
+		t.Errorf("Detect got %v netflix txns, want 4", n)
+	}
+}
@@ -0,0 +1,197 @@
+// Package splits computes what people owe each other for transactions split
+// between them and the payments that settle it.
+package splits
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+// maxExactPeople is the most people with a non-zero balance Settle finds the
+// fewest payments for. It takes time and memory exponential in the number
+// of people so larger groups are settled with up to one payment less than
+// the number of people instead.
+const maxExactPeople = 16
+
+// Payment is money From owes To.
+type Payment struct {
+	From        string
+	To          string
+	AmountCents int64
+}
+
+// Even splits amountCents evenly between people. Cents that can't be split
+// evenly go one each to the first people.
+func Even(amountCents int64, people []string) ([]storage.Share, error) {
+	if len(people) == 0 {
+		return nil, fmt.Errorf("no people to split between")
+	}
+	n := int64(len(people))
+	if abs(amountCents) < n {
+		return nil, fmt.Errorf("amount of %v cents is too small to split between %v people", amountCents, n)
+	}
+	each, rem := amountCents/n, amountCents%n
+	var result []storage.Share
+	for _, p := range people {
+		sh := storage.Share{Person: p, AmountCents: each}
+		if rem > 0 {
+			sh.AmountCents++
+			rem--
+		} else if rem < 0 {
+			sh.AmountCents--
+			rem++
+		}
+		result = append(result, sh)
+	}
+	return result, nil
+}
+
+// Balances returns the balance of every person in the given splits. People
+// with a positive balance are owed money and people with a negative balance
+// owe money. The balances add up to zero.
+func Balances(splits []storage.Split) map[string]int64 {
+	result := map[string]int64{}
+	for i := range splits {
+		Apply(result, &splits[i])
+	}
+	return result
+}
+
+// Apply adds the given split to balances. The payer is owed the amount paid
+// less the part of it the shares don't cover.
+func Apply(balances map[string]int64, s *storage.Split) {
+	remaining := s.AmountCents
+	for _, sh := range s.Shares {
+		balances[sh.Person] += sh.AmountCents
+		remaining -= sh.AmountCents
+	}
+	balances[s.PaidBy] += remaining - s.AmountCents
+}
+
+// Settle returns the fewest payments that bring every balance to zero, with
+// payments ordered by payer and payee.
+func Settle(balances map[string]int64) []Payment {
+	var people []string
+	for p, b := range balances {
+		if b != 0 {
+			people = append(people, p)
+		}
+	}
+	slices.Sort(people)
+	var groups [][]string
+	if len(people) <= maxExactPeople {
+		groups = zeroSumGroups(people, balances)
+	} else {
+		groups = [][]string{people}
+	}
+	var result []Payment
+	for _, g := range groups {
+		result = append(result, settleGroup(g, balances)...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].From != result[j].From {
+			return result[i].From < result[j].From
+		}
+		return result[i].To < result[j].To
+	})
+	return result
+}
+
+// zeroSumGroups partitions people into the most groups whose balances add
+// up to zero. A group of n people is settled with n-1 payments so this
+// minimizes the number of payments.
+func zeroSumGroups(people []string, balances map[string]int64) [][]string {
+	n := len(people)
+	full := 1<<n - 1
+	sums := make([]int64, full+1)
+	// groups[mask] is the most zero-sum groups the people in mask can be
+	// partitioned into, ignoring a trailing group that doesn't add up to
+	// zero.
+	groups := make([]int, full+1)
+	for mask := 1; mask <= full; mask++ {
+		low := mask & -mask
+		i := bitIndex(low)
+		sums[mask] = sums[mask^low] + balances[people[i]]
+		best := 0
+		for rest := mask; rest != 0; rest &= rest - 1 {
+			best = max(best, groups[mask^(rest&-rest)])
+		}
+		if sums[mask] == 0 {
+			best++
+		}
+		groups[mask] = best
+	}
+
+	// Walk back from everyone removing one person at a time along a path
+	// that keeps the most groups. The people removed between two masks
+	// adding up to zero form a group.
+	var result [][]string
+	var group []string
+	for mask := full; mask != 0; {
+		want := groups[mask]
+		if sums[mask] == 0 {
+			want--
+		}
+		for rest := mask; rest != 0; rest &= rest - 1 {
+			bit := rest & -rest
+			if groups[mask^bit] == want {
+				group = append(group, people[bitIndex(bit)])
+				mask ^= bit
+				break
+			}
+		}
+		if sums[mask] == 0 {
+			result = append(result, group)
+			group = nil
+		}
+	}
+	return result
+}
+
+func bitIndex(bit int) int {
+	i := 0
+	for bit > 1 {
+		bit >>= 1
+		i++
+	}
+	return i
+}
+
+// settleGroup settles the balances of people, which add up to zero, with
+// fewer payments than there are people by repeatedly having the person who
+// owes the most pay the person who is owed the most.
+func settleGroup(people []string, balances map[string]int64) []Payment {
+	remaining := map[string]int64{}
+	for _, p := range people {
+		remaining[p] = balances[p]
+	}
+	var result []Payment
+	for {
+		var from, to string
+		for _, p := range people {
+			if remaining[p] < 0 && (from == "" || remaining[p] < remaining[from]) {
+				from = p
+			}
+			if remaining[p] > 0 && (to == "" || remaining[p] > remaining[to]) {
+				to = p
+			}
+		}
+		if from == "" || to == "" {
+			return result
+		}
+		amount := min(-remaining[from], remaining[to])
+		result = append(result, Payment{From: from, To: to, AmountCents: amount})
+		remaining[from] += amount
+		remaining[to] -= amount
+	}
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,118 @@
+package splits
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/smukherj1/expenses/pkg/storage"
+)
+
+func TestEven(t *testing.T) {
+	for _, tc := range []struct {
+		amount  int64
+		people  []string
+		want    []int64
+		wantErr bool
+	}{
+		{amount: -9000, people: []string{"a", "b", "c"}, want: []int64{-3000, -3000, -3000}},
+		{amount: -1000, people: []string{"a", "b", "c"}, want: []int64{-334, -333, -333}},
+		{amount: 1001, people: []string{"a", "b", "c"}, want: []int64{334, 334, 333}},
+		{amount: -2, people: []string{"a", "b", "c"}, wantErr: true},
+		{amount: -100, wantErr: true},
+	} {
+		got, err := Even(tc.amount, tc.people)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Even(%v, %v) got %v, want error", tc.amount, tc.people, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Even(%v, %v) got error: %v", tc.amount, tc.people, err)
+			continue
+		}
+		var amounts []int64
+		for i, sh := range got {
+			if sh.Person != tc.people[i] {
+				t.Errorf("Even(%v, %v) got share %v for %v, want %v", tc.amount, tc.people, i, sh.Person, tc.people[i])
+			}
+			amounts = append(amounts, sh.AmountCents)
+		}
+		if !slices.Equal(amounts, tc.want) {
+			t.Errorf("Even(%v, %v) got amounts %v, want %v", tc.amount, tc.people, amounts, tc.want)
+		}
+	}
+}
+
+func TestBalances(t *testing.T) {
+	got := Balances([]storage.Split{
+		// alice paid 90 for dinner and bob owes half of it.
+		{PaidBy: "alice", AmountCents: -9000, Shares: []storage.Share{{Person: "bob", AmountCents: -4500}}},
+		// bob paid 300 rent split between everyone.
+		{PaidBy: "bob", AmountCents: -30000, Shares: []storage.Share{{Person: "alice", AmountCents: -10000}, {Person: "bob", AmountCents: -10000}, {Person: "carol", AmountCents: -10000}}},
+		// carol paid alice back 20.
+		{PaidBy: "alice", AmountCents: 2000, Shares: []storage.Share{{Person: "carol", AmountCents: 2000}}},
+	})
+	want := map[string]int64{"alice": -7500, "bob": 15500, "carol": -8000}
+	if !maps.Equal(got, want) {
+		t.Errorf("Balances got %v, want %v", got, want)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		balances map[string]int64
+		want     []Payment
+	}{
+		{name: "settled", balances: map[string]int64{"a": 0, "b": 0}},
+		{
+			name:     "one payment",
+			balances: map[string]int64{"a": 500, "b": -500},
+			want:     []Payment{{From: "b", To: "a", AmountCents: 500}},
+		},
+		{
+			name:     "one payee",
+			balances: map[string]int64{"a": 900, "b": -300, "c": -600},
+			want:     []Payment{{From: "b", To: "a", AmountCents: 300}, {From: "c", To: "a", AmountCents: 600}},
+		},
+		{
+			// Settling the largest balances first takes 4 payments while
+			// {a, c, d} and {b, e} settle separately with 3.
+			name:     "independent groups",
+			balances: map[string]int64{"a": 700, "b": 500, "c": -300, "d": -400, "e": -500},
+			want: []Payment{
+				{From: "c", To: "a", AmountCents: 300},
+				{From: "d", To: "a", AmountCents: 400},
+				{From: "e", To: "b", AmountCents: 500},
+			},
+		},
+	} {
+		got := Settle(tc.balances)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("Settle %v got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSettleManyPeople(t *testing.T) {
+	balances := map[string]int64{}
+	for i := range maxExactPeople + 4 {
+		balances[string(rune('a'+i))] = int64(i+1) * 100
+	}
+	balances["payer"] = -(maxExactPeople + 4) * (maxExactPeople + 5) / 2 * 100
+	got := Settle(balances)
+	if len(got) != len(balances)-1 {
+		t.Errorf("Settle got %v payments, want %v", len(got), len(balances)-1)
+	}
+	for _, p := range got {
+		balances[p.From] += p.AmountCents
+		balances[p.To] -= p.AmountCents
+	}
+	for p, b := range balances {
+		if b != 0 {
+			t.Errorf("Settle left %v with balance %v", p, b)
+		}
+	}
+}
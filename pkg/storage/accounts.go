@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// DefaultUser and DefaultHousehold are created by the migrations and own
+	// everything that existed before there were users and households.
+	// Storage, SQLite and Memory are scoped to DefaultHousehold unless they
+	// come from ForHousehold.
+	DefaultUser      int64 = 1
+	DefaultHousehold int64 = 1
+
+	AccountNameLimit = 50
+)
+
+var accountNameRegexp = regexp.MustCompile(`^[\w-]+$`)
+
+type User struct {
+	ID        int64
+	Name      string
+	CreatedAt time.Time
+}
+
+// Household owns transactions along with their attachments and views.
+// Users see the households they're members of.
+type Household struct {
+	ID        int64
+	Name      string
+	CreatedAt time.Time
+}
+
+// Accounts manages the users and households of a database and the API
+// tokens users authenticate with, which aren't scoped to a household.
+type Accounts interface {
+	CreateUser(ctx context.Context, name string) (int64, error)
+	ListUsers(ctx context.Context) ([]User, error)
+	UserByName(ctx context.Context, name string) (User, error)
+
+	CreateHousehold(ctx context.Context, name string) (int64, error)
+	ListHouseholds(ctx context.Context) ([]Household, error)
+	HouseholdByName(ctx context.Context, name string) (Household, error)
+	HouseholdMembers(ctx context.Context, household int64) ([]User, error)
+	AddHouseholdMember(ctx context.Context, household, user int64) error
+	RemoveHouseholdMember(ctx context.Context, household, user int64) error
+	UserHouseholds(ctx context.Context, user int64) ([]Household, error)
+
+	CreateToken(ctx context.Context, t *Token, hash string) (int64, error)
+	ListTokens(ctx context.Context) ([]Token, error)
+	TokenByHash(ctx context.Context, hash string) (Token, error)
+	RevokeToken(ctx context.Context, id int64) error
+}
+
+// Backend is a database holding the data of every household.
+type Backend interface {
+	Accounts
+	// ForHousehold returns the Store of the given household. The household
+	// isn't checked to exist.
+	ForHousehold(household int64) Store
+	// AttachmentDigests returns the blob digests referenced by the
+	// attachments of every household.
+	AttachmentDigests(ctx context.Context) (map[string]bool, error)
+}
+
+var _ Backend = (*Storage)(nil)
+
+func ValidateAccountName(kind, name string) error {
+	if l := len(name); l == 0 || l > AccountNameLimit {
+		return fmt.Errorf("invalid %v name length, got %v, want >0 and <= %v", kind, l, AccountNameLimit)
+	}
+	if !accountNameRegexp.MatchString(name) {
+		return fmt.Errorf("illegal characters in %v name '%v', only alphanumeric, underscores and dashes are allowed", kind, name)
+	}
+	return nil
+}
+
+func scanUser(row interface{ Scan(...any) error }) (User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Name, &u.CreatedAt)
+	return u, err
+}
+
+func scanHousehold(row interface{ Scan(...any) error }) (Household, error) {
+	var h Household
+	err := row.Scan(&h.ID, &h.Name, &h.CreatedAt)
+	return h, err
+}
+
+// scanAll returns every row scanned with scan. kind names the rows in
+// errors.
+func scanAll[T any](rows *sql.Rows, kind string, scan func(row interface{ Scan(...any) error }) (T, error)) ([]T, error) {
+	defer rows.Close()
+	var result []T
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning %v after scanning %v %v: %w", kind, len(result), kind, err)
+		}
+		result = append(result, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying %v: %w", kind, err)
+	}
+	return result, nil
+}
+
+// ForHousehold returns a Storage sharing the database connections of s that
+// only sees the data of the given household.
+func (s *Storage) ForHousehold(household int64) Store {
+	c := *s
+	c.household = household
+	return &c
+}
+
+func isPQErr(err error, code pq.ErrorCode) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == code
+}
+
+func (s *Storage) CreateUser(ctx context.Context, name string) (int64, error) {
+	if err := ValidateAccountName("user", name); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := s.db.QueryRowContext(ctx, `INSERT INTO USERS (NAME) VALUES ($1) RETURNING ID`, name).Scan(&id)
+	if isPQErr(err, pqUniqueViolation) {
+		return 0, fmt.Errorf("%w: user '%v'", ErrAlreadyExists, name)
+	} else if err != nil {
+		return 0, fmt.Errorf("error creating user '%v': %w", name, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT ID, NAME, CREATED_AT FROM USERS ORDER BY ID ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying users: %w", err)
+	}
+	return scanAll(rows, "users", scanUser)
+}
+
+func (s *Storage) UserByName(ctx context.Context, name string) (User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx, `SELECT ID, NAME, CREATED_AT FROM USERS WHERE NAME = $1`, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("%w: user '%v'", ErrNotFound, name)
+	} else if err != nil {
+		return User{}, fmt.Errorf("error fetching user '%v': %w", name, err)
+	}
+	return u, nil
+}
+
+func (s *Storage) CreateHousehold(ctx context.Context, name string) (int64, error) {
+	if err := ValidateAccountName("household", name); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := s.db.QueryRowContext(ctx, `INSERT INTO HOUSEHOLDS (NAME) VALUES ($1) RETURNING ID`, name).Scan(&id)
+	if isPQErr(err, pqUniqueViolation) {
+		return 0, fmt.Errorf("%w: household '%v'", ErrAlreadyExists, name)
+	} else if err != nil {
+		return 0, fmt.Errorf("error creating household '%v': %w", name, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) ListHouseholds(ctx context.Context) ([]Household, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT ID, NAME, CREATED_AT FROM HOUSEHOLDS ORDER BY ID ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying households: %w", err)
+	}
+	return scanAll(rows, "households", scanHousehold)
+}
+
+func (s *Storage) HouseholdByName(ctx context.Context, name string) (Household, error) {
+	h, err := scanHousehold(s.db.QueryRowContext(ctx, `SELECT ID, NAME, CREATED_AT FROM HOUSEHOLDS WHERE NAME = $1`, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Household{}, fmt.Errorf("%w: household '%v'", ErrNotFound, name)
+	} else if err != nil {
+		return Household{}, fmt.Errorf("error fetching household '%v': %w", name, err)
+	}
+	return h, nil
+}
+
+func (s *Storage) HouseholdMembers(ctx context.Context, household int64) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT u.ID, u.NAME, u.CREATED_AT FROM USERS AS u
+		JOIN HOUSEHOLD_MEMBERS AS m ON m.USER_ID = u.ID
+		WHERE m.HOUSEHOLD_ID = $1 ORDER BY u.ID ASC
+	`, household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying members of household %v: %w", household, err)
+	}
+	return scanAll(rows, "users", scanUser)
+}
+
+func (s *Storage) AddHouseholdMember(ctx context.Context, household, user int64) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO HOUSEHOLD_MEMBERS (HOUSEHOLD_ID, USER_ID) VALUES ($1, $2)`, household, user)
+	if isPQErr(err, pqUniqueViolation) {
+		return fmt.Errorf("%w: user %v in household %v", ErrAlreadyExists, user, household)
+	} else if isPQErr(err, pqForeignKeyViolation) {
+		return fmt.Errorf("%w: user %v or household %v", ErrNotFound, user, household)
+	} else if err != nil {
+		return fmt.Errorf("error adding user %v to household %v: %w", user, household, err)
+	}
+	return nil
+}
+
+func (s *Storage) RemoveHouseholdMember(ctx context.Context, household, user int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM HOUSEHOLD_MEMBERS WHERE HOUSEHOLD_ID = $1 AND USER_ID = $2`, household, user)
+	if err != nil {
+		return fmt.Errorf("error removing user %v from household %v: %w", user, household, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify user %v was removed from household %v: %w", user, household, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: user %v in household %v", ErrNotFound, user, household)
+	}
+	return nil
+}
+
+func (s *Storage) UserHouseholds(ctx context.Context, user int64) ([]Household, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT h.ID, h.NAME, h.CREATED_AT FROM HOUSEHOLDS AS h
+		JOIN HOUSEHOLD_MEMBERS AS m ON m.HOUSEHOLD_ID = h.ID
+		WHERE m.USER_ID = $1 ORDER BY h.ID ASC
+	`, user)
+	if err != nil {
+		return nil, fmt.Errorf("error querying households of user %v: %w", user, err)
+	}
+	return scanAll(rows, "households", scanHousehold)
+}
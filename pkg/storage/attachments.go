@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	AttachmentNameLimit        = 255
+	AttachmentContentTypeLimit = 100
+	pqForeignKeyViolation      = "23503"
+
+	// householdTxnIDs selects the IDs of the transactions of the household
+	// given as the last argument of an attachments query.
+	householdTxnIDs = `SELECT ID FROM TRANSACTIONS WHERE HOUSEHOLD_ID = $%v`
+)
+
+type Attachment struct {
+	ID          int64
+	TxnID       int64
+	Name        string
+	ContentType string
+	SizeBytes   int64
+	Digest      string
+	CreatedAt   time.Time
+}
+
+func (a *Attachment) validate() error {
+	if l := len(a.Name); l == 0 || l > AttachmentNameLimit {
+		return fmt.Errorf("invalid attachment name length, got %v, want >0 and <= %v", l, AttachmentNameLimit)
+	}
+	if l := len(a.ContentType); l == 0 || l > AttachmentContentTypeLimit {
+		return fmt.Errorf("invalid attachment content type length, got %v, want >0 and <= %v", l, AttachmentContentTypeLimit)
+	}
+	if a.SizeBytes < 0 {
+		return fmt.Errorf("invalid attachment size, got %v, want >= 0", a.SizeBytes)
+	}
+	if a.Digest == "" {
+		return errors.New("attachment digest was not specified")
+	}
+	return nil
+}
+
+func (s *Storage) CreateAttachment(ctx context.Context, a *Attachment) (int64, error) {
+	if err := a.validate(); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO ATTACHMENTS (TXN_ID, NAME, CONTENT_TYPE, SIZE_BYTES, DIGEST)
+		SELECT $1::BIGINT, $2, $3, $4, $5 WHERE $1::BIGINT IN (`+fmt.Sprintf(householdTxnIDs, 6)+`)
+		RETURNING ID
+	`, a.TxnID, a.Name, a.ContentType, a.SizeBytes, a.Digest, s.household).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) || isPQErr(err, pqForeignKeyViolation) {
+		return 0, fmt.Errorf("%w: txn %v", ErrNotFound, a.TxnID)
+	} else if err != nil {
+		return 0, fmt.Errorf("error creating attachment: %w", err)
+	}
+	return id, nil
+}
+
+func (s *Storage) ListAttachments(ctx context.Context, txnID int64) ([]Attachment, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ID, TXN_ID, NAME, CONTENT_TYPE, SIZE_BYTES, DIGEST, CREATED_AT
+		FROM ATTACHMENTS WHERE TXN_ID = $1 AND TXN_ID IN (`+fmt.Sprintf(householdTxnIDs, 2)+`) ORDER BY ID ASC
+	`, txnID, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying attachments for txn %v: %w", txnID, err)
+	}
+	defer rows.Close()
+	var result []Attachment
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.TxnID, &a.Name, &a.ContentType, &a.SizeBytes, &a.Digest, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning attachment after scanning %v attachments: %w", len(result), err)
+		}
+		result = append(result, a)
+	}
+	return result, nil
+}
+
+func (s *Storage) GetAttachment(ctx context.Context, txnID, id int64) (Attachment, error) {
+	var a Attachment
+	err := s.db.QueryRowContext(ctx, `
+		SELECT ID, TXN_ID, NAME, CONTENT_TYPE, SIZE_BYTES, DIGEST, CREATED_AT
+		FROM ATTACHMENTS WHERE TXN_ID = $1 AND ID = $2 AND TXN_ID IN (`+fmt.Sprintf(householdTxnIDs, 3)+`)
+	`, txnID, id, s.household).Scan(&a.ID, &a.TxnID, &a.Name, &a.ContentType, &a.SizeBytes, &a.Digest, &a.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attachment{}, fmt.Errorf("%w: attachment %v for txn %v", ErrNotFound, id, txnID)
+	} else if err != nil {
+		return Attachment{}, fmt.Errorf("error fetching attachment %v for txn %v: %w", id, txnID, err)
+	}
+	return a, nil
+}
+
+func (s *Storage) AttachmentDigests(ctx context.Context) (map[string]bool, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT DIGEST FROM ATTACHMENTS`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying attachment digests: %w", err)
+	}
+	digests, err := scanAll(rows, "attachment digests", func(row interface{ Scan(...any) error }) (string, error) {
+		var d string
+		err := row.Scan(&d)
+		return d, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]bool{}
+	for _, d := range digests {
+		result[d] = true
+	}
+	return result, nil
+}
+
+// DeleteAttachment deletes the given attachment and returns it along with
+// whether any other attachment still references the same blob digest.
+func (s *Storage) DeleteAttachment(ctx context.Context, txnID, id int64) (Attachment, bool, error) {
+	var a Attachment
+	var digestRefs int64
+	err := s.db.QueryRowContext(ctx, `
+		WITH Deleted AS (
+			DELETE FROM ATTACHMENTS WHERE TXN_ID = $1 AND ID = $2 AND TXN_ID IN (`+fmt.Sprintf(householdTxnIDs, 3)+`)
+			RETURNING ID, TXN_ID, NAME, CONTENT_TYPE, SIZE_BYTES, DIGEST, CREATED_AT
+		)
+		SELECT d.ID, d.TXN_ID, d.NAME, d.CONTENT_TYPE, d.SIZE_BYTES, d.DIGEST, d.CREATED_AT,
+			(SELECT COUNT(*) FROM ATTACHMENTS AS a WHERE a.DIGEST = d.DIGEST AND a.ID <> d.ID)
+		FROM Deleted AS d
+	`, txnID, id, s.household).Scan(&a.ID, &a.TxnID, &a.Name, &a.ContentType, &a.SizeBytes, &a.Digest, &a.CreatedAt, &digestRefs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attachment{}, false, fmt.Errorf("%w: attachment %v for txn %v", ErrNotFound, id, txnID)
+	} else if err != nil {
+		return Attachment{}, false, fmt.Errorf("error deleting attachment %v for txn %v: %w", id, txnID, err)
+	}
+	return a, digestRefs > 0, nil
+}
@@ -0,0 +1,836 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/smukherj1/expenses/pkg/blobstore"
+)
+
+// Backups are gzip compressed JSON lines. The first line is a header with
+// the archive version, followed by one line per row of each table in
+// backupTables order and a footer with the row count and SHA-256 checksum
+// of the rows of every table. Checksums are computed over the JSON encoded
+// row followed by a newline. API tokens and attachment contents aren't
+// backed up.
+
+const (
+	// BackupVersion 2 added users and households, 3 added splits, 4 added
+	// reimbursements, 5 added budgets, 6 added recurring series and 7 added
+	// merchants.
+	BackupVersion = 7
+
+	backupKindHeader = "header"
+	backupKindRow    = "row"
+	backupKindFooter = "footer"
+	backupUsers      = "users"
+	backupHouseholds = "households"
+	backupMembers    = "household_members"
+	backupTxns       = "transactions"
+	backupAtts       = "attachments"
+	backupViews      = "views"
+	backupSplits     = "splits"
+	backupReimbs     = "reimbursements"
+	backupBudgets    = "budgets"
+	backupRecurring  = "recurring_series"
+	backupMerchants  = "merchants"
+	backupTxnMerchs  = "txn_merchants"
+)
+
+var (
+	// backupTables are the tables in a backup in the order they're written
+	// and restored in, which respects foreign keys.
+	backupTables = []string{backupUsers, backupHouseholds, backupMembers, backupTxns, backupAtts, backupViews, backupSplits, backupReimbs, backupBudgets, backupRecurring, backupMerchants, backupTxnMerchs}
+
+	// backupTablesSince are the backup versions tables were added in. Older
+	// backups are restored without them.
+	backupTablesSince = map[string]int{backupUsers: 2, backupHouseholds: 2, backupMembers: 2, backupSplits: 3, backupReimbs: 4, backupBudgets: 5, backupRecurring: 6, backupMerchants: 7, backupTxnMerchs: 7}
+
+	// backupDataTables must be empty to restore a backup. The other tables
+	// have the default user and household created by the migrations.
+	backupDataTables = []string{backupTxns, backupAtts, backupViews, backupSplits, backupReimbs, backupBudgets, backupRecurring, backupMerchants, backupTxnMerchs}
+)
+
+type backupRecord struct {
+	Kind      string                      `json:"kind"`
+	Version   int                         `json:"version,omitempty"`
+	CreatedAt *time.Time                  `json:"created_at,omitempty"`
+	Table     string                      `json:"table,omitempty"`
+	Data      json.RawMessage             `json:"data,omitempty"`
+	Tables    map[string]backupTableStats `json:"tables,omitempty"`
+}
+
+type backupTableStats struct {
+	Rows   int64  `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+type backupUser struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type backupHousehold struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type backupMember struct {
+	HouseholdID int64 `json:"household_id"`
+	UserID      int64 `json:"user_id"`
+}
+
+// backupTxn and backupView have no household in version 1 backups, where
+// everything belongs to the default household.
+type backupTxn struct {
+	ID            int64    `json:"id"`
+	HouseholdID   int64    `json:"household_id,omitempty"`
+	Date          string   `json:"date"`
+	Description   string   `json:"description"`
+	AmountCents   int64    `json:"amount_cents"`
+	Source        string   `json:"source"`
+	Tags          []string `json:"tags,omitempty"`
+	Notes         *string  `json:"notes,omitempty"`
+	DescEmbedding *string  `json:"desc_embedding,omitempty"`
+}
+
+type backupAttachment struct {
+	ID          int64     `json:"id"`
+	TxnID       int64     `json:"txn_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	Digest      string    `json:"digest"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type backupView struct {
+	HouseholdID int64     `json:"household_id,omitempty"`
+	Name        string    `json:"name"`
+	Query       string    `json:"query"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type backupSplit struct {
+	TxnID     int64           `json:"txn_id"`
+	PaidBy    string          `json:"paid_by"`
+	Shares    json.RawMessage `json:"shares"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type backupReimbursement struct {
+	TxnID        int64     `json:"txn_id"`
+	ExpectedFrom string    `json:"expected_from"`
+	CreditTxnID  *int64    `json:"credit_txn_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type backupBudget struct {
+	HouseholdID int64     `json:"household_id"`
+	Tag         string    `json:"tag"`
+	Period      string    `json:"period"`
+	AmountCents int64     `json:"amount_cents"`
+	Rollover    bool      `json:"rollover,omitempty"`
+	Since       string    `json:"since"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type backupRecurringSeries struct {
+	ID          int64           `json:"id"`
+	Name        string          `json:"name"`
+	Period      string          `json:"period"`
+	AmountCents int64           `json:"amount_cents"`
+	TxnIDs      json.RawMessage `json:"txn_ids"`
+	LastDate    string          `json:"last_date"`
+	NextDate    string          `json:"next_date"`
+	Active      bool            `json:"active,omitempty"`
+	Alerts      json.RawMessage `json:"alerts"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+type backupMerchant struct {
+	ID          int64           `json:"id"`
+	HouseholdID int64           `json:"household_id"`
+	Name        string          `json:"name"`
+	Patterns    json.RawMessage `json:"patterns"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type backupTxnMerchant struct {
+	TxnID      int64     `json:"txn_id"`
+	MerchantID int64     `json:"merchant_id"`
+	Source     string    `json:"source"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type tableChecksum struct {
+	rows int64
+	h    hash.Hash
+}
+
+func newTableChecksums() map[string]*tableChecksum {
+	result := map[string]*tableChecksum{}
+	for _, t := range backupTables {
+		result[t] = &tableChecksum{h: sha256.New()}
+	}
+	return result
+}
+
+func (tc *tableChecksum) add(data []byte) {
+	tc.rows++
+	tc.h.Write(data)
+	tc.h.Write([]byte("\n"))
+}
+
+func (tc *tableChecksum) stats() backupTableStats {
+	return backupTableStats{Rows: tc.rows, SHA256: hex.EncodeToString(tc.h.Sum(nil))}
+}
+
+// Backup writes a compressed archive of every table to w. The tables are
+// read from a single snapshot of the database.
+func (s *Storage) Backup(ctx context.Context, w io.Writer) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+
+	bw, err := newBackupWriter(w)
+	if err != nil {
+		return err
+	}
+	writeRow := bw.writeRow
+
+	rows, err := tx.QueryContext(ctx, `SELECT ID, NAME, CREATED_AT FROM USERS ORDER BY ID ASC`)
+	if err != nil {
+		return fmt.Errorf("error querying users: %w", err)
+	}
+	for rows.Next() {
+		var u backupUser
+		if err := rows.Scan(&u.ID, &u.Name, &u.CreatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning user: %w", err)
+		}
+		if err := writeRow(backupUsers, &u); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying users: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT ID, NAME, CREATED_AT FROM HOUSEHOLDS ORDER BY ID ASC`)
+	if err != nil {
+		return fmt.Errorf("error querying households: %w", err)
+	}
+	for rows.Next() {
+		var h backupHousehold
+		if err := rows.Scan(&h.ID, &h.Name, &h.CreatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning household: %w", err)
+		}
+		if err := writeRow(backupHouseholds, &h); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying households: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT HOUSEHOLD_ID, USER_ID FROM HOUSEHOLD_MEMBERS ORDER BY HOUSEHOLD_ID ASC, USER_ID ASC`)
+	if err != nil {
+		return fmt.Errorf("error querying household members: %w", err)
+	}
+	for rows.Next() {
+		var m backupMember
+		if err := rows.Scan(&m.HouseholdID, &m.UserID); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning household member: %w", err)
+		}
+		if err := writeRow(backupMembers, &m); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying household members: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT ID, HOUSEHOLD_ID, DATE, DESCRIPTION, AMOUNT_CENTS, SOURCE, TAGS, NOTES, DESC_EMBEDDING::TEXT
+		FROM TRANSACTIONS ORDER BY ID ASC
+	`)
+	if err != nil {
+		return fmt.Errorf("error querying transactions: %w", err)
+	}
+	for rows.Next() {
+		var t backupTxn
+		var date time.Time
+		if err := rows.Scan(&t.ID, &t.HouseholdID, &date, &t.Description, &t.AmountCents, &t.Source, (*pq.StringArray)(&t.Tags), &t.Notes, &t.DescEmbedding); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning transaction: %w", err)
+		}
+		t.Date = date.Format(dateQueryFmt)
+		if err := writeRow(backupTxns, &t); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying transactions: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT ID, TXN_ID, NAME, CONTENT_TYPE, SIZE_BYTES, DIGEST, CREATED_AT
+		FROM ATTACHMENTS ORDER BY ID ASC
+	`)
+	if err != nil {
+		return fmt.Errorf("error querying attachments: %w", err)
+	}
+	for rows.Next() {
+		var a backupAttachment
+		if err := rows.Scan(&a.ID, &a.TxnID, &a.Name, &a.ContentType, &a.SizeBytes, &a.Digest, &a.CreatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning attachment: %w", err)
+		}
+		if err := writeRow(backupAtts, &a); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying attachments: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT HOUSEHOLD_ID, `+viewColumnsSelected+` FROM VIEWS ORDER BY HOUSEHOLD_ID ASC, NAME ASC`)
+	if err != nil {
+		return fmt.Errorf("error querying views: %w", err)
+	}
+	for rows.Next() {
+		var v backupView
+		if err := rows.Scan(&v.HouseholdID, &v.Name, &v.Query, &v.CreatedAt, &v.UpdatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning view: %w", err)
+		}
+		if err := writeRow(backupViews, &v); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying views: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT TXN_ID, PAID_BY, SHARES, UPDATED_AT FROM SPLITS ORDER BY TXN_ID ASC`)
+	if err != nil {
+		return fmt.Errorf("error querying splits: %w", err)
+	}
+	for rows.Next() {
+		var sp backupSplit
+		if err := rows.Scan(&sp.TxnID, &sp.PaidBy, &sp.Shares, &sp.UpdatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning split: %w", err)
+		}
+		if err := writeRow(backupSplits, &sp); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying splits: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT TXN_ID, EXPECTED_FROM, CREDIT_TXN_ID, CREATED_AT FROM REIMBURSEMENTS ORDER BY TXN_ID ASC`)
+	if err != nil {
+		return fmt.Errorf("error querying reimbursements: %w", err)
+	}
+	for rows.Next() {
+		var rb backupReimbursement
+		if err := rows.Scan(&rb.TxnID, &rb.ExpectedFrom, &rb.CreditTxnID, &rb.CreatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning reimbursement: %w", err)
+		}
+		if err := writeRow(backupReimbs, &rb); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying reimbursements: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT HOUSEHOLD_ID, TAG, PERIOD, AMOUNT_CENTS, ROLLOVER, SINCE, CREATED_AT, UPDATED_AT FROM BUDGETS
+		ORDER BY HOUSEHOLD_ID ASC, TAG ASC, PERIOD ASC
+	`)
+	if err != nil {
+		return fmt.Errorf("error querying budgets: %w", err)
+	}
+	for rows.Next() {
+		var b backupBudget
+		var since time.Time
+		if err := rows.Scan(&b.HouseholdID, &b.Tag, &b.Period, &b.AmountCents, &b.Rollover, &since, &b.CreatedAt, &b.UpdatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning budget: %w", err)
+		}
+		b.Since = since.Format(dateQueryFmt)
+		if err := writeRow(backupBudgets, &b); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying budgets: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT ID, NAME, PERIOD, AMOUNT_CENTS, TXN_IDS, LAST_DATE, NEXT_DATE, ACTIVE, ALERTS, UPDATED_AT FROM RECURRING_SERIES ORDER BY ID ASC
+	`)
+	if err != nil {
+		return fmt.Errorf("error querying recurring series: %w", err)
+	}
+	for rows.Next() {
+		var rs backupRecurringSeries
+		var last, next time.Time
+		if err := rows.Scan(&rs.ID, &rs.Name, &rs.Period, &rs.AmountCents, &rs.TxnIDs, &last, &next, &rs.Active, &rs.Alerts, &rs.UpdatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning recurring series: %w", err)
+		}
+		rs.LastDate, rs.NextDate = last.Format(dateQueryFmt), next.Format(dateQueryFmt)
+		if err := writeRow(backupRecurring, &rs); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying recurring series: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT ID, HOUSEHOLD_ID, NAME, PATTERNS, CREATED_AT FROM MERCHANTS ORDER BY ID ASC`)
+	if err != nil {
+		return fmt.Errorf("error querying merchants: %w", err)
+	}
+	for rows.Next() {
+		var m backupMerchant
+		if err := rows.Scan(&m.ID, &m.HouseholdID, &m.Name, &m.Patterns, &m.CreatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning merchant: %w", err)
+		}
+		if err := writeRow(backupMerchants, &m); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying merchants: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT TXN_ID, MERCHANT_ID, SOURCE, UPDATED_AT FROM TXN_MERCHANTS ORDER BY TXN_ID ASC`)
+	if err != nil {
+		return fmt.Errorf("error querying merchants of transactions: %w", err)
+	}
+	for rows.Next() {
+		var tm backupTxnMerchant
+		if err := rows.Scan(&tm.TxnID, &tm.MerchantID, &tm.Source, &tm.UpdatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning merchant of transaction: %w", err)
+		}
+		if err := writeRow(backupTxnMerchs, &tm); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error querying merchants of transactions: %w", err)
+	}
+
+	return bw.close()
+}
+
+// backupWriter writes the records of a backup archive.
+type backupWriter struct {
+	gw        *gzip.Writer
+	enc       *json.Encoder
+	checksums map[string]*tableChecksum
+}
+
+// newBackupWriter writes the header of a backup archive to w.
+func newBackupWriter(w io.Writer) (*backupWriter, error) {
+	gw := gzip.NewWriter(w)
+	bw := &backupWriter{gw: gw, enc: json.NewEncoder(gw), checksums: newTableChecksums()}
+	now := time.Now().UTC()
+	if err := bw.enc.Encode(&backupRecord{Kind: backupKindHeader, Version: BackupVersion, CreatedAt: &now}); err != nil {
+		return nil, fmt.Errorf("error writing backup header: %w", err)
+	}
+	return bw, nil
+}
+
+func (bw *backupWriter) writeRow(table string, row any) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("error encoding %v row: %w", table, err)
+	}
+	bw.checksums[table].add(data)
+	if err := bw.enc.Encode(&backupRecord{Kind: backupKindRow, Table: table, Data: data}); err != nil {
+		return fmt.Errorf("error writing %v row: %w", table, err)
+	}
+	return nil
+}
+
+// close writes the footer with the checksums of the rows written.
+func (bw *backupWriter) close() error {
+	footer := backupRecord{Kind: backupKindFooter, Tables: map[string]backupTableStats{}}
+	for t, c := range bw.checksums {
+		footer.Tables[t] = c.stats()
+	}
+	if err := bw.enc.Encode(&footer); err != nil {
+		return fmt.Errorf("error writing backup footer: %w", err)
+	}
+	if err := bw.gw.Close(); err != nil {
+		return fmt.Errorf("error finishing compressed backup: %w", err)
+	}
+	return nil
+}
+
+// Restore loads a backup written by Backup into the database, which must
+// not have any transactions or data about them. Users and households in
+// the backup replace the ones with the same IDs. The backup is loaded in a
+// single database transaction that's only committed once the checksums of
+// every table were verified and the contents of every attachment were found
+// in blobs. Backups don't include attachment contents so the attachments
+// directory has to be backed up and restored separately.
+func (s *Storage) Restore(ctx context.Context, r io.Reader, blobs blobstore.Store) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer func() {
+		if tx == nil {
+			return
+		}
+		tx.Rollback()
+	}()
+	for _, t := range backupDataTables {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+t+`)`).Scan(&exists); err != nil {
+			return fmt.Errorf("error checking whether table %v is empty: %w", t, err)
+		} else if exists {
+			return fmt.Errorf("backups can only be restored into an empty database, table %v has rows", t)
+		}
+	}
+
+	digests := map[string]bool{}
+	if err := readBackup(r, func(table string, data []byte) error {
+		if table == backupAtts {
+			var a backupAttachment
+			if err := json.Unmarshal(data, &a); err != nil {
+				return fmt.Errorf("backup had malformed attachment: %w", err)
+			}
+			digests[a.Digest] = true
+		}
+		return restoreRow(ctx, tx, table, data)
+	}); err != nil {
+		return err
+	}
+	if err := checkBlobs(ctx, blobs, digests); err != nil {
+		return err
+	}
+
+	for _, seq := range []string{backupUsers, backupHouseholds, backupTxns, backupAtts, backupMerchants} {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+			`SELECT setval(pg_get_serial_sequence('%v', 'id'), COALESCE(MAX(ID), 1), MAX(ID) IS NOT NULL) FROM %v`,
+			seq, seq)); err != nil {
+			return fmt.Errorf("error resetting ID sequence of table %v: %w", seq, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing restored backup: %w", err)
+	}
+	tx = nil
+	return nil
+}
+
+// readBackup calls fn with the table and data of every row of the backup
+// in r. It returns an error if the backup is malformed, has tables out of
+// order or its rows don't match the checksums in the footer, which is only
+// known once every row was read.
+func readBackup(r io.Reader, fn func(table string, data []byte) error) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("backup was not gzip compressed: %w", err)
+	}
+	defer gr.Close()
+	sc := bufio.NewScanner(gr)
+	// Rows with description embeddings are about 16KB.
+	sc.Buffer(make([]byte, 0, 64<<10), 4<<20)
+	next := func() (*backupRecord, error) {
+		if !sc.Scan() {
+			if err := sc.Err(); err != nil {
+				return nil, fmt.Errorf("error reading backup: %w", err)
+			}
+			return nil, errors.New("backup was truncated, missing footer")
+		}
+		var rec backupRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("backup had malformed record: %w", err)
+		}
+		return &rec, nil
+	}
+
+	header, err := next()
+	if err != nil {
+		return err
+	}
+	if header.Kind != backupKindHeader {
+		return fmt.Errorf("backup didn't start with a header, got record kind '%v'", header.Kind)
+	}
+	if header.Version < 1 || header.Version > BackupVersion {
+		return fmt.Errorf("unsupported backup version, got %v, want >= 1 and <= %v", header.Version, BackupVersion)
+	}
+
+	checksums := newTableChecksums()
+	tableIdx := 0
+	for {
+		rec, err := next()
+		if err != nil {
+			return err
+		}
+		if rec.Kind == backupKindFooter {
+			if err := verifyBackupFooter(header.Version, rec, checksums); err != nil {
+				return err
+			}
+			break
+		}
+		if rec.Kind != backupKindRow {
+			return fmt.Errorf("unexpected backup record kind '%v'", rec.Kind)
+		}
+		for tableIdx < len(backupTables) && backupTables[tableIdx] != rec.Table {
+			tableIdx++
+		}
+		if tableIdx == len(backupTables) {
+			return fmt.Errorf("backup had rows for unknown or out of order table '%v'", rec.Table)
+		}
+		checksums[rec.Table].add(rec.Data)
+		if err := fn(rec.Table, rec.Data); err != nil {
+			return err
+		}
+	}
+	if sc.Scan() {
+		return errors.New("backup had trailing data after the footer")
+	}
+	return nil
+}
+
+// checkBlobs returns an error naming the digests that aren't in blobs.
+func checkBlobs(ctx context.Context, blobs blobstore.Store, digests map[string]bool) error {
+	var missing []string
+	for d := range digests {
+		rc, err := blobs.Get(ctx, d)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			missing = append(missing, d)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error looking up attachment contents %v: %w", d, err)
+		}
+		rc.Close()
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("backup had %v attachments whose contents are missing from the attachments directory, restore it first: %v", len(missing), strings.Join(missing, ", "))
+}
+
+func verifyBackupFooter(version int, footer *backupRecord, checksums map[string]*tableChecksum) error {
+	for _, t := range backupTables {
+		want, ok := footer.Tables[t]
+		if !ok && version < backupTablesSince[t] && checksums[t].rows == 0 {
+			continue
+		}
+		if !ok {
+			return fmt.Errorf("backup footer was missing checksum for table %v", t)
+		}
+		got := checksums[t].stats()
+		if got.Rows != want.Rows {
+			return fmt.Errorf("backup had %v rows for table %v, footer says %v", got.Rows, t, want.Rows)
+		}
+		if got.SHA256 != want.SHA256 {
+			return fmt.Errorf("checksum mismatch for table %v, got %v, want %v", t, got.SHA256, want.SHA256)
+		}
+	}
+	return nil
+}
+
+func restoreRow(ctx context.Context, tx *sql.Tx, table string, data []byte) error {
+	switch table {
+	case backupUsers:
+		var u backupUser
+		if err := json.Unmarshal(data, &u); err != nil {
+			return fmt.Errorf("backup had malformed user: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO USERS (ID, NAME, CREATED_AT) VALUES ($1, $2, $3)
+			ON CONFLICT (ID) DO UPDATE SET NAME = EXCLUDED.NAME, CREATED_AT = EXCLUDED.CREATED_AT
+		`, u.ID, u.Name, u.CreatedAt); err != nil {
+			return fmt.Errorf("error restoring user %v: %w", u.ID, err)
+		}
+	case backupHouseholds:
+		var h backupHousehold
+		if err := json.Unmarshal(data, &h); err != nil {
+			return fmt.Errorf("backup had malformed household: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO HOUSEHOLDS (ID, NAME, CREATED_AT) VALUES ($1, $2, $3)
+			ON CONFLICT (ID) DO UPDATE SET NAME = EXCLUDED.NAME, CREATED_AT = EXCLUDED.CREATED_AT
+		`, h.ID, h.Name, h.CreatedAt); err != nil {
+			return fmt.Errorf("error restoring household %v: %w", h.ID, err)
+		}
+	case backupMembers:
+		var m backupMember
+		if err := json.Unmarshal(data, &m); err != nil {
+			return fmt.Errorf("backup had malformed household member: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO HOUSEHOLD_MEMBERS (HOUSEHOLD_ID, USER_ID) VALUES ($1, $2) ON CONFLICT DO NOTHING
+		`, m.HouseholdID, m.UserID); err != nil {
+			return fmt.Errorf("error restoring user %v in household %v: %w", m.UserID, m.HouseholdID, err)
+		}
+	case backupTxns:
+		var t backupTxn
+		if err := json.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("backup had malformed transaction: %w", err)
+		}
+		var tags any
+		if t.Tags != nil {
+			tags = pq.Array(t.Tags)
+		}
+		if t.HouseholdID == 0 {
+			t.HouseholdID = DefaultHousehold
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO TRANSACTIONS (ID, HOUSEHOLD_ID, DATE, DESCRIPTION, AMOUNT_CENTS, SOURCE, TAGS, NOTES, DESC_EMBEDDING)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, t.ID, t.HouseholdID, t.Date, t.Description, t.AmountCents, t.Source, tags, t.Notes, t.DescEmbedding); err != nil {
+			return fmt.Errorf("error restoring transaction %v: %w", t.ID, err)
+		}
+	case backupAtts:
+		var a backupAttachment
+		if err := json.Unmarshal(data, &a); err != nil {
+			return fmt.Errorf("backup had malformed attachment: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO ATTACHMENTS (ID, TXN_ID, NAME, CONTENT_TYPE, SIZE_BYTES, DIGEST, CREATED_AT)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, a.ID, a.TxnID, a.Name, a.ContentType, a.SizeBytes, a.Digest, a.CreatedAt); err != nil {
+			return fmt.Errorf("error restoring attachment %v: %w", a.ID, err)
+		}
+	case backupViews:
+		var v backupView
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("backup had malformed view: %w", err)
+		}
+		if v.HouseholdID == 0 {
+			v.HouseholdID = DefaultHousehold
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO VIEWS (HOUSEHOLD_ID, NAME, QUERY, CREATED_AT, UPDATED_AT) VALUES ($1, $2, $3, $4, $5)
+		`, v.HouseholdID, v.Name, v.Query, v.CreatedAt, v.UpdatedAt); err != nil {
+			return fmt.Errorf("error restoring view '%v': %w", v.Name, err)
+		}
+	case backupSplits:
+		var sp backupSplit
+		if err := json.Unmarshal(data, &sp); err != nil {
+			return fmt.Errorf("backup had malformed split: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO SPLITS (TXN_ID, PAID_BY, SHARES, UPDATED_AT) VALUES ($1, $2, $3, $4)
+		`, sp.TxnID, sp.PaidBy, []byte(sp.Shares), sp.UpdatedAt); err != nil {
+			return fmt.Errorf("error restoring split of transaction %v: %w", sp.TxnID, err)
+		}
+	case backupReimbs:
+		var rb backupReimbursement
+		if err := json.Unmarshal(data, &rb); err != nil {
+			return fmt.Errorf("backup had malformed reimbursement: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO REIMBURSEMENTS (TXN_ID, EXPECTED_FROM, CREDIT_TXN_ID, CREATED_AT) VALUES ($1, $2, $3, $4)
+		`, rb.TxnID, rb.ExpectedFrom, rb.CreditTxnID, rb.CreatedAt); err != nil {
+			return fmt.Errorf("error restoring reimbursement of transaction %v: %w", rb.TxnID, err)
+		}
+	case backupBudgets:
+		var b backupBudget
+		if err := json.Unmarshal(data, &b); err != nil {
+			return fmt.Errorf("backup had malformed budget: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO BUDGETS (HOUSEHOLD_ID, TAG, PERIOD, AMOUNT_CENTS, ROLLOVER, SINCE, CREATED_AT, UPDATED_AT) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, b.HouseholdID, b.Tag, b.Period, b.AmountCents, b.Rollover, b.Since, b.CreatedAt, b.UpdatedAt); err != nil {
+			return fmt.Errorf("error restoring %v budget for tag '%v': %w", b.Period, b.Tag, err)
+		}
+	case backupRecurring:
+		var rs backupRecurringSeries
+		if err := json.Unmarshal(data, &rs); err != nil {
+			return fmt.Errorf("backup had malformed recurring series: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO RECURRING_SERIES (ID, NAME, PERIOD, AMOUNT_CENTS, TXN_IDS, LAST_DATE, NEXT_DATE, ACTIVE, ALERTS, UPDATED_AT)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`, rs.ID, rs.Name, rs.Period, rs.AmountCents, []byte(rs.TxnIDs), rs.LastDate, rs.NextDate, rs.Active, []byte(rs.Alerts), rs.UpdatedAt); err != nil {
+			return fmt.Errorf("error restoring recurring series %v: %w", rs.ID, err)
+		}
+	case backupMerchants:
+		var m backupMerchant
+		if err := json.Unmarshal(data, &m); err != nil {
+			return fmt.Errorf("backup had malformed merchant: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO MERCHANTS (ID, HOUSEHOLD_ID, NAME, PATTERNS, CREATED_AT) VALUES ($1, $2, $3, $4, $5)
+		`, m.ID, m.HouseholdID, m.Name, []byte(m.Patterns), m.CreatedAt); err != nil {
+			return fmt.Errorf("error restoring merchant %v: %w", m.ID, err)
+		}
+	case backupTxnMerchs:
+		var tm backupTxnMerchant
+		if err := json.Unmarshal(data, &tm); err != nil {
+			return fmt.Errorf("backup had malformed merchant of transaction: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO TXN_MERCHANTS (TXN_ID, MERCHANT_ID, SOURCE, UPDATED_AT) VALUES ($1, $2, $3, $4)
+		`, tm.TxnID, tm.MerchantID, tm.Source, tm.UpdatedAt); err != nil {
+			return fmt.Errorf("error restoring merchant of transaction %v: %w", tm.TxnID, err)
+		}
+	default:
+		return fmt.Errorf("backup had rows for unknown table '%v'", table)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/smukherj1/expenses/pkg/blobstore"
+)
+
+type testBackupRow struct {
+	table string
+	data  string
+}
+
+func writeTestBackup(t *testing.T, rows []testBackupRow) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	bw, err := newBackupWriter(&buf)
+	if err != nil {
+		t.Fatalf("newBackupWriter got error: %v", err)
+	}
+	for _, r := range rows {
+		if err := bw.writeRow(r.table, json.RawMessage(r.data)); err != nil {
+			t.Fatalf("writeRow(%v) got error: %v", r.table, err)
+		}
+	}
+	if err := bw.close(); err != nil {
+		t.Fatalf("close got error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// editTestBackup returns the backup with its uncompressed lines replaced by
+// edit's.
+func editTestBackup(t *testing.T, backup []byte, edit func(lines []string) []string) []byte {
+	t.Helper()
+	gr, err := gzip.NewReader(bytes.NewReader(backup))
+	if err != nil {
+		t.Fatalf("gzip.NewReader got error: %v", err)
+	}
+	data, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatalf("error decompressing backup: %v", err)
+	}
+	lines := edit(strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	gw.Close()
+	return buf.Bytes()
+}
+
+func readTestBackup(backup []byte) ([]testBackupRow, error) {
+	var got []testBackupRow
+	err := readBackup(bytes.NewReader(backup), func(table string, data []byte) error {
+		got = append(got, testBackupRow{table: table, data: string(data)})
+		return nil
+	})
+	return got, err
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	rows := []testBackupRow{
+		{backupUsers, `{"id":1,"name":"default","created_at":"2024-01-01T00:00:00Z"}`},
+		{backupTxns, `{"id":1,"date":"2024/03/01","description":"Coffee","amount_cents":-450,"source":"card"}`},
+		{backupTxns, `{"id":2,"date":"2024/03/02","description":"Books","amount_cents":-2000,"source":"card","tags":["books"]}`},
+		{backupAtts, `{"id":1,"txn_id":2,"name":"receipt.pdf","content_type":"application/pdf","size_bytes":3,"digest":"abc","created_at":"2024-03-02T00:00:00Z"}`},
+		{backupTxnMerchs, `{"txn_id":1,"merchant_id":1,"source":"manual","updated_at":"2024-03-02T00:00:00Z"}`},
+	}
+	backup := writeTestBackup(t, rows)
+	got, err := readTestBackup(backup)
+	if err != nil {
+		t.Fatalf("readBackup got error: %v", err)
+	}
+	if !slices.Equal(got, rows) {
+		t.Errorf("readBackup got rows %v, want %v", got, rows)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		edit    func(lines []string) []string
+		wantErr string
+	}{
+		{
+			name:    "truncated",
+			edit:    func(lines []string) []string { return lines[:len(lines)-1] },
+			wantErr: "backup was truncated, missing footer",
+		},
+		{
+			name: "modified row",
+			edit: func(lines []string) []string {
+				lines[2] = strings.Replace(lines[2], "Coffee", "Tea", 1)
+				return lines
+			},
+			wantErr: "checksum mismatch for table transactions",
+		},
+		{
+			name: "missing row",
+			edit: func(lines []string) []string {
+				return slices.Delete(lines, 3, 4)
+			},
+			wantErr: "backup had 1 rows for table transactions, footer says 2",
+		},
+		{
+			name: "tables out of order",
+			edit: func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			wantErr: "backup had rows for unknown or out of order table 'users'",
+		},
+		{
+			name: "trailing data",
+			edit: func(lines []string) []string {
+				return append(lines, lines[1])
+			},
+			wantErr: "backup had trailing data after the footer",
+		},
+		{
+			name: "newer version",
+			edit: func(lines []string) []string {
+				lines[0] = `{"kind":"header","version":1000}`
+				return lines
+			},
+			wantErr: "unsupported backup version, got 1000",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readTestBackup(editTestBackup(t, backup, tc.edit))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("readBackup got error %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackupOlderVersion(t *testing.T) {
+	// Version 1 backups have no users, households or later tables in their
+	// footer.
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gw)
+	enc.Encode(&backupRecord{Kind: backupKindHeader, Version: 1})
+	row := []byte(`{"id":1,"date":"2024/03/01","description":"Coffee","amount_cents":-450,"source":"card"}`)
+	enc.Encode(&backupRecord{Kind: backupKindRow, Table: backupTxns, Data: row})
+	checksums := newTableChecksums()
+	checksums[backupTxns].add(row)
+	footer := backupRecord{Kind: backupKindFooter, Tables: map[string]backupTableStats{}}
+	for _, t := range []string{backupTxns, backupAtts, backupViews} {
+		footer.Tables[t] = checksums[t].stats()
+	}
+	enc.Encode(&footer)
+	gw.Close()
+
+	got, err := readTestBackup(buf.Bytes())
+	if err != nil {
+		t.Fatalf("readBackup got error: %v", err)
+	}
+	if want := []testBackupRow{{backupTxns, string(row)}}; !slices.Equal(got, want) {
+		t.Errorf("readBackup got rows %v, want %v", got, want)
+	}
+}
+
+func TestCheckBlobs(t *testing.T) {
+	ctx := context.Background()
+	blobs, err := blobstore.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocal got error: %v", err)
+	}
+	stored, _, err := blobs.Put(ctx, strings.NewReader("receipt"))
+	if err != nil {
+		t.Fatalf("Put got error: %v", err)
+	}
+	if err := checkBlobs(ctx, blobs, map[string]bool{stored: true}); err != nil {
+		t.Errorf("checkBlobs got error %v for stored blob", err)
+	}
+	missing := strings.Repeat("0", 64)
+	err = checkBlobs(ctx, blobs, map[string]bool{stored: true, missing: true})
+	if want := "backup had 1 attachments whose contents are missing from the attachments directory, restore it first: " + missing; err == nil || err.Error() != want {
+		t.Errorf("checkBlobs got error %v, want %q", err, want)
+	}
+}
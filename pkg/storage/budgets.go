@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	PeriodMonthly   = "monthly"
+	PeriodQuarterly = "quarterly"
+	PeriodYearly    = "yearly"
+
+	budgetColumnsSelected = "TAG, PERIOD, AMOUNT_CENTS, ROLLOVER, SINCE, CREATED_AT, UPDATED_AT"
+)
+
+var ValidPeriods = fmt.Sprintf("%v|%v|%v", PeriodMonthly, PeriodQuarterly, PeriodYearly)
+
+// Budget limits spending on a tag in every period. With Rollover, what's
+// left of or overspent in the budget of the periods since Since carries
+// over to the next period.
+type Budget struct {
+	Tag         string
+	Period      string
+	AmountCents int64
+	Rollover    bool
+	// Since is the first day of the first period of the budget.
+	Since     time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TagSpending is the amount spent on a tag in the month starting on Month.
+// Debits count as spending and credits, e.g., refunds, reduce it.
+type TagSpending struct {
+	Tag        string
+	Month      time.Time
+	SpentCents int64
+}
+
+func ValidatePeriod(period string) error {
+	switch period {
+	case PeriodMonthly, PeriodQuarterly, PeriodYearly:
+		return nil
+	}
+	return fmt.Errorf("invalid budget period '%v', want %v", period, ValidPeriods)
+}
+
+func (b *Budget) validate() error {
+	if err := ValidateTags([]string{b.Tag}); err != nil {
+		return err
+	}
+	if err := ValidatePeriod(b.Period); err != nil {
+		return err
+	}
+	if b.AmountCents <= 0 {
+		return fmt.Errorf("invalid budget amount, got %v cents, want > 0", b.AmountCents)
+	}
+	if b.Since.IsZero() {
+		return errors.New("start of budget was not specified")
+	}
+	return nil
+}
+
+func scanBudget(row interface{ Scan(...any) error }) (Budget, error) {
+	var b Budget
+	err := row.Scan(&b.Tag, &b.Period, &b.AmountCents, &b.Rollover, &b.Since, &b.CreatedAt, &b.UpdatedAt)
+	return b, err
+}
+
+// SetBudget creates or replaces the budget for a tag and period.
+func (s *Storage) SetBudget(ctx context.Context, b *Budget) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO BUDGETS (HOUSEHOLD_ID, TAG, PERIOD, AMOUNT_CENTS, ROLLOVER, SINCE) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (HOUSEHOLD_ID, TAG, PERIOD) DO UPDATE SET
+			AMOUNT_CENTS = EXCLUDED.AMOUNT_CENTS, ROLLOVER = EXCLUDED.ROLLOVER, SINCE = EXCLUDED.SINCE, UPDATED_AT = NOW()
+	`, s.household, b.Tag, b.Period, b.AmountCents, b.Rollover, b.Since.Format(dateQueryFmt)); err != nil {
+		return fmt.Errorf("error setting %v budget for tag '%v': %w", b.Period, b.Tag, err)
+	}
+	return nil
+}
+
+func (s *Storage) ListBudgets(ctx context.Context) ([]Budget, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+budgetColumnsSelected+` FROM BUDGETS WHERE HOUSEHOLD_ID = $1 ORDER BY TAG ASC, PERIOD ASC`, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying budgets: %w", err)
+	}
+	return scanAll(rows, "budgets", scanBudget)
+}
+
+func (s *Storage) GetBudget(ctx context.Context, tag, period string) (Budget, error) {
+	b, err := scanBudget(s.db.QueryRowContext(ctx, `
+		SELECT `+budgetColumnsSelected+` FROM BUDGETS WHERE HOUSEHOLD_ID = $1 AND TAG = $2 AND PERIOD = $3
+	`, s.household, tag, period))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Budget{}, fmt.Errorf("%w: %v budget for tag '%v'", ErrNotFound, period, tag)
+	} else if err != nil {
+		return Budget{}, fmt.Errorf("error fetching %v budget for tag '%v': %w", period, tag, err)
+	}
+	return b, nil
+}
+
+func (s *Storage) DeleteBudget(ctx context.Context, tag, period string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM BUDGETS WHERE HOUSEHOLD_ID = $1 AND TAG = $2 AND PERIOD = $3`, s.household, tag, period)
+	if err != nil {
+		return fmt.Errorf("error deleting %v budget for tag '%v': %w", period, tag, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify %v budget for tag '%v' was deleted: %w", period, tag, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: %v budget for tag '%v'", ErrNotFound, period, tag)
+	}
+	return nil
+}
+
+// SpendingByTagMonth returns the spending on each of the given tags by
+// month for the transactions dated from from up to to, net of
+// reimbursements. Months without transactions with a tag are left out.
+func (s *Storage) SpendingByTagMonth(ctx context.Context, tags []string, from, to time.Time) ([]TagSpending, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT TAG, DATE_TRUNC('month', DATE)::DATE AS MONTH, SUM(-AMOUNT_CENTS)
+		FROM NET_TRANSACTIONS, UNNEST(TAGS) AS TAG
+		WHERE HOUSEHOLD_ID = $1 AND DATE >= $2 AND DATE <= $3 AND TAG = ANY($4)
+		GROUP BY TAG, MONTH
+		ORDER BY TAG ASC, MONTH ASC
+	`, s.household, from.Format(dateQueryFmt), to.Format(dateQueryFmt), pq.Array(tags))
+	if err != nil {
+		return nil, fmt.Errorf("error querying spending by tag: %w", err)
+	}
+	return scanAll(rows, "tag spending", func(row interface{ Scan(...any) error }) (TagSpending, error) {
+		var ts TagSpending
+		err := row.Scan(&ts.Tag, &ts.Month, &ts.SpentCents)
+		return ts, err
+	})
+}
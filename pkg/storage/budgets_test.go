@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// testBudgets tests setting, reading and deleting budgets and the spending
+// on tags they're tracked against. s must not have any transactions or
+// budgets.
+func testBudgets(t *testing.T, s Store) {
+	ctx := context.Background()
+	createTxns(t, s, []Txn{
+		{Date: date("2024-01-03"), Description: "SAFEWAY", AmountCents: -12000, Source: "AMEX", Tags: []string{"groceries"}},
+		{Date: date("2024-01-20"), Description: "SAFEWAY REFUND", AmountCents: 2000, Source: "AMEX", Tags: []string{"groceries"}},
+		{Date: date("2024-02-10"), Description: "COSTCO", AmountCents: -30000, Source: "AMEX", Tags: []string{"groceries", "bulk"}},
+		{Date: date("2024-02-11"), Description: "CINEMA", AmountCents: -2500, Source: "AMEX", Tags: []string{"fun"}},
+		{Date: date("2024-03-01"), Description: "SAFEWAY", AmountCents: -5000, Source: "AMEX", Tags: []string{"groceries"}},
+	})
+
+	for _, tc := range []struct {
+		name string
+		b    Budget
+	}{
+		{name: "invalid tag", b: Budget{Tag: "a,b", Period: PeriodMonthly, AmountCents: 100, Since: date("2024-01-01")}},
+		{name: "invalid period", b: Budget{Tag: "groceries", Period: "weekly", AmountCents: 100, Since: date("2024-01-01")}},
+		{name: "zero amount", b: Budget{Tag: "groceries", Period: PeriodMonthly, Since: date("2024-01-01")}},
+		{name: "no start", b: Budget{Tag: "groceries", Period: PeriodMonthly, AmountCents: 100}},
+	} {
+		if err := s.SetBudget(ctx, &tc.b); err == nil {
+			t.Errorf("SetBudget %v got no error, want error", tc.name)
+		}
+	}
+	groceries := Budget{Tag: "groceries", Period: PeriodMonthly, AmountCents: 60000, Since: date("2024-01-01")}
+	if err := s.SetBudget(ctx, &groceries); err != nil {
+		t.Fatalf("SetBudget got error: %v", err)
+	}
+	if err := s.SetBudget(ctx, &Budget{Tag: "fun", Period: PeriodYearly, AmountCents: 100000, Since: date("2024-01-01")}); err != nil {
+		t.Fatalf("SetBudget got error: %v", err)
+	}
+	groceries.AmountCents, groceries.Rollover = 50000, true
+	if err := s.SetBudget(ctx, &groceries); err != nil {
+		t.Fatalf("SetBudget replacing budget got error: %v", err)
+	}
+	got, err := s.GetBudget(ctx, "groceries", PeriodMonthly)
+	if err != nil {
+		t.Fatalf("GetBudget got error: %v", err)
+	}
+	if got.AmountCents != 50000 || !got.Rollover || !got.Since.Equal(date("2024-01-01")) {
+		t.Errorf("GetBudget got %+v, want amount 50000 cents with rollover since 2024-01-01", got)
+	}
+	if _, err := s.GetBudget(ctx, "groceries", PeriodYearly); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetBudget of missing budget got error %v, want %v", err, ErrNotFound)
+	}
+	budgets, err := s.ListBudgets(ctx)
+	if err != nil {
+		t.Fatalf("ListBudgets got error: %v", err)
+	}
+	var tags []string
+	for _, b := range budgets {
+		tags = append(tags, b.Tag)
+	}
+	if want := []string{"fun", "groceries"}; !slices.Equal(tags, want) {
+		t.Errorf("ListBudgets got tags %v, want %v", tags, want)
+	}
+
+	spending, err := s.SpendingByTagMonth(ctx, []string{"groceries", "fun"}, date("2024-01-01"), date("2024-02-29"))
+	if err != nil {
+		t.Fatalf("SpendingByTagMonth got error: %v", err)
+	}
+	want := []TagSpending{
+		{Tag: "fun", Month: date("2024-02-01"), SpentCents: 2500},
+		{Tag: "groceries", Month: date("2024-01-01"), SpentCents: 10000},
+		{Tag: "groceries", Month: date("2024-02-01"), SpentCents: 30000},
+	}
+	if !slices.EqualFunc(spending, want, func(a, b TagSpending) bool {
+		return a.Tag == b.Tag && a.Month.Equal(b.Month) && a.SpentCents == b.SpentCents
+	}) {
+		t.Errorf("SpendingByTagMonth got %+v, want %+v", spending, want)
+	}
+
+	if err := s.DeleteBudget(ctx, "fun", PeriodYearly); err != nil {
+		t.Fatalf("DeleteBudget got error: %v", err)
+	}
+	if err := s.DeleteBudget(ctx, "fun", PeriodYearly); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteBudget twice got error %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Config configures the database. Connection settings given individually
+// override the same settings in DSN.
+type Config struct {
+	// Driver selects postgres or a local SQLite database in SQLiteFile. Only
+	// SQLiteFile applies to SQLite.
+	Driver     string
+	SQLiteFile string
+
+	// DSN is a lib/pq key=value connection string or postgres:// URL.
+	DSN          string
+	Host         string
+	Port         int
+	User         string
+	Password     string
+	PasswordFile string
+	DBName       string
+	SSLMode      string
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// ConnectRetries is the number of times connecting to the database is
+	// retried on startup. The wait between attempts starts at ConnectBackoff
+	// and doubles up to ConnectMaxBackoff.
+	ConnectRetries    int
+	ConnectBackoff    time.Duration
+	ConnectMaxBackoff time.Duration
+}
+
+const (
+	// ConfigEnvPrefix prefixes the environment variables for config keys,
+	// e.g. TXNS_DB_MAX_OPEN_CONNS for max-open-conns.
+	ConfigEnvPrefix = "TXNS_DB_"
+
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+
+	defaultDSN = "host=db port=5432 user=postgres dbname=postgres sslmode=disable"
+)
+
+var validSSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// ConfigKey is a setting that can be set by name from flags, environment
+// variables and config files.
+type ConfigKey struct {
+	Name  string
+	Usage string
+	set   func(c *Config, v string) error
+}
+
+func stringKey(name, usage string, field func(c *Config) *string) ConfigKey {
+	return ConfigKey{Name: name, Usage: usage, set: func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}}
+}
+
+func intKey(name, usage string, field func(c *Config) *int) ConfigKey {
+	return ConfigKey{Name: name, Usage: usage, set: func(c *Config, v string) error {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			return fmt.Errorf("invalid value '%v', want non-negative integer", v)
+		}
+		*field(c) = i
+		return nil
+	}}
+}
+
+func durationKey(name, usage string, field func(c *Config) *time.Duration) ConfigKey {
+	return ConfigKey{Name: name, Usage: usage, set: func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid value '%v', want non-negative duration like 30s", v)
+		}
+		*field(c) = d
+		return nil
+	}}
+}
+
+// ConfigKeys lists the settings of Config by name.
+var ConfigKeys = []ConfigKey{
+	{Name: "driver", Usage: fmt.Sprintf("Database driver, one of %v|%v.", DriverPostgres, DriverSQLite), set: func(c *Config, v string) error {
+		if v != DriverPostgres && v != DriverSQLite {
+			return fmt.Errorf("invalid value '%v', want %v|%v", v, DriverPostgres, DriverSQLite)
+		}
+		c.Driver = v
+		return nil
+	}},
+	stringKey("sqlite-file", "SQLite database file used by the sqlite driver.", func(c *Config) *string { return &c.SQLiteFile }),
+	stringKey("dsn", "Postgres connection string or postgres:// URL.", func(c *Config) *string { return &c.DSN }),
+	stringKey("host", "Postgres host.", func(c *Config) *string { return &c.Host }),
+	intKey("port", "Postgres port.", func(c *Config) *int { return &c.Port }),
+	stringKey("user", "Postgres user.", func(c *Config) *string { return &c.User }),
+	stringKey("password", "Postgres password. Prefer password-file.", func(c *Config) *string { return &c.Password }),
+	stringKey("password-file", "File containing the postgres password.", func(c *Config) *string { return &c.PasswordFile }),
+	stringKey("name", "Postgres database name.", func(c *Config) *string { return &c.DBName }),
+	{Name: "sslmode", Usage: "Postgres sslmode, one of " + strings.Join(validSSLModes, "|") + ".", set: func(c *Config, v string) error {
+		if !slices.Contains(validSSLModes, v) {
+			return fmt.Errorf("invalid value '%v', want %v", v, strings.Join(validSSLModes, "|"))
+		}
+		c.SSLMode = v
+		return nil
+	}},
+	intKey("max-open-conns", "Maximum open connections to the database, 0 for unlimited.", func(c *Config) *int { return &c.MaxOpenConns }),
+	intKey("max-idle-conns", "Maximum idle connections kept in the pool.", func(c *Config) *int { return &c.MaxIdleConns }),
+	durationKey("conn-max-lifetime", "Maximum time a connection is reused, 0 for forever.", func(c *Config) *time.Duration { return &c.ConnMaxLifetime }),
+	durationKey("conn-max-idle-time", "Maximum time a connection stays idle, 0 for forever.", func(c *Config) *time.Duration { return &c.ConnMaxIdleTime }),
+	intKey("connect-retries", "Times connecting to the database is retried on startup.", func(c *Config) *int { return &c.ConnectRetries }),
+	durationKey("connect-backoff", "Initial wait between connection attempts on startup.", func(c *Config) *time.Duration { return &c.ConnectBackoff }),
+	durationKey("connect-max-backoff", "Maximum wait between connection attempts on startup.", func(c *Config) *time.Duration { return &c.ConnectMaxBackoff }),
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Driver:            DriverPostgres,
+		SQLiteFile:        "data/txns.db",
+		MaxOpenConns:      10,
+		MaxIdleConns:      5,
+		ConnMaxLifetime:   30 * time.Minute,
+		ConnectRetries:    10,
+		ConnectBackoff:    500 * time.Millisecond,
+		ConnectMaxBackoff: 10 * time.Second,
+	}
+}
+
+// Set sets the setting with the given name from its string form.
+func (c *Config) Set(name, value string) error {
+	for _, k := range ConfigKeys {
+		if k.Name != name {
+			continue
+		}
+		if err := k.set(c, value); err != nil {
+			return fmt.Errorf("invalid database config %v: %w", name, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown database config %v", name)
+}
+
+// EnvName returns the environment variable for the setting with the given
+// name.
+func EnvName(name string) string {
+	return ConfigEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// LoadEnv sets every setting that has an environment variable set.
+func (c *Config) LoadEnv() error {
+	for _, k := range ConfigKeys {
+		if v, ok := os.LookupEnv(EnvName(k.Name)); ok {
+			if err := c.Set(k.Name, v); err != nil {
+				return fmt.Errorf("error in environment variable %v: %w", EnvName(k.Name), err)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadFile sets the settings in a JSON config file. The file is an object
+// keyed by setting name, e.g. {"host": "localhost", "max-open-conns": 20}.
+func (c *Config) LoadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read database config file: %w", err)
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var m map[string]any
+	if err := d.Decode(&m); err != nil {
+		return fmt.Errorf("database config file %v was not a valid JSON object: %w", path, err)
+	}
+	for name, v := range m {
+		switch v.(type) {
+		case string, json.Number:
+		default:
+			return fmt.Errorf("invalid database config %v in %v, want string or number", name, path)
+		}
+		if err := c.Set(name, fmt.Sprint(v)); err != nil {
+			return fmt.Errorf("error in database config file %v: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func quoteDSNValue(v string) string {
+	return `'` + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + `'`
+}
+
+// connString returns the lib/pq connection string. Later keys override
+// earlier ones so the defaults come first, then DSN, then the individually
+// configured settings.
+func (c *Config) connString() (string, error) {
+	dsn := c.DSN
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		var err error
+		if dsn, err = pq.ParseURL(dsn); err != nil {
+			return "", fmt.Errorf("invalid database DSN URL: %w", err)
+		}
+	}
+	parts := []string{defaultDSN, dsn}
+	add := func(k, v string) {
+		if v != "" {
+			parts = append(parts, k+"="+quoteDSNValue(v))
+		}
+	}
+	add("host", c.Host)
+	if c.Port != 0 {
+		add("port", fmt.Sprint(c.Port))
+	}
+	add("user", c.User)
+	add("dbname", c.DBName)
+	add("sslmode", c.SSLMode)
+	add("password", c.Password)
+	if c.PasswordFile != "" {
+		b, err := os.ReadFile(c.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("unable to read database password file: %w", err)
+		}
+		add("password", strings.TrimRight(string(b), "\r\n"))
+	}
+	return strings.Join(parts, " "), nil
+}
@@ -0,0 +1,490 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTxnStore is the conformance suite every TxnStore implementation must
+// pass. newStore must return an empty store whose IDs start at 1.
+func testTxnStore(t *testing.T, newStore func(t *testing.T) TxnStore) {
+	for _, tc := range []struct {
+		name string
+		fn   func(t *testing.T, s TxnStore)
+	}{
+		{"CreateTxn", testCreateTxn},
+		{"QueryTxnsFilters", testQueryTxnsFilters},
+		{"QueryTxnsPagination", testQueryTxnsPagination},
+		{"UpdateTxns", testUpdateTxns},
+		{"TxnTags", testTxnTags},
+		{"QuerySimilarTxns", testQuerySimilarTxns},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newStore(t))
+		})
+	}
+}
+
+func date(s string) time.Time {
+	d, err := time.Parse(dateQueryFmt, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// createTxns creates the given transactions and sets their IDs.
+func createTxns(t *testing.T, s TxnStore, txns []Txn) {
+	t.Helper()
+	for i := range txns {
+		id, err := s.CreateTxn(context.Background(), &txns[i])
+		if err != nil {
+			t.Fatalf("CreateTxn(%+v) got error: %v", txns[i], err)
+		}
+		txns[i].ID = id
+	}
+}
+
+func queryAll(t *testing.T, s TxnStore, tq *TxnQuery) []Txn {
+	t.Helper()
+	page, err := s.QueryTxns(context.Background(), tq)
+	if err != nil {
+		t.Fatalf("QueryTxns(%+v) got error: %v", tq, err)
+	}
+	return page.Txns
+}
+
+func txnIDs(txns []Txn) []int64 {
+	ids := []int64{}
+	for _, t := range txns {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+// sortedTags returns tags sorted and with no tags as an empty slice since
+// backends may return tags in any order and NULL tags as nil.
+func sortedTags(tags []string) []string {
+	result := append([]string{}, tags...)
+	slices.Sort(result)
+	return result
+}
+
+func txnString(t Txn) string {
+	return fmt.Sprintf("{ID:%v Date:%v Description:%q AmountCents:%v Source:%q Tags:%q Notes:%q}",
+		t.ID, t.Date.Format(dateQueryFmt), t.Description, t.AmountCents, t.Source, sortedTags(t.Tags), t.Notes)
+}
+
+func testCreateTxn(t *testing.T, s TxnStore) {
+	want := []Txn{
+		{Date: date("2024-01-02"), Description: "COFFEE SHOP", AmountCents: -450, Source: "AMEX", Tags: []string{"dining", "coffee"}, Notes: "with Sam"},
+		{Date: date("2024-01-01"), Description: "PAYROLL", AmountCents: 250000, Source: "RBC"},
+	}
+	createTxns(t, s, want)
+	if want[0].ID >= want[1].ID {
+		t.Errorf("CreateTxn got IDs %v and %v, want increasing IDs", want[0].ID, want[1].ID)
+	}
+	got := queryAll(t, s, &TxnQuery{})
+	if len(got) != len(want) {
+		t.Fatalf("QueryTxns got %v txns, want %v", len(got), len(want))
+	}
+	for i := range want {
+		if g, w := txnString(got[i]), txnString(want[i]); g != w {
+			t.Errorf("QueryTxns got txn %v, want %v", g, w)
+		}
+	}
+	if _, err := s.CreateTxn(context.Background(), &Txn{Description: "NO DATE", Source: "AMEX"}); err == nil {
+		t.Errorf("CreateTxn without a date got no error, want error")
+	}
+	if _, err := s.CreateTxn(context.Background(), &Txn{Date: date("2024-01-01"), Description: "BAD EMBEDDING", Source: "AMEX", DescEmbedding: "[1, 2]"}); err == nil {
+		t.Errorf("CreateTxn with a short embedding got no error, want error")
+	}
+}
+
+func testQueryTxnsFilters(t *testing.T, s TxnStore) {
+	txns := []Txn{
+		{Date: date("2024-01-01"), Description: "Uber Trip", AmountCents: -1500, Source: "AMEX", Tags: []string{"travel"}},
+		{Date: date("2024-01-05"), Description: "UBER EATS", AmountCents: -2500, Source: "AMEX", Tags: []string{"dining", "delivery"}, Notes: "late dinner"},
+		{Date: date("2024-02-01"), Description: "Payroll 100%", AmountCents: 300000, Source: "RBC CHEQUING"},
+		{Date: date("2024-02-10"), Description: "Grocery_Store", AmountCents: -8000, Source: "RBC VISA", Tags: []string{"groceries"}, Notes: "weekly shop"},
+		{Date: date("2024-03-01"), Description: "Refund UBER", AmountCents: 1500, Source: "AMEX"},
+	}
+	createTxns(t, s, txns)
+	id := func(i int) int64 { return txns[i].ID }
+	mustExpr := func(s string) Expr {
+		e, err := ParseExpr(s)
+		if err != nil {
+			t.Fatalf("ParseExpr(%q) got error: %v", s, err)
+		}
+		return e
+	}
+	for _, tc := range []struct {
+		name string
+		tq   TxnQuery
+		want []int
+	}{
+		{name: "all", want: []int{0, 1, 2, 3, 4}},
+		{name: "start ID", tq: TxnQuery{StartID: id(3)}, want: []int{3, 4}},
+		{name: "dates", tq: TxnQuery{FromDate: ptr(date("2024-01-05")), ToDate: ptr(date("2024-02-01"))}, want: []int{1, 2}},
+		{name: "desc match", tq: TxnQuery{Description: ptr("uber"), DescOp: OpMatch}, want: []int{0, 1, 4}},
+		{name: "desc match wildcard", tq: TxnQuery{Description: ptr("Grocery_"), DescOp: OpMatch}, want: []int{3}},
+		{name: "desc not match", tq: TxnQuery{Description: ptr("uber"), DescOp: OpNotMatch}, want: []int{2, 3}},
+		{name: "desc exact", tq: TxnQuery{Description: ptr("uber eats"), DescOp: OpExact}, want: []int{1}},
+		{name: "desc exact escapes wildcards", tq: TxnQuery{Description: ptr("Payroll 100_"), DescOp: OpExact}, want: []int{}},
+		{name: "desc prefix", tq: TxnQuery{Description: ptr("UBER"), DescOp: OpPrefix}, want: []int{0, 1}},
+		{name: "desc suffix", tq: TxnQuery{Description: ptr("100%"), DescOp: OpSuffix}, want: []int{2}},
+		{name: "desc regex", tq: TxnQuery{Description: ptr("^uber (trip|eats)$"), DescOp: OpRegex}, want: []int{0, 1}},
+		{name: "source", tq: TxnQuery{Source: ptr("rbc"), SourceOp: OpPrefix}, want: []int{2, 3}},
+		{name: "amount", tq: TxnQuery{AmountCents: ptr(int64(-1500))}, want: []int{0}},
+		{name: "amount abs", tq: TxnQuery{AmountCents: ptr(int64(1500)), AmountAbs: true}, want: []int{0, 4}},
+		{name: "amount range", tq: TxnQuery{MinAmountCents: ptr(int64(-3000)), MaxAmountCents: ptr(int64(0))}, want: []int{0, 1}},
+		{name: "amount debit", tq: TxnQuery{AmountType: AmountDebit}, want: []int{0, 1, 3}},
+		{name: "amount credit", tq: TxnQuery{AmountType: AmountCredit}, want: []int{2, 4}},
+		{name: "tags match", tq: TxnQuery{Tags: &[]string{"dining", "delivery"}, TagsOp: OpMatch}, want: []int{1}},
+		{name: "tags not match", tq: TxnQuery{Tags: &[]string{"dining", "travel"}, TagsOp: OpNotMatch}, want: []int{2, 3, 4}},
+		{name: "tagged", tq: TxnQuery{TagsOp: OpMatch}, want: []int{0, 1, 3}},
+		{name: "untagged", tq: TxnQuery{TagsOp: OpEmpty}, want: []int{2, 4}},
+		{name: "notes match", tq: TxnQuery{Notes: ptr("DINNER"), NotesOp: OpMatch}, want: []int{1}},
+		{name: "notes not match", tq: TxnQuery{Notes: ptr("dinner"), NotesOp: OpNotMatch}, want: []int{0, 2, 3, 4}},
+		{name: "notes match escapes wildcards", tq: TxnQuery{Notes: ptr("weekly_shop"), NotesOp: OpMatch}, want: []int{}},
+		{name: "notes not match escapes wildcards", tq: TxnQuery{Notes: ptr("late%"), NotesOp: OpNotMatch}, want: []int{0, 1, 2, 3, 4}},
+		{name: "with notes", tq: TxnQuery{NotesOp: OpMatch}, want: []int{1, 3}},
+		{name: "without notes", tq: TxnQuery{NotesOp: OpEmpty}, want: []int{0, 2, 4}},
+		{name: "expr", tq: TxnQuery{Expr: mustExpr(`(tags:dining OR desc:refund) AND NOT source=rbc`)}, want: []int{1, 4}},
+		{name: "expr not tags", tq: TxnQuery{Expr: mustExpr(`NOT tag:travel amount<0`)}, want: []int{1, 3}},
+		{name: "expr not notes", tq: TxnQuery{Expr: mustExpr(`NOT notes:dinner`)}, want: []int{0, 2, 3, 4}},
+		{name: "expr date", tq: TxnQuery{Expr: mustExpr(`date>=2024/02/01 date<2024/03/01`)}, want: []int{2, 3}},
+		{name: "expr desc equal", tq: TxnQuery{Expr: mustExpr(`desc="uber eats"`)}, want: []int{1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tq := tc.tq
+			got := txnIDs(queryAll(t, s, &tq))
+			want := []int64{}
+			for _, i := range tc.want {
+				want = append(want, id(i))
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("QueryTxns(%v) got IDs %v, want %v", tc.name, got, want)
+			}
+		})
+	}
+	if _, err := s.QueryTxns(context.Background(), &TxnQuery{Limit: 1001}); err == nil {
+		t.Errorf("QueryTxns with limit 1001 got no error, want error")
+	}
+}
+
+func testQueryTxnsPagination(t *testing.T, s TxnStore) {
+	txns := []Txn{
+		{Date: date("2024-01-03"), Description: "C", AmountCents: -300, Source: "AMEX"},
+		{Date: date("2024-01-01"), Description: "A", AmountCents: -100, Source: "AMEX"},
+		{Date: date("2024-01-03"), Description: "B", AmountCents: -300, Source: "AMEX"},
+		{Date: date("2024-01-02"), Description: "D", AmountCents: -200, Source: "AMEX"},
+		{Date: date("2024-01-01"), Description: "E", AmountCents: -500, Source: "AMEX"},
+	}
+	createTxns(t, s, txns)
+	id := func(i int) int64 { return txns[i].ID }
+	for _, tc := range []struct {
+		sort string
+		desc bool
+		want []int
+	}{
+		{sort: SortID, want: []int{0, 1, 2, 3, 4}},
+		{sort: SortID, desc: true, want: []int{4, 3, 2, 1, 0}},
+		{sort: SortDate, want: []int{1, 4, 3, 0, 2}},
+		{sort: SortDate, desc: true, want: []int{2, 0, 3, 4, 1}},
+		{sort: SortAmount, want: []int{4, 0, 2, 3, 1}},
+		{sort: SortAmount, desc: true, want: []int{1, 3, 2, 0, 4}},
+		{sort: SortDescription, want: []int{1, 2, 0, 3, 4}},
+	} {
+		t.Run(fmt.Sprintf("%v desc=%v", tc.sort, tc.desc), func(t *testing.T) {
+			var got []int64
+			var after *Cursor
+			for pages := 1; ; pages++ {
+				tq := TxnQuery{Sort: tc.sort, SortDesc: tc.desc, After: after, Limit: 2}
+				page, err := s.QueryTxns(context.Background(), &tq)
+				if err != nil {
+					t.Fatalf("QueryTxns(%+v) got error: %v", tq, err)
+				}
+				got = append(got, txnIDs(page.Txns)...)
+				if wantMore := pages < 3; page.HasMore != wantMore {
+					t.Errorf("QueryTxns page %v got HasMore %v, want %v", pages, page.HasMore, wantMore)
+				}
+				if !page.HasMore || pages > 3 {
+					break
+				}
+				// Round trip the cursor like clients do.
+				c, err := DecodeCursor(tq.NextCursor(&page.Txns[len(page.Txns)-1]).Encode())
+				if err != nil {
+					t.Fatalf("DecodeCursor got error: %v", err)
+				}
+				after = c
+			}
+			var want []int64
+			for _, i := range tc.want {
+				want = append(want, id(i))
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("QueryTxns pages got IDs %v, want %v", got, want)
+			}
+		})
+	}
+	if _, err := s.QueryTxns(context.Background(), &TxnQuery{Sort: SortDate, After: &Cursor{Sort: SortAmount, Key: "1"}}); err == nil {
+		t.Errorf("QueryTxns with a cursor for another sort got no error, want error")
+	}
+}
+
+func testUpdateTxns(t *testing.T, s TxnStore) {
+	ctx := context.Background()
+	txns := []Txn{
+		{Date: date("2024-01-01"), Description: "A", AmountCents: -100, Source: "AMEX", Tags: []string{"old"}, Notes: "old notes"},
+		{Date: date("2024-01-02"), Description: "B", AmountCents: -200, Source: "AMEX"},
+	}
+	createTxns(t, s, txns)
+	ids := txnIDs(txns)
+	if err := s.UpdateTxns(ctx, ids, &TxnUpdates{Tags: &[]string{"a", "b"}, Notes: ptr("new notes")}); err != nil {
+		t.Fatalf("UpdateTxns got error: %v", err)
+	}
+	for _, got := range queryAll(t, s, &TxnQuery{}) {
+		if !slices.Equal(sortedTags(got.Tags), []string{"a", "b"}) || got.Notes != "new notes" {
+			t.Errorf("UpdateTxns got txn %v, want tags [a b] and notes 'new notes'", txnString(got))
+		}
+	}
+	if err := s.UpdateTxns(ctx, ids[:1], &TxnUpdates{Tags: &[]string{}, Notes: ptr("")}); err != nil {
+		t.Fatalf("UpdateTxns clearing tags and notes got error: %v", err)
+	}
+	got := queryAll(t, s, &TxnQuery{TagsOp: OpEmpty, NotesOp: OpEmpty})
+	if !slices.Equal(txnIDs(got), ids[:1]) {
+		t.Errorf("UpdateTxns clearing tags and notes got untagged txns without notes %v, want %v", txnIDs(got), ids[:1])
+	}
+	if err := s.UpdateTxns(ctx, []int64{ids[1], ids[1]}, &TxnUpdates{Notes: ptr("twice")}); err != nil {
+		t.Errorf("UpdateTxns with a repeated ID got error: %v", err)
+	}
+	if err := s.UpdateTxns(ctx, []int64{ids[0], ids[1] + 100}, &TxnUpdates{Notes: ptr("missing")}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateTxns with a missing ID got error %v, want %v", err, ErrNotFound)
+	}
+	if got := queryAll(t, s, &TxnQuery{Notes: ptr("missing"), NotesOp: OpMatch}); len(got) != 0 {
+		t.Errorf("UpdateTxns with a missing ID updated txns %v, want none", txnIDs(got))
+	}
+	for _, tc := range []struct {
+		name string
+		ids  []int64
+		tu   *TxnUpdates
+	}{
+		{name: "no updates", ids: ids, tu: &TxnUpdates{}},
+		{name: "no ids", tu: &TxnUpdates{Notes: ptr("notes")}},
+		{name: "invalid tags", ids: ids, tu: &TxnUpdates{Tags: &[]string{"bad;tag"}}},
+		{name: "embedding for many txns", ids: ids, tu: &TxnUpdates{DescEmbedding: ptr(embedding(0))}},
+	} {
+		if err := s.UpdateTxns(ctx, tc.ids, tc.tu); err == nil {
+			t.Errorf("UpdateTxns with %v got no error, want error", tc.name)
+		}
+	}
+}
+
+func testTxnTags(t *testing.T, s TxnStore) {
+	ctx := context.Background()
+	txns := []Txn{
+		{Date: date("2024-01-01"), Description: "A", AmountCents: -100, Source: "AMEX", Tags: []string{"a"}},
+		{Date: date("2024-01-02"), Description: "B", AmountCents: -200, Source: "AMEX"},
+	}
+	createTxns(t, s, txns)
+	ids := txnIDs(txns)
+	tagsByID := func() map[int64]string {
+		result := map[int64]string{}
+		for _, txn := range queryAll(t, s, &TxnQuery{}) {
+			result[txn.ID] = strings.Join(sortedTags(txn.Tags), ",")
+		}
+		return result
+	}
+	if err := s.TxnAddTags(ctx, ids, []string{"a", "b"}); err != nil {
+		t.Fatalf("TxnAddTags got error: %v", err)
+	}
+	if got, want := tagsByID(), map[int64]string{ids[0]: "a,b", ids[1]: "a,b"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("TxnAddTags got tags %v, want %v", got, want)
+	}
+	if err := s.TxnRemoveTags(ctx, ids[:1], []string{"a", "c"}); err != nil {
+		t.Fatalf("TxnRemoveTags got error: %v", err)
+	}
+	if got, want := tagsByID(), map[int64]string{ids[0]: "b", ids[1]: "a,b"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("TxnRemoveTags got tags %v, want %v", got, want)
+	}
+	missing := ids[1] + 100
+	if err := s.TxnAddTags(ctx, []int64{ids[0], missing}, []string{"c"}); err == nil {
+		t.Errorf("TxnAddTags with missing txn got no error, want error")
+	}
+	if err := s.TxnRemoveTags(ctx, []int64{ids[1], missing}, []string{"a"}); err == nil {
+		t.Errorf("TxnRemoveTags with missing txn got no error, want error")
+	}
+	if got, want := tagsByID(), map[int64]string{ids[0]: "b", ids[1]: "a,b"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("failed tag updates got tags %v, want unchanged tags %v", got, want)
+	}
+	if err := s.TxnAddTags(ctx, nil, []string{"c"}); err == nil {
+		t.Errorf("TxnAddTags without ids got no error, want error")
+	}
+	if err := s.TxnRemoveTags(ctx, ids, []string{"bad;tag"}); err == nil {
+		t.Errorf("TxnRemoveTags with invalid tag got no error, want error")
+	}
+}
+
+// testTxnTagsByQuery tests updating tags on the transactions matching a
+// query. s must not have any transactions.
+func testTxnTagsByQuery(t *testing.T, s Store) {
+	ctx := context.Background()
+	txns := []Txn{
+		{Date: date("2024-01-01"), Description: "A", AmountCents: -100, Source: "AMEX", Tags: []string{"a"}},
+		{Date: date("2024-01-02"), Description: "B", AmountCents: -200, Source: "AMEX"},
+		{Date: date("2024-01-03"), Description: "C", AmountCents: -300, Source: "AMEX"},
+		{Date: date("2024-02-01"), Description: "D", AmountCents: -400, Source: "AMEX"},
+	}
+	createTxns(t, s, txns)
+	ids := txnIDs(txns)
+	to := date("2024-01-31")
+	// Pagination parameters such as the start ID of a saved query are
+	// ignored.
+	tq := &TxnQuery{ToDate: &to, StartID: ids[1], Limit: 1}
+	got, err := s.TxnTagsByQuery(ctx, tq, TagsOpAdd, []string{"b"}, 10, true)
+	if err != nil {
+		t.Fatalf("TxnTagsByQuery dry run got error: %v", err)
+	}
+	if !got.DryRun || !slices.Equal(got.IDs, ids[:3]) {
+		t.Errorf("TxnTagsByQuery dry run got %+v, want dry run of %v", got, ids[:3])
+	}
+	if tagged := queryAll(t, s, &TxnQuery{Tags: &[]string{"b"}, TagsOp: OpMatch}); len(tagged) != 0 {
+		t.Errorf("TxnTagsByQuery dry run tagged txns %v, want none", txnIDs(tagged))
+	}
+	if _, err := s.TxnTagsByQuery(ctx, tq, TagsOpAdd, []string{"b"}, 2, false); !errors.Is(err, ErrTooManyTxns) {
+		t.Errorf("TxnTagsByQuery matching more than max affected got error %v, want %v", err, ErrTooManyTxns)
+	}
+	got, err = s.TxnTagsByQuery(ctx, tq, TagsOpAdd, []string{"b"}, 10, false)
+	if err != nil {
+		t.Fatalf("TxnTagsByQuery got error: %v", err)
+	}
+	if got.DryRun || !slices.Equal(got.IDs, ids[:3]) {
+		t.Errorf("TxnTagsByQuery got %+v, want %v", got, ids[:3])
+	}
+	if tagged := queryAll(t, s, &TxnQuery{Tags: &[]string{"b"}, TagsOp: OpMatch}); !slices.Equal(txnIDs(tagged), ids[:3]) {
+		t.Errorf("TxnTagsByQuery tagged txns %v, want %v", txnIDs(tagged), ids[:3])
+	}
+}
+
+// embedding returns a unit description embedding along the given
+// dimensions.
+func embedding(dims ...int) string {
+	e := make([]string, DescEmbedLen)
+	for i := range e {
+		e[i] = "0"
+	}
+	for _, d := range dims {
+		e[d] = "1"
+	}
+	return "[" + strings.Join(e, ",") + "]"
+}
+
+func testQuerySimilarTxns(t *testing.T, s TxnStore) {
+	ctx := context.Background()
+	txns := []Txn{
+		{Date: date("2024-01-05"), Description: "SELECTED", AmountCents: -100, Source: "AMEX", DescEmbedding: embedding(0)},
+		{Date: date("2024-01-04"), Description: "FAR", AmountCents: -100, Source: "AMEX", DescEmbedding: embedding(1)},
+		{Date: date("2024-01-03"), Description: "CLOSE", AmountCents: -100, Source: "AMEX", DescEmbedding: embedding(0, 2)},
+		{Date: date("2024-01-02"), Description: "SAME", AmountCents: -100, Source: "RBC", DescEmbedding: embedding(0)},
+		{Date: date("2024-01-01"), Description: "NO EMBEDDING", AmountCents: -100, Source: "AMEX"},
+	}
+	createTxns(t, s, txns)
+	id := func(i int) int64 { return txns[i].ID }
+	for _, tc := range []struct {
+		name         string
+		ids          []int64
+		tq           TxnQuery
+		wantSelected []int64
+		wantSimilar  []int64
+	}{
+		{
+			name:         "nearest ordered by date",
+			ids:          []int64{id(0)},
+			tq:           TxnQuery{Limit: 2},
+			wantSelected: []int64{id(0)},
+			wantSimilar:  []int64{id(3), id(2)},
+		},
+		{
+			name:         "filtered",
+			ids:          []int64{id(0)},
+			tq:           TxnQuery{Source: ptr("amex"), SourceOp: OpMatch, Limit: 2},
+			wantSelected: []int64{id(0)},
+			wantSimilar:  []int64{id(2), id(1)},
+		},
+		{
+			name:         "no embeddings selected",
+			ids:          []int64{id(4)},
+			wantSelected: []int64{id(4)},
+			wantSimilar:  []int64{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tq := tc.tq
+			got, err := s.QuerySimilarTxns(ctx, tc.ids, &tq)
+			if err != nil {
+				t.Fatalf("QuerySimilarTxns got error: %v", err)
+			}
+			if !slices.Equal(txnIDs(got.Selected), tc.wantSelected) {
+				t.Errorf("QuerySimilarTxns got selected %v, want %v", txnIDs(got.Selected), tc.wantSelected)
+			}
+			if !slices.Equal(txnIDs(got.Similar), tc.wantSimilar) {
+				t.Errorf("QuerySimilarTxns got similar %v, want %v", txnIDs(got.Similar), tc.wantSimilar)
+			}
+		})
+	}
+	if _, err := s.QuerySimilarTxns(ctx, []int64{id(0)}, &TxnQuery{Sort: SortDate}); err == nil {
+		t.Errorf("QuerySimilarTxns with a sort got no error, want error")
+	}
+}
+
+// testHouseholdIsolation checks stores a and b of different households of
+// the same database don't see or change each other's transactions.
+func testHouseholdIsolation(t *testing.T, a, b TxnStore) {
+	ctx := context.Background()
+	aTxns := []Txn{{Date: date("2024-01-01"), Description: "RENT", AmountCents: -150000, Source: "RBC", DescEmbedding: embedding(1, 0)}}
+	bTxns := []Txn{{Date: date("2024-01-02"), Description: "RENT", AmountCents: -90000, Source: "AMEX", DescEmbedding: embedding(1, 0)}}
+	createTxns(t, a, aTxns)
+	createTxns(t, b, bTxns)
+
+	if got := txnIDs(queryAll(t, a, &TxnQuery{})); !slices.Equal(got, []int64{aTxns[0].ID}) {
+		t.Errorf("QueryTxns for household a got IDs %v, want %v", got, []int64{aTxns[0].ID})
+	}
+	if got := txnIDs(queryAll(t, b, &TxnQuery{})); !slices.Equal(got, []int64{bTxns[0].ID}) {
+		t.Errorf("QueryTxns for household b got IDs %v, want %v", got, []int64{bTxns[0].ID})
+	}
+	if err := b.TxnAddTags(ctx, []int64{aTxns[0].ID}, []string{"housing"}); err == nil {
+		t.Errorf("TxnAddTags on txn of another household got no error, want error")
+	}
+	if err := b.UpdateTxns(ctx, []int64{aTxns[0].ID}, &TxnUpdates{Notes: ptr("not mine")}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateTxns on txn of another household got error %v, want %v", err, ErrNotFound)
+	}
+	if err := b.UpdateTxns(ctx, []int64{bTxns[0].ID, aTxns[0].ID}, &TxnUpdates{Tags: &[]string{"housing"}}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateTxns on txns of both households got error %v, want %v", err, ErrNotFound)
+	}
+	if got := queryAll(t, b, &TxnQuery{}); len(got) != 1 || len(got[0].Tags) != 0 {
+		t.Errorf("QueryTxns for household b got %v, want txn unchanged by failed update", got)
+	}
+	if got := queryAll(t, a, &TxnQuery{}); len(got) != 1 || got[0].Notes != "" || len(got[0].Tags) != 0 {
+		t.Errorf("QueryTxns for household a got %v, want txn unchanged by household b", got)
+	}
+	similar, err := b.QuerySimilarTxns(ctx, []int64{aTxns[0].ID, bTxns[0].ID}, &TxnQuery{})
+	if err != nil {
+		t.Fatalf("QuerySimilarTxns got error: %v", err)
+	}
+	if got := txnIDs(similar.Selected); !slices.Equal(got, []int64{bTxns[0].ID}) {
+		t.Errorf("QuerySimilarTxns for household b got selected IDs %v, want %v", got, []int64{bTxns[0].ID})
+	}
+	if len(similar.Similar) != 0 {
+		t.Errorf("QuerySimilarTxns for household b got similar txns %v from another household, want none", txnIDs(similar.Similar))
+	}
+}
@@ -0,0 +1,430 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// Query expressions let callers combine transaction filters with AND, OR,
+// NOT and parentheses, e.g.,
+//
+//	(tags:dining OR description:uber) AND NOT source:amex
+//
+// Adjacent terms without an operator between them are implicitly ANDed. A
+// term is <field><op><value> where values containing spaces, parentheses,
+// quotes or operator characters must be double quoted. Expressions are
+// parsed into an AST that's compiled into parameterized SQL so values never
+// become part of the query text.
+
+const (
+	ExprLimit      = 1000
+	exprDepthLimit = 20
+	exprTermsLimit = 50
+	exprDateFmt    = "2006/01/02"
+
+	FieldDate        = "date"
+	FieldDescription = "description"
+	FieldSource      = "source"
+	FieldAmount      = "amount"
+	FieldTags        = "tags"
+	FieldNotes       = "notes"
+
+	ExprOpMatch = ":"
+	ExprOpEq    = "="
+	ExprOpNe    = "!="
+	ExprOpLt    = "<"
+	ExprOpLe    = "<="
+	ExprOpGt    = ">"
+	ExprOpGe    = ">="
+)
+
+var (
+	exprFieldAliases = map[string]string{
+		"desc": FieldDescription,
+		"tag":  FieldTags,
+	}
+	exprFieldColumns = map[string]string{
+		FieldDate:        "DATE",
+		FieldDescription: "DESCRIPTION",
+		FieldSource:      "SOURCE",
+		FieldAmount:      "AMOUNT_CENTS",
+		FieldTags:        "TAGS",
+		FieldNotes:       "NOTES",
+	}
+	exprQuoteReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	exprOpsSQL        = map[string]string{
+		ExprOpEq: "=",
+		ExprOpNe: "<>",
+		ExprOpLt: "<",
+		ExprOpLe: "<=",
+		ExprOpGt: ">",
+		ExprOpGe: ">=",
+	}
+)
+
+// Expr is a node in a parsed query expression.
+type Expr interface {
+	String() string
+	compile(c *exprCompiler) (string, error)
+}
+
+type AndExpr struct {
+	Left, Right Expr
+}
+
+type OrExpr struct {
+	Left, Right Expr
+}
+
+type NotExpr struct {
+	Expr Expr
+}
+
+// Predicate compares a single transaction field against a value.
+type Predicate struct {
+	Field string
+	Op    string
+	Value string
+}
+
+func (e *AndExpr) String() string {
+	return fmt.Sprintf("(%v AND %v)", e.Left, e.Right)
+}
+
+func (e *OrExpr) String() string {
+	return fmt.Sprintf("(%v OR %v)", e.Left, e.Right)
+}
+
+func (e *NotExpr) String() string {
+	return fmt.Sprintf("NOT %v", e.Expr)
+}
+
+func (p *Predicate) String() string {
+	return p.Field + p.Op + `"` + exprQuoteReplacer.Replace(p.Value) + `"`
+}
+
+type exprCompiler struct {
+	tableID  string
+	prevArgs int
+	args     []any
+}
+
+func (c *exprCompiler) arg(v any) string {
+	c.args = append(c.args, v)
+	return fmt.Sprint("$", len(c.args)+c.prevArgs)
+}
+
+func (e *AndExpr) compile(c *exprCompiler) (string, error) {
+	l, err := e.Left.compile(c)
+	if err != nil {
+		return "", err
+	}
+	r, err := e.Right.compile(c)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(%v AND %v)", l, r), nil
+}
+
+func (e *OrExpr) compile(c *exprCompiler) (string, error) {
+	l, err := e.Left.compile(c)
+	if err != nil {
+		return "", err
+	}
+	r, err := e.Right.compile(c)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(%v OR %v)", l, r), nil
+}
+
+func (e *NotExpr) compile(c *exprCompiler) (string, error) {
+	s, err := e.Expr.compile(c)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(NOT %v)", s), nil
+}
+
+// compile returns a clause that's never NULL so that negating a predicate
+// on a NULL column, e.g., untagged transactions, selects the row.
+func (p *Predicate) compile(c *exprCompiler) (string, error) {
+	col, ok := exprFieldColumns[p.Field]
+	if !ok {
+		return "", fmt.Errorf("unknown field '%v' in query expression", p.Field)
+	}
+	col = c.tableID + col
+	switch p.Field {
+	case FieldDescription, FieldSource, FieldNotes:
+		var err error
+		switch p.Field {
+		case FieldDescription:
+			err = ValidateDescription(p.Value)
+		case FieldSource:
+			err = ValidateSource(p.Value)
+		case FieldNotes:
+			if p.Value == "" {
+				err = errors.New("notes can't be an empty string")
+			} else {
+				err = ValidateNotes(p.Value)
+			}
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid value for field '%v': %w", p.Field, err)
+		}
+		switch p.Op {
+		case ExprOpMatch:
+			return fmt.Sprintf("COALESCE(%v ILIKE %v, FALSE)", col, c.arg("%"+p.Value+"%")), nil
+		case ExprOpEq, ExprOpNe:
+			return fmt.Sprintf("COALESCE(LOWER(%v) %v LOWER(%v), FALSE)", col, exprOpsSQL[p.Op], c.arg(p.Value)), nil
+		}
+	case FieldTags:
+		if err := ValidateTags([]string{p.Value}); err != nil {
+			return "", fmt.Errorf("invalid value for field '%v': %w", p.Field, err)
+		}
+		if p.Op == ExprOpMatch || p.Op == ExprOpEq {
+			return fmt.Sprintf("COALESCE(%v @> %v, FALSE)", col, c.arg(pq.Array([]string{p.Value}))), nil
+		}
+	case FieldAmount:
+		a, err := ParseAmount(p.Value)
+		if err != nil {
+			return "", fmt.Errorf("invalid value for field '%v': %w", p.Field, err)
+		}
+		if op, ok := exprOpsSQL[p.Op]; ok {
+			return fmt.Sprintf("%v %v %v", col, op, c.arg(a)), nil
+		}
+	case FieldDate:
+		d, err := time.Parse(exprDateFmt, p.Value)
+		if err != nil {
+			return "", fmt.Errorf("invalid value for field '%v', got %q, want format yyyy/mm/dd", p.Field, p.Value)
+		}
+		if op, ok := exprOpsSQL[p.Op]; ok {
+			return fmt.Sprintf("%v %v %v", col, op, c.arg(d.Format(dateQueryFmt))), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported operator '%v' for field '%v' in query expression", p.Op, p.Field)
+}
+
+func compileExpr(e Expr, copts clausesOpts) (string, []any, error) {
+	c := exprCompiler{tableID: copts.tableID, prevArgs: copts.prevArgs}
+	s, err := e.compile(&c)
+	if err != nil {
+		return "", nil, err
+	}
+	return s, c.args, nil
+}
+
+type exprTokenKind int
+
+const (
+	tkEOF exprTokenKind = iota
+	tkWord
+	tkString
+	tkOp
+	tkLParen
+	tkRParen
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	val  string
+	pos  int
+}
+
+func isExprOpChar(r rune) bool {
+	return r == ':' || r == '=' || r == '!' || r == '<' || r == '>'
+}
+
+func lexExpr(s string) ([]exprToken, error) {
+	var tokens []exprToken
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, exprToken{kind: tkLParen, val: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, exprToken{kind: tkRParen, val: ")", pos: i})
+			i++
+		case r == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			for ; i < len(rs) && rs[i] != '"'; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+				}
+				sb.WriteRune(rs[i])
+			}
+			if i == len(rs) {
+				return nil, fmt.Errorf("unterminated quoted string starting at position %v", start)
+			}
+			i++
+			tokens = append(tokens, exprToken{kind: tkString, val: sb.String(), pos: start})
+		case isExprOpChar(r):
+			start := i
+			for i < len(rs) && isExprOpChar(rs[i]) {
+				i++
+			}
+			op := string(rs[start:i])
+			switch op {
+			case ExprOpMatch, ExprOpEq, ExprOpNe, ExprOpLt, ExprOpLe, ExprOpGt, ExprOpGe:
+			default:
+				return nil, fmt.Errorf("unknown operator '%v' at position %v", op, start)
+			}
+			tokens = append(tokens, exprToken{kind: tkOp, val: op, pos: start})
+		default:
+			start := i
+			for i < len(rs) && !unicode.IsSpace(rs[i]) && !isExprOpChar(rs[i]) && rs[i] != '(' && rs[i] != ')' && rs[i] != '"' {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tkWord, val: string(rs[start:i]), pos: start})
+		}
+	}
+	return append(tokens, exprToken{kind: tkEOF, pos: len(rs)}), nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	depth  int
+	terms  int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != tkEOF {
+		p.pos++
+	}
+	return t
+}
+
+func isKeyword(t exprToken, kw string) bool {
+	return t.kind == tkWord && strings.EqualFold(t.val, kw)
+}
+
+func (p *exprParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.peek(), "OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &OrExpr{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if isKeyword(t, "AND") {
+			p.next()
+		} else if t.kind == tkEOF || t.kind == tkRParen || isKeyword(t, "OR") {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &AndExpr{Left: left, Right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > exprDepthLimit {
+		return nil, fmt.Errorf("query expression nested too deeply, want <= %v levels", exprDepthLimit)
+	}
+	t := p.next()
+	switch {
+	case isKeyword(t, "NOT"):
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Expr: e}, nil
+	case t.kind == tkLParen:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tkRParen {
+			return nil, fmt.Errorf("expected ')' at position %v to close '(' at position %v", c.pos, t.pos)
+		}
+		return e, nil
+	case t.kind == tkWord:
+		return p.parsePredicate(t)
+	case t.kind == tkEOF:
+		return nil, errors.New("unexpected end of query expression")
+	}
+	return nil, fmt.Errorf("unexpected '%v' at position %v", t.val, t.pos)
+}
+
+func (p *exprParser) parsePredicate(field exprToken) (Expr, error) {
+	p.terms++
+	if p.terms > exprTermsLimit {
+		return nil, fmt.Errorf("too many terms in query expression, want <= %v", exprTermsLimit)
+	}
+	name := strings.ToLower(field.val)
+	if alias, ok := exprFieldAliases[name]; ok {
+		name = alias
+	}
+	if _, ok := exprFieldColumns[name]; !ok {
+		return nil, fmt.Errorf("unknown field '%v' at position %v", field.val, field.pos)
+	}
+	op := p.next()
+	if op.kind != tkOp {
+		return nil, fmt.Errorf("expected operator after field '%v' at position %v", field.val, op.pos)
+	}
+	v := p.next()
+	if v.kind != tkWord && v.kind != tkString {
+		return nil, fmt.Errorf("expected value after '%v%v' at position %v", field.val, op.val, v.pos)
+	}
+	return &Predicate{Field: name, Op: op.val, Value: v.val}, nil
+}
+
+// ParseExpr parses a query expression. The returned expression is
+// validated by compiling it so callers get errors for bad values upfront.
+func ParseExpr(s string) (Expr, error) {
+	if l := len(s); l == 0 || l > ExprLimit {
+		return nil, fmt.Errorf("invalid query expression length, got %v, want >0 and <= %v", l, ExprLimit)
+	}
+	tokens, err := lexExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	p := exprParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tkEOF {
+		return nil, fmt.Errorf("unexpected '%v' at position %v", t.val, t.pos)
+	}
+	if _, _, err := compileExpr(e, clausesOpts{}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
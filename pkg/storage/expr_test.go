@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	terms := func(n int) string {
+		return strings.TrimSuffix(strings.Repeat("tags:a OR ", n), " OR ")
+	}
+	for _, tc := range []struct {
+		name    string
+		expr    string
+		want    string
+		wantErr string
+	}{
+		{name: "predicate", expr: "tags:dining", want: `tags:"dining"`},
+		{name: "aliases and case", expr: "TAG:dining Desc=uber", want: `(tags:"dining" AND description="uber")`},
+		{name: "quoted value", expr: `description:"uber \"eats\" (ca)"`, want: `description:"uber \"eats\" (ca)"`},
+		{name: "comparison ops", expr: "amount>=10 amount<20 amount!=15 date<=2024/01/31 date>2024/01/01", want: `((((amount>="10" AND amount<"20") AND amount!="15") AND date<="2024/01/31") AND date>"2024/01/01")`},
+		{name: "and binds tighter than or", expr: "tags:a OR tags:b AND tags:c", want: `(tags:"a" OR (tags:"b" AND tags:"c"))`},
+		{name: "implicit and binds tighter than or", expr: "tags:a tags:b OR tags:c", want: `((tags:"a" AND tags:"b") OR tags:"c")`},
+		{name: "not binds tighter than and", expr: "NOT tags:a AND tags:b", want: `(NOT tags:"a" AND tags:"b")`},
+		{name: "or is left associative", expr: "tags:a OR tags:b OR tags:c", want: `((tags:"a" OR tags:"b") OR tags:"c")`},
+		{name: "parens", expr: "(tags:dining OR description:uber) AND NOT source:amex", want: `((tags:"dining" OR description:"uber") AND NOT source:"amex")`},
+		{name: "lower case keywords", expr: "not (tags:a or tags:b) and tags:c", want: `(NOT (tags:"a" OR tags:"b") AND tags:"c")`},
+		{name: "max depth", expr: strings.Repeat("(", exprDepthLimit-1) + "tags:a" + strings.Repeat(")", exprDepthLimit-1), want: `tags:"a"`},
+		{name: "max terms", expr: terms(exprTermsLimit), want: "(" + strings.Repeat("(", exprTermsLimit-2) + `tags:"a"` + strings.Repeat(` OR tags:"a")`, exprTermsLimit-1)},
+
+		{name: "empty", expr: "", wantErr: "invalid query expression length, got 0, want >0 and <= 1000"},
+		{name: "too long", expr: strings.Repeat("a", ExprLimit+1), wantErr: "invalid query expression length, got 1001, want >0 and <= 1000"},
+		{name: "unclosed paren", expr: "(tags:a OR tags:b", wantErr: "expected ')' at position 17 to close '(' at position 0"},
+		{name: "unopened paren", expr: "tags:a)", wantErr: "unexpected ')' at position 6"},
+		{name: "empty parens", expr: "()", wantErr: "unexpected ')' at position 1"},
+		{name: "dangling or", expr: "tags:a OR", wantErr: "unexpected end of query expression"},
+		{name: "dangling not", expr: "NOT", wantErr: "unexpected end of query expression"},
+		{name: "unknown op", expr: "amount=>10", wantErr: "unknown operator '=>' at position 6"},
+		{name: "bang op", expr: "tags!a", wantErr: "unknown operator '!' at position 4"},
+		{name: "missing op", expr: "tags dining", wantErr: "expected operator after field 'tags' at position 5"},
+		{name: "missing value", expr: "tags:", wantErr: "expected value after 'tags:' at position 5"},
+		{name: "op without field", expr: ":dining", wantErr: "unexpected ':' at position 0"},
+		{name: "unknown field", expr: "merchant:uber", wantErr: "unknown field 'merchant' at position 0"},
+		{name: "unterminated quote", expr: `description:"uber`, wantErr: "unterminated quoted string starting at position 12"},
+		{name: "unsupported op for field", expr: "tags<dining", wantErr: "unsupported operator '<' for field 'tags' in query expression"},
+		{name: "bad amount", expr: "amount>ten", wantErr: "invalid value for field 'amount'"},
+		{name: "bad date", expr: "date>2024-01-01", wantErr: `invalid value for field 'date', got "2024-01-01", want format yyyy/mm/dd`},
+		{name: "too deep", expr: strings.Repeat("(", exprDepthLimit) + "tags:a" + strings.Repeat(")", exprDepthLimit), wantErr: "query expression nested too deeply, want <= 20 levels"},
+		{name: "too many nots", expr: strings.Repeat("NOT ", exprDepthLimit) + "tags:a", wantErr: "query expression nested too deeply, want <= 20 levels"},
+		{name: "too many terms", expr: terms(exprTermsLimit + 1), wantErr: "too many terms in query expression, want <= 50"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := ParseExpr(tc.expr)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("ParseExpr(%q) got error %v, want error containing %q", tc.expr, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseExpr(%q) got error: %v", tc.expr, err)
+			}
+			if got := e.String(); got != tc.want {
+				t.Errorf("ParseExpr(%q) got %v, want %v", tc.expr, got, tc.want)
+			}
+		})
+	}
+}
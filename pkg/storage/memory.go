@@ -0,0 +1,661 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a TxnStore keeping transactions in memory. It matches the
+// semantics of Storage, except text sorts compare bytes instead of using
+// the database's collation, and is meant for tests and local development.
+// Like Storage it only sees the transactions of one household, the default
+// one unless it's from ForHousehold.
+type Memory struct {
+	*memDB
+	household int64
+}
+
+type memDB struct {
+	mu sync.Mutex
+	// txns holds the transactions of each household ordered by ID.
+	txns   map[int64][]memTxn
+	nextID int64
+}
+
+type memTxn struct {
+	Txn
+	embedding []float64
+}
+
+var _ TxnStore = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{memDB: &memDB{txns: map[int64][]memTxn{}, nextID: 1}, household: DefaultHousehold}
+}
+
+// ForHousehold returns a Memory sharing the transactions of m that only
+// sees the transactions of the given household.
+func (m *Memory) ForHousehold(household int64) *Memory {
+	return &Memory{memDB: m.memDB, household: household}
+}
+
+// dateOnly truncates t to its date like the DATE column in postgres.
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func parseEmbedding(descEmbedding string) []float64 {
+	if descEmbedding == "" {
+		return nil
+	}
+	var e []float64
+	json.Unmarshal([]byte(descEmbedding), &e)
+	return e
+}
+
+// copyTxn returns a copy of t that doesn't share tags with the store. No
+// tags are always returned as nil.
+func copyTxn(t *Txn) Txn {
+	c := *t
+	c.Tags = nil
+	if len(t.Tags) > 0 {
+		c.Tags = slices.Clone(t.Tags)
+	}
+	c.DescEmbedding = ""
+	return c
+}
+
+func (m *Memory) CreateTxn(ctx context.Context, t *Txn) (int64, error) {
+	if err := t.validate(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mt := memTxn{Txn: copyTxn(t), embedding: parseEmbedding(t.DescEmbedding)}
+	mt.ID = m.nextID
+	mt.Date = dateOnly(t.Date)
+	m.nextID++
+	m.txns[m.household] = append(m.txns[m.household], mt)
+	return mt.ID, nil
+}
+
+func (m *Memory) find(id int64) int {
+	return findTxn(m.txns[m.household], id)
+}
+
+// findTxn returns the index of the transaction with the given ID in txns
+// sorted by ID or -1.
+func findTxn(txns []memTxn, id int64) int {
+	i, ok := slices.BinarySearchFunc(txns, id, func(t memTxn, id int64) int {
+		return cmp.Compare(t.ID, id)
+	})
+	if !ok {
+		return -1
+	}
+	return i
+}
+
+func (m *Memory) UpdateTxns(ctx context.Context, ids []int64, tu *TxnUpdates) error {
+	var defaultUpdates TxnUpdates
+	if tu == nil || *tu == defaultUpdates {
+		return fmt.Errorf("no fields were requested to be updated for the given transaction IDs")
+	}
+	if len(ids) < 1 {
+		return fmt.Errorf("ids must be specified")
+	}
+	if tu.Tags != nil {
+		if err := ValidateTags(*tu.Tags); err != nil {
+			return fmt.Errorf("unable to update txns with invalid tags: %w", err)
+		}
+	}
+	if tu.Notes != nil {
+		if err := ValidateNotes(*tu.Notes); err != nil {
+			return fmt.Errorf("unable to update txns with invalid notes: %w", err)
+		}
+	}
+	if tu.DescEmbedding != nil {
+		if len(ids) != 1 {
+			return fmt.Errorf("can't update embedding, got %v ids, want 1", len(ids))
+		}
+		if err := validateDescEmbedding(*tu.DescEmbedding); err != nil {
+			return fmt.Errorf("unable to update txn %v with invalid description embedding: %w", ids[0], err)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids = uniqueIDs(ids)
+	idxs := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if i := m.find(id); i >= 0 {
+			idxs = append(idxs, i)
+		}
+	}
+	if len(idxs) != len(ids) {
+		return fmt.Errorf("%w: got %v of %v txns to update", ErrNotFound, len(idxs), len(ids))
+	}
+	for _, i := range idxs {
+		t := &m.txns[m.household][i]
+		if tu.Tags != nil {
+			t.Tags = nil
+			if len(*tu.Tags) > 0 {
+				t.Tags = slices.Clone(*tu.Tags)
+			}
+		}
+		if tu.Notes != nil {
+			t.Notes = *tu.Notes
+		}
+		if tu.DescEmbedding != nil {
+			t.embedding = parseEmbedding(*tu.DescEmbedding)
+		}
+	}
+	return nil
+}
+
+// updateTags replaces the tags of every given transaction with the result
+// of fn. Nothing is changed unless every ID exists and is given once.
+func (m *Memory) updateTags(ids []int64, fn func(tags []string) []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var idxs []int
+	for _, id := range ids {
+		if i := m.find(id); i >= 0 && !slices.Contains(idxs, i) {
+			idxs = append(idxs, i)
+		}
+	}
+	if len(idxs) != len(ids) {
+		return fmt.Errorf("not all txns updated successfully, got %v updated, want %v", len(idxs), len(ids))
+	}
+	txns := m.txns[m.household]
+	for _, i := range idxs {
+		txns[i].Tags = fn(txns[i].Tags)
+	}
+	return nil
+}
+
+func (m *Memory) TxnAddTags(ctx context.Context, ids []int64, tags []string) error {
+	if err := ValidateTags(tags); err != nil {
+		return fmt.Errorf("error validating tags to be added: %w", err)
+	}
+	if len(ids) == 0 {
+		return errors.New("no ids given to add the given tags")
+	}
+	return m.updateTags(ids, func(old []string) []string {
+		return addTags(old, tags)
+	})
+}
+
+func (m *Memory) TxnRemoveTags(ctx context.Context, ids []int64, tags []string) error {
+	if err := ValidateTags(tags); err != nil {
+		return fmt.Errorf("error validating tags to be removed: %w", err)
+	}
+	if len(ids) == 0 {
+		return errors.New("no ids given to remove the given tags")
+	}
+	return m.updateTags(ids, func(old []string) []string {
+		return removeTags(old, tags)
+	})
+}
+
+// addTags returns old with tags added, without duplicates like the array
+// expression used by Storage.
+func addTags(old, tags []string) []string {
+	var result []string
+	for _, t := range append(slices.Clone(old), tags...) {
+		if !slices.Contains(result, t) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// removeTags returns old with tags removed, without duplicates like the
+// array expression used by Storage.
+func removeTags(old, tags []string) []string {
+	var result []string
+	for _, t := range old {
+		if !slices.Contains(tags, t) && !slices.Contains(result, t) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+func (m *Memory) QueryTxns(ctx context.Context, tq *TxnQuery) (TxnsPage, error) {
+	if err := tq.validate(); err != nil {
+		return TxnsPage{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result, err := matchingTxns(m.txns[m.household], tq)
+	if err != nil {
+		return TxnsPage{}, err
+	}
+	if int64(len(result)) > tq.Limit {
+		return TxnsPage{Txns: result[:tq.Limit], HasMore: true}, nil
+	}
+	return TxnsPage{Txns: result}, nil
+}
+
+// matchingTxns returns copies of the transactions matching the given
+// validated query, including its cursor, in the query's sort order. The
+// Limit of the query is ignored.
+func matchingTxns(txns []memTxn, tq *TxnQuery) ([]Txn, error) {
+	match, err := tq.matcher()
+	if err != nil {
+		return nil, err
+	}
+	after, err := tq.afterMatcher()
+	if err != nil {
+		return nil, err
+	}
+	var result []Txn
+	for i := range txns {
+		if t := &txns[i].Txn; match(t) && after(t) {
+			result = append(result, copyTxn(t))
+		}
+	}
+	slices.SortFunc(result, tq.compareTxns)
+	return result, nil
+}
+
+func (m *Memory) QuerySimilarTxns(ctx context.Context, ids []int64, tq *TxnQuery) (SimilarTxns, error) {
+	if err := tq.validate(); err != nil {
+		return SimilarTxns{}, err
+	}
+	if tq.sort() != SortID || tq.SortDesc || tq.After != nil {
+		return SimilarTxns{}, errors.New("sort orders and cursors are not supported when querying similar txns")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return similarTxns(m.txns[m.household], ids, tq)
+}
+
+// similarTxns returns the given selected transactions and the transactions
+// matching the given validated query closest to the average of their
+// description embeddings, like Storage.QuerySimilarTxns.
+func similarTxns(txns []memTxn, ids []int64, tq *TxnQuery) (SimilarTxns, error) {
+	match, err := tq.matcher()
+	if err != nil {
+		return SimilarTxns{}, err
+	}
+	var result SimilarTxns
+	var avg []float64
+	embeddings := 0
+	for _, id := range ids {
+		i := findTxn(txns, id)
+		if i < 0 || slices.ContainsFunc(result.Selected, func(t Txn) bool { return t.ID == id }) {
+			continue
+		}
+		result.Selected = append(result.Selected, copyTxn(&txns[i].Txn))
+		if e := txns[i].embedding; e != nil {
+			if avg == nil {
+				avg = make([]float64, len(e))
+			}
+			for j := range e {
+				avg[j] += e[j]
+			}
+			embeddings++
+		}
+	}
+	if avg != nil {
+		for j := range avg {
+			avg[j] /= float64(embeddings)
+		}
+		type candidate struct {
+			txn      Txn
+			distance float64
+		}
+		var candidates []candidate
+		for i := range txns {
+			t := &txns[i]
+			if slices.Contains(ids, t.ID) || !match(&t.Txn) {
+				continue
+			}
+			// Transactions without embeddings sort last like NULLs in
+			// postgres.
+			d := math.Inf(1)
+			if t.embedding != nil {
+				d = cosineDistance(t.embedding, avg)
+			}
+			candidates = append(candidates, candidate{txn: copyTxn(&t.Txn), distance: d})
+		}
+		slices.SortStableFunc(candidates, func(a, b candidate) int {
+			return cmp.Compare(a.distance, b.distance)
+		})
+		for _, c := range candidates[:min(int64(len(candidates)), tq.Limit)] {
+			result.Similar = append(result.Similar, c.txn)
+		}
+	}
+	byDate := func(a, b Txn) int {
+		return cmp.Or(a.Date.Compare(b.Date), cmp.Compare(a.ID, b.ID))
+	}
+	slices.SortFunc(result.Selected, byDate)
+	slices.SortFunc(result.Similar, byDate)
+	return result, nil
+}
+
+// cosineDistance matches the <=> operator of pgvector.
+func cosineDistance(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	return 1 - dot/math.Sqrt(na*nb)
+}
+
+// likeMatcher returns a function matching strings against a case
+// insensitive LIKE pattern.
+func likeMatcher(pattern string) func(s string) bool {
+	var sb strings.Builder
+	sb.WriteString(`(?is)^`)
+	rs := []rune(pattern)
+	for i := 0; i < len(rs); i++ {
+		switch rs[i] {
+		case '%':
+			sb.WriteString(`.*`)
+		case '_':
+			sb.WriteString(`.`)
+		case '\\':
+			if i+1 < len(rs) {
+				i++
+			}
+			sb.WriteString(regexp.QuoteMeta(string(rs[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(rs[i])))
+		}
+	}
+	sb.WriteString(`$`)
+	re := regexp.MustCompile(sb.String())
+	return re.MatchString
+}
+
+// textOpMatcher is the in-memory equivalent of textOpClause.
+func textOpMatcher(op, val string) (func(s string) bool, error) {
+	switch op {
+	case OpMatch:
+		return likeMatcher("%" + val + "%"), nil
+	case OpNotMatch:
+		m := likeMatcher("%" + val + "%")
+		return func(s string) bool { return !m(s) }, nil
+	case OpExact:
+		return likeMatcher(escapeLike(val)), nil
+	case OpPrefix:
+		return likeMatcher(escapeLike(val) + "%"), nil
+	case OpSuffix:
+		return likeMatcher("%" + escapeLike(val)), nil
+	case OpRegex:
+		re, err := regexp.Compile("(?i)" + val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %w", val, err)
+		}
+		return re.MatchString, nil
+	}
+	return nil, fmt.Errorf("want %v", ValidOps)
+}
+
+func containsAll(tags, want []string) bool {
+	for _, w := range want {
+		if !slices.Contains(tags, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// matcher is the in-memory equivalent of asClauses. Empty notes and tags
+// behave like NULL columns.
+func (tq *TxnQuery) matcher() (func(t *Txn) bool, error) {
+	var preds []func(t *Txn) bool
+	add := func(p func(t *Txn) bool) {
+		preds = append(preds, p)
+	}
+	add(func(t *Txn) bool { return t.ID >= tq.StartID })
+	if tq.FromDate != nil {
+		from := dateOnly(*tq.FromDate)
+		add(func(t *Txn) bool { return !t.Date.Before(from) })
+	}
+	if tq.ToDate != nil {
+		to := dateOnly(*tq.ToDate)
+		add(func(t *Txn) bool { return !t.Date.After(to) })
+	}
+	if tq.Description != nil {
+		m, err := textOpMatcher(tq.DescOp, *tq.Description)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported query op '%v' for description: %w", tq.DescOp, err)
+		}
+		add(func(t *Txn) bool { return m(t.Description) })
+	}
+	if tq.Source != nil {
+		m, err := textOpMatcher(tq.SourceOp, *tq.Source)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported query op '%v' for source: %w", tq.SourceOp, err)
+		}
+		add(func(t *Txn) bool { return m(t.Source) })
+	}
+	amount := func(t *Txn) int64 {
+		if tq.AmountAbs && t.AmountCents < 0 {
+			return -t.AmountCents
+		}
+		return t.AmountCents
+	}
+	if tq.AmountCents != nil {
+		add(func(t *Txn) bool { return amount(t) == *tq.AmountCents })
+	}
+	if tq.MinAmountCents != nil {
+		add(func(t *Txn) bool { return amount(t) >= *tq.MinAmountCents })
+	}
+	if tq.MaxAmountCents != nil {
+		add(func(t *Txn) bool { return amount(t) <= *tq.MaxAmountCents })
+	}
+	switch tq.AmountType {
+	case "":
+	case AmountDebit:
+		add(func(t *Txn) bool { return t.AmountCents < 0 })
+	case AmountCredit:
+		add(func(t *Txn) bool { return t.AmountCents > 0 })
+	default:
+		return nil, fmt.Errorf("unsupported amount type '%v'", tq.AmountType)
+	}
+	if tq.Tags != nil {
+		want := *tq.Tags
+		switch tq.TagsOp {
+		case OpMatch:
+			add(func(t *Txn) bool { return len(t.Tags) > 0 && containsAll(t.Tags, want) })
+		case OpNotMatch:
+			add(func(t *Txn) bool {
+				return !slices.ContainsFunc(t.Tags, func(tag string) bool { return slices.Contains(want, tag) })
+			})
+		default:
+			return nil, fmt.Errorf("unsupported query op '%v' for tags", tq.TagsOp)
+		}
+	} else if tq.TagsOp == OpMatch {
+		add(func(t *Txn) bool { return len(t.Tags) > 0 })
+	} else if tq.TagsOp == OpEmpty {
+		add(func(t *Txn) bool { return len(t.Tags) == 0 })
+	}
+	if tq.Notes != nil {
+		m := likeMatcher("%" + escapeLike(*tq.Notes) + "%")
+		switch tq.NotesOp {
+		case OpMatch:
+			add(func(t *Txn) bool { return t.Notes != "" && m(t.Notes) })
+		case OpNotMatch:
+			add(func(t *Txn) bool { return t.Notes == "" || !m(t.Notes) })
+		default:
+			return nil, fmt.Errorf("unsupported query op '%v' for notes", tq.NotesOp)
+		}
+	} else if tq.NotesOp == OpMatch {
+		add(func(t *Txn) bool { return t.Notes != "" })
+	} else if tq.NotesOp == OpEmpty {
+		add(func(t *Txn) bool { return t.Notes == "" })
+	}
+	if tq.Expr != nil {
+		m, err := exprMatcher(tq.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling query expression: %w", err)
+		}
+		add(m)
+	}
+	return func(t *Txn) bool {
+		for _, p := range preds {
+			if !p(t) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func compareOp[T cmp.Ordered](op string, a, b T) bool {
+	switch op {
+	case ExprOpEq:
+		return a == b
+	case ExprOpNe:
+		return a != b
+	case ExprOpLt:
+		return a < b
+	case ExprOpLe:
+		return a <= b
+	case ExprOpGt:
+		return a > b
+	case ExprOpGe:
+		return a >= b
+	}
+	return false
+}
+
+// exprMatcher is the in-memory equivalent of compileExpr.
+func exprMatcher(e Expr) (func(t *Txn) bool, error) {
+	switch e := e.(type) {
+	case *AndExpr:
+		l, r, err := exprMatchers(e.Left, e.Right)
+		if err != nil {
+			return nil, err
+		}
+		return func(t *Txn) bool { return l(t) && r(t) }, nil
+	case *OrExpr:
+		l, r, err := exprMatchers(e.Left, e.Right)
+		if err != nil {
+			return nil, err
+		}
+		return func(t *Txn) bool { return l(t) || r(t) }, nil
+	case *NotExpr:
+		m, err := exprMatcher(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return func(t *Txn) bool { return !m(t) }, nil
+	case *Predicate:
+		// Compiling validates the predicate's field, op and value.
+		if _, err := e.compile(&exprCompiler{}); err != nil {
+			return nil, err
+		}
+		return predicateMatcher(e), nil
+	}
+	return nil, fmt.Errorf("unknown query expression node %T", e)
+}
+
+func exprMatchers(l, r Expr) (func(t *Txn) bool, func(t *Txn) bool, error) {
+	lm, err := exprMatcher(l)
+	if err != nil {
+		return nil, nil, err
+	}
+	rm, err := exprMatcher(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lm, rm, nil
+}
+
+func predicateMatcher(p *Predicate) func(t *Txn) bool {
+	switch p.Field {
+	case FieldDescription, FieldSource, FieldNotes:
+		text := func(t *Txn) string {
+			switch p.Field {
+			case FieldDescription:
+				return t.Description
+			case FieldSource:
+				return t.Source
+			}
+			return t.Notes
+		}
+		if p.Op == ExprOpMatch {
+			m := likeMatcher("%" + p.Value + "%")
+			return func(t *Txn) bool {
+				s := text(t)
+				return (p.Field != FieldNotes || s != "") && m(s)
+			}
+		}
+		want := strings.ToLower(p.Value)
+		return func(t *Txn) bool {
+			s := text(t)
+			return (p.Field != FieldNotes || s != "") && compareOp(p.Op, strings.ToLower(s), want)
+		}
+	case FieldTags:
+		return func(t *Txn) bool { return slices.Contains(t.Tags, p.Value) }
+	case FieldAmount:
+		a, _ := ParseAmount(p.Value)
+		return func(t *Txn) bool { return compareOp(p.Op, t.AmountCents, a) }
+	case FieldDate:
+		d, _ := time.Parse(exprDateFmt, p.Value)
+		want := d.Format(dateQueryFmt)
+		return func(t *Txn) bool { return compareOp(p.Op, t.Date.Format(dateQueryFmt), want) }
+	}
+	return func(t *Txn) bool { return false }
+}
+
+// compareTxns orders transactions like orderBy.
+func (tq *TxnQuery) compareTxns(a, b Txn) int {
+	var c int
+	switch tq.sort() {
+	case SortDate:
+		c = a.Date.Compare(b.Date)
+	case SortAmount:
+		c = cmp.Compare(a.AmountCents, b.AmountCents)
+	case SortDescription:
+		c = strings.Compare(a.Description, b.Description)
+	case SortSource:
+		c = strings.Compare(a.Source, b.Source)
+	}
+	c = cmp.Or(c, cmp.Compare(a.ID, b.ID))
+	if tq.SortDesc {
+		return -c
+	}
+	return c
+}
+
+// afterMatcher is the in-memory equivalent of keysetClause.
+func (tq *TxnQuery) afterMatcher() (func(t *Txn) bool, error) {
+	if tq.After == nil {
+		return func(*Txn) bool { return true }, nil
+	}
+	if _, err := tq.After.keyArg(); err != nil {
+		return nil, err
+	}
+	// Build the last transaction of the previous page from the cursor so
+	// it can be compared with compareTxns.
+	last := Txn{ID: tq.After.ID}
+	switch tq.sort() {
+	case SortDate:
+		d, _ := time.Parse(dateQueryFmt, tq.After.Key)
+		last.Date = d
+	case SortAmount:
+		a, _ := tq.After.keyArg()
+		last.AmountCents = a.(int64)
+	case SortDescription:
+		last.Description = tq.After.Key
+	case SortSource:
+		last.Source = tq.After.Key
+	}
+	return func(t *Txn) bool { return tq.compareTxns(*t, last) > 0 }, nil
+}
@@ -0,0 +1,14 @@
+package storage
+
+import "testing"
+
+func TestMemory(t *testing.T) {
+	testTxnStore(t, func(t *testing.T) TxnStore {
+		return NewMemory()
+	})
+}
+
+func TestMemoryHouseholds(t *testing.T) {
+	m := NewMemory()
+	testHouseholdIsolation(t, m, m.ForHousehold(DefaultHousehold+1))
+}
@@ -0,0 +1,410 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+)
+
+const (
+	MerchantNameLimit    = 100
+	MaxMerchantPatterns  = 20
+	MerchantPatternLimit = 200
+
+	// How transactions were mapped to merchants. Manual mappings are never
+	// changed by automatic ones.
+	MappedByPattern     = "pattern"
+	MappedByDescription = "description"
+	MappedByEmbedding   = "embedding"
+	MappedManually      = "manual"
+)
+
+var ValidMappingSources = fmt.Sprintf("%v|%v|%v|%v", MappedByPattern, MappedByDescription, MappedByEmbedding, MappedManually)
+
+// Merchant is who a transaction is with, whatever its raw description, e.g.,
+// "AMZN Mktp CA*2X4" and "AMAZON.CA" are both Amazon.
+type Merchant struct {
+	ID   int64
+	Name string
+	// Patterns are case insensitive regular expressions matching the
+	// descriptions of the transactions with the merchant.
+	Patterns []string
+	// TxnCount is how many transactions are mapped to the merchant. It's
+	// filled in when reading merchants and ignored when writing them.
+	TxnCount  int64
+	CreatedAt time.Time
+}
+
+// TxnMerchant maps a transaction to its merchant.
+type TxnMerchant struct {
+	TxnID      int64
+	MerchantID int64
+	Source     string
+	// MerchantName, Date, Description and AmountCents are filled in when
+	// reading mappings and ignored when setting them.
+	MerchantName string
+	Date         time.Time
+	Description  string
+	AmountCents  int64
+	UpdatedAt    time.Time
+}
+
+// MerchantSpending is the total amount of the transactions with a merchant.
+type MerchantSpending struct {
+	MerchantID  int64
+	Name        string
+	TxnCount    int64
+	AmountCents int64
+}
+
+func ValidateMerchantName(name string) error {
+	return validateText("merchant name", name, MerchantNameLimit)
+}
+
+// CompileMerchantPattern compiles a merchant pattern into a case insensitive
+// regular expression.
+func CompileMerchantPattern(pattern string) (*regexp.Regexp, error) {
+	if l := len(pattern); l == 0 || l > MerchantPatternLimit {
+		return nil, fmt.Errorf("invalid merchant pattern length, got %v, want >0 and <= %v", l, MerchantPatternLimit)
+	}
+	if err := validateRegex(pattern); err != nil {
+		return nil, fmt.Errorf("invalid merchant pattern: %w", err)
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid merchant pattern '%v': %w", pattern, err)
+	}
+	return re, nil
+}
+
+func ValidateMappingSource(source string) error {
+	switch source {
+	case MappedByPattern, MappedByDescription, MappedByEmbedding, MappedManually:
+		return nil
+	}
+	return fmt.Errorf("invalid merchant mapping source '%v', want %v", source, ValidMappingSources)
+}
+
+func (m *Merchant) validate() error {
+	if err := ValidateMerchantName(m.Name); err != nil {
+		return err
+	}
+	if len(m.Patterns) > MaxMerchantPatterns {
+		return fmt.Errorf("too many patterns for merchant '%v', got %v, want <= %v", m.Name, len(m.Patterns), MaxMerchantPatterns)
+	}
+	for _, p := range m.Patterns {
+		if _, err := CompileMerchantPattern(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Merchant) encodePatterns() ([]byte, error) {
+	patterns := m.Patterns
+	if patterns == nil {
+		patterns = []string{}
+	}
+	result, err := json.Marshal(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding patterns of merchant '%v': %w", m.Name, err)
+	}
+	return result, nil
+}
+
+// mergePatterns returns the patterns of into followed by those of from it
+// doesn't have yet.
+func mergePatterns(into, from []string) ([]string, error) {
+	result := slices.Clone(into)
+	for _, p := range from {
+		if !slices.Contains(result, p) {
+			result = append(result, p)
+		}
+	}
+	if len(result) > MaxMerchantPatterns {
+		return nil, fmt.Errorf("merged merchant would have %v patterns, want <= %v", len(result), MaxMerchantPatterns)
+	}
+	return result, nil
+}
+
+const merchantColumnsSelected = `m.ID, m.NAME, m.PATTERNS, (SELECT COUNT(*) FROM TXN_MERCHANTS AS tm WHERE tm.MERCHANT_ID = m.ID), m.CREATED_AT
+	FROM MERCHANTS AS m`
+
+func scanMerchant(row interface{ Scan(...any) error }) (Merchant, error) {
+	var m Merchant
+	var patterns []byte
+	if err := row.Scan(&m.ID, &m.Name, &patterns, &m.TxnCount, &m.CreatedAt); err != nil {
+		return Merchant{}, err
+	}
+	if err := json.Unmarshal(patterns, &m.Patterns); err != nil {
+		return Merchant{}, fmt.Errorf("merchant %v had malformed patterns: %w", m.ID, err)
+	}
+	return m, nil
+}
+
+const txnMerchantColumnsSelected = `tm.TXN_ID, tm.MERCHANT_ID, tm.SOURCE, m.NAME, t.DATE, t.DESCRIPTION, t.AMOUNT_CENTS, tm.UPDATED_AT
+	FROM TXN_MERCHANTS AS tm
+	JOIN MERCHANTS AS m ON m.ID = tm.MERCHANT_ID
+	JOIN TRANSACTIONS AS t ON t.ID = tm.TXN_ID`
+
+// txnMerchantColumns selects the ID and name of the merchant of the
+// transaction with the given ID column, or 0 and an empty name if it has
+// none, for reading transactions along with their merchant.
+func txnMerchantColumns(idColumn string) string {
+	return `COALESCE((SELECT tm.MERCHANT_ID FROM TXN_MERCHANTS AS tm WHERE tm.TXN_ID = ` + idColumn + `), 0),
+	COALESCE((SELECT m.NAME FROM TXN_MERCHANTS AS tm JOIN MERCHANTS AS m ON m.ID = tm.MERCHANT_ID WHERE tm.TXN_ID = ` + idColumn + `), '')`
+}
+
+func scanTxnMerchant(row interface{ Scan(...any) error }) (TxnMerchant, error) {
+	var tm TxnMerchant
+	err := row.Scan(&tm.TxnID, &tm.MerchantID, &tm.Source, &tm.MerchantName, &tm.Date, &tm.Description, &tm.AmountCents, &tm.UpdatedAt)
+	return tm, err
+}
+
+func (s *Storage) CreateMerchant(ctx context.Context, m *Merchant) (int64, error) {
+	if err := m.validate(); err != nil {
+		return 0, err
+	}
+	patterns, err := m.encodePatterns()
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO MERCHANTS (HOUSEHOLD_ID, NAME, PATTERNS) VALUES ($1, $2, $3) RETURNING ID
+	`, s.household, m.Name, patterns).Scan(&id)
+	if isPQErr(err, pqUniqueViolation) {
+		return 0, fmt.Errorf("%w: merchant '%v'", ErrAlreadyExists, m.Name)
+	} else if err != nil {
+		return 0, fmt.Errorf("error creating merchant '%v': %w", m.Name, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) ListMerchants(ctx context.Context) ([]Merchant, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+merchantColumnsSelected+` WHERE m.HOUSEHOLD_ID = $1 ORDER BY m.NAME ASC`, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying merchants: %w", err)
+	}
+	return scanAll(rows, "merchants", scanMerchant)
+}
+
+func (s *Storage) GetMerchant(ctx context.Context, id int64) (Merchant, error) {
+	m, err := scanMerchant(s.db.QueryRowContext(ctx, `SELECT `+merchantColumnsSelected+` WHERE m.ID = $1 AND m.HOUSEHOLD_ID = $2`, id, s.household))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Merchant{}, fmt.Errorf("%w: merchant %v", ErrNotFound, id)
+	} else if err != nil {
+		return Merchant{}, fmt.Errorf("error fetching merchant %v: %w", id, err)
+	}
+	return m, nil
+}
+
+// UpdateMerchant renames a merchant and replaces its patterns.
+func (s *Storage) UpdateMerchant(ctx context.Context, m *Merchant) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	patterns, err := m.encodePatterns()
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE MERCHANTS SET NAME = $3, PATTERNS = $4 WHERE ID = $1 AND HOUSEHOLD_ID = $2
+	`, m.ID, s.household, m.Name, patterns)
+	if isPQErr(err, pqUniqueViolation) {
+		return fmt.Errorf("%w: merchant '%v'", ErrAlreadyExists, m.Name)
+	} else if err != nil {
+		return fmt.Errorf("error updating merchant %v: %w", m.ID, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify merchant %v was updated: %w", m.ID, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: merchant %v", ErrNotFound, m.ID)
+	}
+	return nil
+}
+
+// DeleteMerchant deletes a merchant along with the mappings of transactions
+// to it.
+func (s *Storage) DeleteMerchant(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM MERCHANTS WHERE ID = $1 AND HOUSEHOLD_ID = $2`, id, s.household)
+	if err != nil {
+		return fmt.Errorf("error deleting merchant %v: %w", id, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify merchant %v was deleted: %w", id, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: merchant %v", ErrNotFound, id)
+	}
+	return nil
+}
+
+// MergeMerchants moves the transactions and patterns of merchant fromID to
+// merchant intoID and deletes fromID.
+func (s *Storage) MergeMerchants(ctx context.Context, fromID, intoID int64) error {
+	if fromID == intoID {
+		return fmt.Errorf("can't merge merchant %v into itself", fromID)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	var patterns [2][]string
+	for i, id := range []int64{fromID, intoID} {
+		var p []byte
+		err := tx.QueryRowContext(ctx, `SELECT PATTERNS FROM MERCHANTS WHERE ID = $1 AND HOUSEHOLD_ID = $2 FOR UPDATE`, id, s.household).Scan(&p)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: merchant %v", ErrNotFound, id)
+		} else if err != nil {
+			return fmt.Errorf("error fetching merchant %v: %w", id, err)
+		}
+		if err := json.Unmarshal(p, &patterns[i]); err != nil {
+			return fmt.Errorf("merchant %v had malformed patterns: %w", id, err)
+		}
+	}
+	merged, err := mergePatterns(patterns[1], patterns[0])
+	if err != nil {
+		return err
+	}
+	encoded, err := (&Merchant{Patterns: merged}).encodePatterns()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE TXN_MERCHANTS SET MERCHANT_ID = $2, UPDATED_AT = NOW() WHERE MERCHANT_ID = $1`, fromID, intoID); err != nil {
+		return fmt.Errorf("error moving transactions of merchant %v to merchant %v: %w", fromID, intoID, err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE MERCHANTS SET PATTERNS = $2 WHERE ID = $1`, intoID, encoded); err != nil {
+		return fmt.Errorf("error updating patterns of merchant %v: %w", intoID, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM MERCHANTS WHERE ID = $1`, fromID); err != nil {
+		return fmt.Errorf("error deleting merchant %v: %w", fromID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error merging merchant %v into merchant %v: %w", fromID, intoID, err)
+	}
+	return nil
+}
+
+// SetTxnMerchants maps transactions to merchants, replacing their earlier
+// mappings. Either all or none of the mappings are set.
+func (s *Storage) SetTxnMerchants(ctx context.Context, mappings []TxnMerchant) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	for _, tm := range mappings {
+		if err := ValidateMappingSource(tm.Source); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO TXN_MERCHANTS (TXN_ID, MERCHANT_ID, SOURCE)
+			SELECT $1::BIGINT, $2::BIGINT, $3::TEXT
+			WHERE EXISTS (SELECT 1 FROM TRANSACTIONS WHERE ID = $1 AND HOUSEHOLD_ID = $4)
+				AND EXISTS (SELECT 1 FROM MERCHANTS WHERE ID = $2 AND HOUSEHOLD_ID = $4)
+			ON CONFLICT (TXN_ID) DO UPDATE SET MERCHANT_ID = EXCLUDED.MERCHANT_ID, SOURCE = EXCLUDED.SOURCE, UPDATED_AT = NOW()
+		`, tm.TxnID, tm.MerchantID, tm.Source, s.household)
+		if err != nil {
+			return fmt.Errorf("error mapping txn %v to merchant %v: %w", tm.TxnID, tm.MerchantID, err)
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to verify txn %v was mapped to merchant %v: %w", tm.TxnID, tm.MerchantID, err)
+		} else if rows == 0 {
+			return fmt.Errorf("%w: txn %v or merchant %v", ErrNotFound, tm.TxnID, tm.MerchantID)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error mapping txns to merchants: %w", err)
+	}
+	return nil
+}
+
+// ListTxnMerchants returns the mappings of transactions to the merchant with
+// the given ID, or every merchant when it's 0, optionally only those with
+// the given source, ordered by the date and ID of the transactions.
+func (s *Storage) ListTxnMerchants(ctx context.Context, merchantID int64, source string) ([]TxnMerchant, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+txnMerchantColumnsSelected+`
+		WHERE m.HOUSEHOLD_ID = $1 AND ($2::BIGINT = 0 OR tm.MERCHANT_ID = $2) AND ($3::TEXT = '' OR tm.SOURCE = $3)
+		ORDER BY t.DATE ASC, t.ID ASC
+	`, s.household, merchantID, source)
+	if err != nil {
+		return nil, fmt.Errorf("error querying merchants of txns: %w", err)
+	}
+	return scanAll(rows, "merchants of txns", scanTxnMerchant)
+}
+
+func (s *Storage) GetTxnMerchant(ctx context.Context, txnID int64) (TxnMerchant, error) {
+	tm, err := scanTxnMerchant(s.db.QueryRowContext(ctx, `SELECT `+txnMerchantColumnsSelected+` WHERE tm.TXN_ID = $1 AND m.HOUSEHOLD_ID = $2`, txnID, s.household))
+	if errors.Is(err, sql.ErrNoRows) {
+		return TxnMerchant{}, fmt.Errorf("%w: merchant of txn %v", ErrNotFound, txnID)
+	} else if err != nil {
+		return TxnMerchant{}, fmt.Errorf("error fetching merchant of txn %v: %w", txnID, err)
+	}
+	return tm, nil
+}
+
+// NearestMerchants maps every transaction of the household without a
+// merchant to the merchant of the transaction with the closest description
+// embedding, if it's at most maxDistance away in cosine distance. The
+// mappings are returned, not set.
+func (s *Storage) NearestMerchants(ctx context.Context, maxDistance float64) ([]TxnMerchant, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.ID, n.MERCHANT_ID FROM TRANSACTIONS AS t
+		CROSS JOIN LATERAL (
+			SELECT tm.MERCHANT_ID, t.DESC_EMBEDDING <=> e.DESC_EMBEDDING AS DISTANCE
+			FROM TXN_MERCHANTS AS tm JOIN TRANSACTIONS AS e ON e.ID = tm.TXN_ID
+			WHERE e.HOUSEHOLD_ID = $1 AND e.DESC_EMBEDDING IS NOT NULL
+			ORDER BY t.DESC_EMBEDDING <=> e.DESC_EMBEDDING
+			LIMIT 1
+		) AS n
+		WHERE t.HOUSEHOLD_ID = $1 AND t.DESC_EMBEDDING IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM TXN_MERCHANTS WHERE TXN_ID = t.ID)
+			AND n.DISTANCE <= $2
+		ORDER BY t.ID ASC
+	`, s.household, maxDistance)
+	if err != nil {
+		return nil, fmt.Errorf("error querying nearest merchants: %w", err)
+	}
+	return scanAll(rows, "nearest merchants", func(row interface{ Scan(...any) error }) (TxnMerchant, error) {
+		tm := TxnMerchant{Source: MappedByEmbedding}
+		err := row.Scan(&tm.TxnID, &tm.MerchantID)
+		return tm, err
+	})
+}
+
+// MerchantSpending totals the transactions matching tq by merchant, net of
+// reimbursements, ordered from the largest net spending.
+func (s *Storage) MerchantSpending(ctx context.Context, tq *TxnQuery) ([]MerchantSpending, error) {
+	if err := tq.validate(); err != nil {
+		return nil, err
+	}
+	clauses, args, err := tq.asClauses(WithTableID("t."), withHousehold(s.household))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT m.ID, m.NAME, COUNT(*), SUM(n.AMOUNT_CENTS)
+		FROM TRANSACTIONS AS t
+		JOIN NET_TRANSACTIONS AS n ON n.ID = t.ID
+		JOIN TXN_MERCHANTS AS tm ON tm.TXN_ID = t.ID
+		JOIN MERCHANTS AS m ON m.ID = tm.MERCHANT_ID
+		WHERE `+clausesAsQuery(clauses)+`
+		GROUP BY m.ID, m.NAME
+		ORDER BY SUM(n.AMOUNT_CENTS) ASC, m.NAME ASC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying spending by merchant: %w", err)
+	}
+	return scanAll(rows, "merchant spending", func(row interface{ Scan(...any) error }) (MerchantSpending, error) {
+		var ms MerchantSpending
+		err := row.Scan(&ms.MerchantID, &ms.Name, &ms.TxnCount, &ms.AmountCents)
+		return ms, err
+	})
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// testMerchants tests creating, updating, merging and deleting merchants and
+// mapping transactions to them. s must not have any transactions or
+// merchants.
+func testMerchants(t *testing.T, s Store) {
+	ctx := context.Background()
+	txns := []Txn{
+		{Date: date("2024-01-01"), Description: "AMZN Mktp CA*2X4", AmountCents: -2000, Source: "AMEX", DescEmbedding: embedding(0)},
+		{Date: date("2024-01-02"), Description: "AMAZON.CA", AmountCents: -3000, Source: "AMEX", DescEmbedding: embedding(0, 1)},
+		{Date: date("2024-01-03"), Description: "SAFEWAY", AmountCents: -4000, Source: "AMEX", DescEmbedding: embedding(2)},
+		{Date: date("2024-01-04"), Description: "AMAZON REFUND", AmountCents: 500, Source: "AMEX"},
+	}
+	createTxns(t, s, txns)
+
+	amazon := Merchant{Name: "Amazon", Patterns: []string{`^AMZN`, `^AMAZON`}}
+	id, err := s.CreateMerchant(ctx, &amazon)
+	if err != nil {
+		t.Fatalf("CreateMerchant got error: %v", err)
+	}
+	amazon.ID = id
+	if _, err := s.CreateMerchant(ctx, &Merchant{Name: "Amazon"}); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("CreateMerchant of existing merchant got error %v, want %v", err, ErrAlreadyExists)
+	}
+	if _, err := s.CreateMerchant(ctx, &Merchant{Name: "Bad", Patterns: []string{`(`}}); err == nil {
+		t.Errorf("CreateMerchant with invalid pattern got no error")
+	}
+	safeway := Merchant{Name: "Safeway"}
+	if safeway.ID, err = s.CreateMerchant(ctx, &safeway); err != nil {
+		t.Fatalf("CreateMerchant got error: %v", err)
+	}
+
+	if err := s.SetTxnMerchants(ctx, []TxnMerchant{
+		{TxnID: txns[0].ID, MerchantID: amazon.ID, Source: MappedByPattern},
+		{TxnID: txns[1].ID, MerchantID: amazon.ID + 100, Source: MappedByPattern},
+	}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetTxnMerchants with missing merchant got error %v, want %v", err, ErrNotFound)
+	}
+	if got, err := s.ListTxnMerchants(ctx, 0, ""); err != nil || len(got) != 0 {
+		t.Errorf("ListTxnMerchants after failed set got %+v, %v, want no mappings", got, err)
+	}
+	if err := s.SetTxnMerchants(ctx, []TxnMerchant{
+		{TxnID: txns[0].ID, MerchantID: amazon.ID, Source: MappedByPattern},
+		{TxnID: txns[2].ID, MerchantID: safeway.ID, Source: MappedByDescription},
+		{TxnID: txns[3].ID, MerchantID: safeway.ID, Source: MappedByDescription},
+	}); err != nil {
+		t.Fatalf("SetTxnMerchants got error: %v", err)
+	}
+	// Correct the mapping of the refund.
+	if err := s.SetTxnMerchants(ctx, []TxnMerchant{{TxnID: txns[3].ID, MerchantID: amazon.ID, Source: MappedManually}}); err != nil {
+		t.Fatalf("SetTxnMerchants got error: %v", err)
+	}
+	got, err := s.ListTxnMerchants(ctx, amazon.ID, "")
+	if err != nil {
+		t.Fatalf("ListTxnMerchants got error: %v", err)
+	}
+	if len(got) != 2 || got[0].TxnID != txns[0].ID || got[1].TxnID != txns[3].ID || got[1].Source != MappedManually ||
+		got[1].MerchantName != "Amazon" || got[1].Description != "AMAZON REFUND" || got[1].AmountCents != 500 || !got[1].Date.Equal(txns[3].Date) {
+		t.Errorf("ListTxnMerchants of Amazon got %+v, want txns %v and %v", got, txns[0].ID, txns[3].ID)
+	}
+	if got, err := s.GetTxnMerchant(ctx, txns[3].ID); err != nil || got.MerchantID != amazon.ID || got.Source != MappedManually {
+		t.Errorf("GetTxnMerchant got %+v, %v, want manual mapping to Amazon", got, err)
+	}
+	if _, err := s.GetTxnMerchant(ctx, txns[1].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetTxnMerchant of unmapped txn got error %v, want %v", err, ErrNotFound)
+	}
+	if got, err := s.ListTxnMerchants(ctx, 0, MappedManually); err != nil || len(got) != 1 || got[0].TxnID != txns[3].ID {
+		t.Errorf("ListTxnMerchants of manual mappings got %+v, %v, want txn %v", got, err, txns[3].ID)
+	}
+
+	nearest, err := s.NearestMerchants(ctx, 0.3)
+	if err != nil {
+		t.Fatalf("NearestMerchants got error: %v", err)
+	}
+	want := []TxnMerchant{{TxnID: txns[1].ID, MerchantID: amazon.ID, Source: MappedByEmbedding}}
+	if !slices.Equal(nearest, want) {
+		t.Errorf("NearestMerchants got %+v, want %+v", nearest, want)
+	}
+	if nearest, err := s.NearestMerchants(ctx, 0.1); err != nil || len(nearest) != 0 {
+		t.Errorf("NearestMerchants within 0.1 got %+v, %v, want none", nearest, err)
+	}
+	if err := s.SetTxnMerchants(ctx, nearest); err != nil {
+		t.Fatalf("SetTxnMerchants got error: %v", err)
+	}
+
+	// Transactions are read along with their merchant.
+	for _, tc := range []struct {
+		txn      Txn
+		wantID   int64
+		wantName string
+	}{
+		{txns[1], amazon.ID, "Amazon"},
+		{txns[2], safeway.ID, "Safeway"},
+	} {
+		got := queryAll(t, s, &TxnQuery{StartID: tc.txn.ID, Limit: 1})
+		if len(got) != 1 || got[0].MerchantID != tc.wantID || got[0].Merchant != tc.wantName {
+			t.Errorf("QueryTxns of txn %v got %+v, want merchant %v %v", tc.txn.ID, got, tc.wantID, tc.wantName)
+		}
+	}
+	var unmapped []Txn
+	if err := s.ForEachTxn(ctx, &TxnQuery{}, func(txn *Txn) error {
+		if txn.MerchantID == 0 || txn.Merchant == "" {
+			unmapped = append(unmapped, *txn)
+		}
+		return nil
+	}); err != nil || len(unmapped) != 0 {
+		t.Errorf("ForEachTxn got txns without merchants %+v, %v, want none", unmapped, err)
+	}
+
+	spending, err := s.MerchantSpending(ctx, &TxnQuery{})
+	if err != nil {
+		t.Fatalf("MerchantSpending got error: %v", err)
+	}
+	wantSpending := []MerchantSpending{
+		{MerchantID: amazon.ID, Name: "Amazon", TxnCount: 3, AmountCents: -4500},
+		{MerchantID: safeway.ID, Name: "Safeway", TxnCount: 1, AmountCents: -4000},
+	}
+	if !slices.Equal(spending, wantSpending) {
+		t.Errorf("MerchantSpending got %+v, want %+v", spending, wantSpending)
+	}
+	from := date("2024-01-03")
+	spending, err = s.MerchantSpending(ctx, &TxnQuery{FromDate: &from})
+	if err != nil {
+		t.Fatalf("MerchantSpending got error: %v", err)
+	}
+	wantSpending = []MerchantSpending{
+		{MerchantID: safeway.ID, Name: "Safeway", TxnCount: 1, AmountCents: -4000},
+		{MerchantID: amazon.ID, Name: "Amazon", TxnCount: 1, AmountCents: 500},
+	}
+	if !slices.Equal(spending, wantSpending) {
+		t.Errorf("MerchantSpending from %v got %+v, want %+v", from, spending, wantSpending)
+	}
+
+	safeway.Name, safeway.Patterns = "Safeway Inc", []string{`SAFEWAY`, `^AMZN`}
+	if err := s.UpdateMerchant(ctx, &safeway); err != nil {
+		t.Fatalf("UpdateMerchant got error: %v", err)
+	}
+	if err := s.UpdateMerchant(ctx, &Merchant{ID: safeway.ID, Name: "Amazon"}); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("UpdateMerchant to existing name got error %v, want %v", err, ErrAlreadyExists)
+	}
+	if err := s.UpdateMerchant(ctx, &Merchant{ID: safeway.ID + 100, Name: "Missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateMerchant of missing merchant got error %v, want %v", err, ErrNotFound)
+	}
+
+	if err := s.MergeMerchants(ctx, safeway.ID, amazon.ID+100); !errors.Is(err, ErrNotFound) {
+		t.Errorf("MergeMerchants into missing merchant got error %v, want %v", err, ErrNotFound)
+	}
+	if err := s.MergeMerchants(ctx, safeway.ID, amazon.ID); err != nil {
+		t.Fatalf("MergeMerchants got error: %v", err)
+	}
+	merchants, err := s.ListMerchants(ctx)
+	if err != nil {
+		t.Fatalf("ListMerchants got error: %v", err)
+	}
+	if len(merchants) != 1 || merchants[0].ID != amazon.ID || merchants[0].TxnCount != 4 ||
+		!slices.Equal(merchants[0].Patterns, []string{`^AMZN`, `^AMAZON`, `SAFEWAY`}) || merchants[0].CreatedAt.IsZero() {
+		t.Errorf("ListMerchants after merge got %+v, want Amazon with 4 txns and the patterns of both", merchants)
+	}
+	if _, err := s.GetMerchant(ctx, safeway.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetMerchant of merged merchant got error %v, want %v", err, ErrNotFound)
+	}
+
+	if err := s.DeleteMerchant(ctx, amazon.ID); err != nil {
+		t.Fatalf("DeleteMerchant got error: %v", err)
+	}
+	if err := s.DeleteMerchant(ctx, amazon.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteMerchant of deleted merchant got error %v, want %v", err, ErrNotFound)
+	}
+	if got, err := s.ListTxnMerchants(ctx, 0, ""); err != nil || len(got) != 0 {
+		t.Errorf("ListTxnMerchants after deleting merchant got %+v, %v, want no mappings", got, err)
+	}
+}
@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Migrations are pairs of SQL files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql in the migrations directory. Versions start at
+// 1 and are contiguous. Applied versions are recorded in the
+// SCHEMA_MIGRATIONS table.
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrationsLockID is the postgres advisory lock held while migrating so
+// concurrently starting servers don't apply the same migration twice.
+const migrationsLockID = 7031990
+
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list embedded migrations: %w", err)
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := migrationFileRegexp.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name '%v', want <version>_<name>.(up|down).sql", e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		b, err := migrationsFS.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read migration %v: %w", e.Name(), err)
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration version %v has conflicting names '%v' and '%v'", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.up = string(b)
+		} else {
+			mig.down = string(b)
+		}
+	}
+	var result []Migration
+	for v := 1; v <= len(byVersion); v++ {
+		mig, ok := byVersion[v]
+		if !ok {
+			return nil, fmt.Errorf("migration versions aren't contiguous, missing version %v", v)
+		}
+		if mig.up == "" || mig.down == "" {
+			return nil, fmt.Errorf("migration %v_%v must have both up and down files", mig.Version, mig.Name)
+		}
+		result = append(result, *mig)
+	}
+	return result, nil
+}
+
+func (s *Storage) appliedMigrations(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}) (map[int]time.Time, error) {
+	rows, err := q.QueryContext(ctx, `SELECT VERSION, APPLIED_AT FROM SCHEMA_MIGRATIONS`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying applied migrations: %w", err)
+	}
+	defer rows.Close()
+	result := map[int]time.Time{}
+	for rows.Next() {
+		var v int
+		var t time.Time
+		if err := rows.Scan(&v, &t); err != nil {
+			return nil, fmt.Errorf("error scanning applied migration: %w", err)
+		}
+		result[v] = t
+	}
+	return result, rows.Err()
+}
+
+func (s *Storage) ensureMigrationsTable(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS SCHEMA_MIGRATIONS (
+			VERSION INT PRIMARY KEY,
+			NAME TEXT NOT NULL,
+			APPLIED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`); err != nil {
+		return fmt.Errorf("error creating schema migrations table: %w", err)
+	}
+	return nil
+}
+
+// migrate applies or reverts a single migration in a database transaction
+// holding the migrations lock. It does nothing if the migration was
+// already applied or reverted by someone else.
+func (s *Storage) migrate(ctx context.Context, m *Migration, up bool) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer func() {
+		if tx == nil {
+			return
+		}
+		tx.Rollback()
+	}()
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationsLockID); err != nil {
+		return false, fmt.Errorf("error acquiring migrations lock: %w", err)
+	}
+	applied, err := s.appliedMigrations(ctx, tx)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := applied[m.Version]; ok == up {
+		return false, nil
+	}
+	stmt, record := m.up, `INSERT INTO SCHEMA_MIGRATIONS (VERSION, NAME) VALUES ($1, $2)`
+	if !up {
+		stmt, record = m.down, `DELETE FROM SCHEMA_MIGRATIONS WHERE VERSION = $1 AND NAME = $2`
+	}
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return false, fmt.Errorf("error running migration %v_%v: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, m.Version, m.Name); err != nil {
+		return false, fmt.Errorf("error recording migration %v_%v: %w", m.Version, m.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing migration %v_%v: %w", m.Version, m.Name, err)
+	}
+	tx = nil
+	return true, nil
+}
+
+// MigrateUp applies every migration that hasn't been applied yet in order
+// and returns the applied migrations.
+func (s *Storage) MigrateUp(ctx context.Context) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+	var result []Migration
+	for i := range migrations {
+		ok, err := s.migrate(ctx, &migrations[i], true)
+		if err != nil {
+			return result, err
+		}
+		if ok {
+			result = append(result, migrations[i])
+		}
+	}
+	return result, nil
+}
+
+// MigrateDown reverts the given number of most recently applied migrations
+// and returns the reverted migrations.
+func (s *Storage) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("invalid number of migrations to revert, got %v, want > 0", steps)
+	}
+	statuses, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(statuses)
+	var result []Migration
+	for i := range statuses {
+		if len(result) == steps {
+			break
+		}
+		if statuses[i].AppliedAt == nil {
+			continue
+		}
+		ok, err := s.migrate(ctx, &statuses[i].Migration, false)
+		if err != nil {
+			return result, err
+		}
+		if ok {
+			result = append(result, statuses[i].Migration)
+		}
+	}
+	return result, nil
+}
+
+// MigrationStatus returns every known migration in order along with when
+// it was applied, if it was.
+func (s *Storage) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	var result []MigrationStatus
+	for _, m := range migrations {
+		st := MigrationStatus{Migration: m}
+		if t, ok := applied[m.Version]; ok {
+			st.AppliedAt = &t
+		}
+		result = append(result, st)
+	}
+	return result, nil
+}
@@ -11,5 +11,5 @@ CREATE TABLE IF NOT EXISTS TRANSACTIONS (
     DESC_EMBEDDING VECTOR(768)
 );
 
-CREATE INDEX IF NOT EXISTS TRANSACTIONS_INDEX 
-ON TRANSACTIONS(DATE, DESCRIPTION, AMOUNT_CENTS);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS TRANSACTIONS_INDEX
+ON TRANSACTIONS(DATE, DESCRIPTION, AMOUNT_CENTS);
@@ -0,0 +1 @@
+ALTER TABLE TRANSACTIONS DROP COLUMN IF EXISTS NOTES;
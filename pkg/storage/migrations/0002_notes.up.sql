@@ -0,0 +1 @@
+ALTER TABLE TRANSACTIONS ADD COLUMN IF NOT EXISTS NOTES TEXT;
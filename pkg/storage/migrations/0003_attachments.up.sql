@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS ATTACHMENTS (
+    ID BIGSERIAL PRIMARY KEY,
+    TXN_ID BIGINT NOT NULL REFERENCES TRANSACTIONS(ID) ON DELETE CASCADE,
+    NAME TEXT NOT NULL,
+    CONTENT_TYPE TEXT NOT NULL,
+    SIZE_BYTES BIGINT NOT NULL,
+    DIGEST TEXT NOT NULL,
+    CREATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS ATTACHMENTS_TXN_ID_INDEX ON ATTACHMENTS(TXN_ID);
+CREATE INDEX IF NOT EXISTS ATTACHMENTS_DIGEST_INDEX ON ATTACHMENTS(DIGEST);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS VIEWS (
+    NAME TEXT PRIMARY KEY,
+    QUERY TEXT NOT NULL,
+    CREATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UPDATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
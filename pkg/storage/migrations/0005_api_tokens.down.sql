@@ -0,0 +1 @@
+DROP TABLE IF EXISTS API_TOKENS;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS API_TOKENS (
+    ID BIGSERIAL PRIMARY KEY,
+    NAME TEXT NOT NULL,
+    TOKEN_HASH TEXT NOT NULL UNIQUE,
+    SCOPES TEXT[] NOT NULL,
+    CREATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    REVOKED_AT TIMESTAMPTZ
+);
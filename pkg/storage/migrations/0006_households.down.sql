@@ -0,0 +1,13 @@
+ALTER TABLE API_TOKENS DROP COLUMN IF EXISTS USER_ID;
+
+-- Fails if several households have views with the same name.
+ALTER TABLE VIEWS DROP CONSTRAINT VIEWS_PKEY;
+ALTER TABLE VIEWS DROP COLUMN IF EXISTS HOUSEHOLD_ID;
+ALTER TABLE VIEWS ADD PRIMARY KEY (NAME);
+
+DROP INDEX IF EXISTS TRANSACTIONS_HOUSEHOLD_ID_INDEX;
+ALTER TABLE TRANSACTIONS DROP COLUMN IF EXISTS HOUSEHOLD_ID;
+
+DROP TABLE IF EXISTS HOUSEHOLD_MEMBERS;
+DROP TABLE IF EXISTS HOUSEHOLDS;
+DROP TABLE IF EXISTS USERS;
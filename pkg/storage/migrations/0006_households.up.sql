@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS USERS (
+    ID BIGSERIAL PRIMARY KEY,
+    NAME TEXT NOT NULL UNIQUE,
+    CREATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS HOUSEHOLDS (
+    ID BIGSERIAL PRIMARY KEY,
+    NAME TEXT NOT NULL UNIQUE,
+    CREATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS HOUSEHOLD_MEMBERS (
+    HOUSEHOLD_ID BIGINT NOT NULL REFERENCES HOUSEHOLDS(ID) ON DELETE CASCADE,
+    USER_ID BIGINT NOT NULL REFERENCES USERS(ID) ON DELETE CASCADE,
+    PRIMARY KEY (HOUSEHOLD_ID, USER_ID)
+);
+
+-- Everything that already exists belongs to the default user and household,
+-- which get ID 1 in the new tables.
+INSERT INTO USERS (NAME) VALUES ('default');
+INSERT INTO HOUSEHOLDS (NAME) VALUES ('default');
+INSERT INTO HOUSEHOLD_MEMBERS (HOUSEHOLD_ID, USER_ID) VALUES (1, 1);
+
+ALTER TABLE TRANSACTIONS ADD COLUMN HOUSEHOLD_ID BIGINT NOT NULL DEFAULT 1 REFERENCES HOUSEHOLDS(ID);
+ALTER TABLE TRANSACTIONS ALTER COLUMN HOUSEHOLD_ID DROP DEFAULT;
+CREATE INDEX IF NOT EXISTS TRANSACTIONS_HOUSEHOLD_ID_INDEX ON TRANSACTIONS(HOUSEHOLD_ID, ID);
+
+ALTER TABLE VIEWS ADD COLUMN HOUSEHOLD_ID BIGINT NOT NULL DEFAULT 1 REFERENCES HOUSEHOLDS(ID);
+ALTER TABLE VIEWS ALTER COLUMN HOUSEHOLD_ID DROP DEFAULT;
+ALTER TABLE VIEWS DROP CONSTRAINT VIEWS_PKEY;
+ALTER TABLE VIEWS ADD PRIMARY KEY (HOUSEHOLD_ID, NAME);
+
+ALTER TABLE API_TOKENS ADD COLUMN USER_ID BIGINT NOT NULL DEFAULT 1 REFERENCES USERS(ID);
+ALTER TABLE API_TOKENS ALTER COLUMN USER_ID DROP DEFAULT;
@@ -0,0 +1,2 @@
+DROP VIEW IF EXISTS NET_TRANSACTIONS;
+DROP TABLE IF EXISTS REIMBURSEMENTS;
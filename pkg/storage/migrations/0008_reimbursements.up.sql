@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS REIMBURSEMENTS (
+    TXN_ID BIGINT PRIMARY KEY REFERENCES TRANSACTIONS(ID) ON DELETE CASCADE,
+    EXPECTED_FROM TEXT NOT NULL,
+    CREDIT_TXN_ID BIGINT UNIQUE REFERENCES TRANSACTIONS(ID) ON DELETE SET NULL,
+    CREATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- NET_TRANSACTIONS are the transactions with reimbursed debits reduced by
+-- the credits reimbursing them, which are left out, for reporting spending
+-- net of reimbursements.
+CREATE OR REPLACE VIEW NET_TRANSACTIONS AS
+SELECT
+    t.ID, t.HOUSEHOLD_ID, t.DATE, t.DESCRIPTION,
+    t.AMOUNT_CENTS + COALESCE(c.AMOUNT_CENTS, 0) AS AMOUNT_CENTS,
+    t.SOURCE, t.TAGS, t.NOTES
+FROM TRANSACTIONS AS t
+LEFT JOIN REIMBURSEMENTS AS r ON r.TXN_ID = t.ID
+LEFT JOIN TRANSACTIONS AS c ON c.ID = r.CREDIT_TXN_ID
+WHERE NOT EXISTS (SELECT 1 FROM REIMBURSEMENTS AS l WHERE l.CREDIT_TXN_ID = t.ID);
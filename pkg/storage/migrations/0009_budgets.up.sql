@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS BUDGETS (
+    HOUSEHOLD_ID BIGINT NOT NULL REFERENCES HOUSEHOLDS(ID) ON DELETE CASCADE,
+    TAG TEXT NOT NULL,
+    PERIOD TEXT NOT NULL,
+    AMOUNT_CENTS BIGINT NOT NULL,
+    ROLLOVER BOOLEAN NOT NULL DEFAULT FALSE,
+    SINCE DATE NOT NULL,
+    CREATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UPDATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (HOUSEHOLD_ID, TAG, PERIOD)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS RECURRING_SERIES;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS RECURRING_SERIES (
+    ID BIGINT PRIMARY KEY REFERENCES TRANSACTIONS(ID) ON DELETE CASCADE,
+    NAME TEXT NOT NULL,
+    PERIOD TEXT NOT NULL,
+    AMOUNT_CENTS BIGINT NOT NULL,
+    TXN_IDS JSONB NOT NULL,
+    LAST_DATE DATE NOT NULL,
+    NEXT_DATE DATE NOT NULL,
+    ACTIVE BOOLEAN NOT NULL,
+    ALERTS JSONB NOT NULL,
+    UPDATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS TXN_MERCHANTS;
+DROP TABLE IF EXISTS MERCHANTS;
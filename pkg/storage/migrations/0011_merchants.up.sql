@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS MERCHANTS (
+    ID BIGSERIAL PRIMARY KEY,
+    HOUSEHOLD_ID BIGINT NOT NULL REFERENCES HOUSEHOLDS(ID) ON DELETE CASCADE,
+    NAME TEXT NOT NULL,
+    PATTERNS JSONB NOT NULL DEFAULT '[]',
+    CREATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (HOUSEHOLD_ID, NAME)
+);
+
+-- SOURCE is how the transaction was mapped to the merchant, see
+-- storage.TxnMerchant.
+CREATE TABLE IF NOT EXISTS TXN_MERCHANTS (
+    TXN_ID BIGINT PRIMARY KEY REFERENCES TRANSACTIONS(ID) ON DELETE CASCADE,
+    MERCHANT_ID BIGINT NOT NULL REFERENCES MERCHANTS(ID) ON DELETE CASCADE,
+    SOURCE TEXT NOT NULL,
+    UPDATED_AT TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS TXN_MERCHANTS_MERCHANT_ID_INDEX ON TXN_MERCHANTS(MERCHANT_ID);
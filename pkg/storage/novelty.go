@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// DescriptionNovelty returns how novel the descriptions of the transactions
+// matching tq are as the cosine distance between the description embedding
+// of each and the closest one of a transaction of the household dated
+// before it and no earlier than since. Bounding the comparisons by since
+// keeps the cost from growing with the whole history. Transactions without
+// an embedding or without earlier transactions with one are left out.
+func (s *Storage) DescriptionNovelty(ctx context.Context, tq *TxnQuery, since time.Time) (map[int64]float64, error) {
+	if err := tq.validate(); err != nil {
+		return nil, err
+	}
+	clauses, args, err := tq.asClauses(WithTableID("t."), withHousehold(s.household))
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, since.Format(dateQueryFmt))
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT t.ID, n.DISTANCE FROM TRANSACTIONS AS t
+		CROSS JOIN LATERAL (
+			SELECT t.DESC_EMBEDDING <=> e.DESC_EMBEDDING AS DISTANCE FROM TRANSACTIONS AS e
+			WHERE e.HOUSEHOLD_ID = t.HOUSEHOLD_ID AND e.DATE >= $%v AND e.DATE < t.DATE AND e.DESC_EMBEDDING IS NOT NULL
+			ORDER BY t.DESC_EMBEDDING <=> e.DESC_EMBEDDING
+			LIMIT 1
+		) AS n
+		WHERE t.DESC_EMBEDDING IS NOT NULL AND (%v)
+	`, len(args), clausesAsQuery(clauses)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying description novelty: %w", err)
+	}
+	defer rows.Close()
+	result := map[int64]float64{}
+	for rows.Next() {
+		var id int64
+		var d float64
+		if err := rows.Scan(&id, &d); err != nil {
+			return nil, fmt.Errorf("error scanning description novelty after %v transactions: %w", len(result), err)
+		}
+		result[id] = d
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying description novelty after %v transactions: %w", len(result), err)
+	}
+	return result, nil
+}
+
+// descriptionNovelty computes Storage.DescriptionNovelty over txns.
+func descriptionNovelty(txns []memTxn, tq *TxnQuery, since time.Time) (map[int64]float64, error) {
+	match, err := tq.matcher()
+	if err != nil {
+		return nil, err
+	}
+	result := map[int64]float64{}
+	for i := range txns {
+		t := &txns[i]
+		if t.embedding == nil || !match(&t.Txn) {
+			continue
+		}
+		closest := math.Inf(1)
+		for j := range txns {
+			e := &txns[j]
+			if e.embedding != nil && e.Date.Before(t.Date) && !e.Date.Before(since) {
+				closest = min(closest, cosineDistance(t.embedding, e.embedding))
+			}
+		}
+		if !math.IsInf(closest, 1) {
+			result[t.ID] = closest
+		}
+	}
+	return result, nil
+}
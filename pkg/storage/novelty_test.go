@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// testDescriptionNovelty tests the distance of description embeddings to
+// those of earlier transactions. s must not have any transactions.
+func testDescriptionNovelty(t *testing.T, s Store) {
+	ctx := context.Background()
+	txns := []Txn{
+		{Date: date("2024-01-01"), Description: "SAFEWAY", AmountCents: -100, Source: "AMEX", DescEmbedding: embedding(0)},
+		{Date: date("2024-01-02"), Description: "SAFEWAY 2", AmountCents: -100, Source: "AMEX", DescEmbedding: embedding(0, 1)},
+		{Date: date("2024-01-03"), Description: "JEWELLER", AmountCents: -90000, Source: "AMEX", DescEmbedding: embedding(2)},
+		{Date: date("2024-01-03"), Description: "NO EMBEDDING", AmountCents: -100, Source: "AMEX"},
+	}
+	createTxns(t, s, txns)
+	from := date("2024-01-02")
+	for _, tc := range []struct {
+		since time.Time
+		want  map[int64]float64
+	}{
+		{since: date("2024-01-01"), want: map[int64]float64{txns[1].ID: 1 - 1/math.Sqrt2, txns[2].ID: 1}},
+		// Only transactions since the given date are compared against.
+		{since: from, want: map[int64]float64{txns[2].ID: 1}},
+	} {
+		got, err := s.DescriptionNovelty(ctx, &TxnQuery{FromDate: &from}, tc.since)
+		if err != nil {
+			t.Fatalf("DescriptionNovelty since %v got error: %v", tc.since, err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("DescriptionNovelty since %v got %v, want %v", tc.since, got, tc.want)
+		}
+		for id, d := range tc.want {
+			if math.Abs(got[id]-d) > 1e-6 {
+				t.Errorf("DescriptionNovelty since %v of txn %v got %v, want %v", tc.since, id, got[id], d)
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// PeriodWeekly is only used by recurring series, which otherwise share
+	// their periods with budgets.
+	PeriodWeekly = "weekly"
+
+	AlertMissing       = "missing"
+	AlertAmountChanged = "amount_changed"
+)
+
+// RecurringSeries are transactions repeating every period with about the
+// same description and amount, e.g., a subscription.
+type RecurringSeries struct {
+	// ID is the ID of the first transaction of the series.
+	ID int64
+	// Name is the normalized description shared by the transactions.
+	Name   string
+	Period string
+	// AmountCents is the amount of the latest transaction.
+	AmountCents int64
+	TxnIDs      []int64
+	LastDate    time.Time
+	// NextDate is when the next transaction of the series is expected.
+	NextDate time.Time
+	// Active is false once the series missed several periods in a row, e.g.,
+	// when a subscription was cancelled.
+	Active    bool
+	Alerts    []RecurringAlert
+	UpdatedAt time.Time
+}
+
+// RecurringAlert flags a charge of a recurring series that's missing or
+// charged a different amount than before.
+type RecurringAlert struct {
+	Kind string `json:"kind"`
+	// Date is when the missing charge was expected or the changed charge was
+	// made.
+	Date          time.Time `json:"date"`
+	TxnID         int64     `json:"txn_id,omitempty"`
+	ExpectedCents int64     `json:"expected_cents"`
+	AmountCents   int64     `json:"amount_cents,omitempty"`
+}
+
+func (rs *RecurringSeries) validate() error {
+	if len(rs.TxnIDs) == 0 || rs.TxnIDs[0] != rs.ID {
+		return fmt.Errorf("recurring series %v didn't start with its own transaction, got transactions %v", rs.ID, rs.TxnIDs)
+	}
+	switch rs.Period {
+	case PeriodWeekly, PeriodMonthly, PeriodYearly:
+	default:
+		return fmt.Errorf("invalid period '%v' of recurring series %v", rs.Period, rs.ID)
+	}
+	for _, a := range rs.Alerts {
+		if a.Kind != AlertMissing && a.Kind != AlertAmountChanged {
+			return fmt.Errorf("invalid alert kind '%v' for recurring series %v", a.Kind, rs.ID)
+		}
+	}
+	return nil
+}
+
+// encode returns the transaction IDs and alerts of the series as JSON.
+func (rs *RecurringSeries) encode() ([]byte, []byte, error) {
+	txnIDs, err := json.Marshal(rs.TxnIDs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error encoding transactions of recurring series %v: %w", rs.ID, err)
+	}
+	alerts := rs.Alerts
+	if alerts == nil {
+		alerts = []RecurringAlert{}
+	}
+	alertsJSON, err := json.Marshal(alerts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error encoding alerts of recurring series %v: %w", rs.ID, err)
+	}
+	return txnIDs, alertsJSON, nil
+}
+
+const recurringColumnsSelected = "ID, NAME, PERIOD, AMOUNT_CENTS, TXN_IDS, LAST_DATE, NEXT_DATE, ACTIVE, ALERTS, UPDATED_AT"
+
+func scanRecurringSeries(row interface{ Scan(...any) error }) (RecurringSeries, error) {
+	var rs RecurringSeries
+	var txnIDs, alerts []byte
+	if err := row.Scan(&rs.ID, &rs.Name, &rs.Period, &rs.AmountCents, &txnIDs, &rs.LastDate, &rs.NextDate, &rs.Active, &alerts, &rs.UpdatedAt); err != nil {
+		return RecurringSeries{}, err
+	}
+	if err := json.Unmarshal(txnIDs, &rs.TxnIDs); err != nil {
+		return RecurringSeries{}, fmt.Errorf("recurring series %v had malformed transactions: %w", rs.ID, err)
+	}
+	if err := json.Unmarshal(alerts, &rs.Alerts); err != nil {
+		return RecurringSeries{}, fmt.Errorf("recurring series %v had malformed alerts: %w", rs.ID, err)
+	}
+	return rs, nil
+}
+
+// ReplaceRecurringSeries replaces the recurring series of the household with
+// the given ones, which must start with transactions of the household.
+func (s *Storage) ReplaceRecurringSeries(ctx context.Context, series []RecurringSeries) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM RECURRING_SERIES WHERE ID IN (`+fmt.Sprintf(householdTxnIDs, 1)+`)
+	`, s.household); err != nil {
+		return fmt.Errorf("error deleting recurring series: %w", err)
+	}
+	for i := range series {
+		rs := &series[i]
+		if err := rs.validate(); err != nil {
+			return err
+		}
+		txnIDs, alerts, err := rs.encode()
+		if err != nil {
+			return err
+		}
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM TRANSACTIONS WHERE ID = $1 AND HOUSEHOLD_ID = $2)
+		`, rs.ID, s.household).Scan(&exists); err != nil {
+			return fmt.Errorf("error fetching txn %v: %w", rs.ID, err)
+		} else if !exists {
+			return fmt.Errorf("%w: txn %v", ErrNotFound, rs.ID)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO RECURRING_SERIES (ID, NAME, PERIOD, AMOUNT_CENTS, TXN_IDS, LAST_DATE, NEXT_DATE, ACTIVE, ALERTS)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, rs.ID, rs.Name, rs.Period, rs.AmountCents, txnIDs, rs.LastDate.Format(dateQueryFmt), rs.NextDate.Format(dateQueryFmt), rs.Active, alerts); err != nil {
+			return fmt.Errorf("error creating recurring series %v: %w", rs.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error replacing recurring series: %w", err)
+	}
+	return nil
+}
+
+// ListRecurringSeries returns the recurring series of the household ordered
+// by their next expected date.
+func (s *Storage) ListRecurringSeries(ctx context.Context) ([]RecurringSeries, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+recurringColumnsSelected+` FROM RECURRING_SERIES
+		WHERE ID IN (`+fmt.Sprintf(householdTxnIDs, 1)+`) ORDER BY NEXT_DATE ASC, ID ASC
+	`, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying recurring series: %w", err)
+	}
+	return scanAll(rows, "recurring series", scanRecurringSeries)
+}
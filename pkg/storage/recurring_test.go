@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// testRecurring tests replacing and listing recurring series. s must not
+// have any transactions.
+func testRecurring(t *testing.T, s Store) {
+	ctx := context.Background()
+	txns := []Txn{
+		{Date: date("2024-01-05"), Description: "NETFLIX.COM 1234", AmountCents: -1549, Source: "AMEX"},
+		{Date: date("2024-02-05"), Description: "NETFLIX.COM 5678", AmountCents: -1549, Source: "AMEX"},
+		{Date: date("2024-03-05"), Description: "NETFLIX.COM 9012", AmountCents: -1799, Source: "AMEX"},
+		{Date: date("2024-01-01"), Description: "GYM", AmountCents: -5000, Source: "AMEX"},
+	}
+	createTxns(t, s, txns)
+	netflix := RecurringSeries{
+		ID:          txns[0].ID,
+		Name:        "NETFLIX COM",
+		Period:      PeriodMonthly,
+		AmountCents: -1799,
+		TxnIDs:      []int64{txns[0].ID, txns[1].ID, txns[2].ID},
+		LastDate:    date("2024-03-05"),
+		NextDate:    date("2024-04-05"),
+		Active:      true,
+		Alerts:      []RecurringAlert{{Kind: AlertAmountChanged, Date: date("2024-03-05"), TxnID: txns[2].ID, ExpectedCents: -1549, AmountCents: -1799}},
+	}
+	gym := RecurringSeries{ID: txns[3].ID, Name: "GYM", Period: PeriodYearly, AmountCents: -5000, TxnIDs: []int64{txns[3].ID}, LastDate: date("2024-01-01"), NextDate: date("2025-01-01")}
+
+	for _, tc := range []struct {
+		name    string
+		rs      RecurringSeries
+		wantErr error
+	}{
+		{name: "missing txn", rs: RecurringSeries{ID: txns[3].ID + 1, Period: PeriodWeekly, TxnIDs: []int64{txns[3].ID + 1}}, wantErr: ErrNotFound},
+		{name: "invalid period", rs: RecurringSeries{ID: txns[3].ID, Period: "daily", TxnIDs: []int64{txns[3].ID}}},
+		{name: "not starting with its txn", rs: RecurringSeries{ID: txns[3].ID, Period: PeriodWeekly, TxnIDs: []int64{txns[0].ID}}},
+	} {
+		err := s.ReplaceRecurringSeries(ctx, []RecurringSeries{gym, tc.rs})
+		if err == nil || (tc.wantErr != nil && !errors.Is(err, tc.wantErr)) {
+			t.Errorf("ReplaceRecurringSeries %v got error %v, want %v", tc.name, err, tc.wantErr)
+		}
+	}
+	if got, err := s.ListRecurringSeries(ctx); err != nil || len(got) != 0 {
+		t.Errorf("ListRecurringSeries after failed replace got %+v, %v, want no series", got, err)
+	}
+
+	if err := s.ReplaceRecurringSeries(ctx, []RecurringSeries{gym, netflix}); err != nil {
+		t.Fatalf("ReplaceRecurringSeries got error: %v", err)
+	}
+	got, err := s.ListRecurringSeries(ctx)
+	if err != nil {
+		t.Fatalf("ListRecurringSeries got error: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != netflix.ID || got[1].ID != gym.ID {
+		t.Fatalf("ListRecurringSeries got %+v, want netflix then gym", got)
+	}
+	g := got[0]
+	if g.Name != netflix.Name || g.Period != netflix.Period || g.AmountCents != netflix.AmountCents || !slices.Equal(g.TxnIDs, netflix.TxnIDs) ||
+		!g.LastDate.Equal(netflix.LastDate) || !g.NextDate.Equal(netflix.NextDate) || !g.Active {
+		t.Errorf("ListRecurringSeries got %+v, want %+v", g, netflix)
+	}
+	if len(g.Alerts) != 1 || g.Alerts[0].Kind != AlertAmountChanged || g.Alerts[0].TxnID != txns[2].ID || !g.Alerts[0].Date.Equal(date("2024-03-05")) {
+		t.Errorf("ListRecurringSeries got alerts %+v, want %+v", g.Alerts, netflix.Alerts)
+	}
+	if got[1].Active || len(got[1].Alerts) != 0 {
+		t.Errorf("ListRecurringSeries got %+v, want inactive series without alerts", got[1])
+	}
+
+	if err := s.ReplaceRecurringSeries(ctx, []RecurringSeries{gym}); err != nil {
+		t.Fatalf("ReplaceRecurringSeries got error: %v", err)
+	}
+	if got, err := s.ListRecurringSeries(ctx); err != nil || len(got) != 1 || got[0].ID != gym.ID {
+		t.Errorf("ListRecurringSeries after replace got %+v, %v, want only gym", got, err)
+	}
+}
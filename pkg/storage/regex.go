@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+const (
+	regexNodesLimit      = 100
+	regexRepeatLimit     = 100
+	regexStarHeightLimit = 1
+)
+
+// validateRegex guards the database from regexes that are expensive to
+// evaluate with Postgres' backtracking regex engine. Regexes must parse as
+// RE2 syntax, which rules out backreferences, and are limited in size,
+// repetition counts and nesting of repetitions. They also mustn't use
+// constructs Postgres reads differently from RE2, which matches them in Go.
+func validateRegex(re string) error {
+	if err := checkRegexDialect(re); err != nil {
+		return err
+	}
+	parsed, err := syntax.Parse(re, syntax.Perl)
+	if err != nil {
+		return fmt.Errorf("invalid regex %q: %w", re, err)
+	}
+	nodes := 0
+	var walk func(r *syntax.Regexp, starHeight int) error
+	walk = func(r *syntax.Regexp, starHeight int) error {
+		nodes++
+		if nodes > regexNodesLimit {
+			return fmt.Errorf("regex %q is too complex, want <= %v nodes", re, regexNodesLimit)
+		}
+		switch r.Op {
+		case syntax.OpStar, syntax.OpPlus, syntax.OpRepeat:
+			starHeight++
+			if starHeight > regexStarHeightLimit {
+				return fmt.Errorf("regex %q nests repetitions too deeply, want <= %v levels", re, regexStarHeightLimit)
+			}
+			if r.Op == syntax.OpRepeat && (r.Min > regexRepeatLimit || r.Max > regexRepeatLimit) {
+				return fmt.Errorf("regex %q has too large a repetition count, want <= %v", re, regexRepeatLimit)
+			}
+		}
+		for _, s := range r.Sub {
+			if err := walk(s, starHeight); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(parsed, 0)
+}
+
+// regexEscapes are the letter and digit escapes meaning the same in RE2 and
+// Postgres' advanced regexes, outside and inside bracket expressions.
+// Escaped punctuation is a literal in both. Others differ, e.g., \b is a
+// word boundary in RE2 but a backspace in Postgres, \w and \s follow the
+// database locale in Postgres and \z, \Q and \p are errors in Postgres.
+const (
+	regexEscapes      = "dDAtnrfva"
+	regexClassEscapes = "dtnrfva"
+)
+
+// checkRegexDialect rejects escapes other than regexEscapes, groups with
+// flags, which the case insensitive match in Go is prefixed with, and
+// character classes, collating elements and equivalence classes inside
+// bracket expressions, which follow the database locale in Postgres.
+func checkRegexDialect(re string) error {
+	inClass, classStart := false, 0
+	for i := 0; i < len(re); i++ {
+		c := re[i]
+		switch {
+		case c == '\\':
+			if i+1 == len(re) {
+				// Left to syntax.Parse to report.
+				return nil
+			}
+			i++
+			e := re[i]
+			allowed := regexEscapes
+			if inClass {
+				allowed = regexClassEscapes
+			}
+			if isASCIIAlnum(e) && strings.IndexByte(allowed, e) < 0 {
+				return fmt.Errorf("escape \\%c isn't supported in regex %q, it means something else in the database", e, re)
+			}
+		case inClass:
+			if c == ']' && i > classStart {
+				inClass = false
+			} else if c == '[' && i+1 < len(re) && strings.IndexByte(":.=", re[i+1]) >= 0 {
+				return fmt.Errorf("%q isn't supported in regex %q, it means something else in the database, list the characters instead", re[i:i+2], re)
+			}
+		case c == '[':
+			inClass, classStart = true, i+1
+			if classStart < len(re) && re[classStart] == '^' {
+				classStart++
+			}
+		case c == '(' && strings.HasPrefix(re[i:], "(?") && !strings.HasPrefix(re[i:], "(?:"):
+			return fmt.Errorf("flags and named groups are not supported in regex %q, only (?: groups", re)
+		}
+	}
+	return nil
+}
+
+func isASCIIAlnum(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike escapes s so it matches literally in a LIKE pattern.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
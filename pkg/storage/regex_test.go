@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRegex(t *testing.T) {
+	for _, tc := range []struct {
+		re      string
+		wantErr string
+	}{
+		{re: `^uber (trip|eats)$`},
+		{re: `^AMZN\s`, wantErr: `escape \s isn't supported`},
+		{re: `^AMZN `},
+		{re: `\d{4}-\d{2}`},
+		{re: `[^\d]+\D`},
+		{re: `\AAMAZON\.CA`},
+		{re: `TAB\tSEP`},
+		{re: `\(REF: [0-9]+\)`},
+		{re: `a\\b`},
+		{re: `a\\p`},
+		{re: `[]a]`},
+		{re: `[^]a]`},
+		{re: `[a-z\]]+`},
+		{re: `(?:uber|lyft) trip`},
+		{re: `Café Crème`},
+		{re: `\bUBER\b`, wantErr: `escape \b isn't supported`},
+		{re: `UBER\B`, wantErr: `escape \B isn't supported`},
+		{re: `\w+`, wantErr: `escape \w isn't supported`},
+		{re: `[\s]`, wantErr: `escape \s isn't supported`},
+		{re: `[\D]`, wantErr: `escape \D isn't supported`},
+		{re: `UBER\z`, wantErr: `escape \z isn't supported`},
+		{re: `UBER\Z`, wantErr: `escape \Z isn't supported`},
+		{re: `\Q*\E`, wantErr: `escape \Q isn't supported`},
+		{re: `\pL`, wantErr: `escape \p isn't supported`},
+		{re: `\PL`, wantErr: `escape \P isn't supported`},
+		{re: `\x41B`, wantErr: `escape \x isn't supported`},
+		{re: `\101`, wantErr: `escape \1 isn't supported`},
+		{re: `(a)\1`, wantErr: `escape \1 isn't supported`},
+		{re: `\y`, wantErr: `escape \y isn't supported`},
+		{re: `[[:alpha:]]+`, wantErr: `"[:" isn't supported`},
+		{re: `[[.a.]]`, wantErr: `"[." isn't supported`},
+		{re: `[[=e=]]`, wantErr: `"[=" isn't supported`},
+		{re: `[[]`},
+		{re: `(?i)uber`, wantErr: "flags and named groups are not supported"},
+		{re: `(?-i:uber)`, wantErr: "flags and named groups are not supported"},
+		{re: `(?s).`, wantErr: "flags and named groups are not supported"},
+		{re: `(?P<name>uber)`, wantErr: "flags and named groups are not supported"},
+		{re: `\(?uber`},
+		{re: `(`, wantErr: "invalid regex"},
+		{re: `uber\`, wantErr: "invalid regex"},
+		{re: `(a+)+`, wantErr: "nests repetitions too deeply"},
+		{re: `a{101}`, wantErr: "too large a repetition count"},
+		{re: strings.Repeat("(a)", regexNodesLimit), wantErr: "too complex"},
+	} {
+		err := validateRegex(tc.re)
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("validateRegex(%q) got error: %v", tc.re, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("validateRegex(%q) got error %v, want error containing %q", tc.re, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const ExpectedFromLimit = 100
+
+var ErrInvalidReimbursement = errors.New("invalid reimbursement")
+
+// Reimbursement marks a debit as an expense someone else pays back, e.g.,
+// an employer. It's outstanding until the incoming credit paying it back is
+// linked to it. A credit reimburses at most one debit.
+type Reimbursement struct {
+	TxnID        int64
+	ExpectedFrom string
+	// CreditTxnID is the credit reimbursing the debit, 0 while the
+	// reimbursement is outstanding.
+	CreditTxnID int64
+	// Date, Description and AmountCents are those of the debit and
+	// CreditAmountCents is the amount of the credit. They're filled in when
+	// reading reimbursements and ignored when setting them.
+	Date              time.Time
+	Description       string
+	AmountCents       int64
+	CreditAmountCents int64
+	CreatedAt         time.Time
+}
+
+// Outstanding reports whether no credit was linked to the reimbursement.
+func (r *Reimbursement) Outstanding() bool {
+	return r.CreditTxnID == 0
+}
+
+// NetCents is the cost of the debit after the credit reimbursing it.
+func (r *Reimbursement) NetCents() int64 {
+	return r.AmountCents + r.CreditAmountCents
+}
+
+func ValidateExpectedFrom(from string) error {
+	return validateText("expected payer", from, ExpectedFromLimit)
+}
+
+const reimbursementColumnsSelected = `r.TXN_ID, r.EXPECTED_FROM, COALESCE(r.CREDIT_TXN_ID, 0), t.DATE, t.DESCRIPTION, t.AMOUNT_CENTS, COALESCE(c.AMOUNT_CENTS, 0), r.CREATED_AT
+	FROM REIMBURSEMENTS AS r
+	JOIN TRANSACTIONS AS t ON t.ID = r.TXN_ID
+	LEFT JOIN TRANSACTIONS AS c ON c.ID = r.CREDIT_TXN_ID`
+
+func scanReimbursement(row interface{ Scan(...any) error }) (Reimbursement, error) {
+	var r Reimbursement
+	err := row.Scan(&r.TxnID, &r.ExpectedFrom, &r.CreditTxnID, &r.Date, &r.Description, &r.AmountCents, &r.CreditAmountCents, &r.CreatedAt)
+	return r, err
+}
+
+// checkReimbursable checks a transaction with the given amount can be marked
+// reimbursable.
+func checkReimbursable(txnID, amountCents int64) error {
+	if amountCents >= 0 {
+		return fmt.Errorf("%w: txn %v with amount %v cents isn't a debit", ErrInvalidReimbursement, txnID, amountCents)
+	}
+	return nil
+}
+
+// checkReimbursing checks a transaction with the given amount can be linked
+// as the credit reimbursing a debit.
+func checkReimbursing(creditTxnID, amountCents int64) error {
+	if amountCents <= 0 {
+		return fmt.Errorf("%w: txn %v with amount %v cents isn't a credit", ErrInvalidReimbursement, creditTxnID, amountCents)
+	}
+	return nil
+}
+
+// SetReimbursable marks a debit reimbursable or changes who is expected to
+// pay it back. The linked credit of a reimbursable debit is kept.
+func (s *Storage) SetReimbursable(ctx context.Context, r *Reimbursement) error {
+	if err := ValidateExpectedFrom(r.ExpectedFrom); err != nil {
+		return err
+	}
+	var amountCents int64
+	err := s.db.QueryRowContext(ctx, `SELECT AMOUNT_CENTS FROM TRANSACTIONS WHERE ID = $1 AND HOUSEHOLD_ID = $2`, r.TxnID, s.household).Scan(&amountCents)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: txn %v", ErrNotFound, r.TxnID)
+	} else if err != nil {
+		return fmt.Errorf("error fetching txn %v: %w", r.TxnID, err)
+	}
+	if err := checkReimbursable(r.TxnID, amountCents); err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO REIMBURSEMENTS (TXN_ID, EXPECTED_FROM) VALUES ($1, $2)
+		ON CONFLICT (TXN_ID) DO UPDATE SET EXPECTED_FROM = EXCLUDED.EXPECTED_FROM
+	`, r.TxnID, r.ExpectedFrom)
+	if isPQErr(err, pqForeignKeyViolation) {
+		return fmt.Errorf("%w: txn %v", ErrNotFound, r.TxnID)
+	} else if err != nil {
+		return fmt.Errorf("error marking txn %v reimbursable: %w", r.TxnID, err)
+	}
+	return nil
+}
+
+func (s *Storage) GetReimbursement(ctx context.Context, txnID int64) (Reimbursement, error) {
+	r, err := scanReimbursement(s.db.QueryRowContext(ctx, `
+		SELECT `+reimbursementColumnsSelected+` WHERE r.TXN_ID = $1 AND t.HOUSEHOLD_ID = $2
+	`, txnID, s.household))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reimbursement{}, fmt.Errorf("%w: reimbursement of txn %v", ErrNotFound, txnID)
+	} else if err != nil {
+		return Reimbursement{}, fmt.Errorf("error fetching reimbursement of txn %v: %w", txnID, err)
+	}
+	return r, nil
+}
+
+// ListReimbursements returns the reimbursements of the household, or only
+// the outstanding ones, ordered by the date and ID of their debits.
+func (s *Storage) ListReimbursements(ctx context.Context, outstandingOnly bool) ([]Reimbursement, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+reimbursementColumnsSelected+`
+		WHERE t.HOUSEHOLD_ID = $1 AND (NOT $2 OR r.CREDIT_TXN_ID IS NULL)
+		ORDER BY t.DATE ASC, t.ID ASC
+	`, s.household, outstandingOnly)
+	if err != nil {
+		return nil, fmt.Errorf("error querying reimbursements: %w", err)
+	}
+	return scanAll(rows, "reimbursements", scanReimbursement)
+}
+
+// DeleteReimbursement marks a debit as no longer reimbursable.
+func (s *Storage) DeleteReimbursement(ctx context.Context, txnID int64) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM REIMBURSEMENTS WHERE TXN_ID = $1 AND TXN_ID IN (`+fmt.Sprintf(householdTxnIDs, 2)+`)
+	`, txnID, s.household)
+	if err != nil {
+		return fmt.Errorf("error deleting reimbursement of txn %v: %w", txnID, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify reimbursement of txn %v was deleted: %w", txnID, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: reimbursement of txn %v", ErrNotFound, txnID)
+	}
+	return nil
+}
+
+// LinkReimbursement records the credit reimbursing a reimbursable debit,
+// replacing any credit linked before.
+func (s *Storage) LinkReimbursement(ctx context.Context, txnID, creditTxnID int64) error {
+	return s.LinkReimbursements(ctx, map[int64]int64{txnID: creditTxnID})
+}
+
+// LinkReimbursements records the credits reimbursing several reimbursable
+// debits, keyed by the debit's txn ID, in a single database transaction so
+// either every credit is linked or none is.
+func (s *Storage) LinkReimbursements(ctx context.Context, links map[int64]int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	for _, txnID := range sortedLinks(links) {
+		creditTxnID := links[txnID]
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM REIMBURSEMENTS WHERE TXN_ID = $1 AND TXN_ID IN (`+fmt.Sprintf(householdTxnIDs, 2)+`))
+		`, txnID, s.household).Scan(&exists); err != nil {
+			return fmt.Errorf("error fetching reimbursement of txn %v: %w", txnID, err)
+		} else if !exists {
+			return fmt.Errorf("%w: reimbursement of txn %v", ErrNotFound, txnID)
+		}
+		var amountCents int64
+		err = tx.QueryRowContext(ctx, `SELECT AMOUNT_CENTS FROM TRANSACTIONS WHERE ID = $1 AND HOUSEHOLD_ID = $2`, creditTxnID, s.household).Scan(&amountCents)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: txn %v", ErrNotFound, creditTxnID)
+		} else if err != nil {
+			return fmt.Errorf("error fetching txn %v: %w", creditTxnID, err)
+		}
+		if err := checkReimbursing(creditTxnID, amountCents); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE REIMBURSEMENTS SET CREDIT_TXN_ID = $2 WHERE TXN_ID = $1`, txnID, creditTxnID)
+		if isPQErr(err, pqUniqueViolation) {
+			return fmt.Errorf("%w: reimbursement by credit txn %v", ErrAlreadyExists, creditTxnID)
+		} else if err != nil {
+			return fmt.Errorf("error linking credit txn %v to reimbursement of txn %v: %w", creditTxnID, txnID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing linked reimbursements: %w", err)
+	}
+	return nil
+}
+
+// sortedLinks returns the debit txn IDs of links in ascending order so
+// they're linked, and fail, in a deterministic order.
+func sortedLinks(links map[int64]int64) []int64 {
+	result := make([]int64, 0, len(links))
+	for txnID := range links {
+		result = append(result, txnID)
+	}
+	slices.Sort(result)
+	return result
+}
+
+// UnlinkReimbursement makes a reimbursement outstanding again.
+func (s *Storage) UnlinkReimbursement(ctx context.Context, txnID int64) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE REIMBURSEMENTS SET CREDIT_TXN_ID = NULL WHERE TXN_ID = $1 AND TXN_ID IN (`+fmt.Sprintf(householdTxnIDs, 2)+`)
+	`, txnID, s.household)
+	if err != nil {
+		return fmt.Errorf("error unlinking reimbursement of txn %v: %w", txnID, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify reimbursement of txn %v was unlinked: %w", txnID, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: reimbursement of txn %v", ErrNotFound, txnID)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// testReimbursements tests marking debits reimbursable and linking the
+// credits reimbursing them. s must not have any transactions.
+func testReimbursements(t *testing.T, s Store) {
+	ctx := context.Background()
+	txns := []Txn{
+		{Date: date("2024-02-01"), Description: "HOTEL", AmountCents: -40000, Source: "AMEX"},
+		{Date: date("2024-01-15"), Description: "FLIGHT", AmountCents: -60000, Source: "AMEX"},
+		{Date: date("2024-02-20"), Description: "ACME PAYROLL EXPENSES", AmountCents: 40000, Source: "RBC"},
+	}
+	createTxns(t, s, txns)
+	hotel, flight, credit := txns[0].ID, txns[1].ID, txns[2].ID
+
+	for _, tc := range []struct {
+		name    string
+		r       Reimbursement
+		wantErr error
+	}{
+		{name: "missing txn", r: Reimbursement{TxnID: credit + 1, ExpectedFrom: "ACME"}, wantErr: ErrNotFound},
+		{name: "credit", r: Reimbursement{TxnID: credit, ExpectedFrom: "ACME"}, wantErr: ErrInvalidReimbursement},
+	} {
+		if err := s.SetReimbursable(ctx, &tc.r); !errors.Is(err, tc.wantErr) {
+			t.Errorf("SetReimbursable %v got error %v, want %v", tc.name, err, tc.wantErr)
+		}
+	}
+	for _, id := range []int64{hotel, flight} {
+		if err := s.SetReimbursable(ctx, &Reimbursement{TxnID: id, ExpectedFrom: "ACME"}); err != nil {
+			t.Fatalf("SetReimbursable of txn %v got error: %v", id, err)
+		}
+	}
+
+	if err := s.LinkReimbursement(ctx, hotel, flight); !errors.Is(err, ErrInvalidReimbursement) {
+		t.Errorf("LinkReimbursement to a debit got error %v, want %v", err, ErrInvalidReimbursement)
+	}
+	if err := s.LinkReimbursement(ctx, credit, hotel); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LinkReimbursement of a txn that isn't reimbursable got error %v, want %v", err, ErrNotFound)
+	}
+	if err := s.LinkReimbursement(ctx, hotel, credit); err != nil {
+		t.Fatalf("LinkReimbursement got error: %v", err)
+	}
+	if err := s.LinkReimbursement(ctx, flight, credit); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("LinkReimbursement of a linked credit got error %v, want %v", err, ErrAlreadyExists)
+	}
+	// Changing the expected payer keeps the linked credit.
+	if err := s.SetReimbursable(ctx, &Reimbursement{TxnID: hotel, ExpectedFrom: "ACME Corp"}); err != nil {
+		t.Fatalf("SetReimbursable changing the payer got error: %v", err)
+	}
+	got, err := s.GetReimbursement(ctx, hotel)
+	if err != nil {
+		t.Fatalf("GetReimbursement got error: %v", err)
+	}
+	if got.ExpectedFrom != "ACME Corp" || got.CreditTxnID != credit || got.Outstanding() || got.NetCents() != 0 || got.Description != "HOTEL" {
+		t.Errorf("GetReimbursement got %+v, want the hotel reimbursed by txn %v from ACME Corp", got, credit)
+	}
+
+	ids := func(rs []Reimbursement) []int64 {
+		var result []int64
+		for _, r := range rs {
+			result = append(result, r.TxnID)
+		}
+		return result
+	}
+	all, err := s.ListReimbursements(ctx, false)
+	if err != nil {
+		t.Fatalf("ListReimbursements got error: %v", err)
+	}
+	if want := []int64{flight, hotel}; !slices.Equal(ids(all), want) {
+		t.Errorf("ListReimbursements got txns %v, want %v", ids(all), want)
+	}
+	outstanding, err := s.ListReimbursements(ctx, true)
+	if err != nil {
+		t.Fatalf("ListReimbursements outstanding got error: %v", err)
+	}
+	if want := []int64{flight}; !slices.Equal(ids(outstanding), want) {
+		t.Errorf("ListReimbursements outstanding got txns %v, want %v", ids(outstanding), want)
+	}
+
+	if err := s.UnlinkReimbursement(ctx, hotel); err != nil {
+		t.Fatalf("UnlinkReimbursement got error: %v", err)
+	}
+	if got, err := s.GetReimbursement(ctx, hotel); err != nil || !got.Outstanding() || got.NetCents() != -40000 {
+		t.Errorf("GetReimbursement after unlinking got %+v, %v, want it outstanding", got, err)
+	}
+	// A failing link leaves every other link in the batch out.
+	if err := s.LinkReimbursements(ctx, map[int64]int64{hotel: credit, flight: hotel}); !errors.Is(err, ErrInvalidReimbursement) {
+		t.Errorf("LinkReimbursements with a debit credit got error %v, want %v", err, ErrInvalidReimbursement)
+	}
+	if got, err := s.GetReimbursement(ctx, hotel); err != nil || !got.Outstanding() {
+		t.Errorf("GetReimbursement after failed LinkReimbursements got %+v, %v, want it outstanding", got, err)
+	}
+	if err := s.LinkReimbursements(ctx, map[int64]int64{hotel: credit}); err != nil {
+		t.Fatalf("LinkReimbursements got error: %v", err)
+	}
+	if got, err := s.GetReimbursement(ctx, hotel); err != nil || got.CreditTxnID != credit {
+		t.Errorf("GetReimbursement after LinkReimbursements got %+v, %v, want it reimbursed by txn %v", got, err, credit)
+	}
+	if err := s.DeleteReimbursement(ctx, hotel); err != nil {
+		t.Fatalf("DeleteReimbursement got error: %v", err)
+	}
+	if err := s.DeleteReimbursement(ctx, hotel); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteReimbursement twice got error %v, want %v", err, ErrNotFound)
+	}
+}
+
+// testNetSpending tests that spending by tag and merchant is net of
+// reimbursements. s must not have any transactions or merchants.
+func testNetSpending(t *testing.T, s Store) {
+	ctx := context.Background()
+	txns := []Txn{
+		{Date: date("2024-02-01"), Description: "HOTEL", AmountCents: -40000, Source: "AMEX", Tags: []string{"travel"}},
+		{Date: date("2024-02-05"), Description: "HOTEL", AmountCents: -10000, Source: "AMEX", Tags: []string{"travel"}},
+		{Date: date("2024-03-20"), Description: "ACME PAYROLL EXPENSES", AmountCents: 40000, Source: "RBC", Tags: []string{"travel"}},
+	}
+	createTxns(t, s, txns)
+	if err := s.SetReimbursable(ctx, &Reimbursement{TxnID: txns[0].ID, ExpectedFrom: "ACME"}); err != nil {
+		t.Fatalf("SetReimbursable got error: %v", err)
+	}
+	if err := s.LinkReimbursement(ctx, txns[0].ID, txns[2].ID); err != nil {
+		t.Fatalf("LinkReimbursement got error: %v", err)
+	}
+	hotel := Merchant{Name: "Hotel"}
+	var err error
+	if hotel.ID, err = s.CreateMerchant(ctx, &hotel); err != nil {
+		t.Fatalf("CreateMerchant got error: %v", err)
+	}
+	var mappings []TxnMerchant
+	for _, txn := range txns {
+		mappings = append(mappings, TxnMerchant{TxnID: txn.ID, MerchantID: hotel.ID, Source: MappedManually})
+	}
+	if err := s.SetTxnMerchants(ctx, mappings); err != nil {
+		t.Fatalf("SetTxnMerchants got error: %v", err)
+	}
+
+	spending, err := s.SpendingByTagMonth(ctx, []string{"travel"}, date("2024-01-01"), date("2024-12-31"))
+	if err != nil {
+		t.Fatalf("SpendingByTagMonth got error: %v", err)
+	}
+	if len(spending) != 1 || !spending[0].Month.Equal(date("2024-02-01")) || spending[0].SpentCents != 10000 {
+		t.Errorf("SpendingByTagMonth got %+v, want 10000 cents spent on travel in 2024-02", spending)
+	}
+	merchantSpending, err := s.MerchantSpending(ctx, &TxnQuery{})
+	if err != nil {
+		t.Fatalf("MerchantSpending got error: %v", err)
+	}
+	if want := []MerchantSpending{{MerchantID: hotel.ID, Name: "Hotel", TxnCount: 2, AmountCents: -10000}}; !slices.Equal(merchantSpending, want) {
+		t.Errorf("MerchantSpending got %+v, want %+v", merchantSpending, want)
+	}
+}
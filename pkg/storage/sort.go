@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	SortID          = "id"
+	SortDate        = "date"
+	SortAmount      = "amount"
+	SortDescription = "description"
+	SortSource      = "source"
+)
+
+var (
+	ValidSorts  = fmt.Sprintf("%v|%v|%v|%v|%v", SortID, SortDate, SortAmount, SortDescription, SortSource)
+	sortColumns = map[string]string{
+		SortID:          "ID",
+		SortDate:        "DATE",
+		SortAmount:      "AMOUNT_CENTS",
+		SortDescription: "DESCRIPTION",
+		SortSource:      "SOURCE",
+	}
+)
+
+func ValidateSort(sort string) bool {
+	_, ok := sortColumns[sort]
+	return ok
+}
+
+// Cursor identifies the last row of a page of transactions returned by
+// QueryTxns for a given sort order. It is handed to clients as an opaque
+// string and resumes the query strictly after that row.
+type Cursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	Key  string `json:"k"`
+	ID   int64  `json:"i"`
+}
+
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("cursor was not valid base64: %w", err)
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("cursor was malformed: %w", err)
+	}
+	if !ValidateSort(c.Sort) {
+		return nil, fmt.Errorf("cursor had unknown sort '%v'", c.Sort)
+	}
+	if _, err := c.keyArg(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *Cursor) keyArg() (any, error) {
+	switch c.Sort {
+	case SortID:
+		return c.ID, nil
+	case SortAmount:
+		a, err := strconv.ParseInt(c.Key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cursor had invalid amount key '%v': %w", c.Key, err)
+		}
+		return a, nil
+	case SortDate:
+		if _, err := time.Parse(dateQueryFmt, c.Key); err != nil {
+			return nil, fmt.Errorf("cursor had invalid date key '%v': %w", c.Key, err)
+		}
+	}
+	return c.Key, nil
+}
+
+// NextCursor returns the cursor that resumes the query after the given
+// transaction, which should be the last transaction of the current page.
+func (tq *TxnQuery) NextCursor(last *Txn) *Cursor {
+	c := &Cursor{Sort: tq.sort(), Desc: tq.SortDesc, ID: last.ID}
+	switch c.Sort {
+	case SortDate:
+		c.Key = last.Date.Format(dateQueryFmt)
+	case SortAmount:
+		c.Key = fmt.Sprint(last.AmountCents)
+	case SortDescription:
+		c.Key = last.Description
+	case SortSource:
+		c.Key = last.Source
+	}
+	return c
+}
+
+func (tq *TxnQuery) sort() string {
+	if tq.Sort == "" {
+		return SortID
+	}
+	return tq.Sort
+}
+
+func (tq *TxnQuery) validateSort() error {
+	if !ValidateSort(tq.sort()) {
+		return fmt.Errorf("invalid sort '%v', want %v", tq.Sort, ValidSorts)
+	}
+	if tq.After != nil && (tq.After.Sort != tq.sort() || tq.After.Desc != tq.SortDesc) {
+		return fmt.Errorf("cursor was created for a different sort order, got sort '%v' desc=%v, want sort '%v' desc=%v",
+			tq.After.Sort, tq.After.Desc, tq.sort(), tq.SortDesc)
+	}
+	return nil
+}
+
+// keysetClause returns the clause selecting rows strictly after the
+// cursor in the query's sort order, if a cursor was given.
+func (tq *TxnQuery) keysetClause(firstArg int) (string, []any, error) {
+	if tq.After == nil {
+		return "", nil, nil
+	}
+	cmp := ">"
+	if tq.SortDesc {
+		cmp = "<"
+	}
+	if tq.sort() == SortID {
+		return fmt.Sprintf("ID %v $%v", cmp, firstArg), []any{tq.After.ID}, nil
+	}
+	key, err := tq.After.keyArg()
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("(%v, ID) %v ($%v, $%v)", sortColumns[tq.sort()], cmp, firstArg, firstArg+1),
+		[]any{key, tq.After.ID}, nil
+}
+
+func (tq *TxnQuery) orderBy() string {
+	dir := "ASC"
+	if tq.SortDesc {
+		dir = "DESC"
+	}
+	if tq.sort() == SortID {
+		return "ID " + dir
+	}
+	return fmt.Sprintf("%v %v, ID %v", sortColumns[tq.sort()], dir, dir)
+}
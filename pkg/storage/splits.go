@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	PersonNameLimit = 50
+	MaxSplitShares  = 50
+)
+
+var ErrInvalidSplit = errors.New("invalid split")
+
+// Share is the part of the amount of a transaction a person is responsible
+// for. It has the same sign as the amount of the transaction.
+type Share struct {
+	Person      string `json:"person"`
+	AmountCents int64  `json:"amount_cents"`
+}
+
+// Split divides a transaction between people. PaidBy paid the whole amount
+// of the transaction and is responsible for whatever the shares of the
+// other people don't cover. A payment between two people is recorded by
+// splitting the transfer transaction with the payer's share going to the
+// person who was paid.
+type Split struct {
+	TxnID  int64
+	PaidBy string
+	Shares []Share
+	// Date and AmountCents are those of the transaction. They're filled in
+	// when reading splits and ignored when setting them.
+	Date        time.Time
+	AmountCents int64
+	UpdatedAt   time.Time
+}
+
+func ValidatePersonName(name string) error {
+	return validateText("person name", name, PersonNameLimit)
+}
+
+func (s *Split) validate() error {
+	if err := ValidatePersonName(s.PaidBy); err != nil {
+		return fmt.Errorf("invalid payer: %w", err)
+	}
+	if l := len(s.Shares); l == 0 || l > MaxSplitShares {
+		return fmt.Errorf("invalid number of shares, got %v, want >0 and <= %v", l, MaxSplitShares)
+	}
+	seen := map[string]bool{}
+	for i, sh := range s.Shares {
+		if err := ValidatePersonName(sh.Person); err != nil {
+			return fmt.Errorf("invalid share at index %v: %w", i, err)
+		}
+		if seen[sh.Person] {
+			return fmt.Errorf("duplicate share for '%v' at index %v", sh.Person, i)
+		}
+		seen[sh.Person] = true
+		if sh.AmountCents == 0 {
+			return fmt.Errorf("share of '%v' at index %v was zero", sh.Person, i)
+		}
+	}
+	return nil
+}
+
+// checkSharesCover checks the shares of s have the sign of the transaction
+// amount and don't add up to more than it.
+func (s *Split) checkSharesCover(amountCents int64) error {
+	var total int64
+	for _, sh := range s.Shares {
+		if (sh.AmountCents < 0) != (amountCents < 0) || amountCents == 0 {
+			return fmt.Errorf("%w: share of '%v' was %v cents for txn %v with amount %v cents, want the same sign", ErrInvalidSplit, sh.Person, sh.AmountCents, s.TxnID, amountCents)
+		}
+		total += sh.AmountCents
+	}
+	if abs(total) > abs(amountCents) {
+		return fmt.Errorf("%w: shares added up to %v cents, more than the amount %v cents of txn %v", ErrInvalidSplit, total, amountCents, s.TxnID)
+	}
+	return nil
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func scanSplit(row interface{ Scan(...any) error }) (Split, error) {
+	var s Split
+	var shares []byte
+	if err := row.Scan(&s.TxnID, &s.PaidBy, &shares, &s.Date, &s.AmountCents, &s.UpdatedAt); err != nil {
+		return Split{}, err
+	}
+	if err := json.Unmarshal(shares, &s.Shares); err != nil {
+		return Split{}, fmt.Errorf("split of txn %v had malformed shares: %w", s.TxnID, err)
+	}
+	return s, nil
+}
+
+const splitColumnsSelected = "s.TXN_ID, s.PAID_BY, s.SHARES, t.DATE, t.AMOUNT_CENTS, s.UPDATED_AT"
+
+// SetSplit creates or replaces the split of a transaction.
+func (s *Storage) SetSplit(ctx context.Context, sp *Split) error {
+	if err := sp.validate(); err != nil {
+		return err
+	}
+	shares, err := json.Marshal(sp.Shares)
+	if err != nil {
+		return fmt.Errorf("error encoding shares: %w", err)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	var amountCents int64
+	err = tx.QueryRowContext(ctx, `SELECT AMOUNT_CENTS FROM TRANSACTIONS WHERE ID = $1 AND HOUSEHOLD_ID = $2 FOR UPDATE`, sp.TxnID, s.household).Scan(&amountCents)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: txn %v", ErrNotFound, sp.TxnID)
+	} else if err != nil {
+		return fmt.Errorf("error fetching txn %v: %w", sp.TxnID, err)
+	}
+	if err := sp.checkSharesCover(amountCents); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO SPLITS (TXN_ID, PAID_BY, SHARES) VALUES ($1, $2, $3)
+		ON CONFLICT (TXN_ID) DO UPDATE SET PAID_BY = EXCLUDED.PAID_BY, SHARES = EXCLUDED.SHARES, UPDATED_AT = NOW()
+	`, sp.TxnID, sp.PaidBy, shares); err != nil {
+		return fmt.Errorf("error setting split of txn %v: %w", sp.TxnID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error setting split of txn %v: %w", sp.TxnID, err)
+	}
+	return nil
+}
+
+func (s *Storage) GetSplit(ctx context.Context, txnID int64) (Split, error) {
+	sp, err := scanSplit(s.db.QueryRowContext(ctx, `
+		SELECT `+splitColumnsSelected+` FROM SPLITS AS s JOIN TRANSACTIONS AS t ON t.ID = s.TXN_ID
+		WHERE s.TXN_ID = $1 AND t.HOUSEHOLD_ID = $2
+	`, txnID, s.household))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Split{}, fmt.Errorf("%w: split of txn %v", ErrNotFound, txnID)
+	} else if err != nil {
+		return Split{}, fmt.Errorf("error fetching split of txn %v: %w", txnID, err)
+	}
+	return sp, nil
+}
+
+// ListSplits returns every split of the household ordered by the date and
+// ID of their transactions.
+func (s *Storage) ListSplits(ctx context.Context) ([]Split, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+splitColumnsSelected+` FROM SPLITS AS s JOIN TRANSACTIONS AS t ON t.ID = s.TXN_ID
+		WHERE t.HOUSEHOLD_ID = $1 ORDER BY t.DATE ASC, t.ID ASC
+	`, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying splits: %w", err)
+	}
+	return scanAll(rows, "splits", scanSplit)
+}
+
+func (s *Storage) DeleteSplit(ctx context.Context, txnID int64) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM SPLITS WHERE TXN_ID = $1 AND TXN_ID IN (`+fmt.Sprintf(householdTxnIDs, 2)+`)
+	`, txnID, s.household)
+	if err != nil {
+		return fmt.Errorf("error deleting split of txn %v: %w", txnID, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify split of txn %v was deleted: %w", txnID, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: split of txn %v", ErrNotFound, txnID)
+	}
+	return nil
+}
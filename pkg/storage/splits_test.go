@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// testSplits tests setting, reading and deleting splits. s must not have
+// any transactions.
+func testSplits(t *testing.T, s Store) {
+	ctx := context.Background()
+	txns := []Txn{
+		{Date: date("2024-01-02"), Description: "DINNER", AmountCents: -9000, Source: "AMEX"},
+		{Date: date("2024-01-01"), Description: "RENT", AmountCents: -300000, Source: "RBC"},
+		{Date: date("2024-01-03"), Description: "E-TRANSFER", AmountCents: 3000, Source: "RBC"},
+	}
+	createTxns(t, s, txns)
+
+	for _, tc := range []struct {
+		name    string
+		split   Split
+		wantErr error
+	}{
+		{name: "missing txn", split: Split{TxnID: txns[2].ID + 1, PaidBy: "alice", Shares: []Share{{"bob", -100}}}, wantErr: ErrNotFound},
+		{name: "wrong sign", split: Split{TxnID: txns[0].ID, PaidBy: "alice", Shares: []Share{{"bob", 100}}}, wantErr: ErrInvalidSplit},
+		{name: "more than amount", split: Split{TxnID: txns[0].ID, PaidBy: "alice", Shares: []Share{{"bob", -5000}, {"carol", -4001}}}, wantErr: ErrInvalidSplit},
+	} {
+		if err := s.SetSplit(ctx, &tc.split); !errors.Is(err, tc.wantErr) {
+			t.Errorf("SetSplit %v got error %v, want %v", tc.name, err, tc.wantErr)
+		}
+	}
+	if err := s.SetSplit(ctx, &Split{TxnID: txns[0].ID, PaidBy: "alice", Shares: []Share{{"bob", -100}, {"bob", -100}}}); err == nil {
+		t.Errorf("SetSplit with duplicate shares got no error")
+	}
+
+	splits := []Split{
+		{TxnID: txns[0].ID, PaidBy: "alice", Shares: []Share{{"bob", -3000}, {"carol", -3000}}},
+		{TxnID: txns[1].ID, PaidBy: "bob", Shares: []Share{{"alice", -100000}, {"bob", -100000}, {"carol", -100000}}},
+		{TxnID: txns[2].ID, PaidBy: "alice", Shares: []Share{{"bob", 3000}}},
+	}
+	for i := range splits {
+		if err := s.SetSplit(ctx, &splits[i]); err != nil {
+			t.Fatalf("SetSplit of txn %v got error: %v", splits[i].TxnID, err)
+		}
+	}
+	// Replacing a split keeps a single split for the txn.
+	splits[0].Shares = []Share{{"bob", -4500}}
+	if err := s.SetSplit(ctx, &splits[0]); err != nil {
+		t.Fatalf("SetSplit replacing split got error: %v", err)
+	}
+	got, err := s.GetSplit(ctx, txns[0].ID)
+	if err != nil {
+		t.Fatalf("GetSplit got error: %v", err)
+	}
+	if got.PaidBy != "alice" || !slices.Equal(got.Shares, splits[0].Shares) || got.AmountCents != -9000 || !got.Date.Equal(date("2024-01-02")) {
+		t.Errorf("GetSplit got %+v, want %+v with the amount and date of the txn", got, splits[0])
+	}
+
+	list, err := s.ListSplits(ctx)
+	if err != nil {
+		t.Fatalf("ListSplits got error: %v", err)
+	}
+	var gotIDs []int64
+	for _, sp := range list {
+		gotIDs = append(gotIDs, sp.TxnID)
+	}
+	if wantIDs := []int64{txns[1].ID, txns[0].ID, txns[2].ID}; !slices.Equal(gotIDs, wantIDs) {
+		t.Errorf("ListSplits got splits of txns %v, want %v ordered by date", gotIDs, wantIDs)
+	}
+
+	if err := s.DeleteSplit(ctx, txns[0].ID); err != nil {
+		t.Fatalf("DeleteSplit got error: %v", err)
+	}
+	if err := s.DeleteSplit(ctx, txns[0].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteSplit twice got error %v, want %v", err, ErrNotFound)
+	}
+	if _, err := s.GetSplit(ctx, txns[0].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetSplit after delete got error %v, want %v", err, ErrNotFound)
+	}
+}
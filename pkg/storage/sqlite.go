@@ -0,0 +1,1626 @@
+//go:build cgo
+
+package storage
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLite stores everything in a single SQLite database file for running
+// the app locally without postgres. The start ID, date range, sort order,
+// cursor and limit of transaction queries run in SQL while the other
+// filters, e.g., tags and query expressions, and comparisons by description
+// embedding run in Go with the same code as Memory. Like Storage it only
+// reads and writes the data of a single household.
+type SQLite struct {
+	db        *sql.DB
+	household int64
+}
+
+var _ Backend = (*SQLite)(nil)
+
+// SQLite migrations are files named <version>_<name>.sql in the
+// sqlite_migrations directory that are only ever applied. The applied
+// version is tracked with PRAGMA user_version.
+
+//go:embed sqlite_migrations/*.sql
+var sqliteMigrationsFS embed.FS
+
+var sqliteMigrationFileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+func NewSQLite(ctx context.Context, file string) (*SQLite, error) {
+	if file == "" {
+		return nil, errors.New("sqlite database file was not specified")
+	}
+	db, err := sql.Open("sqlite3", file+"?_foreign_keys=1&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("unable to open sqlite database %v: %w", file, err)
+	}
+	// SQLite allows a single writer so serialize everything through one
+	// connection instead of failing with busy errors.
+	db.SetMaxOpenConns(1)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to open sqlite database %v: %w", file, err)
+	}
+	s := &SQLite{db: db, household: DefaultHousehold}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating sqlite database %v: %w", file, err)
+	}
+	return s, nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// ForHousehold returns a SQLite sharing the database of s that only sees the
+// data of the given household.
+func (s *SQLite) ForHousehold(household int64) Store {
+	c := *s
+	c.household = household
+	return &c
+}
+
+func (s *SQLite) migrate(ctx context.Context) error {
+	entries, err := fs.ReadDir(sqliteMigrationsFS, "sqlite_migrations")
+	if err != nil {
+		return fmt.Errorf("unable to list embedded migrations: %w", err)
+	}
+	var current int
+	if err := s.db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&current); err != nil {
+		return fmt.Errorf("error querying schema version: %w", err)
+	}
+	for i, e := range entries {
+		m := sqliteMigrationFileRegexp.FindStringSubmatch(e.Name())
+		if m == nil {
+			return fmt.Errorf("invalid migration file name '%v', want <version>_<name>.sql", e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		if version != i+1 {
+			return fmt.Errorf("migration versions aren't contiguous, got version %v, want %v", version, i+1)
+		}
+		if version <= current {
+			continue
+		}
+		b, err := sqliteMigrationsFS.ReadFile(path.Join("sqlite_migrations", e.Name()))
+		if err != nil {
+			return fmt.Errorf("unable to read migration %v: %w", e.Name(), err)
+		}
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error beginning transaction with database: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, string(b)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error running migration %v: %w", e.Name(), err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprint("PRAGMA user_version = ", version)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error recording migration %v: %w", e.Name(), err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing migration %v: %w", e.Name(), err)
+		}
+	}
+	return nil
+}
+
+func isSQLiteErr(err error, code sqlite3.ErrNoExtended) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == code
+}
+
+// sqliteTags returns the TAGS column value for the given tags.
+func sqliteTags(tags []string) (any, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(tags)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding tags: %w", err)
+	}
+	return string(b), nil
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func (s *SQLite) CreateTxn(ctx context.Context, t *Txn) (int64, error) {
+	if err := t.validate(); err != nil {
+		return 0, err
+	}
+	tags, err := sqliteTags(t.Tags)
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO TRANSACTIONS (HOUSEHOLD_ID, DATE, DESCRIPTION, AMOUNT_CENTS, SOURCE, TAGS, NOTES, DESC_EMBEDDING)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.household, t.Date.Format(dateQueryFmt), t.Description, t.AmountCents, t.Source, tags, nullIfEmpty(t.Notes), nullIfEmpty(t.DescEmbedding))
+	if err != nil {
+		return 0, fmt.Errorf("error creating transaction: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error fetching ID of created transaction: %w", err)
+	}
+	return id, nil
+}
+
+type sqliteQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// sqliteTxnBatchSize is how many rows eachTxn reads at a time. The
+// connection is released between batches so other requests aren't blocked
+// while the transactions are handled. It's a variable for tests.
+var sqliteTxnBatchSize = 500
+
+// loadTxns returns the transactions that can match the given query ordered
+// by ID. Only the start ID and date range are filtered in SQL.
+func (s *SQLite) loadTxns(ctx context.Context, q sqliteQuerier, tq *TxnQuery, withEmbeddings bool) ([]memTxn, error) {
+	where, args := sqliteTxnRange(tq)
+	return s.selectTxns(ctx, q, withEmbeddings, where, "ID ASC", 0, args...)
+}
+
+// sqliteTxnRange returns the clause selecting the transactions from the
+// start ID of tq in its date range.
+func sqliteTxnRange(tq *TxnQuery) (string, []any) {
+	where := `ID >= ?`
+	args := []any{tq.StartID}
+	if tq.FromDate != nil {
+		where += ` AND DATE >= ?`
+		args = append(args, tq.FromDate.Format(dateQueryFmt))
+	}
+	if tq.ToDate != nil {
+		where += ` AND DATE <= ?`
+		args = append(args, tq.ToDate.Format(dateQueryFmt))
+	}
+	return where, args
+}
+
+// sqliteFiltersInGo reports whether tq filters on anything but the start ID
+// and date range, which eachTxn filters in Go since tags are stored as JSON
+// and expressions and text ops aren't translated to SQLite.
+func sqliteFiltersInGo(tq *TxnQuery) bool {
+	ctq := *tq
+	ctq.FromDate, ctq.ToDate = nil, nil
+	return ctq.HasFilter()
+}
+
+// eachTxn calls fn with the transactions matching the validated query in
+// its sort order, stopping after limit transactions if limit > 0. The start
+// ID, date range, cursor and order are handled in SQL and so is the limit
+// unless the rest of the query has to be filtered in Go. Rows are read in
+// batches resumed with a cursor after the last row of the previous batch.
+func (s *SQLite) eachTxn(ctx context.Context, tq *TxnQuery, limit int64, fn func(t *Txn) error) error {
+	match, err := tq.matcher()
+	if err != nil {
+		return err
+	}
+	pushLimit := limit > 0 && !sqliteFiltersInGo(tq)
+	btq := *tq
+	var n int64
+	for {
+		where, args := sqliteTxnRange(&btq)
+		// The household is the first argument and SQLite numbers
+		// arguments with ?NNN instead of $NNN.
+		kc, kargs, err := btq.keysetClause(len(args) + 2)
+		if err != nil {
+			return err
+		}
+		if kc != "" {
+			where += " AND " + strings.ReplaceAll(kc, "$", "?")
+			args = append(args, kargs...)
+		}
+		batch := int64(sqliteTxnBatchSize)
+		if pushLimit {
+			batch = min(batch, limit-n)
+		}
+		txns, err := s.selectTxns(ctx, s.db, false, where, btq.orderBy(), batch, args...)
+		if err != nil {
+			return err
+		}
+		for i := range txns {
+			if t := &txns[i].Txn; match(t) {
+				if err := fn(t); err != nil {
+					return err
+				}
+				if n++; limit > 0 && n >= limit {
+					return nil
+				}
+			}
+		}
+		if int64(len(txns)) < batch {
+			return nil
+		}
+		btq.After = btq.NextCursor(&txns[len(txns)-1].Txn)
+	}
+}
+
+// selectTxns returns at most limit transactions of the household matching
+// the given where clause in the given order, or all of them if limit is 0.
+// Description embeddings are only loaded when asked for.
+func (s *SQLite) selectTxns(ctx context.Context, q sqliteQuerier, withEmbeddings bool, where, orderBy string, limit int64, args ...any) ([]memTxn, error) {
+	query := `SELECT ID, DATE, DESCRIPTION, AMOUNT_CENTS, SOURCE, TAGS, COALESCE(NOTES, ''), ` + txnMerchantColumns("TRANSACTIONS.ID")
+	if withEmbeddings {
+		query += `, DESC_EMBEDDING`
+	}
+	query += ` FROM TRANSACTIONS WHERE HOUSEHOLD_ID = ? AND (` + where + `) ORDER BY ` + orderBy
+	if limit > 0 {
+		query += fmt.Sprint(" LIMIT ", limit)
+	}
+	rows, err := q.QueryContext(ctx, query, append([]any{s.household}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying for transactions: %w", err)
+	}
+	defer rows.Close()
+	var result []memTxn
+	for rows.Next() {
+		var t memTxn
+		var tags, embedding sql.NullString
+		dest := []any{&t.ID, &t.Date, &t.Description, &t.AmountCents, &t.Source, &tags, &t.Notes, &t.MerchantID, &t.Merchant}
+		if withEmbeddings {
+			dest = append(dest, &embedding)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("error scanning transaction after scanning %v transactions: %w", len(result), err)
+		}
+		if tags.Valid {
+			if err := json.Unmarshal([]byte(tags.String), &t.Tags); err != nil {
+				return nil, fmt.Errorf("transaction %v had invalid tags: %w", t.ID, err)
+			}
+		}
+		t.embedding = parseEmbedding(embedding.String)
+		result = append(result, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying for transactions after %v transactions: %w", len(result), err)
+	}
+	return result, nil
+}
+
+func (s *SQLite) QueryTxns(ctx context.Context, tq *TxnQuery) (TxnsPage, error) {
+	if err := tq.validate(); err != nil {
+		return TxnsPage{}, err
+	}
+	// Fetch one extra transaction to find out whether there are more pages.
+	var result []Txn
+	if err := s.eachTxn(ctx, tq, tq.Limit+1, func(t *Txn) error {
+		result = append(result, *t)
+		return nil
+	}); err != nil {
+		return TxnsPage{}, err
+	}
+	if int64(len(result)) > tq.Limit {
+		return TxnsPage{Txns: result[:tq.Limit], HasMore: true}, nil
+	}
+	return TxnsPage{Txns: result}, nil
+}
+
+// ForEachTxn calls fn with every transaction matching the given query in
+// the query's sort order without loading all of them in memory. The Limit
+// of the query is ignored. Iteration stops at the first error returned by
+// fn.
+func (s *SQLite) ForEachTxn(ctx context.Context, tq *TxnQuery, fn func(t *Txn) error) error {
+	if err := tq.validate(); err != nil {
+		return err
+	}
+	return s.eachTxn(ctx, tq, 0, fn)
+}
+
+// CountTxns returns the total number of transactions matching the filters
+// in the given query, ignoring the pagination parameters StartID, After
+// and Limit.
+func (s *SQLite) CountTxns(ctx context.Context, tq *TxnQuery) (int64, error) {
+	if err := tq.validate(); err != nil {
+		return 0, err
+	}
+	ctq := *tq
+	ctq.StartID = 0
+	ctq.After = nil
+	var n int64
+	err := s.eachTxn(ctx, &ctq, 0, func(*Txn) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+func (s *SQLite) QuerySimilarTxns(ctx context.Context, ids []int64, tq *TxnQuery) (SimilarTxns, error) {
+	if err := tq.validate(); err != nil {
+		return SimilarTxns{}, err
+	}
+	if tq.sort() != SortID || tq.SortDesc || tq.After != nil {
+		return SimilarTxns{}, errors.New("sort orders and cursors are not supported when querying similar txns")
+	}
+	// Selected transactions may be outside the filtered date range.
+	txns, err := s.loadTxns(ctx, s.db, &TxnQuery{}, true)
+	if err != nil {
+		return SimilarTxns{}, err
+	}
+	return similarTxns(txns, ids, tq)
+}
+
+func (s *SQLite) UpdateTxns(ctx context.Context, ids []int64, tu *TxnUpdates) error {
+	var defaultUpdates TxnUpdates
+	if tu == nil || *tu == defaultUpdates {
+		return fmt.Errorf("no fields were requested to be updated for the given transaction IDs")
+	}
+	if len(ids) < 1 {
+		return fmt.Errorf("ids must be specified")
+	}
+	var assigns []string
+	var vals []any
+	if tu.Tags != nil {
+		if err := ValidateTags(*tu.Tags); err != nil {
+			return fmt.Errorf("unable to update txns with invalid tags: %w", err)
+		}
+		tags, err := sqliteTags(*tu.Tags)
+		if err != nil {
+			return err
+		}
+		assigns = append(assigns, "TAGS = ?")
+		vals = append(vals, tags)
+	}
+	if tu.Notes != nil {
+		if err := ValidateNotes(*tu.Notes); err != nil {
+			return fmt.Errorf("unable to update txns with invalid notes: %w", err)
+		}
+		assigns = append(assigns, "NOTES = ?")
+		vals = append(vals, nullIfEmpty(*tu.Notes))
+	}
+	if tu.DescEmbedding != nil {
+		if len(ids) != 1 {
+			return fmt.Errorf("can't update embedding, got %v ids, want 1", len(ids))
+		}
+		if err := validateDescEmbedding(*tu.DescEmbedding); err != nil {
+			return fmt.Errorf("unable to update txn %v with invalid description embedding: %w", ids[0], err)
+		}
+		assigns = append(assigns, "DESC_EMBEDDING = ?")
+		vals = append(vals, nullIfEmpty(*tu.DescEmbedding))
+	}
+	ids = uniqueIDs(ids)
+	q := `UPDATE TRANSACTIONS SET ` + strings.Join(assigns, ", ") +
+		fmt.Sprintf(" WHERE ID IN (%v) AND HOUSEHOLD_ID = ?", strings.Join(int64sToStrs(ids), ", "))
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, q, append(vals, s.household)...)
+	if err != nil {
+		return fmt.Errorf("error updating transaction: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify txns were updated: %w", err)
+	} else if rows != int64(len(ids)) {
+		return fmt.Errorf("%w: got %v of %v txns to update", ErrNotFound, rows, len(ids))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing txn updates: %w", err)
+	}
+	return nil
+}
+
+// updateTags sets the tags of the given transactions to the result of fn
+// in the given database transaction.
+func (s *SQLite) updateTags(ctx context.Context, tx *sql.Tx, txns []memTxn, fn func(tags []string) []string) error {
+	for _, t := range txns {
+		tags, err := sqliteTags(fn(t.Tags))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE TRANSACTIONS SET TAGS = ? WHERE ID = ?`, tags, t.ID); err != nil {
+			return fmt.Errorf("failed to execute update: %w", err)
+		}
+	}
+	return nil
+}
+
+// updateTagsByID updates the tags of every given transaction with fn.
+// Nothing is changed unless every ID exists and is given once.
+func (s *SQLite) updateTagsByID(ctx context.Context, ids []int64, fn func(tags []string) []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer func() {
+		if tx == nil {
+			return
+		}
+		tx.Rollback()
+	}()
+	txns, err := s.selectTxns(ctx, tx, false, fmt.Sprintf("ID IN (%v)", strings.Join(int64sToStrs(ids), ", ")), "ID ASC", 0)
+	if err != nil {
+		return err
+	}
+	if len(txns) != len(ids) {
+		return fmt.Errorf("not all txns updated successfully, got %v updated, want %v", len(txns), len(ids))
+	}
+	if err := s.updateTags(ctx, tx, txns, fn); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing updates: %w", err)
+	}
+	tx = nil
+	return nil
+}
+
+func (s *SQLite) TxnAddTags(ctx context.Context, ids []int64, tags []string) error {
+	if err := ValidateTags(tags); err != nil {
+		return fmt.Errorf("error validating tags to be added: %w", err)
+	}
+	if len(ids) == 0 {
+		return errors.New("no ids given to add the given tags")
+	}
+	return s.updateTagsByID(ctx, ids, func(old []string) []string {
+		return addTags(old, tags)
+	})
+}
+
+func (s *SQLite) TxnRemoveTags(ctx context.Context, ids []int64, tags []string) error {
+	if err := ValidateTags(tags); err != nil {
+		return fmt.Errorf("error validating tags to be removed: %w", err)
+	}
+	if len(ids) == 0 {
+		return errors.New("no ids given to remove the given tags")
+	}
+	return s.updateTagsByID(ctx, ids, func(old []string) []string {
+		return removeTags(old, tags)
+	})
+}
+
+// TxnTagsByQuery adds, removes or clears tags on every transaction matching
+// the filters in the given query like Storage.TxnTagsByQuery.
+func (s *SQLite) TxnTagsByQuery(ctx context.Context, tq *TxnQuery, op string, tags []string, maxAffected int, dryRun bool) (TagsByQueryResult, error) {
+	if err := tq.validate(); err != nil {
+		return TagsByQueryResult{}, err
+	}
+	if maxAffected <= 0 || maxAffected > MaxBulkTxns {
+		return TagsByQueryResult{}, fmt.Errorf("invalid max affected txns, got %v, want > 0 and <= %v", maxAffected, MaxBulkTxns)
+	}
+	var fn func(old []string) []string
+	switch op {
+	case TagsOpAdd:
+		fn = func(old []string) []string { return addTags(old, tags) }
+	case TagsOpRemove:
+		fn = func(old []string) []string { return removeTags(old, tags) }
+	case TagsOpClear:
+		fn = func([]string) []string { return nil }
+		if len(tags) != 0 {
+			return TagsByQueryResult{}, fmt.Errorf("tags can't be specified when clearing tags, got %v", tags)
+		}
+	default:
+		return TagsByQueryResult{}, fmt.Errorf("unknown tags op '%v', want %v|%v|%v", op, TagsOpAdd, TagsOpRemove, TagsOpClear)
+	}
+	if op != TagsOpClear {
+		if len(tags) == 0 {
+			return TagsByQueryResult{}, errors.New("no tags given to update")
+		}
+		if err := ValidateTags(tags); err != nil {
+			return TagsByQueryResult{}, fmt.Errorf("error validating tags: %w", err)
+		}
+	}
+	ctq := *tq
+	ctq.StartID = 0
+	ctq.After = nil
+	ctq.Sort = SortID
+	ctq.SortDesc = false
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return TagsByQueryResult{}, fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer func() {
+		if tx == nil {
+			return
+		}
+		tx.Rollback()
+	}()
+	txns, err := s.loadTxns(ctx, tx, &ctq, false)
+	if err != nil {
+		return TagsByQueryResult{}, err
+	}
+	matched, err := matchingTxns(txns, &ctq)
+	if err != nil {
+		return TagsByQueryResult{}, err
+	}
+	if len(matched) > maxAffected {
+		return TagsByQueryResult{}, fmt.Errorf("%w: query matched more than %v txns, narrow down the query or raise the limit", ErrTooManyTxns, maxAffected)
+	}
+	var ids []int64
+	var update []memTxn
+	for _, t := range matched {
+		ids = append(ids, t.ID)
+		update = append(update, memTxn{Txn: t})
+	}
+	if dryRun || len(ids) == 0 {
+		return TagsByQueryResult{IDs: ids, DryRun: dryRun}, nil
+	}
+	if err := s.updateTags(ctx, tx, update, fn); err != nil {
+		return TagsByQueryResult{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return TagsByQueryResult{}, fmt.Errorf("error committing updates: %w", err)
+	}
+	tx = nil
+	return TagsByQueryResult{IDs: ids}, nil
+}
+
+const (
+	sqliteAttachmentColumns = "ID, TXN_ID, NAME, CONTENT_TYPE, SIZE_BYTES, DIGEST, CREATED_AT"
+	// sqliteHouseholdTxnIDs selects the IDs of the transactions of the
+	// household given as the last argument of an attachments query.
+	sqliteHouseholdTxnIDs = `SELECT ID FROM TRANSACTIONS WHERE HOUSEHOLD_ID = ?`
+)
+
+func scanAttachment(row interface{ Scan(...any) error }) (Attachment, error) {
+	var a Attachment
+	err := row.Scan(&a.ID, &a.TxnID, &a.Name, &a.ContentType, &a.SizeBytes, &a.Digest, &a.CreatedAt)
+	return a, err
+}
+
+func (s *SQLite) CreateAttachment(ctx context.Context, a *Attachment) (int64, error) {
+	if err := a.validate(); err != nil {
+		return 0, err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO ATTACHMENTS (TXN_ID, NAME, CONTENT_TYPE, SIZE_BYTES, DIGEST)
+		SELECT ?1, ?2, ?3, ?4, ?5 WHERE ?1 IN (`+sqliteHouseholdTxnIDs+`)
+	`, a.TxnID, a.Name, a.ContentType, a.SizeBytes, a.Digest, s.household)
+	if err != nil {
+		return 0, fmt.Errorf("error creating attachment: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return 0, fmt.Errorf("failed to verify attachment was created: %w", err)
+	} else if rows == 0 {
+		return 0, fmt.Errorf("%w: txn %v", ErrNotFound, a.TxnID)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error fetching ID of created attachment: %w", err)
+	}
+	return id, nil
+}
+
+func (s *SQLite) ListAttachments(ctx context.Context, txnID int64) ([]Attachment, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+sqliteAttachmentColumns+` FROM ATTACHMENTS WHERE TXN_ID = ? AND TXN_ID IN (`+sqliteHouseholdTxnIDs+`) ORDER BY ID ASC`, txnID, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying attachments for txn %v: %w", txnID, err)
+	}
+	defer rows.Close()
+	var result []Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning attachment after scanning %v attachments: %w", len(result), err)
+		}
+		result = append(result, a)
+	}
+	return result, nil
+}
+
+func (s *SQLite) GetAttachment(ctx context.Context, txnID, id int64) (Attachment, error) {
+	a, err := scanAttachment(s.db.QueryRowContext(ctx, `SELECT `+sqliteAttachmentColumns+` FROM ATTACHMENTS WHERE TXN_ID = ? AND ID = ? AND TXN_ID IN (`+sqliteHouseholdTxnIDs+`)`, txnID, id, s.household))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attachment{}, fmt.Errorf("%w: attachment %v for txn %v", ErrNotFound, id, txnID)
+	} else if err != nil {
+		return Attachment{}, fmt.Errorf("error fetching attachment %v for txn %v: %w", id, txnID, err)
+	}
+	return a, nil
+}
+
+func (s *SQLite) AttachmentDigests(ctx context.Context) (map[string]bool, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT DIGEST FROM ATTACHMENTS`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying attachment digests: %w", err)
+	}
+	digests, err := scanAll(rows, "attachment digests", func(row interface{ Scan(...any) error }) (string, error) {
+		var d string
+		err := row.Scan(&d)
+		return d, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]bool{}
+	for _, d := range digests {
+		result[d] = true
+	}
+	return result, nil
+}
+
+// DeleteAttachment deletes the given attachment and returns it along with
+// whether any other attachment still references the same blob digest.
+func (s *SQLite) DeleteAttachment(ctx context.Context, txnID, id int64) (Attachment, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Attachment{}, false, fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer func() {
+		if tx == nil {
+			return
+		}
+		tx.Rollback()
+	}()
+	a, err := scanAttachment(tx.QueryRowContext(ctx, `SELECT `+sqliteAttachmentColumns+` FROM ATTACHMENTS WHERE TXN_ID = ? AND ID = ? AND TXN_ID IN (`+sqliteHouseholdTxnIDs+`)`, txnID, id, s.household))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attachment{}, false, fmt.Errorf("%w: attachment %v for txn %v", ErrNotFound, id, txnID)
+	} else if err != nil {
+		return Attachment{}, false, fmt.Errorf("error deleting attachment %v for txn %v: %w", id, txnID, err)
+	}
+	var digestRefs int64
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ATTACHMENTS WHERE ID = ?`, id); err != nil {
+		return Attachment{}, false, fmt.Errorf("error deleting attachment %v for txn %v: %w", id, txnID, err)
+	}
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM ATTACHMENTS WHERE DIGEST = ?`, a.Digest).Scan(&digestRefs); err != nil {
+		return Attachment{}, false, fmt.Errorf("error counting references to attachment digest: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Attachment{}, false, fmt.Errorf("error deleting attachment %v for txn %v: %w", id, txnID, err)
+	}
+	tx = nil
+	return a, digestRefs > 0, nil
+}
+
+func (s *SQLite) CreateView(ctx context.Context, v *View) error {
+	if err := v.validate(); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO VIEWS (HOUSEHOLD_ID, NAME, QUERY) VALUES (?, ?, ?)`, s.household, v.Name, v.Query)
+	if isSQLiteErr(err, sqlite3.ErrConstraintPrimaryKey) {
+		return fmt.Errorf("%w: view '%v'", ErrAlreadyExists, v.Name)
+	} else if err != nil {
+		return fmt.Errorf("error creating view '%v': %w", v.Name, err)
+	}
+	return nil
+}
+
+func (s *SQLite) ListViews(ctx context.Context) ([]View, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+viewColumnsSelected+` FROM VIEWS WHERE HOUSEHOLD_ID = ? ORDER BY NAME ASC`, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying views: %w", err)
+	}
+	defer rows.Close()
+	var result []View
+	for rows.Next() {
+		v, err := scanView(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning view after scanning %v views: %w", len(result), err)
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+func (s *SQLite) GetView(ctx context.Context, name string) (View, error) {
+	v, err := scanView(s.db.QueryRowContext(ctx, `SELECT `+viewColumnsSelected+` FROM VIEWS WHERE HOUSEHOLD_ID = ? AND NAME = ?`, s.household, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return View{}, fmt.Errorf("%w: view '%v'", ErrNotFound, name)
+	} else if err != nil {
+		return View{}, fmt.Errorf("error fetching view '%v': %w", name, err)
+	}
+	return v, nil
+}
+
+func (s *SQLite) UpdateView(ctx context.Context, v *View) error {
+	if err := v.validate(); err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx, `UPDATE VIEWS SET QUERY = ?, UPDATED_AT = CURRENT_TIMESTAMP WHERE HOUSEHOLD_ID = ? AND NAME = ?`, v.Query, s.household, v.Name)
+	if err != nil {
+		return fmt.Errorf("error updating view '%v': %w", v.Name, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify view '%v' was updated: %w", v.Name, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: view '%v'", ErrNotFound, v.Name)
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteView(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM VIEWS WHERE HOUSEHOLD_ID = ? AND NAME = ?`, s.household, name)
+	if err != nil {
+		return fmt.Errorf("error deleting view '%v': %w", name, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify view '%v' was deleted: %w", name, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: view '%v'", ErrNotFound, name)
+	}
+	return nil
+}
+
+func (s *SQLite) SetSplit(ctx context.Context, sp *Split) error {
+	if err := sp.validate(); err != nil {
+		return err
+	}
+	shares, err := json.Marshal(sp.Shares)
+	if err != nil {
+		return fmt.Errorf("error encoding shares: %w", err)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	var amountCents int64
+	err = tx.QueryRowContext(ctx, `SELECT AMOUNT_CENTS FROM TRANSACTIONS WHERE ID = ? AND HOUSEHOLD_ID = ?`, sp.TxnID, s.household).Scan(&amountCents)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: txn %v", ErrNotFound, sp.TxnID)
+	} else if err != nil {
+		return fmt.Errorf("error fetching txn %v: %w", sp.TxnID, err)
+	}
+	if err := sp.checkSharesCover(amountCents); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO SPLITS (TXN_ID, PAID_BY, SHARES) VALUES (?, ?, ?)
+		ON CONFLICT (TXN_ID) DO UPDATE SET PAID_BY = excluded.PAID_BY, SHARES = excluded.SHARES, UPDATED_AT = CURRENT_TIMESTAMP
+	`, sp.TxnID, sp.PaidBy, string(shares)); err != nil {
+		return fmt.Errorf("error setting split of txn %v: %w", sp.TxnID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error setting split of txn %v: %w", sp.TxnID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetSplit(ctx context.Context, txnID int64) (Split, error) {
+	sp, err := scanSplit(s.db.QueryRowContext(ctx, `
+		SELECT `+splitColumnsSelected+` FROM SPLITS AS s JOIN TRANSACTIONS AS t ON t.ID = s.TXN_ID
+		WHERE s.TXN_ID = ? AND t.HOUSEHOLD_ID = ?
+	`, txnID, s.household))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Split{}, fmt.Errorf("%w: split of txn %v", ErrNotFound, txnID)
+	} else if err != nil {
+		return Split{}, fmt.Errorf("error fetching split of txn %v: %w", txnID, err)
+	}
+	return sp, nil
+}
+
+func (s *SQLite) ListSplits(ctx context.Context) ([]Split, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+splitColumnsSelected+` FROM SPLITS AS s JOIN TRANSACTIONS AS t ON t.ID = s.TXN_ID
+		WHERE t.HOUSEHOLD_ID = ? ORDER BY t.DATE ASC, t.ID ASC
+	`, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying splits: %w", err)
+	}
+	return scanAll(rows, "splits", scanSplit)
+}
+
+func (s *SQLite) DeleteSplit(ctx context.Context, txnID int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM SPLITS WHERE TXN_ID = ? AND TXN_ID IN (`+sqliteHouseholdTxnIDs+`)`, txnID, s.household)
+	if err != nil {
+		return fmt.Errorf("error deleting split of txn %v: %w", txnID, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify split of txn %v was deleted: %w", txnID, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: split of txn %v", ErrNotFound, txnID)
+	}
+	return nil
+}
+
+func (s *SQLite) SetReimbursable(ctx context.Context, r *Reimbursement) error {
+	if err := ValidateExpectedFrom(r.ExpectedFrom); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	var amountCents int64
+	err = tx.QueryRowContext(ctx, `SELECT AMOUNT_CENTS FROM TRANSACTIONS WHERE ID = ? AND HOUSEHOLD_ID = ?`, r.TxnID, s.household).Scan(&amountCents)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: txn %v", ErrNotFound, r.TxnID)
+	} else if err != nil {
+		return fmt.Errorf("error fetching txn %v: %w", r.TxnID, err)
+	}
+	if err := checkReimbursable(r.TxnID, amountCents); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO REIMBURSEMENTS (TXN_ID, EXPECTED_FROM) VALUES (?, ?)
+		ON CONFLICT (TXN_ID) DO UPDATE SET EXPECTED_FROM = excluded.EXPECTED_FROM
+	`, r.TxnID, r.ExpectedFrom); err != nil {
+		return fmt.Errorf("error marking txn %v reimbursable: %w", r.TxnID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error marking txn %v reimbursable: %w", r.TxnID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetReimbursement(ctx context.Context, txnID int64) (Reimbursement, error) {
+	r, err := scanReimbursement(s.db.QueryRowContext(ctx, `
+		SELECT `+reimbursementColumnsSelected+` WHERE r.TXN_ID = ? AND t.HOUSEHOLD_ID = ?
+	`, txnID, s.household))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reimbursement{}, fmt.Errorf("%w: reimbursement of txn %v", ErrNotFound, txnID)
+	} else if err != nil {
+		return Reimbursement{}, fmt.Errorf("error fetching reimbursement of txn %v: %w", txnID, err)
+	}
+	return r, nil
+}
+
+func (s *SQLite) ListReimbursements(ctx context.Context, outstandingOnly bool) ([]Reimbursement, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+reimbursementColumnsSelected+`
+		WHERE t.HOUSEHOLD_ID = ? AND (NOT ? OR r.CREDIT_TXN_ID IS NULL)
+		ORDER BY t.DATE ASC, t.ID ASC
+	`, s.household, outstandingOnly)
+	if err != nil {
+		return nil, fmt.Errorf("error querying reimbursements: %w", err)
+	}
+	return scanAll(rows, "reimbursements", scanReimbursement)
+}
+
+func (s *SQLite) DeleteReimbursement(ctx context.Context, txnID int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM REIMBURSEMENTS WHERE TXN_ID = ? AND TXN_ID IN (`+sqliteHouseholdTxnIDs+`)`, txnID, s.household)
+	if err != nil {
+		return fmt.Errorf("error deleting reimbursement of txn %v: %w", txnID, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify reimbursement of txn %v was deleted: %w", txnID, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: reimbursement of txn %v", ErrNotFound, txnID)
+	}
+	return nil
+}
+
+func (s *SQLite) LinkReimbursement(ctx context.Context, txnID, creditTxnID int64) error {
+	return s.LinkReimbursements(ctx, map[int64]int64{txnID: creditTxnID})
+}
+
+func (s *SQLite) LinkReimbursements(ctx context.Context, links map[int64]int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	for _, txnID := range sortedLinks(links) {
+		creditTxnID := links[txnID]
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM REIMBURSEMENTS WHERE TXN_ID = ? AND TXN_ID IN (`+sqliteHouseholdTxnIDs+`))
+		`, txnID, s.household).Scan(&exists); err != nil {
+			return fmt.Errorf("error fetching reimbursement of txn %v: %w", txnID, err)
+		} else if !exists {
+			return fmt.Errorf("%w: reimbursement of txn %v", ErrNotFound, txnID)
+		}
+		var amountCents int64
+		err = tx.QueryRowContext(ctx, `SELECT AMOUNT_CENTS FROM TRANSACTIONS WHERE ID = ? AND HOUSEHOLD_ID = ?`, creditTxnID, s.household).Scan(&amountCents)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: txn %v", ErrNotFound, creditTxnID)
+		} else if err != nil {
+			return fmt.Errorf("error fetching txn %v: %w", creditTxnID, err)
+		}
+		if err := checkReimbursing(creditTxnID, amountCents); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE REIMBURSEMENTS SET CREDIT_TXN_ID = ? WHERE TXN_ID = ?`, creditTxnID, txnID)
+		if isSQLiteErr(err, sqlite3.ErrConstraintUnique) {
+			return fmt.Errorf("%w: reimbursement by credit txn %v", ErrAlreadyExists, creditTxnID)
+		} else if err != nil {
+			return fmt.Errorf("error linking credit txn %v to reimbursement of txn %v: %w", creditTxnID, txnID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing linked reimbursements: %w", err)
+	}
+	return nil
+}
+
+// reimbursedCents returns the amounts of the credits reimbursing debits by
+// the debit's txn ID and the IDs of those credits, for reporting spending
+// net of reimbursements like the postgres NET_TRANSACTIONS view.
+func (s *SQLite) reimbursedCents(ctx context.Context) (map[int64]int64, map[int64]bool, error) {
+	type link struct {
+		txnID, creditTxnID, creditCents int64
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.TXN_ID, r.CREDIT_TXN_ID, c.AMOUNT_CENTS FROM REIMBURSEMENTS AS r
+		JOIN TRANSACTIONS AS c ON c.ID = r.CREDIT_TXN_ID
+		WHERE c.HOUSEHOLD_ID = ?
+	`, s.household)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying reimbursements: %w", err)
+	}
+	links, err := scanAll(rows, "reimbursement", func(row interface{ Scan(...any) error }) (link, error) {
+		var l link
+		err := row.Scan(&l.txnID, &l.creditTxnID, &l.creditCents)
+		return l, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	reimbursed, credits := map[int64]int64{}, map[int64]bool{}
+	for _, l := range links {
+		reimbursed[l.txnID] = l.creditCents
+		credits[l.creditTxnID] = true
+	}
+	return reimbursed, credits, nil
+}
+
+func (s *SQLite) UnlinkReimbursement(ctx context.Context, txnID int64) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE REIMBURSEMENTS SET CREDIT_TXN_ID = NULL WHERE TXN_ID = ? AND TXN_ID IN (`+sqliteHouseholdTxnIDs+`)`, txnID, s.household)
+	if err != nil {
+		return fmt.Errorf("error unlinking reimbursement of txn %v: %w", txnID, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify reimbursement of txn %v was unlinked: %w", txnID, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: reimbursement of txn %v", ErrNotFound, txnID)
+	}
+	return nil
+}
+
+func (s *SQLite) SetBudget(ctx context.Context, b *Budget) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO BUDGETS (HOUSEHOLD_ID, TAG, PERIOD, AMOUNT_CENTS, ROLLOVER, SINCE) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (HOUSEHOLD_ID, TAG, PERIOD) DO UPDATE SET
+			AMOUNT_CENTS = excluded.AMOUNT_CENTS, ROLLOVER = excluded.ROLLOVER, SINCE = excluded.SINCE, UPDATED_AT = CURRENT_TIMESTAMP
+	`, s.household, b.Tag, b.Period, b.AmountCents, b.Rollover, b.Since.Format(dateQueryFmt)); err != nil {
+		return fmt.Errorf("error setting %v budget for tag '%v': %w", b.Period, b.Tag, err)
+	}
+	return nil
+}
+
+func (s *SQLite) ListBudgets(ctx context.Context) ([]Budget, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+budgetColumnsSelected+` FROM BUDGETS WHERE HOUSEHOLD_ID = ? ORDER BY TAG ASC, PERIOD ASC`, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying budgets: %w", err)
+	}
+	return scanAll(rows, "budgets", scanBudget)
+}
+
+func (s *SQLite) GetBudget(ctx context.Context, tag, period string) (Budget, error) {
+	b, err := scanBudget(s.db.QueryRowContext(ctx, `
+		SELECT `+budgetColumnsSelected+` FROM BUDGETS WHERE HOUSEHOLD_ID = ? AND TAG = ? AND PERIOD = ?
+	`, s.household, tag, period))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Budget{}, fmt.Errorf("%w: %v budget for tag '%v'", ErrNotFound, period, tag)
+	} else if err != nil {
+		return Budget{}, fmt.Errorf("error fetching %v budget for tag '%v': %w", period, tag, err)
+	}
+	return b, nil
+}
+
+func (s *SQLite) DeleteBudget(ctx context.Context, tag, period string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM BUDGETS WHERE HOUSEHOLD_ID = ? AND TAG = ? AND PERIOD = ?`, s.household, tag, period)
+	if err != nil {
+		return fmt.Errorf("error deleting %v budget for tag '%v': %w", period, tag, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify %v budget for tag '%v' was deleted: %w", period, tag, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: %v budget for tag '%v'", ErrNotFound, period, tag)
+	}
+	return nil
+}
+
+// SpendingByTagMonth sums the spending of the transactions in the date range
+// in Go since tags are stored as JSON.
+func (s *SQLite) SpendingByTagMonth(ctx context.Context, tags []string, from, to time.Time) ([]TagSpending, error) {
+	txns, err := s.loadTxns(ctx, s.db, &TxnQuery{FromDate: &from, ToDate: &to}, false)
+	if err != nil {
+		return nil, err
+	}
+	reimbursed, credits, err := s.reimbursedCents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	type key struct {
+		tag   string
+		month time.Time
+	}
+	spent := map[key]int64{}
+	for _, t := range txns {
+		if credits[t.ID] {
+			continue
+		}
+		month := time.Date(t.Date.Year(), t.Date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		for _, tag := range t.Tags {
+			if slices.Contains(tags, tag) {
+				spent[key{tag, month}] -= t.AmountCents + reimbursed[t.ID]
+			}
+		}
+	}
+	var result []TagSpending
+	for k, v := range spent {
+		result = append(result, TagSpending{Tag: k.tag, Month: k.month, SpentCents: v})
+	}
+	slices.SortFunc(result, func(a, b TagSpending) int {
+		if c := cmp.Compare(a.Tag, b.Tag); c != 0 {
+			return c
+		}
+		return a.Month.Compare(b.Month)
+	})
+	return result, nil
+}
+
+func (s *SQLite) ReplaceRecurringSeries(ctx context.Context, series []RecurringSeries) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM RECURRING_SERIES WHERE ID IN (`+sqliteHouseholdTxnIDs+`)`, s.household); err != nil {
+		return fmt.Errorf("error deleting recurring series: %w", err)
+	}
+	for i := range series {
+		rs := &series[i]
+		if err := rs.validate(); err != nil {
+			return err
+		}
+		txnIDs, alerts, err := rs.encode()
+		if err != nil {
+			return err
+		}
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM TRANSACTIONS WHERE ID = ? AND HOUSEHOLD_ID = ?)
+		`, rs.ID, s.household).Scan(&exists); err != nil {
+			return fmt.Errorf("error fetching txn %v: %w", rs.ID, err)
+		} else if !exists {
+			return fmt.Errorf("%w: txn %v", ErrNotFound, rs.ID)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO RECURRING_SERIES (ID, NAME, PERIOD, AMOUNT_CENTS, TXN_IDS, LAST_DATE, NEXT_DATE, ACTIVE, ALERTS)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, rs.ID, rs.Name, rs.Period, rs.AmountCents, string(txnIDs), rs.LastDate.Format(dateQueryFmt), rs.NextDate.Format(dateQueryFmt), rs.Active, string(alerts)); err != nil {
+			return fmt.Errorf("error creating recurring series %v: %w", rs.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error replacing recurring series: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) ListRecurringSeries(ctx context.Context) ([]RecurringSeries, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+recurringColumnsSelected+` FROM RECURRING_SERIES
+		WHERE ID IN (`+sqliteHouseholdTxnIDs+`) ORDER BY NEXT_DATE ASC, ID ASC
+	`, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying recurring series: %w", err)
+	}
+	return scanAll(rows, "recurring series", scanRecurringSeries)
+}
+
+func (s *SQLite) CreateMerchant(ctx context.Context, m *Merchant) (int64, error) {
+	if err := m.validate(); err != nil {
+		return 0, err
+	}
+	patterns, err := m.encodePatterns()
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.db.ExecContext(ctx, `INSERT INTO MERCHANTS (HOUSEHOLD_ID, NAME, PATTERNS) VALUES (?, ?, ?)`, s.household, m.Name, string(patterns))
+	if isSQLiteErr(err, sqlite3.ErrConstraintUnique) {
+		return 0, fmt.Errorf("%w: merchant '%v'", ErrAlreadyExists, m.Name)
+	} else if err != nil {
+		return 0, fmt.Errorf("error creating merchant '%v': %w", m.Name, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting ID of created merchant '%v': %w", m.Name, err)
+	}
+	return id, nil
+}
+
+func (s *SQLite) ListMerchants(ctx context.Context) ([]Merchant, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+merchantColumnsSelected+` WHERE m.HOUSEHOLD_ID = ? ORDER BY m.NAME ASC`, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying merchants: %w", err)
+	}
+	return scanAll(rows, "merchants", scanMerchant)
+}
+
+func (s *SQLite) GetMerchant(ctx context.Context, id int64) (Merchant, error) {
+	m, err := scanMerchant(s.db.QueryRowContext(ctx, `SELECT `+merchantColumnsSelected+` WHERE m.ID = ? AND m.HOUSEHOLD_ID = ?`, id, s.household))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Merchant{}, fmt.Errorf("%w: merchant %v", ErrNotFound, id)
+	} else if err != nil {
+		return Merchant{}, fmt.Errorf("error fetching merchant %v: %w", id, err)
+	}
+	return m, nil
+}
+
+func (s *SQLite) UpdateMerchant(ctx context.Context, m *Merchant) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	patterns, err := m.encodePatterns()
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE MERCHANTS SET NAME = ?, PATTERNS = ? WHERE ID = ? AND HOUSEHOLD_ID = ?
+	`, m.Name, string(patterns), m.ID, s.household)
+	if isSQLiteErr(err, sqlite3.ErrConstraintUnique) {
+		return fmt.Errorf("%w: merchant '%v'", ErrAlreadyExists, m.Name)
+	} else if err != nil {
+		return fmt.Errorf("error updating merchant %v: %w", m.ID, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify merchant %v was updated: %w", m.ID, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: merchant %v", ErrNotFound, m.ID)
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteMerchant(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM MERCHANTS WHERE ID = ? AND HOUSEHOLD_ID = ?`, id, s.household)
+	if err != nil {
+		return fmt.Errorf("error deleting merchant %v: %w", id, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify merchant %v was deleted: %w", id, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: merchant %v", ErrNotFound, id)
+	}
+	return nil
+}
+
+func (s *SQLite) MergeMerchants(ctx context.Context, fromID, intoID int64) error {
+	if fromID == intoID {
+		return fmt.Errorf("can't merge merchant %v into itself", fromID)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	var patterns [2][]string
+	for i, id := range []int64{fromID, intoID} {
+		var p string
+		err := tx.QueryRowContext(ctx, `SELECT PATTERNS FROM MERCHANTS WHERE ID = ? AND HOUSEHOLD_ID = ?`, id, s.household).Scan(&p)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: merchant %v", ErrNotFound, id)
+		} else if err != nil {
+			return fmt.Errorf("error fetching merchant %v: %w", id, err)
+		}
+		if err := json.Unmarshal([]byte(p), &patterns[i]); err != nil {
+			return fmt.Errorf("merchant %v had malformed patterns: %w", id, err)
+		}
+	}
+	merged, err := mergePatterns(patterns[1], patterns[0])
+	if err != nil {
+		return err
+	}
+	encoded, err := (&Merchant{Patterns: merged}).encodePatterns()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE TXN_MERCHANTS SET MERCHANT_ID = ?, UPDATED_AT = CURRENT_TIMESTAMP WHERE MERCHANT_ID = ?`, intoID, fromID); err != nil {
+		return fmt.Errorf("error moving transactions of merchant %v to merchant %v: %w", fromID, intoID, err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE MERCHANTS SET PATTERNS = ? WHERE ID = ?`, string(encoded), intoID); err != nil {
+		return fmt.Errorf("error updating patterns of merchant %v: %w", intoID, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM MERCHANTS WHERE ID = ?`, fromID); err != nil {
+		return fmt.Errorf("error deleting merchant %v: %w", fromID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error merging merchant %v into merchant %v: %w", fromID, intoID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) SetTxnMerchants(ctx context.Context, mappings []TxnMerchant) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	for _, tm := range mappings {
+		if err := ValidateMappingSource(tm.Source); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO TXN_MERCHANTS (TXN_ID, MERCHANT_ID, SOURCE)
+			SELECT ?1, ?2, ?3
+			WHERE EXISTS (SELECT 1 FROM TRANSACTIONS WHERE ID = ?1 AND HOUSEHOLD_ID = ?4)
+				AND EXISTS (SELECT 1 FROM MERCHANTS WHERE ID = ?2 AND HOUSEHOLD_ID = ?4)
+			ON CONFLICT (TXN_ID) DO UPDATE SET MERCHANT_ID = excluded.MERCHANT_ID, SOURCE = excluded.SOURCE, UPDATED_AT = CURRENT_TIMESTAMP
+		`, tm.TxnID, tm.MerchantID, tm.Source, s.household)
+		if err != nil {
+			return fmt.Errorf("error mapping txn %v to merchant %v: %w", tm.TxnID, tm.MerchantID, err)
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to verify txn %v was mapped to merchant %v: %w", tm.TxnID, tm.MerchantID, err)
+		} else if rows == 0 {
+			return fmt.Errorf("%w: txn %v or merchant %v", ErrNotFound, tm.TxnID, tm.MerchantID)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error mapping txns to merchants: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) ListTxnMerchants(ctx context.Context, merchantID int64, source string) ([]TxnMerchant, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+txnMerchantColumnsSelected+`
+		WHERE m.HOUSEHOLD_ID = ?1 AND (?2 = 0 OR tm.MERCHANT_ID = ?2) AND (?3 = '' OR tm.SOURCE = ?3)
+		ORDER BY t.DATE ASC, t.ID ASC
+	`, s.household, merchantID, source)
+	if err != nil {
+		return nil, fmt.Errorf("error querying merchants of txns: %w", err)
+	}
+	return scanAll(rows, "merchants of txns", scanTxnMerchant)
+}
+
+func (s *SQLite) GetTxnMerchant(ctx context.Context, txnID int64) (TxnMerchant, error) {
+	tm, err := scanTxnMerchant(s.db.QueryRowContext(ctx, `SELECT `+txnMerchantColumnsSelected+` WHERE tm.TXN_ID = ? AND m.HOUSEHOLD_ID = ?`, txnID, s.household))
+	if errors.Is(err, sql.ErrNoRows) {
+		return TxnMerchant{}, fmt.Errorf("%w: merchant of txn %v", ErrNotFound, txnID)
+	} else if err != nil {
+		return TxnMerchant{}, fmt.Errorf("error fetching merchant of txn %v: %w", txnID, err)
+	}
+	return tm, nil
+}
+
+// txnMerchantIDs returns the IDs of the merchants of the mapped transactions
+// of the household by transaction ID.
+func (s *SQLite) txnMerchantIDs(ctx context.Context) (map[int64]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT tm.TXN_ID, tm.MERCHANT_ID FROM TXN_MERCHANTS AS tm
+		JOIN MERCHANTS AS m ON m.ID = tm.MERCHANT_ID WHERE m.HOUSEHOLD_ID = ?
+	`, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying merchants of txns: %w", err)
+	}
+	mappings, err := scanAll(rows, "merchants of txns", func(row interface{ Scan(...any) error }) (TxnMerchant, error) {
+		var tm TxnMerchant
+		err := row.Scan(&tm.TxnID, &tm.MerchantID)
+		return tm, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := map[int64]int64{}
+	for _, tm := range mappings {
+		result[tm.TxnID] = tm.MerchantID
+	}
+	return result, nil
+}
+
+// NearestMerchants compares the embeddings in Go since SQLite has no vector
+// distance.
+func (s *SQLite) NearestMerchants(ctx context.Context, maxDistance float64) ([]TxnMerchant, error) {
+	merchantOf, err := s.txnMerchantIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txns, err := s.loadTxns(ctx, s.db, &TxnQuery{}, true)
+	if err != nil {
+		return nil, err
+	}
+	var mapped, unmapped []*memTxn
+	for i := range txns {
+		if t := &txns[i]; t.embedding == nil {
+			continue
+		} else if _, ok := merchantOf[t.ID]; ok {
+			mapped = append(mapped, t)
+		} else {
+			unmapped = append(unmapped, t)
+		}
+	}
+	var result []TxnMerchant
+	for _, t := range unmapped {
+		var nearest *memTxn
+		distance := math.Inf(1)
+		for _, m := range mapped {
+			if d := cosineDistance(t.embedding, m.embedding); d < distance {
+				nearest, distance = m, d
+			}
+		}
+		if nearest != nil && distance <= maxDistance {
+			result = append(result, TxnMerchant{TxnID: t.ID, MerchantID: merchantOf[nearest.ID], Source: MappedByEmbedding})
+		}
+	}
+	return result, nil
+}
+
+// MerchantSpending totals the matching transactions in Go since tags are
+// stored as JSON.
+func (s *SQLite) MerchantSpending(ctx context.Context, tq *TxnQuery) ([]MerchantSpending, error) {
+	if err := tq.validate(); err != nil {
+		return nil, err
+	}
+	merchants, err := s.ListMerchants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	merchantOf, err := s.txnMerchantIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	loaded, err := s.loadTxns(ctx, s.db, tq, false)
+	if err != nil {
+		return nil, err
+	}
+	txns, err := matchingTxns(loaded, tq)
+	if err != nil {
+		return nil, err
+	}
+	reimbursed, credits, err := s.reimbursedCents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	spending := map[int64]*MerchantSpending{}
+	for _, m := range merchants {
+		spending[m.ID] = &MerchantSpending{MerchantID: m.ID, Name: m.Name}
+	}
+	var result []MerchantSpending
+	for _, t := range txns {
+		if ms, ok := spending[merchantOf[t.ID]]; ok && !credits[t.ID] {
+			ms.TxnCount++
+			ms.AmountCents += t.AmountCents + reimbursed[t.ID]
+		}
+	}
+	for _, m := range merchants {
+		if ms := spending[m.ID]; ms.TxnCount > 0 {
+			result = append(result, *ms)
+		}
+	}
+	slices.SortStableFunc(result, func(a, b MerchantSpending) int {
+		return cmp.Compare(a.AmountCents, b.AmountCents)
+	})
+	return result, nil
+}
+
+func (s *SQLite) DescriptionNovelty(ctx context.Context, tq *TxnQuery, since time.Time) (map[int64]float64, error) {
+	if err := tq.validate(); err != nil {
+		return nil, err
+	}
+	// Earlier transactions may be outside the filtered date range.
+	from := tq.FromDate
+	if from != nil && since.Before(*from) {
+		from = &since
+	}
+	txns, err := s.loadTxns(ctx, s.db, &TxnQuery{FromDate: from, ToDate: tq.ToDate}, true)
+	if err != nil {
+		return nil, err
+	}
+	return descriptionNovelty(txns, tq, since)
+}
+
+func scanSQLiteToken(row interface{ Scan(...any) error }) (Token, error) {
+	var t Token
+	var scopes string
+	var revokedAt sql.NullTime
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.CreatedAt, &revokedAt); err != nil {
+		return Token{}, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &t.Scopes); err != nil {
+		return Token{}, fmt.Errorf("token %v had invalid scopes: %w", t.ID, err)
+	}
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+	return t, nil
+}
+
+func (s *SQLite) CreateToken(ctx context.Context, t *Token, hash string) (int64, error) {
+	t.Scopes = normalizeScopes(t.Scopes)
+	if err := t.validate(); err != nil {
+		return 0, err
+	}
+	scopes, err := json.Marshal(t.Scopes)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding token scopes: %w", err)
+	}
+	// USER_ID isn't a foreign key, see the households migration.
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO API_TOKENS (USER_ID, NAME, TOKEN_HASH, SCOPES)
+		SELECT ?1, ?2, ?3, ?4 WHERE EXISTS (SELECT 1 FROM USERS WHERE ID = ?1)
+	`, t.UserID, t.Name, hash, string(scopes))
+	if err != nil {
+		return 0, fmt.Errorf("error creating token '%v': %w", t.Name, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return 0, fmt.Errorf("failed to verify token '%v' was created: %w", t.Name, err)
+	} else if rows == 0 {
+		return 0, fmt.Errorf("%w: user %v", ErrNotFound, t.UserID)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting ID of created token '%v': %w", t.Name, err)
+	}
+	return id, nil
+}
+
+func (s *SQLite) ListTokens(ctx context.Context) ([]Token, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+tokenColumnsSelected+` FROM API_TOKENS ORDER BY ID ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tokens: %w", err)
+	}
+	defer rows.Close()
+	var result []Token
+	for rows.Next() {
+		t, err := scanSQLiteToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning token after scanning %v tokens: %w", len(result), err)
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+func (s *SQLite) TokenByHash(ctx context.Context, hash string) (Token, error) {
+	t, err := scanSQLiteToken(s.db.QueryRowContext(ctx, `SELECT `+tokenColumnsSelected+` FROM API_TOKENS WHERE TOKEN_HASH = ? AND REVOKED_AT IS NULL`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Token{}, fmt.Errorf("%w: token", ErrNotFound)
+	} else if err != nil {
+		return Token{}, fmt.Errorf("error fetching token: %w", err)
+	}
+	return t, nil
+}
+
+func (s *SQLite) RevokeToken(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE API_TOKENS SET REVOKED_AT = CURRENT_TIMESTAMP WHERE ID = ? AND REVOKED_AT IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("error revoking token %v: %w", id, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify token %v was revoked: %w", id, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: unrevoked token %v", ErrNotFound, id)
+	}
+	return nil
+}
+
+func (s *SQLite) CreateUser(ctx context.Context, name string) (int64, error) {
+	if err := ValidateAccountName("user", name); err != nil {
+		return 0, err
+	}
+	result, err := s.db.ExecContext(ctx, `INSERT INTO USERS (NAME) VALUES (?)`, name)
+	if isSQLiteErr(err, sqlite3.ErrConstraintUnique) {
+		return 0, fmt.Errorf("%w: user '%v'", ErrAlreadyExists, name)
+	} else if err != nil {
+		return 0, fmt.Errorf("error creating user '%v': %w", name, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting ID of created user '%v': %w", name, err)
+	}
+	return id, nil
+}
+
+func (s *SQLite) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT ID, NAME, CREATED_AT FROM USERS ORDER BY ID ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying users: %w", err)
+	}
+	return scanAll(rows, "users", scanUser)
+}
+
+func (s *SQLite) UserByName(ctx context.Context, name string) (User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx, `SELECT ID, NAME, CREATED_AT FROM USERS WHERE NAME = ?`, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("%w: user '%v'", ErrNotFound, name)
+	} else if err != nil {
+		return User{}, fmt.Errorf("error fetching user '%v': %w", name, err)
+	}
+	return u, nil
+}
+
+func (s *SQLite) CreateHousehold(ctx context.Context, name string) (int64, error) {
+	if err := ValidateAccountName("household", name); err != nil {
+		return 0, err
+	}
+	result, err := s.db.ExecContext(ctx, `INSERT INTO HOUSEHOLDS (NAME) VALUES (?)`, name)
+	if isSQLiteErr(err, sqlite3.ErrConstraintUnique) {
+		return 0, fmt.Errorf("%w: household '%v'", ErrAlreadyExists, name)
+	} else if err != nil {
+		return 0, fmt.Errorf("error creating household '%v': %w", name, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting ID of created household '%v': %w", name, err)
+	}
+	return id, nil
+}
+
+func (s *SQLite) ListHouseholds(ctx context.Context) ([]Household, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT ID, NAME, CREATED_AT FROM HOUSEHOLDS ORDER BY ID ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying households: %w", err)
+	}
+	return scanAll(rows, "households", scanHousehold)
+}
+
+func (s *SQLite) HouseholdByName(ctx context.Context, name string) (Household, error) {
+	h, err := scanHousehold(s.db.QueryRowContext(ctx, `SELECT ID, NAME, CREATED_AT FROM HOUSEHOLDS WHERE NAME = ?`, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Household{}, fmt.Errorf("%w: household '%v'", ErrNotFound, name)
+	} else if err != nil {
+		return Household{}, fmt.Errorf("error fetching household '%v': %w", name, err)
+	}
+	return h, nil
+}
+
+func (s *SQLite) HouseholdMembers(ctx context.Context, household int64) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT u.ID, u.NAME, u.CREATED_AT FROM USERS AS u
+		JOIN HOUSEHOLD_MEMBERS AS m ON m.USER_ID = u.ID
+		WHERE m.HOUSEHOLD_ID = ? ORDER BY u.ID ASC
+	`, household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying members of household %v: %w", household, err)
+	}
+	return scanAll(rows, "users", scanUser)
+}
+
+func (s *SQLite) AddHouseholdMember(ctx context.Context, household, user int64) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO HOUSEHOLD_MEMBERS (HOUSEHOLD_ID, USER_ID) VALUES (?, ?)`, household, user)
+	if isSQLiteErr(err, sqlite3.ErrConstraintPrimaryKey) {
+		return fmt.Errorf("%w: user %v in household %v", ErrAlreadyExists, user, household)
+	} else if isSQLiteErr(err, sqlite3.ErrConstraintForeignKey) {
+		return fmt.Errorf("%w: user %v or household %v", ErrNotFound, user, household)
+	} else if err != nil {
+		return fmt.Errorf("error adding user %v to household %v: %w", user, household, err)
+	}
+	return nil
+}
+
+func (s *SQLite) RemoveHouseholdMember(ctx context.Context, household, user int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM HOUSEHOLD_MEMBERS WHERE HOUSEHOLD_ID = ? AND USER_ID = ?`, household, user)
+	if err != nil {
+		return fmt.Errorf("error removing user %v from household %v: %w", user, household, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify user %v was removed from household %v: %w", user, household, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: user %v in household %v", ErrNotFound, user, household)
+	}
+	return nil
+}
+
+func (s *SQLite) UserHouseholds(ctx context.Context, user int64) ([]Household, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT h.ID, h.NAME, h.CREATED_AT FROM HOUSEHOLDS AS h
+		JOIN HOUSEHOLD_MEMBERS AS m ON m.HOUSEHOLD_ID = h.ID
+		WHERE m.USER_ID = ? ORDER BY h.ID ASC
+	`, user)
+	if err != nil {
+		return nil, fmt.Errorf("error querying households of user %v: %w", user, err)
+	}
+	return scanAll(rows, "households", scanHousehold)
+}
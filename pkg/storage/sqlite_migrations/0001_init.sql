@@ -0,0 +1,34 @@
+-- Dates are stored as yyyy-mm-dd text, tags and description embeddings as
+-- JSON arrays.
+CREATE TABLE IF NOT EXISTS TRANSACTIONS (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    DATE DATE NOT NULL,
+    DESCRIPTION TEXT NOT NULL,
+    AMOUNT_CENTS INTEGER NOT NULL,
+    SOURCE TEXT NOT NULL,
+    TAGS TEXT,
+    NOTES TEXT,
+    DESC_EMBEDDING TEXT
+);
+
+CREATE INDEX IF NOT EXISTS TRANSACTIONS_DATE_INDEX ON TRANSACTIONS(DATE);
+
+CREATE TABLE IF NOT EXISTS ATTACHMENTS (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    TXN_ID INTEGER NOT NULL REFERENCES TRANSACTIONS(ID) ON DELETE CASCADE,
+    NAME TEXT NOT NULL,
+    CONTENT_TYPE TEXT NOT NULL,
+    SIZE_BYTES INTEGER NOT NULL,
+    DIGEST TEXT NOT NULL,
+    CREATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS ATTACHMENTS_TXN_ID_INDEX ON ATTACHMENTS(TXN_ID);
+CREATE INDEX IF NOT EXISTS ATTACHMENTS_DIGEST_INDEX ON ATTACHMENTS(DIGEST);
+
+CREATE TABLE IF NOT EXISTS VIEWS (
+    NAME TEXT PRIMARY KEY,
+    QUERY TEXT NOT NULL,
+    CREATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UPDATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
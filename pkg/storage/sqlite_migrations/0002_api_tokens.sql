@@ -0,0 +1,9 @@
+-- Scopes are stored as a JSON array.
+CREATE TABLE IF NOT EXISTS API_TOKENS (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    NAME TEXT NOT NULL,
+    TOKEN_HASH TEXT NOT NULL UNIQUE,
+    SCOPES TEXT NOT NULL,
+    CREATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    REVOKED_AT TIMESTAMP
+);
@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS USERS (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    NAME TEXT NOT NULL UNIQUE,
+    CREATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS HOUSEHOLDS (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    NAME TEXT NOT NULL UNIQUE,
+    CREATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS HOUSEHOLD_MEMBERS (
+    HOUSEHOLD_ID INTEGER NOT NULL REFERENCES HOUSEHOLDS(ID) ON DELETE CASCADE,
+    USER_ID INTEGER NOT NULL REFERENCES USERS(ID) ON DELETE CASCADE,
+    PRIMARY KEY (HOUSEHOLD_ID, USER_ID)
+);
+
+-- Everything that already exists belongs to the default user and household.
+INSERT INTO USERS (ID, NAME) VALUES (1, 'default');
+INSERT INTO HOUSEHOLDS (ID, NAME) VALUES (1, 'default');
+INSERT INTO HOUSEHOLD_MEMBERS (HOUSEHOLD_ID, USER_ID) VALUES (1, 1);
+
+-- SQLite can't add columns referencing other tables with a non NULL default
+-- so the household and user of rows are only enforced by the code.
+ALTER TABLE TRANSACTIONS ADD COLUMN HOUSEHOLD_ID INTEGER NOT NULL DEFAULT 1;
+CREATE INDEX IF NOT EXISTS TRANSACTIONS_HOUSEHOLD_ID_INDEX ON TRANSACTIONS(HOUSEHOLD_ID, ID);
+
+ALTER TABLE API_TOKENS ADD COLUMN USER_ID INTEGER NOT NULL DEFAULT 1;
+
+-- View names are unique per household.
+CREATE TABLE VIEWS_BY_HOUSEHOLD (
+    HOUSEHOLD_ID INTEGER NOT NULL REFERENCES HOUSEHOLDS(ID),
+    NAME TEXT NOT NULL,
+    QUERY TEXT NOT NULL,
+    CREATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UPDATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (HOUSEHOLD_ID, NAME)
+);
+INSERT INTO VIEWS_BY_HOUSEHOLD (HOUSEHOLD_ID, NAME, QUERY, CREATED_AT, UPDATED_AT)
+    SELECT 1, NAME, QUERY, CREATED_AT, UPDATED_AT FROM VIEWS;
+DROP TABLE VIEWS;
+ALTER TABLE VIEWS_BY_HOUSEHOLD RENAME TO VIEWS;
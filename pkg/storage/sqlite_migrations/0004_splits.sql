@@ -0,0 +1,7 @@
+-- Shares are stored as a JSON array of {"person", "amount_cents"} objects.
+CREATE TABLE IF NOT EXISTS SPLITS (
+    TXN_ID INTEGER PRIMARY KEY REFERENCES TRANSACTIONS(ID) ON DELETE CASCADE,
+    PAID_BY TEXT NOT NULL,
+    SHARES TEXT NOT NULL,
+    UPDATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
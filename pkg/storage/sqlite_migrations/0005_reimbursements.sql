@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS REIMBURSEMENTS (
+    TXN_ID INTEGER PRIMARY KEY REFERENCES TRANSACTIONS(ID) ON DELETE CASCADE,
+    EXPECTED_FROM TEXT NOT NULL,
+    CREDIT_TXN_ID INTEGER UNIQUE REFERENCES TRANSACTIONS(ID) ON DELETE SET NULL,
+    CREATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
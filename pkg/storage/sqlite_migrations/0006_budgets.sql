@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS BUDGETS (
+    HOUSEHOLD_ID INTEGER NOT NULL,
+    TAG TEXT NOT NULL,
+    PERIOD TEXT NOT NULL,
+    AMOUNT_CENTS INTEGER NOT NULL,
+    ROLLOVER BOOLEAN NOT NULL DEFAULT FALSE,
+    SINCE DATE NOT NULL,
+    CREATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UPDATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (HOUSEHOLD_ID, TAG, PERIOD)
+);
@@ -0,0 +1,14 @@
+-- Transaction IDs are stored as a JSON array and alerts as a JSON array of
+-- {"kind", "date", "txn_id", "expected_cents", "amount_cents"} objects.
+CREATE TABLE IF NOT EXISTS RECURRING_SERIES (
+    ID INTEGER PRIMARY KEY REFERENCES TRANSACTIONS(ID) ON DELETE CASCADE,
+    NAME TEXT NOT NULL,
+    PERIOD TEXT NOT NULL,
+    AMOUNT_CENTS INTEGER NOT NULL,
+    TXN_IDS TEXT NOT NULL,
+    LAST_DATE DATE NOT NULL,
+    NEXT_DATE DATE NOT NULL,
+    ACTIVE BOOLEAN NOT NULL,
+    ALERTS TEXT NOT NULL,
+    UPDATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
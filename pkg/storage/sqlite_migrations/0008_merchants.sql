@@ -0,0 +1,17 @@
+-- Patterns are stored as a JSON array of regular expressions.
+CREATE TABLE IF NOT EXISTS MERCHANTS (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    HOUSEHOLD_ID INTEGER NOT NULL,
+    NAME TEXT NOT NULL,
+    PATTERNS TEXT NOT NULL DEFAULT '[]',
+    CREATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (HOUSEHOLD_ID, NAME)
+);
+
+CREATE TABLE IF NOT EXISTS TXN_MERCHANTS (
+    TXN_ID INTEGER PRIMARY KEY REFERENCES TRANSACTIONS(ID) ON DELETE CASCADE,
+    MERCHANT_ID INTEGER NOT NULL REFERENCES MERCHANTS(ID) ON DELETE CASCADE,
+    SOURCE TEXT NOT NULL,
+    UPDATED_AT TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS TXN_MERCHANTS_MERCHANT_ID_INDEX ON TXN_MERCHANTS(MERCHANT_ID);
@@ -0,0 +1,18 @@
+//go:build !cgo
+
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// SQLite needs the cgo SQLite driver so binaries built without cgo, e.g.,
+// the docker image, only support postgres.
+type SQLite struct {
+	Backend
+}
+
+func NewSQLite(ctx context.Context, file string) (*SQLite, error) {
+	return nil, errors.New("the sqlite driver isn't supported by this binary, it must be built with CGO_ENABLED=1")
+}
@@ -0,0 +1,319 @@
+//go:build cgo
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestSQLite(t *testing.T) *SQLite {
+	t.Helper()
+	s, err := NewSQLite(context.Background(), filepath.Join(t.TempDir(), "txns.db"))
+	if err != nil {
+		t.Fatalf("NewSQLite got error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLite(t *testing.T) {
+	testTxnStore(t, func(t *testing.T) TxnStore {
+		return newTestSQLite(t)
+	})
+}
+
+// TestSQLiteTxnBatches runs the conformance suite reading transactions a
+// few rows at a time so queries span several batches.
+func TestSQLiteTxnBatches(t *testing.T) {
+	defer func(size int) { sqliteTxnBatchSize = size }(sqliteTxnBatchSize)
+	sqliteTxnBatchSize = 2
+	testTxnStore(t, func(t *testing.T) TxnStore {
+		return newTestSQLite(t)
+	})
+}
+
+func TestSQLiteHouseholds(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+	id, err := s.CreateHousehold(ctx, "roommates")
+	if err != nil {
+		t.Fatalf("CreateHousehold got error: %v", err)
+	}
+	if _, err := s.CreateHousehold(ctx, "roommates"); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("CreateHousehold twice got error %v, want %v", err, ErrAlreadyExists)
+	}
+	other := s.ForHousehold(id)
+	testHouseholdIsolation(t, s, other)
+
+	if err := other.CreateView(ctx, &View{Name: "rent", Query: "description=RENT"}); err != nil {
+		t.Fatalf("CreateView got error: %v", err)
+	}
+	if err := s.CreateView(ctx, &View{Name: "rent", Query: "description=RENT&source=RBC"}); err != nil {
+		t.Errorf("CreateView with a name used by another household got error: %v", err)
+	}
+	if v, err := other.GetView(ctx, "rent"); err != nil || v.Query != "description=RENT" {
+		t.Errorf("GetView got %+v, %v, want the view of its own household", v, err)
+	}
+	page, err := s.QueryTxns(ctx, &TxnQuery{})
+	if err != nil {
+		t.Fatalf("QueryTxns got error: %v", err)
+	}
+	a := Attachment{TxnID: page.Txns[0].ID, Name: "lease.pdf", ContentType: "application/pdf", SizeBytes: 10, Digest: "abc"}
+	if _, err := other.CreateAttachment(ctx, &a); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CreateAttachment on txn of another household got error %v, want %v", err, ErrNotFound)
+	}
+	aID, err := s.CreateAttachment(ctx, &a)
+	if err != nil {
+		t.Fatalf("CreateAttachment got error: %v", err)
+	}
+	if _, err := other.GetAttachment(ctx, a.TxnID, aID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAttachment of another household got error %v, want %v", err, ErrNotFound)
+	}
+
+	user, err := s.CreateUser(ctx, "alex")
+	if err != nil {
+		t.Fatalf("CreateUser got error: %v", err)
+	}
+	if err := s.AddHouseholdMember(ctx, id, user); err != nil {
+		t.Fatalf("AddHouseholdMember got error: %v", err)
+	}
+	if err := s.AddHouseholdMember(ctx, id, user); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("AddHouseholdMember twice got error %v, want %v", err, ErrAlreadyExists)
+	}
+	if err := s.AddHouseholdMember(ctx, DefaultHousehold, user); err != nil {
+		t.Fatalf("AddHouseholdMember got error: %v", err)
+	}
+	hs, err := s.UserHouseholds(ctx, user)
+	if err != nil {
+		t.Fatalf("UserHouseholds got error: %v", err)
+	}
+	if len(hs) != 2 || hs[0].ID != DefaultHousehold || hs[1].ID != id {
+		t.Errorf("UserHouseholds got %+v, want households %v and %v", hs, DefaultHousehold, id)
+	}
+	if err := s.RemoveHouseholdMember(ctx, DefaultHousehold, user); err != nil {
+		t.Fatalf("RemoveHouseholdMember got error: %v", err)
+	}
+	members, err := s.HouseholdMembers(ctx, DefaultHousehold)
+	if err != nil {
+		t.Fatalf("HouseholdMembers got error: %v", err)
+	}
+	if len(members) != 1 || members[0].ID != DefaultUser {
+		t.Errorf("HouseholdMembers got %+v, want only the default user", members)
+	}
+}
+
+func TestSQLiteReopen(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "txns.db")
+	s, err := NewSQLite(ctx, file)
+	if err != nil {
+		t.Fatalf("NewSQLite got error: %v", err)
+	}
+	txns := []Txn{{Date: date("2024-01-01"), Description: "A", AmountCents: -100, Source: "AMEX", Tags: []string{"a"}}}
+	createTxns(t, s, txns)
+	s.Close()
+
+	s, err = NewSQLite(ctx, file)
+	if err != nil {
+		t.Fatalf("NewSQLite reopening %v got error: %v", file, err)
+	}
+	defer s.Close()
+	got := queryAll(t, s, &TxnQuery{})
+	if len(got) != 1 || txnString(got[0]) != txnString(txns[0]) {
+		t.Errorf("QueryTxns after reopening got %v, want %v", got, txns)
+	}
+}
+
+func TestSQLiteAttachmentsAndViews(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+	txns := []Txn{{Date: date("2024-01-01"), Description: "A", AmountCents: -100, Source: "AMEX"}}
+	createTxns(t, s, txns)
+
+	a := Attachment{TxnID: txns[0].ID, Name: "receipt.pdf", ContentType: "application/pdf", SizeBytes: 10, Digest: "abc"}
+	if _, err := s.CreateAttachment(ctx, &a); err != nil {
+		t.Fatalf("CreateAttachment got error: %v", err)
+	}
+	missing := a
+	missing.TxnID = txns[0].ID + 1
+	if _, err := s.CreateAttachment(ctx, &missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CreateAttachment for missing txn got error %v, want %v", err, ErrNotFound)
+	}
+	as, err := s.ListAttachments(ctx, txns[0].ID)
+	if err != nil || len(as) != 1 || as[0].Name != a.Name || as[0].CreatedAt.IsZero() {
+		t.Fatalf("ListAttachments got %+v, %v, want the created attachment", as, err)
+	}
+	other := s.ForHousehold(DefaultHousehold + 1).(*SQLite)
+	if digests, err := other.AttachmentDigests(ctx); err != nil || !digests["abc"] || len(digests) != 1 {
+		t.Errorf("AttachmentDigests got %v, %v, want the digest of every household", digests, err)
+	}
+	if _, referenced, err := s.DeleteAttachment(ctx, txns[0].ID, as[0].ID); err != nil || referenced {
+		t.Errorf("DeleteAttachment got referenced %v, error %v, want false, nil", referenced, err)
+	}
+	if _, err := s.GetAttachment(ctx, txns[0].ID, as[0].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAttachment after delete got error %v, want %v", err, ErrNotFound)
+	}
+	if digests, err := s.AttachmentDigests(ctx); err != nil || len(digests) != 0 {
+		t.Errorf("AttachmentDigests after delete got %v, %v, want none", digests, err)
+	}
+
+	v := View{Name: "dining", Query: "tags=dining&tagsOp=match"}
+	if err := s.CreateView(ctx, &v); err != nil {
+		t.Fatalf("CreateView got error: %v", err)
+	}
+	if err := s.CreateView(ctx, &v); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("CreateView twice got error %v, want %v", err, ErrAlreadyExists)
+	}
+	v.Query = "tags=dining&tagsOp=not-match"
+	if err := s.UpdateView(ctx, &v); err != nil {
+		t.Fatalf("UpdateView got error: %v", err)
+	}
+	if got, err := s.GetView(ctx, v.Name); err != nil || got.Query != v.Query {
+		t.Errorf("GetView got %+v, %v, want query %q", got, err, v.Query)
+	}
+	if err := s.DeleteView(ctx, v.Name); err != nil {
+		t.Fatalf("DeleteView got error: %v", err)
+	}
+	if err := s.DeleteView(ctx, v.Name); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteView twice got error %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestSQLiteSplits(t *testing.T) {
+	s := newTestSQLite(t)
+	testSplits(t, s)
+	other := s.ForHousehold(DefaultHousehold + 1)
+	if splits, err := other.ListSplits(context.Background()); err != nil || len(splits) != 0 {
+		t.Errorf("ListSplits of another household got %+v, %v, want no splits", splits, err)
+	}
+}
+
+func TestSQLiteReimbursements(t *testing.T) {
+	testReimbursements(t, newTestSQLite(t))
+}
+
+func TestSQLiteNetSpending(t *testing.T) {
+	testNetSpending(t, newTestSQLite(t))
+}
+
+func TestSQLiteBudgets(t *testing.T) {
+	s := newTestSQLite(t)
+	testBudgets(t, s)
+	other := s.ForHousehold(DefaultHousehold + 1)
+	if budgets, err := other.ListBudgets(context.Background()); err != nil || len(budgets) != 0 {
+		t.Errorf("ListBudgets of another household got %+v, %v, want no budgets", budgets, err)
+	}
+}
+
+// TestSQLiteBudgetSince tests the start of budgets is stored as a date
+// like transaction dates, whatever the time of day and location it's given
+// in, since spending is compared against it as text.
+func TestSQLiteBudgetSince(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+	since := time.Date(2024, 3, 1, 15, 30, 0, 0, time.FixedZone("PST", -8*60*60))
+	if err := s.SetBudget(ctx, &Budget{Tag: "groceries", Period: PeriodMonthly, AmountCents: 100, Since: since}); err != nil {
+		t.Fatalf("SetBudget got error: %v", err)
+	}
+	var stored string
+	if err := s.db.QueryRowContext(ctx, `SELECT CAST(SINCE AS TEXT) FROM BUDGETS`).Scan(&stored); err != nil {
+		t.Fatalf("error querying stored budget start: %v", err)
+	}
+	if want := "2024-03-01"; stored != want {
+		t.Errorf("SetBudget stored start %q, want %q", stored, want)
+	}
+	got, err := s.GetBudget(ctx, "groceries", PeriodMonthly)
+	if err != nil {
+		t.Fatalf("GetBudget got error: %v", err)
+	}
+	if want := date("2024-03-01"); !got.Since.Equal(want) {
+		t.Errorf("GetBudget got start %v, want %v", got.Since, want)
+	}
+	budgets, err := s.ListBudgets(ctx)
+	if err != nil {
+		t.Fatalf("ListBudgets got error: %v", err)
+	}
+	if want := date("2024-03-01"); len(budgets) != 1 || !budgets[0].Since.Equal(want) {
+		t.Errorf("ListBudgets got %+v, want a budget starting on %v", budgets, want)
+	}
+}
+
+func TestSQLiteRecurring(t *testing.T) {
+	s := newTestSQLite(t)
+	testRecurring(t, s)
+	other := s.ForHousehold(DefaultHousehold + 1)
+	if series, err := other.ListRecurringSeries(context.Background()); err != nil || len(series) != 0 {
+		t.Errorf("ListRecurringSeries of another household got %+v, %v, want no series", series, err)
+	}
+}
+
+func TestSQLiteTxnTagsByQuery(t *testing.T) {
+	testTxnTagsByQuery(t, newTestSQLite(t))
+}
+
+func TestSQLiteDescriptionNovelty(t *testing.T) {
+	testDescriptionNovelty(t, newTestSQLite(t))
+}
+
+func TestSQLiteMerchants(t *testing.T) {
+	s := newTestSQLite(t)
+	testMerchants(t, s)
+	other := s.ForHousehold(DefaultHousehold + 1)
+	if merchants, err := other.ListMerchants(context.Background()); err != nil || len(merchants) != 0 {
+		t.Errorf("ListMerchants of another household got %+v, %v, want no merchants", merchants, err)
+	}
+}
+
+func TestSQLiteTokens(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+	secret, hash, err := NewTokenSecret()
+	if err != nil {
+		t.Fatalf("NewTokenSecret got error: %v", err)
+	}
+	if HashTokenSecret(secret) != hash {
+		t.Fatalf("HashTokenSecret(%q) = %q, want %q", secret, HashTokenSecret(secret), hash)
+	}
+	if _, err := s.CreateToken(ctx, &Token{UserID: DefaultUser, Name: "ui", Scopes: []string{"owner"}}, hash); err == nil {
+		t.Errorf("CreateToken with invalid scope got nil error, want error")
+	}
+	if _, err := s.CreateToken(ctx, &Token{UserID: DefaultUser + 1, Name: "ui", Scopes: []string{ScopeRead}}, hash); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CreateToken for missing user got error %v, want %v", err, ErrNotFound)
+	}
+	id, err := s.CreateToken(ctx, &Token{UserID: DefaultUser, Name: "ui", Scopes: []string{ScopeWrite, ScopeRead, ScopeWrite}}, hash)
+	if err != nil {
+		t.Fatalf("CreateToken got error: %v", err)
+	}
+	got, err := s.TokenByHash(ctx, hash)
+	if err != nil {
+		t.Fatalf("TokenByHash got error: %v", err)
+	}
+	if got.ID != id || got.UserID != DefaultUser || got.Name != "ui" || !slices.Equal(got.Scopes, []string{ScopeRead, ScopeWrite}) || got.RevokedAt != nil {
+		t.Errorf("TokenByHash got %+v, want unrevoked token %v named ui with scopes [read write]", got, id)
+	}
+	if _, err := s.TokenByHash(ctx, HashTokenSecret("txns_wrong")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("TokenByHash with unknown hash got error %v, want %v", err, ErrNotFound)
+	}
+
+	if err := s.RevokeToken(ctx, id); err != nil {
+		t.Fatalf("RevokeToken got error: %v", err)
+	}
+	if err := s.RevokeToken(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RevokeToken twice got error %v, want %v", err, ErrNotFound)
+	}
+	if _, err := s.TokenByHash(ctx, hash); !errors.Is(err, ErrNotFound) {
+		t.Errorf("TokenByHash for revoked token got error %v, want %v", err, ErrNotFound)
+	}
+	tokens, err := s.ListTokens(ctx)
+	if err != nil {
+		t.Fatalf("ListTokens got error: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != id || tokens[0].RevokedAt == nil {
+		t.Errorf("ListTokens got %+v, want revoked token %v", tokens, id)
+	}
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// ScopeRead allows reading, ScopeWrite allows creating and changing data
+	// and ScopeAdmin allows everything. Each scope includes the ones before
+	// it.
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+
+	TokenNameLimit       = 100
+	tokenSecretPrefix    = "txns_"
+	tokenSecretBytes     = 32
+	tokenColumnsSelected = "ID, USER_ID, NAME, SCOPES, CREATED_AT, REVOKED_AT"
+)
+
+var (
+	ValidScopes = fmt.Sprintf("%v|%v|%v", ScopeRead, ScopeWrite, ScopeAdmin)
+
+	// scopeRanks orders the scopes so a scope grants every scope ranked at
+	// or below it.
+	scopeRanks = map[string]int{ScopeRead: 1, ScopeWrite: 2, ScopeAdmin: 3}
+)
+
+// Token is an API token of a user. Only the SHA-256 hash of the secret is
+// stored so the secret is shown once when the token is created.
+type Token struct {
+	ID        int64
+	UserID    int64
+	Name      string
+	Scopes    []string
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+// HasScope returns whether the token grants the given scope.
+func (t *Token) HasScope(scope string) bool {
+	want, ok := scopeRanks[scope]
+	if !ok {
+		return false
+	}
+	for _, s := range t.Scopes {
+		if scopeRanks[s] >= want {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Token) validate() error {
+	if l := len(t.Name); l == 0 || l > TokenNameLimit {
+		return fmt.Errorf("invalid token name length, got %v, want >0 and <= %v", l, TokenNameLimit)
+	}
+	if len(t.Scopes) == 0 {
+		return fmt.Errorf("token has no scopes, want at least one of %v", ValidScopes)
+	}
+	for _, s := range t.Scopes {
+		if _, ok := scopeRanks[s]; !ok {
+			return fmt.Errorf("invalid token scope '%v', want %v", s, ValidScopes)
+		}
+	}
+	return nil
+}
+
+// NewTokenSecret generates a random token secret and returns it along with
+// the hash to store.
+func NewTokenSecret() (secret, hash string, err error) {
+	b := make([]byte, tokenSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("error generating token secret: %w", err)
+	}
+	secret = tokenSecretPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return secret, HashTokenSecret(secret), nil
+}
+
+// HashTokenSecret returns the hash stored for a token secret.
+func HashTokenSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// normalizeScopes sorts and dedups scopes so they're stored consistently.
+func normalizeScopes(scopes []string) []string {
+	result := slices.Clone(scopes)
+	for i, s := range result {
+		result[i] = strings.TrimSpace(s)
+	}
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+func scanToken(row interface{ Scan(...any) error }) (Token, error) {
+	var t Token
+	var revokedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, pq.Array(&t.Scopes), &t.CreatedAt, &revokedAt)
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+	return t, err
+}
+
+// CreateToken stores a token with the hash of its secret and returns the ID
+// of the token.
+func (s *Storage) CreateToken(ctx context.Context, t *Token, hash string) (int64, error) {
+	t.Scopes = normalizeScopes(t.Scopes)
+	if err := t.validate(); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := s.db.QueryRowContext(ctx, `INSERT INTO API_TOKENS (USER_ID, NAME, TOKEN_HASH, SCOPES) VALUES ($1, $2, $3, $4) RETURNING ID`,
+		t.UserID, t.Name, hash, pq.Array(t.Scopes)).Scan(&id)
+	if isPQErr(err, pqForeignKeyViolation) {
+		return 0, fmt.Errorf("%w: user %v", ErrNotFound, t.UserID)
+	} else if err != nil {
+		return 0, fmt.Errorf("error creating token '%v': %w", t.Name, err)
+	}
+	return id, nil
+}
+
+// ListTokens returns every token including revoked ones.
+func (s *Storage) ListTokens(ctx context.Context) ([]Token, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+tokenColumnsSelected+` FROM API_TOKENS ORDER BY ID ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tokens: %w", err)
+	}
+	defer rows.Close()
+	var result []Token
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning token after scanning %v tokens: %w", len(result), err)
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// TokenByHash returns the unrevoked token with the given secret hash.
+func (s *Storage) TokenByHash(ctx context.Context, hash string) (Token, error) {
+	t, err := scanToken(s.db.QueryRowContext(ctx, `SELECT `+tokenColumnsSelected+` FROM API_TOKENS WHERE TOKEN_HASH = $1 AND REVOKED_AT IS NULL`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Token{}, fmt.Errorf("%w: token", ErrNotFound)
+	} else if err != nil {
+		return Token{}, fmt.Errorf("error fetching token: %w", err)
+	}
+	return t, nil
+}
+
+// RevokeToken revokes the token with the given ID. Revoking a token that is
+// already revoked is an error.
+func (s *Storage) RevokeToken(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE API_TOKENS SET REVOKED_AT = NOW() WHERE ID = $1 AND REVOKED_AT IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("error revoking token %v: %w", id, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify token %v was revoked: %w", id, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: unrevoked token %v", ErrNotFound, id)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package storage
+
+import "testing"
+
+func TestTokenHasScope(t *testing.T) {
+	for _, tc := range []struct {
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{scopes: []string{ScopeRead}, scope: ScopeRead, want: true},
+		{scopes: []string{ScopeRead}, scope: ScopeWrite, want: false},
+		{scopes: []string{ScopeWrite}, scope: ScopeRead, want: true},
+		{scopes: []string{ScopeWrite}, scope: ScopeAdmin, want: false},
+		{scopes: []string{ScopeRead, ScopeAdmin}, scope: ScopeWrite, want: true},
+		{scopes: []string{ScopeAdmin}, scope: "owner", want: false},
+		{scopes: nil, scope: ScopeRead, want: false},
+	} {
+		tok := Token{Scopes: tc.scopes}
+		if got := tok.HasScope(tc.scope); got != tc.want {
+			t.Errorf("Token{Scopes: %v}.HasScope(%v) = %v, want %v", tc.scopes, tc.scope, got, tc.want)
+		}
+	}
+}
@@ -7,8 +7,12 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/lib/pq"
 )
@@ -20,17 +24,35 @@ const (
 	DescEmbedLen = 768
 	MaxTags      = 10
 	TagSizeLimit = 30
+	NotesLimit   = 1000
 	dateQueryFmt = "2006-01-02"
 	OpMatch      = "match"
 	OpNotMatch   = "not-match"
 	OpEmpty      = "empty"
+	OpExact      = "exact"
+	OpPrefix     = "prefix"
+	OpSuffix     = "suffix"
+	OpRegex      = "regex"
+	AmountDebit  = "debit"
+	AmountCredit = "credit"
+	TagsOpAdd    = "add"
+	TagsOpRemove = "remove"
+	TagsOpClear  = "clear"
+	MaxBulkTxns  = 10000
 )
 
 var (
-	descRegexp = regexp.MustCompile(`^[\w\s-&/\.,\*']+$`)
-	srcRegexp  = regexp.MustCompile(`^[\w\s-]+$`)
-	tagRegexp  = regexp.MustCompile(`^[\w\s-]+$`)
-	ValidOps   = fmt.Sprintf("%v|%v|%v", OpMatch, OpNotMatch, OpEmpty)
+	tagRegexp    = regexp.MustCompile(`^[\w\s-]+$`)
+	ValidOps     = fmt.Sprintf("%v|%v|%v|%v|%v|%v|%v", OpMatch, OpNotMatch, OpEmpty, OpExact, OpPrefix, OpSuffix, OpRegex)
+	ValidTagsOps = fmt.Sprintf("%v|%v|%v", OpMatch, OpNotMatch, OpEmpty)
+
+	ErrNotFound    = errors.New("not found")
+	ErrTooManyTxns = errors.New("too many matching txns")
+
+	// textRanges are the unicode character classes allowed in descriptions
+	// and sources. Marks are included so decomposed accented letters are
+	// accepted as well.
+	textRanges = []*unicode.RangeTable{unicode.L, unicode.M, unicode.N, unicode.P, unicode.S, unicode.Zs}
 )
 
 type Txn struct {
@@ -40,10 +62,36 @@ type Txn struct {
 	AmountCents   int64
 	Source        string
 	Tags          []string
+	Notes         string
 	DescEmbedding string
+	// MerchantID and Merchant are the ID and name of the merchant the
+	// transaction is mapped to, if any. They're filled in when reading
+	// transactions and ignored when writing them.
+	MerchantID int64
+	Merchant   string
 }
 
 func ValidateOp(op string) bool {
+	switch op {
+	case OpMatch:
+		fallthrough
+	case OpNotMatch:
+		fallthrough
+	case OpEmpty:
+		fallthrough
+	case OpExact:
+		fallthrough
+	case OpPrefix:
+		fallthrough
+	case OpSuffix:
+		fallthrough
+	case OpRegex:
+		return true
+	}
+	return false
+}
+
+func ValidateTagsOp(op string) bool {
 	switch op {
 	case OpMatch:
 		fallthrough
@@ -70,6 +118,71 @@ func ValidateTags(tags []string) error {
 	return nil
 }
 
+func validateText(field, s string, limit int) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("%v was not a valid UTF-8 string", field)
+	}
+	if l := utf8.RuneCountInString(s); l == 0 || l > limit {
+		return fmt.Errorf("invalid %v length, got %v characters, want >0 and <= %v", field, l, limit)
+	}
+	for i, c := range s {
+		if !unicode.IsOneOf(textRanges, c) {
+			return fmt.Errorf("%v had invalid character %q at byte offset %v, only letters, numbers, punctuation, symbols and spaces are allowed", field, c, i)
+		}
+	}
+	return nil
+}
+
+func ValidateDescription(desc string) error {
+	return validateText("description", desc, DescLimit)
+}
+
+func ValidateSource(source string) error {
+	return validateText("source", source, SourceLimit)
+}
+
+func ValidateNotes(notes string) error {
+	if !utf8.ValidString(notes) {
+		return errors.New("notes were not a valid UTF-8 string")
+	}
+	if l := utf8.RuneCountInString(notes); l > NotesLimit {
+		return fmt.Errorf("notes too long, got %v characters, want <= %v", l, NotesLimit)
+	}
+	return nil
+}
+
+// ParseAmount parses a dollar amount like "-12.34" into cents.
+func ParseAmount(amount string) (int64, error) {
+	splitAmount := strings.Split(amount, ".")
+	var dollars, cents string
+	if len(splitAmount) == 1 {
+		dollars = splitAmount[0]
+		cents = "0"
+	} else if len(splitAmount) == 2 {
+		dollars, cents = splitAmount[0], splitAmount[1]
+	} else {
+		return 0, fmt.Errorf("invalid amount %q, want <dollars>.<cents>", amount)
+	}
+	d, err := strconv.ParseInt(dollars, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid dollar portion %q in amount %q, expected base 10 64-bit integer: %v", dollars, amount, err)
+	}
+	if l := len(cents); l == 0 || l > 2 {
+		return 0, fmt.Errorf("invalid cents portion %q in amount %q, want 1 or 2 digits", cents, amount)
+	} else if l == 1 {
+		// "12.5" is 12 dollars and 50 cents.
+		cents += "0"
+	}
+	c, err := strconv.ParseUint(cents, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cents portion %q in amount %q, expected base 10 integer: %v", cents, amount, err)
+	}
+	if d < 0 || strings.HasPrefix(dollars, "-") {
+		return d*100 - int64(c), nil
+	}
+	return d*100 + int64(c), nil
+}
+
 func validateDescEmbedding(descEmbedding string) error {
 	if descEmbedding == "" {
 		return nil
@@ -88,15 +201,18 @@ func (tx *Txn) validate() error {
 	if tx.Date.IsZero() {
 		return errors.New("date was not specified")
 	}
-	if l := len(tx.Description); l == 0 || l > DescLimit {
-		return fmt.Errorf("invalid description length, got %v, want >0 and <= %v", l, DescLimit)
+	if err := ValidateDescription(tx.Description); err != nil {
+		return err
 	}
-	if l := len(tx.Source); l == 0 || l > SourceLimit {
-		return fmt.Errorf("invalid source length, got %v, want >0 and <= %v", l, SourceLimit)
+	if err := ValidateSource(tx.Source); err != nil {
+		return err
 	}
 	if err := ValidateTags(tx.Tags); err != nil {
 		return err
 	}
+	if err := ValidateNotes(tx.Notes); err != nil {
+		return err
+	}
 	if err := validateDescEmbedding(tx.DescEmbedding); err != nil {
 		return err
 	}
@@ -104,37 +220,66 @@ func (tx *Txn) validate() error {
 }
 
 type TxnQuery struct {
-	FromDate    *time.Time
-	ToDate      *time.Time
-	Description *string
-	DescOp      string
-	AmountCents *int64
-	Source      *string
-	SourceOp    string
-	Tags        *[]string
-	TagsOp      string
-	StartID     int64
-	Limit       int64
+	FromDate       *time.Time
+	ToDate         *time.Time
+	Description    *string
+	DescOp         string
+	AmountCents    *int64
+	MinAmountCents *int64
+	MaxAmountCents *int64
+	AmountAbs      bool
+	AmountType     string
+	Source         *string
+	SourceOp       string
+	Tags           *[]string
+	TagsOp         string
+	Notes          *string
+	NotesOp        string
+	Expr           Expr
+	StartID        int64
+	Sort           string
+	SortDesc       bool
+	After          *Cursor
+	Limit          int64
+}
+
+// HasFilter reports whether tq selects transactions by anything but their
+// position, i.e., by date, description, source, notes, amount, tags or an
+// expression. Paging and sorting don't count and neither does AmountAbs on
+// its own.
+func (tq *TxnQuery) HasFilter() bool {
+	return tq.FromDate != nil || tq.ToDate != nil ||
+		tq.Description != nil || tq.Source != nil || tq.Notes != nil || tq.Tags != nil ||
+		tq.AmountCents != nil || tq.MinAmountCents != nil || tq.MaxAmountCents != nil || tq.AmountType != "" ||
+		tq.Expr != nil
 }
 
 func (tq *TxnQuery) validate() error {
 	if tq.Description != nil {
-		if l := len(*tq.Description); l > DescLimit {
-			return fmt.Errorf("description too long, got length %v, want <= %v", l, DescLimit)
-		}
-		if !descRegexp.MatchString(*tq.Description) {
-			return fmt.Errorf("description had invalid characters, got '%v', only alphanumeric, spaces, hyphens and dashes are allowed", *tq.Description)
+		if tq.DescOp == OpRegex {
+			if l := utf8.RuneCountInString(*tq.Description); l > DescLimit {
+				return fmt.Errorf("description regex too long, got length %v, want <= %v", l, DescLimit)
+			}
+			if err := validateRegex(*tq.Description); err != nil {
+				return fmt.Errorf("invalid description regex: %w", err)
+			}
+		} else if err := ValidateDescription(*tq.Description); err != nil {
+			return err
 		}
 		if ok := ValidateOp(tq.DescOp); !ok {
 			return fmt.Errorf("invalid descOp '%v'", tq.DescOp)
 		}
 	}
 	if tq.Source != nil {
-		if l := len(*tq.Source); l > SourceLimit {
-			return fmt.Errorf("source too long, got length %v, want <= %v", l, SourceLimit)
-		}
-		if !srcRegexp.MatchString(*tq.Source) {
-			return fmt.Errorf("source had invalid characters, got '%v', only alphanumeric, spaces, hyphens and dashes are allowed", *tq.Source)
+		if tq.SourceOp == OpRegex {
+			if l := utf8.RuneCountInString(*tq.Source); l > SourceLimit {
+				return fmt.Errorf("source regex too long, got length %v, want <= %v", l, SourceLimit)
+			}
+			if err := validateRegex(*tq.Source); err != nil {
+				return fmt.Errorf("invalid source regex: %w", err)
+			}
+		} else if err := ValidateSource(*tq.Source); err != nil {
+			return err
 		}
 		if ok := ValidateOp(tq.SourceOp); !ok {
 			return fmt.Errorf("invalid sourceOp '%v'", tq.SourceOp)
@@ -144,7 +289,7 @@ func (tq *TxnQuery) validate() error {
 		if err := ValidateTags(*tq.Tags); err != nil {
 			return fmt.Errorf("error validating tags: %w", err)
 		}
-		if ok := ValidateOp(tq.TagsOp); !ok {
+		if ok := ValidateTagsOp(tq.TagsOp); !ok {
 			return fmt.Errorf("invalid tagsOp '%v'", tq.TagsOp)
 		}
 		if tq.TagsOp == OpEmpty {
@@ -155,6 +300,34 @@ func (tq *TxnQuery) validate() error {
 			return fmt.Errorf("invalid tagsOp '%v', want %v|%v", tq.TagsOp, OpEmpty, OpMatch)
 		}
 	}
+	if tq.MinAmountCents != nil && tq.MaxAmountCents != nil && *tq.MinAmountCents > *tq.MaxAmountCents {
+		return fmt.Errorf("invalid amount range, got min %v > max %v", *tq.MinAmountCents, *tq.MaxAmountCents)
+	}
+	if tq.AmountAbs {
+		for _, a := range []*int64{tq.AmountCents, tq.MinAmountCents, tq.MaxAmountCents} {
+			if a != nil && *a < 0 {
+				return fmt.Errorf("invalid amount %v, want >= 0 when comparing absolute amounts", *a)
+			}
+		}
+	}
+	if tq.AmountType != "" && tq.AmountType != AmountDebit && tq.AmountType != AmountCredit {
+		return fmt.Errorf("invalid amountType '%v', want %v|%v", tq.AmountType, AmountDebit, AmountCredit)
+	}
+	if tq.Notes != nil {
+		if l := len(*tq.Notes); l == 0 {
+			return errors.New("notes can't be an empty string")
+		}
+		if err := ValidateNotes(*tq.Notes); err != nil {
+			return fmt.Errorf("error validating notes: %w", err)
+		}
+		if tq.NotesOp != OpMatch && tq.NotesOp != OpNotMatch {
+			return fmt.Errorf("invalid notesOp '%v', want %v|%v", tq.NotesOp, OpMatch, OpNotMatch)
+		}
+	} else if tq.NotesOp != "" {
+		if tq.NotesOp != OpEmpty && tq.NotesOp != OpMatch {
+			return fmt.Errorf("invalid notesOp '%v', want %v|%v", tq.NotesOp, OpEmpty, OpMatch)
+		}
+	}
 	if tq.Limit < 0 || tq.Limit > 1000 {
 		return fmt.Errorf("invalid limit, got %v, want >= 0 and <= 1000", tq.Limit)
 	} else if tq.Limit == 0 {
@@ -163,13 +336,17 @@ func (tq *TxnQuery) validate() error {
 	if tq.StartID < 0 {
 		return fmt.Errorf("invalid start ID, got %v, want >= 0", tq.StartID)
 	}
+	if err := tq.validateSort(); err != nil {
+		return err
+	}
 
 	return nil
 }
 
 type clausesOpts struct {
-	prevArgs int
-	tableID  string
+	prevArgs  int
+	tableID   string
+	household int64
 }
 
 type clauseOpt func(o *clausesOpts)
@@ -186,6 +363,34 @@ func WithTableID(id string) clauseOpt {
 	}
 }
 
+// withHousehold restricts the clauses to the transactions of the given
+// household. Without it no transactions match.
+func withHousehold(household int64) clauseOpt {
+	return func(o *clausesOpts) {
+		o.household = household
+	}
+}
+
+// textOpClause returns the clause and its argument comparing the given text
+// column to val using op. Matches are case insensitive.
+func textOpClause(col, op, val string, argNum int) (string, any, error) {
+	switch op {
+	case OpMatch:
+		return fmt.Sprintf("%v ILIKE $%v", col, argNum), "%" + val + "%", nil
+	case OpNotMatch:
+		return fmt.Sprintf("%v NOT ILIKE $%v", col, argNum), "%" + val + "%", nil
+	case OpExact:
+		return fmt.Sprintf("%v ILIKE $%v", col, argNum), escapeLike(val), nil
+	case OpPrefix:
+		return fmt.Sprintf("%v ILIKE $%v", col, argNum), escapeLike(val) + "%", nil
+	case OpSuffix:
+		return fmt.Sprintf("%v ILIKE $%v", col, argNum), "%" + escapeLike(val), nil
+	case OpRegex:
+		return fmt.Sprintf("%v ~* $%v", col, argNum), val, nil
+	}
+	return "", nil, fmt.Errorf("want %v", ValidOps)
+}
+
 func (tq *TxnQuery) asClauses(opts ...clauseOpt) ([]string, []any, error) {
 	var copts clausesOpts
 	for _, o := range opts {
@@ -197,6 +402,7 @@ func (tq *TxnQuery) asClauses(opts ...clauseOpt) ([]string, []any, error) {
 		return len(qArgs) + 1 + copts.prevArgs
 	}
 
+	clauses = append(clauses, fmt.Sprintf("%vHOUSEHOLD_ID = %v", copts.tableID, copts.household))
 	clauses = append(clauses, fmt.Sprintf("%vID >= %v", copts.tableID, tq.StartID))
 	if tq.FromDate != nil {
 		ds := tq.FromDate.Format(dateQueryFmt)
@@ -209,29 +415,46 @@ func (tq *TxnQuery) asClauses(opts ...clauseOpt) ([]string, []any, error) {
 		qArgs = append(qArgs, ds)
 	}
 	if tq.Description != nil {
-		if tq.DescOp == OpMatch {
-			clauses = append(clauses, fmt.Sprintf("%vDESCRIPTION ILIKE $%v", copts.tableID, argCount()))
-		} else if tq.DescOp == OpNotMatch {
-			clauses = append(clauses, fmt.Sprintf("%vDESCRIPTION NOT ILIKE $%v", copts.tableID, argCount()))
-		} else {
-			return nil, nil, fmt.Errorf("unsupported query op '%v' for description", tq.DescOp)
+		clause, arg, err := textOpClause(copts.tableID+"DESCRIPTION", tq.DescOp, *tq.Description, argCount())
+		if err != nil {
+			return nil, nil, fmt.Errorf("unsupported query op '%v' for description: %w", tq.DescOp, err)
 		}
-		qArgs = append(qArgs, "%"+*tq.Description+"%")
+		clauses = append(clauses, clause)
+		qArgs = append(qArgs, arg)
 	}
 	if tq.Source != nil {
-		if tq.SourceOp == OpMatch {
-			clauses = append(clauses, fmt.Sprintf("%vSOURCE ILIKE $%v", copts.tableID, argCount()))
-		} else if tq.SourceOp == OpNotMatch {
-			clauses = append(clauses, fmt.Sprintf("%vSOURCE NOT ILIKE $%v", copts.tableID, argCount()))
-		} else {
-			return nil, nil, fmt.Errorf("unsupported query op '%v' for source", tq.SourceOp)
+		clause, arg, err := textOpClause(copts.tableID+"SOURCE", tq.SourceOp, *tq.Source, argCount())
+		if err != nil {
+			return nil, nil, fmt.Errorf("unsupported query op '%v' for source: %w", tq.SourceOp, err)
 		}
-		qArgs = append(qArgs, "%"+*tq.Source+"%")
+		clauses = append(clauses, clause)
+		qArgs = append(qArgs, arg)
+	}
+	amountCol := fmt.Sprintf("%vAMOUNT_CENTS", copts.tableID)
+	if tq.AmountAbs {
+		amountCol = fmt.Sprintf("ABS(%v)", amountCol)
 	}
 	if tq.AmountCents != nil {
-		clauses = append(clauses, fmt.Sprintf("%vAMOUNT_CENTS = $%v", copts.tableID, argCount()))
+		clauses = append(clauses, fmt.Sprintf("%v = $%v", amountCol, argCount()))
 		qArgs = append(qArgs, *tq.AmountCents)
 	}
+	if tq.MinAmountCents != nil {
+		clauses = append(clauses, fmt.Sprintf("%v >= $%v", amountCol, argCount()))
+		qArgs = append(qArgs, *tq.MinAmountCents)
+	}
+	if tq.MaxAmountCents != nil {
+		clauses = append(clauses, fmt.Sprintf("%v <= $%v", amountCol, argCount()))
+		qArgs = append(qArgs, *tq.MaxAmountCents)
+	}
+	switch tq.AmountType {
+	case "":
+	case AmountDebit:
+		clauses = append(clauses, fmt.Sprintf("%vAMOUNT_CENTS < 0", copts.tableID))
+	case AmountCredit:
+		clauses = append(clauses, fmt.Sprintf("%vAMOUNT_CENTS > 0", copts.tableID))
+	default:
+		return nil, nil, fmt.Errorf("unsupported amount type '%v'", tq.AmountType)
+	}
 	if tq.Tags != nil {
 		if tq.TagsOp == OpMatch {
 			clauses = append(clauses, fmt.Sprintf("%vTAGS @> $%v", copts.tableID, argCount()))
@@ -254,34 +477,200 @@ func (tq *TxnQuery) asClauses(opts ...clauseOpt) ([]string, []any, error) {
 		clauses = append(clauses,
 			fmt.Sprintf("((%vTAGS IS NULL) OR (CARDINALITY(%vTAGS) = 0))", copts.tableID, copts.tableID))
 	}
+	if tq.Notes != nil {
+		if tq.NotesOp == OpMatch {
+			clauses = append(clauses, fmt.Sprintf("%vNOTES ILIKE $%v", copts.tableID, argCount()))
+		} else if tq.NotesOp == OpNotMatch {
+			clauses = append(clauses,
+				fmt.Sprintf("((%vNOTES IS NULL) OR (%vNOTES NOT ILIKE $%v))", copts.tableID, copts.tableID, argCount()))
+		} else {
+			return nil, nil, fmt.Errorf("unsupported query op '%v' for notes", tq.NotesOp)
+		}
+		qArgs = append(qArgs, "%"+escapeLike(*tq.Notes)+"%")
+	} else if tq.NotesOp == OpMatch {
+		clauses = append(clauses, fmt.Sprintf("LENGTH(%vNOTES) > 0", copts.tableID))
+	} else if tq.NotesOp == OpEmpty {
+		clauses = append(clauses,
+			fmt.Sprintf("((%vNOTES IS NULL) OR (LENGTH(%vNOTES) = 0))", copts.tableID, copts.tableID))
+	}
+	if tq.Expr != nil {
+		clause, eArgs, err := compileExpr(tq.Expr, clausesOpts{prevArgs: argCount() - 1, tableID: copts.tableID})
+		if err != nil {
+			return nil, nil, fmt.Errorf("error compiling query expression: %w", err)
+		}
+		clauses = append(clauses, clause)
+		qArgs = append(qArgs, eArgs...)
+	}
 	return clauses, qArgs, nil
 }
 
+// TxnStore creates, queries and updates transactions. It's implemented by
+// Storage backed by postgres and by Memory.
+type TxnStore interface {
+	CreateTxn(ctx context.Context, t *Txn) (int64, error)
+	QueryTxns(ctx context.Context, tq *TxnQuery) (TxnsPage, error)
+	UpdateTxns(ctx context.Context, ids []int64, tu *TxnUpdates) error
+	TxnAddTags(ctx context.Context, ids []int64, tags []string) error
+	TxnRemoveTags(ctx context.Context, ids []int64, tags []string) error
+	QuerySimilarTxns(ctx context.Context, ids []int64, tq *TxnQuery) (SimilarTxns, error)
+}
+
+// Store is everything the txns server needs from the storage of a
+// household. It's implemented by Storage backed by postgres and by SQLite.
+type Store interface {
+	TxnStore
+	CountTxns(ctx context.Context, tq *TxnQuery) (int64, error)
+	ForEachTxn(ctx context.Context, tq *TxnQuery, fn func(t *Txn) error) error
+	DescriptionNovelty(ctx context.Context, tq *TxnQuery, since time.Time) (map[int64]float64, error)
+	TxnTagsByQuery(ctx context.Context, tq *TxnQuery, op string, tags []string, maxAffected int, dryRun bool) (TagsByQueryResult, error)
+
+	CreateAttachment(ctx context.Context, a *Attachment) (int64, error)
+	ListAttachments(ctx context.Context, txnID int64) ([]Attachment, error)
+	GetAttachment(ctx context.Context, txnID, id int64) (Attachment, error)
+	DeleteAttachment(ctx context.Context, txnID, id int64) (Attachment, bool, error)
+
+	CreateView(ctx context.Context, v *View) error
+	ListViews(ctx context.Context) ([]View, error)
+	GetView(ctx context.Context, name string) (View, error)
+	UpdateView(ctx context.Context, v *View) error
+	DeleteView(ctx context.Context, name string) error
+
+	SetSplit(ctx context.Context, s *Split) error
+	GetSplit(ctx context.Context, txnID int64) (Split, error)
+	ListSplits(ctx context.Context) ([]Split, error)
+	DeleteSplit(ctx context.Context, txnID int64) error
+
+	SetReimbursable(ctx context.Context, r *Reimbursement) error
+	GetReimbursement(ctx context.Context, txnID int64) (Reimbursement, error)
+	ListReimbursements(ctx context.Context, outstandingOnly bool) ([]Reimbursement, error)
+	DeleteReimbursement(ctx context.Context, txnID int64) error
+	LinkReimbursement(ctx context.Context, txnID, creditTxnID int64) error
+	LinkReimbursements(ctx context.Context, links map[int64]int64) error
+	UnlinkReimbursement(ctx context.Context, txnID int64) error
+
+	SetBudget(ctx context.Context, b *Budget) error
+	ListBudgets(ctx context.Context) ([]Budget, error)
+	GetBudget(ctx context.Context, tag, period string) (Budget, error)
+	DeleteBudget(ctx context.Context, tag, period string) error
+	SpendingByTagMonth(ctx context.Context, tags []string, from, to time.Time) ([]TagSpending, error)
+
+	ReplaceRecurringSeries(ctx context.Context, series []RecurringSeries) error
+	ListRecurringSeries(ctx context.Context) ([]RecurringSeries, error)
+
+	CreateMerchant(ctx context.Context, m *Merchant) (int64, error)
+	ListMerchants(ctx context.Context) ([]Merchant, error)
+	GetMerchant(ctx context.Context, id int64) (Merchant, error)
+	UpdateMerchant(ctx context.Context, m *Merchant) error
+	DeleteMerchant(ctx context.Context, id int64) error
+	MergeMerchants(ctx context.Context, fromID, intoID int64) error
+	SetTxnMerchants(ctx context.Context, mappings []TxnMerchant) error
+	GetTxnMerchant(ctx context.Context, txnID int64) (TxnMerchant, error)
+	ListTxnMerchants(ctx context.Context, merchantID int64, source string) ([]TxnMerchant, error)
+	NearestMerchants(ctx context.Context, maxDistance float64) ([]TxnMerchant, error)
+	MerchantSpending(ctx context.Context, tq *TxnQuery) ([]MerchantSpending, error)
+}
+
+var (
+	_ TxnStore = (*Storage)(nil)
+	_ Store    = (*Storage)(nil)
+)
+
+// Storage is the postgres database. Transactions, attachments and views are
+// only read and written for a single household.
 type Storage struct {
-	db *sql.DB
+	db        *sql.DB
+	household int64
+}
+
+type newOpts struct {
+	config         *Config
+	skipMigrations bool
+	logf           func(format string, a ...any)
+}
+
+type NewOption func(o *newOpts)
+
+// WithConfig sets the database connection config. DefaultConfig is used
+// otherwise.
+func WithConfig(c *Config) NewOption {
+	return func(o *newOpts) {
+		o.config = c
+	}
 }
 
-func New() (*Storage, error) {
-	db, err := sql.Open("postgres", "host=db port=5432 user=postgres password=password dbname=postgres sslmode=disable")
+// WithoutMigrations skips applying pending schema migrations when
+// connecting to the database.
+func WithoutMigrations() NewOption {
+	return func(o *newOpts) {
+		o.skipMigrations = true
+	}
+}
+
+// WithLogf sets the function used to report failed connection attempts
+// that will be retried.
+func WithLogf(logf func(format string, a ...any)) NewOption {
+	return func(o *newOpts) {
+		o.logf = logf
+	}
+}
+
+func New(opts ...NewOption) (*Storage, error) {
+	nopts := newOpts{config: DefaultConfig(), logf: func(string, ...any) {}}
+	for _, o := range opts {
+		o(&nopts)
+	}
+	c := nopts.config
+	connStr, err := c.connString()
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open connection to postgres: %w", err)
 	}
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("connection to postgres was not healthy: %w", err)
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	backoff := c.ConnectBackoff
+	for attempt := 0; ; attempt++ {
+		err := db.Ping()
+		if err == nil {
+			break
+		}
+		if attempt >= c.ConnectRetries {
+			db.Close()
+			return nil, fmt.Errorf("connection to postgres was not healthy after %v attempts: %w", attempt+1, err)
+		}
+		nopts.logf("Connection to postgres was not healthy, retrying in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, c.ConnectMaxBackoff)
 	}
-	return &Storage{db: db}, nil
+	s := &Storage{db: db, household: DefaultHousehold}
+	if !nopts.skipMigrations {
+		if _, err := s.MigrateUp(context.Background()); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error migrating database schema: %w", err)
+		}
+	}
+	return s, nil
 }
 
 func (s *Storage) CreateTxn(ctx context.Context, t *Txn) (int64, error) {
 	if err := t.validate(); err != nil {
 		return 0, err
 	}
-	cols := []string{"DATE", "DESCRIPTION", "AMOUNT_CENTS", "SOURCE", "TAGS"}
-	vars := []string{"$1", "$2", "$3", "$4", "$5"}
-	vals := []any{t.Date, t.Description, t.AmountCents, t.Source, pq.Array(t.Tags)}
+	cols := []string{"HOUSEHOLD_ID", "DATE", "DESCRIPTION", "AMOUNT_CENTS", "SOURCE", "TAGS"}
+	vars := []string{"$1", "$2", "$3", "$4", "$5", "$6"}
+	vals := []any{s.household, t.Date, t.Description, t.AmountCents, t.Source, pq.Array(t.Tags)}
+	if t.Notes != "" {
+		cols = append(cols, "NOTES")
+		vars = append(vars, fmt.Sprint("$", len(vals)+1))
+		vals = append(vals, t.Notes)
+	}
 	if t.DescEmbedding != "" {
 		cols = append(cols, "DESC_EMBEDDING")
-		vars = append(vars, "$6")
+		vars = append(vars, fmt.Sprint("$", len(vals)+1))
 		vals = append(vals, t.DescEmbedding)
 	}
 	q := `INSERT INTO TRANSACTIONS (` + strings.Join(cols, ", ") + `)
@@ -296,6 +685,7 @@ VALUES (` + strings.Join(vars, ", ") + `) RETURNING ID
 
 type TxnUpdates struct {
 	Tags          *[]string
+	Notes         *string
 	DescEmbedding *string
 }
 
@@ -307,6 +697,15 @@ func int64sToStrs(is []int64) []string {
 	return s
 }
 
+// uniqueIDs returns the sorted IDs in ids without duplicates.
+func uniqueIDs(ids []int64) []int64 {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// UpdateTxns updates the given transactions of the household. Nothing is
+// changed and ErrNotFound is returned unless every ID exists.
 func (s *Storage) UpdateTxns(ctx context.Context, ids []int64, tu *TxnUpdates) error {
 	var defaultUpdates TxnUpdates
 	if tu == nil || *tu == defaultUpdates {
@@ -331,6 +730,18 @@ func (s *Storage) UpdateTxns(ctx context.Context, ids []int64, tu *TxnUpdates) e
 			vCounter += 1
 		}
 	}
+	if tu.Notes != nil {
+		if err := ValidateNotes(*tu.Notes); err != nil {
+			return fmt.Errorf("unable to update txns with invalid notes: %w", err)
+		}
+		if len(*tu.Notes) == 0 {
+			assigns = append(assigns, "NOTES = NULL")
+		} else {
+			assigns = append(assigns, fmt.Sprint("NOTES = $", vCounter))
+			vals = append(vals, *tu.Notes)
+			vCounter += 1
+		}
+	}
 	if tu.DescEmbedding != nil {
 		if len(ids) != 1 {
 			return fmt.Errorf("can't update embedding, got %v ids, want 1", len(ids))
@@ -342,13 +753,26 @@ func (s *Storage) UpdateTxns(ctx context.Context, ids []int64, tu *TxnUpdates) e
 		vals = append(vals, *tu.DescEmbedding)
 		vCounter += 1
 	}
+	ids = uniqueIDs(ids)
 	q += strings.Join(assigns, ", ")
-	q += fmt.Sprintf(" WHERE ID IN (%v)", strings.Join(int64sToStrs(ids), ", "))
-	rows, err := s.db.QueryContext(ctx, q, vals...)
+	q += fmt.Sprintf(" WHERE ID IN (%v) AND HOUSEHOLD_ID = %v", strings.Join(int64sToStrs(ids), ", "), s.household)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, q, vals...)
 	if err != nil {
 		return fmt.Errorf("error updating transaction: %w", err)
 	}
-	defer rows.Close()
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify txns were updated: %w", err)
+	} else if rows != int64(len(ids)) {
+		return fmt.Errorf("%w: got %v of %v txns to update", ErrNotFound, rows, len(ids))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing txn updates: %w", err)
+	}
 	return nil
 }
 
@@ -374,14 +798,14 @@ func (s *Storage) TxnAddTags(ctx context.Context, ids []int64, tags []string) er
 		SET TAGS = ARRAY(
 			SELECT DISTINCT UNNEST(TAGS || $1::VARCHAR(30)[])
 		)
-		WHERE ID = ANY($2::BIGINT[])
+		WHERE ID = ANY($2::BIGINT[]) AND HOUSEHOLD_ID = $3
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
-	result, err := stmt.ExecContext(ctx, pq.Array(tags), pq.Array(ids))
+	result, err := stmt.ExecContext(ctx, pq.Array(tags), pq.Array(ids), s.household)
 	if err != nil {
 		return fmt.Errorf("failed to execute update: %w", err)
 	}
@@ -419,14 +843,14 @@ func (s *Storage) TxnRemoveTags(ctx context.Context, ids []int64, tags []string)
 		SET TAGS = ARRAY(
 			SELECT UNNEST(TAGS) EXCEPT SELECT UNNEST($1::VARCHAR(30)[])
 		)
-		WHERE ID = ANY($2::BIGINT[])
+		WHERE ID = ANY($2::BIGINT[]) AND HOUSEHOLD_ID = $3
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
-	result, err := stmt.ExecContext(ctx, pq.Array(tags), pq.Array(ids))
+	result, err := stmt.ExecContext(ctx, pq.Array(tags), pq.Array(ids), s.household)
 	if err != nil {
 		return fmt.Errorf("failed to execute update: %w", err)
 	}
@@ -442,6 +866,111 @@ func (s *Storage) TxnRemoveTags(ctx context.Context, ids []int64, tags []string)
 	return nil
 }
 
+// TagsByQueryResult are the IDs of the transactions affected by
+// TxnTagsByQuery in ascending order.
+type TagsByQueryResult struct {
+	IDs    []int64
+	DryRun bool
+}
+
+// TxnTagsByQuery adds, removes or clears tags on every transaction matching
+// the filters in the given query in a single database transaction. The
+// pagination parameters of the query are ignored. Nothing is changed if more
+// than maxAffected transactions match or if dryRun is set.
+func (s *Storage) TxnTagsByQuery(ctx context.Context, tq *TxnQuery, op string, tags []string, maxAffected int, dryRun bool) (TagsByQueryResult, error) {
+	if err := tq.validate(); err != nil {
+		return TagsByQueryResult{}, err
+	}
+	if maxAffected <= 0 || maxAffected > MaxBulkTxns {
+		return TagsByQueryResult{}, fmt.Errorf("invalid max affected txns, got %v, want > 0 and <= %v", maxAffected, MaxBulkTxns)
+	}
+	var set string
+	var setArgs []any
+	switch op {
+	case TagsOpAdd:
+		set = `TAGS = ARRAY(SELECT DISTINCT UNNEST(TAGS || $2::VARCHAR(30)[]))`
+		setArgs = append(setArgs, pq.Array(tags))
+	case TagsOpRemove:
+		set = `TAGS = ARRAY(SELECT UNNEST(TAGS) EXCEPT SELECT UNNEST($2::VARCHAR(30)[]))`
+		setArgs = append(setArgs, pq.Array(tags))
+	case TagsOpClear:
+		set = `TAGS = NULL`
+		if len(tags) != 0 {
+			return TagsByQueryResult{}, fmt.Errorf("tags can't be specified when clearing tags, got %v", tags)
+		}
+	default:
+		return TagsByQueryResult{}, fmt.Errorf("unknown tags op '%v', want %v|%v|%v", op, TagsOpAdd, TagsOpRemove, TagsOpClear)
+	}
+	if op != TagsOpClear {
+		if len(tags) == 0 {
+			return TagsByQueryResult{}, errors.New("no tags given to update")
+		}
+		if err := ValidateTags(tags); err != nil {
+			return TagsByQueryResult{}, fmt.Errorf("error validating tags: %w", err)
+		}
+	}
+	ctq := *tq
+	ctq.StartID = 0
+	ctq.After = nil
+	clauses, args, err := ctq.asClauses(withHousehold(s.household))
+	if err != nil {
+		return TagsByQueryResult{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return TagsByQueryResult{}, fmt.Errorf("error beginning transaction with database: %w", err)
+	}
+	defer func() {
+		if tx == nil {
+			return
+		}
+		tx.Rollback()
+	}()
+	rows, err := tx.QueryContext(ctx,
+		`SELECT ID FROM TRANSACTIONS WHERE `+clausesAsQuery(clauses)+
+			fmt.Sprint(" ORDER BY ID ASC LIMIT ", maxAffected+1, " FOR UPDATE"),
+		args...)
+	if err != nil {
+		return TagsByQueryResult{}, fmt.Errorf("error querying for transactions to update: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return TagsByQueryResult{}, fmt.Errorf("error scanning transaction ID after scanning %v IDs: %w", len(ids), err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return TagsByQueryResult{}, fmt.Errorf("error querying for transactions to update: %w", err)
+	}
+	if len(ids) > maxAffected {
+		return TagsByQueryResult{}, fmt.Errorf("%w: query matched more than %v txns, narrow down the query or raise the limit", ErrTooManyTxns, maxAffected)
+	}
+	if dryRun || len(ids) == 0 {
+		return TagsByQueryResult{IDs: ids, DryRun: dryRun}, nil
+	}
+	result, err := tx.ExecContext(ctx,
+		`UPDATE TRANSACTIONS SET `+set+` WHERE ID = ANY($1::BIGINT[])`,
+		append([]any{pq.Array(ids)}, setArgs...)...)
+	if err != nil {
+		return TagsByQueryResult{}, fmt.Errorf("failed to execute update: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return TagsByQueryResult{}, fmt.Errorf("failed to verify number of updated txns: %w", err)
+	} else if int(n) != len(ids) {
+		return TagsByQueryResult{}, fmt.Errorf("not all txns updated successfully, got %v updated, want %v", n, len(ids))
+	}
+	if err := tx.Commit(); err != nil {
+		return TagsByQueryResult{}, fmt.Errorf("error committing updates: %w", err)
+	}
+	tx = nil
+	return TagsByQueryResult{IDs: ids}, nil
+}
+
 func clausesAsQuery(clauses []string) string {
 	if len(clauses) > 0 {
 		return strings.Join(clauses, " AND ")
@@ -449,41 +978,130 @@ func clausesAsQuery(clauses []string) string {
 	return "TRUE"
 }
 
-func (s *Storage) QueryTxns(ctx context.Context, tq *TxnQuery) ([]Txn, error) {
+type TxnsPage struct {
+	Txns    []Txn
+	HasMore bool
+}
+
+func (s *Storage) QueryTxns(ctx context.Context, tq *TxnQuery) (TxnsPage, error) {
 	if err := tq.validate(); err != nil {
-		return nil, err
+		return TxnsPage{}, err
 	}
-	q := `SELECT ID, DATE, DESCRIPTION, AMOUNT_CENTS, SOURCE, TAGS
+	// Fetch one extra row to find out whether there are more pages.
+	rows, err := s.selectTxns(ctx, tq, tq.Limit+1)
+	if err != nil {
+		return TxnsPage{}, err
+	}
+	defer rows.Close()
+
+	var result []Txn
+	for rows.Next() {
+		txn, err := scanTxn(rows)
+		if err != nil {
+			return TxnsPage{}, fmt.Errorf("error scanning transaction after scanning %v transactions: %w", len(result), err)
+		}
+		result = append(result, txn)
+	}
+	if int64(len(result)) > tq.Limit {
+		return TxnsPage{Txns: result[:tq.Limit], HasMore: true}, nil
+	}
+	return TxnsPage{Txns: result}, nil
+}
+
+// ForEachTxn calls fn with every transaction matching the given query in
+// the query's sort order without loading all of them in memory. The Limit
+// of the query is ignored. Iteration stops at the first error returned by
+// fn.
+func (s *Storage) ForEachTxn(ctx context.Context, tq *TxnQuery, fn func(t *Txn) error) error {
+	if err := tq.validate(); err != nil {
+		return err
+	}
+	rows, err := s.selectTxns(ctx, tq, 0)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		txn, err := scanTxn(rows)
+		if err != nil {
+			return fmt.Errorf("error scanning transaction after scanning %v transactions: %w", n, err)
+		}
+		if err := fn(&txn); err != nil {
+			return err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over transactions after %v transactions: %w", n, err)
+	}
+	return nil
+}
+
+// selectTxns runs the given validated query and returns at most limit rows
+// that can be read with scanTxn. There's no limit if limit is 0.
+func (s *Storage) selectTxns(ctx context.Context, tq *TxnQuery, limit int64) (*sql.Rows, error) {
+	q := `SELECT ID, DATE, DESCRIPTION, AMOUNT_CENTS, SOURCE, TAGS, COALESCE(NOTES, ''), ` + txnMerchantColumns("TRANSACTIONS.ID") + `
 FROM TRANSACTIONS WHERE `
-	clauses, args, err := tq.asClauses()
+	clauses, args, err := tq.asClauses(withHousehold(s.household))
+	if err != nil {
+		return nil, err
+	}
+	kc, kargs, err := tq.keysetClause(len(args) + 1)
 	if err != nil {
 		return nil, err
 	}
+	if kc != "" {
+		clauses = append(clauses, kc)
+		args = append(args, kargs...)
+	}
 	q += clausesAsQuery(clauses)
-	q += fmt.Sprint(" ORDER BY ID ASC LIMIT ", tq.Limit)
+	q += fmt.Sprint(" ORDER BY ", tq.orderBy())
+	if limit > 0 {
+		q += fmt.Sprint(" LIMIT ", limit)
+	}
 	rows, err := s.db.QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error querying for transactions: %w", err)
 	}
-	defer rows.Close()
+	return rows, nil
+}
 
-	var result []Txn
-	for rows.Next() {
-		var txn Txn
-		if err := rows.Scan(
-			&txn.ID,
-			&txn.Date,
-			&txn.Description,
-			&txn.AmountCents,
-			&txn.Source,
-			(*pq.StringArray)(&txn.Tags),
-		); err != nil {
-			return nil, fmt.Errorf("error scanning transaction after scanning %v transactions: %w", len(result), err)
-		}
-		result = append(result, txn)
-	}
+func scanTxn(rows *sql.Rows) (Txn, error) {
+	var txn Txn
+	err := rows.Scan(
+		&txn.ID,
+		&txn.Date,
+		&txn.Description,
+		&txn.AmountCents,
+		&txn.Source,
+		(*pq.StringArray)(&txn.Tags),
+		&txn.Notes,
+		&txn.MerchantID,
+		&txn.Merchant,
+	)
+	return txn, err
+}
 
-	return result, nil
+// CountTxns returns the total number of transactions matching the filters
+// in the given query, ignoring the pagination parameters StartID, After
+// and Limit.
+func (s *Storage) CountTxns(ctx context.Context, tq *TxnQuery) (int64, error) {
+	if err := tq.validate(); err != nil {
+		return 0, err
+	}
+	ctq := *tq
+	ctq.StartID = 0
+	ctq.After = nil
+	clauses, args, err := ctq.asClauses(withHousehold(s.household))
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM TRANSACTIONS WHERE `+clausesAsQuery(clauses), args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting transactions: %w", err)
+	}
+	return count, nil
 }
 
 type SimilarTxns struct {
@@ -495,7 +1113,10 @@ func (s *Storage) QuerySimilarTxns(ctx context.Context, ids []int64, tq *TxnQuer
 	if err := tq.validate(); err != nil {
 		return SimilarTxns{}, err
 	}
-	clauses, cargs, err := tq.asClauses(WithPrevArgs(1), WithTableID("t."))
+	if tq.sort() != SortID || tq.SortDesc || tq.After != nil {
+		return SimilarTxns{}, errors.New("sort orders and cursors are not supported when querying similar txns")
+	}
+	clauses, cargs, err := tq.asClauses(WithPrevArgs(1), WithTableID("t."), withHousehold(s.household))
 	if err != nil {
 		return SimilarTxns{}, err
 	}
@@ -510,9 +1131,10 @@ func (s *Storage) QuerySimilarTxns(ctx context.Context, ids []int64, tq *TxnQuer
 			t.AMOUNT_CENTS,
 			t.SOURCE,
 			t.TAGS,
+			t.NOTES,
 			t.DESC_EMBEDDING
 		FROM TRANSACTIONS AS t
-		WHERE t.ID = ANY($1::BIGINT[])
+		WHERE t.ID = ANY($1::BIGINT[]) AND t.HOUSEHOLD_ID = ` + fmt.Sprint(s.household) + `
     ),
 	AvgDescEmbedding AS (
 	  SELECT AVG(DESC_EMBEDDING) AS avg_desc_embedding FROM SelectedTransactions
@@ -524,7 +1146,8 @@ func (s *Storage) QuerySimilarTxns(ctx context.Context, ids []int64, tq *TxnQuer
             t.DESCRIPTION,
             t.AMOUNT_CENTS,
 			t.SOURCE,
-			t.TAGS
+			t.TAGS,
+			t.NOTES
         FROM
             TRANSACTIONS AS t
         WHERE
@@ -543,6 +1166,8 @@ SELECT
     AMOUNT_CENTS,
 	SOURCE,
 	TAGS,
+	COALESCE(NOTES, ''),
+	` + txnMerchantColumns("SelectedTransactions.ID") + `,
     0 AS QueryType
 FROM
     SelectedTransactions
@@ -556,6 +1181,8 @@ SELECT
     AMOUNT_CENTS,
 	SOURCE,
 	TAGS,
+	COALESCE(NOTES, ''),
+	` + txnMerchantColumns("SimilarTransactions.ID") + `,
     1 AS QueryType
 FROM
     SimilarTransactions
@@ -581,6 +1208,9 @@ ORDER BY DATE
 			&txn.AmountCents,
 			&txn.Source,
 			(*pq.StringArray)(&txn.Tags),
+			&txn.Notes,
+			&txn.MerchantID,
+			&txn.Merchant,
 			&qType); err != nil {
 			return SimilarTxns{}, fmt.Errorf("error scanning similar txn row from database: %w", err)
 		}
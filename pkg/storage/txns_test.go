@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+func FuzzValidateDescription(f *testing.F) {
+	for _, s := range []string{
+		"AMZN Mktp CA*2X4AB12",
+		"CAFÉ DU MONDE #123",
+		"Café Crème",
+		"PAYPAL @ EBAY (REF: 456)",
+		"Müller & Söhne GmbH",
+		"東京スーパー",
+		"tab\tseparated",
+		"new\nline",
+		"",
+		"\xff\xfe",
+		strings.Repeat("a", DescLimit+1),
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		err := ValidateDescription(s)
+		if err != nil {
+			return
+		}
+		if !utf8.ValidString(s) {
+			t.Fatalf("ValidateDescription(%q) accepted invalid UTF-8", s)
+		}
+		if l := utf8.RuneCountInString(s); l == 0 || l > DescLimit {
+			t.Fatalf("ValidateDescription(%q) accepted string with %v characters, want >0 and <= %v", s, l, DescLimit)
+		}
+		for _, c := range s {
+			if unicode.IsControl(c) || (unicode.IsSpace(c) && c != ' ' && !unicode.Is(unicode.Zs, c)) {
+				t.Fatalf("ValidateDescription(%q) accepted disallowed character %q", s, c)
+			}
+		}
+		tx := Txn{Date: time.Now(), Description: s, Source: "SRC"}
+		if err := tx.validate(); err != nil {
+			t.Fatalf("Txn.validate() rejected description %q accepted by ValidateDescription: %v", s, err)
+		}
+		tq := TxnQuery{Description: &s, DescOp: OpMatch}
+		if err := tq.validate(); err != nil {
+			t.Fatalf("TxnQuery.validate() rejected description %q accepted by ValidateDescription: %v", s, err)
+		}
+	})
+}
+
+func TestValidateSource(t *testing.T) {
+	for _, tc := range []struct {
+		source  string
+		wantErr bool
+	}{
+		{source: "AMEX"},
+		{source: "RBC_CHEQUING"},
+		{source: "Crédit Agricole: Visa"},
+		{source: "", wantErr: true},
+		{source: "bad\x00source", wantErr: true},
+		{source: strings.Repeat("é", SourceLimit)},
+		{source: strings.Repeat("é", SourceLimit+1), wantErr: true},
+	} {
+		if err := ValidateSource(tc.source); (err != nil) != tc.wantErr {
+			t.Errorf("ValidateSource(%q) got error %v, want error %v", tc.source, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateNotes(t *testing.T) {
+	for _, tc := range []struct {
+		notes   string
+		wantErr bool
+	}{
+		{notes: ""},
+		{notes: "paid back 50%"},
+		{notes: strings.Repeat("é", NotesLimit)},
+		{notes: strings.Repeat("é", NotesLimit+1), wantErr: true},
+		{notes: "\xff", wantErr: true},
+	} {
+		if err := ValidateNotes(tc.notes); (err != nil) != tc.wantErr {
+			t.Errorf("ValidateNotes(%q) got error %v, want error %v", tc.notes, err, tc.wantErr)
+		}
+	}
+}
+
+// TestStorage runs the TxnStore conformance suite against the postgres
+// database given by TXNS_TEST_DSN. The database is wiped so it must be a
+// disposable one.
+func TestStorage(t *testing.T) {
+	dsn := os.Getenv("TXNS_TEST_DSN")
+	if dsn == "" {
+		t.Skip("TXNS_TEST_DSN isn't set")
+	}
+	c := DefaultConfig()
+	c.DSN = dsn
+	c.ConnectRetries = 0
+	s, err := New(WithConfig(c))
+	if err != nil {
+		t.Fatalf("New got error: %v", err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	truncate := func(t *testing.T) {
+		if _, err := s.db.ExecContext(context.Background(), `TRUNCATE TRANSACTIONS, BUDGETS, MERCHANTS RESTART IDENTITY CASCADE`); err != nil {
+			t.Fatalf("error emptying the transactions table: %v", err)
+		}
+	}
+	testTxnStore(t, func(t *testing.T) TxnStore {
+		truncate(t)
+		return s
+	})
+
+	t.Run("Households", func(t *testing.T) {
+		truncate(t)
+		ctx := context.Background()
+		h, err := s.HouseholdByName(ctx, "test-other")
+		if errors.Is(err, ErrNotFound) {
+			h.ID, err = s.CreateHousehold(ctx, "test-other")
+		}
+		if err != nil {
+			t.Fatalf("error creating household: %v", err)
+		}
+		testHouseholdIsolation(t, s, s.ForHousehold(h.ID))
+	})
+
+	t.Run("TxnTagsByQuery", func(t *testing.T) {
+		truncate(t)
+		testTxnTagsByQuery(t, s)
+	})
+
+	t.Run("Splits", func(t *testing.T) {
+		truncate(t)
+		testSplits(t, s)
+	})
+
+	t.Run("Reimbursements", func(t *testing.T) {
+		truncate(t)
+		testReimbursements(t, s)
+	})
+
+	t.Run("NetSpending", func(t *testing.T) {
+		truncate(t)
+		testNetSpending(t, s)
+	})
+
+	t.Run("Budgets", func(t *testing.T) {
+		truncate(t)
+		testBudgets(t, s)
+	})
+
+	t.Run("Recurring", func(t *testing.T) {
+		truncate(t)
+		testRecurring(t, s)
+	})
+
+	t.Run("DescriptionNovelty", func(t *testing.T) {
+		truncate(t)
+		testDescriptionNovelty(t, s)
+	})
+
+	t.Run("Merchants", func(t *testing.T) {
+		truncate(t)
+		testMerchants(t, s)
+	})
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const (
+	ViewNameLimit       = 50
+	ViewQueryLimit      = 4000
+	pqUniqueViolation   = "23505"
+	viewColumnsSelected = "NAME, QUERY, CREATED_AT, UPDATED_AT"
+)
+
+var (
+	viewNameRegexp = regexp.MustCompile(`^[\w-]+$`)
+
+	ErrAlreadyExists = errors.New("already exists")
+)
+
+// View is a saved, named transactions query. Query holds the query
+// serialized as url encoded parameters of the GET /txns API, which includes
+// filters as well as the sort order.
+type View struct {
+	Name      string
+	Query     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func ValidateViewName(name string) error {
+	if l := len(name); l == 0 || l > ViewNameLimit {
+		return fmt.Errorf("invalid view name length, got %v, want >0 and <= %v", l, ViewNameLimit)
+	}
+	if !viewNameRegexp.MatchString(name) {
+		return fmt.Errorf("illegal characters in view name '%v', only alphanumeric, underscores and dashes are allowed", name)
+	}
+	return nil
+}
+
+func (v *View) validate() error {
+	if err := ValidateViewName(v.Name); err != nil {
+		return err
+	}
+	if l := len(v.Query); l > ViewQueryLimit {
+		return fmt.Errorf("view query too long, got length %v, want <= %v", l, ViewQueryLimit)
+	}
+	return nil
+}
+
+func scanView(row interface{ Scan(...any) error }) (View, error) {
+	var v View
+	err := row.Scan(&v.Name, &v.Query, &v.CreatedAt, &v.UpdatedAt)
+	return v, err
+}
+
+func (s *Storage) CreateView(ctx context.Context, v *View) error {
+	if err := v.validate(); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO VIEWS (HOUSEHOLD_ID, NAME, QUERY) VALUES ($1, $2, $3)`, s.household, v.Name, v.Query)
+	if isPQErr(err, pqUniqueViolation) {
+		return fmt.Errorf("%w: view '%v'", ErrAlreadyExists, v.Name)
+	} else if err != nil {
+		return fmt.Errorf("error creating view '%v': %w", v.Name, err)
+	}
+	return nil
+}
+
+func (s *Storage) ListViews(ctx context.Context) ([]View, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+viewColumnsSelected+` FROM VIEWS WHERE HOUSEHOLD_ID = $1 ORDER BY NAME ASC`, s.household)
+	if err != nil {
+		return nil, fmt.Errorf("error querying views: %w", err)
+	}
+	defer rows.Close()
+	var result []View
+	for rows.Next() {
+		v, err := scanView(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning view after scanning %v views: %w", len(result), err)
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+func (s *Storage) GetView(ctx context.Context, name string) (View, error) {
+	v, err := scanView(s.db.QueryRowContext(ctx, `SELECT `+viewColumnsSelected+` FROM VIEWS WHERE HOUSEHOLD_ID = $1 AND NAME = $2`, s.household, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return View{}, fmt.Errorf("%w: view '%v'", ErrNotFound, name)
+	} else if err != nil {
+		return View{}, fmt.Errorf("error fetching view '%v': %w", name, err)
+	}
+	return v, nil
+}
+
+func (s *Storage) UpdateView(ctx context.Context, v *View) error {
+	if err := v.validate(); err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx, `UPDATE VIEWS SET QUERY = $3, UPDATED_AT = NOW() WHERE HOUSEHOLD_ID = $1 AND NAME = $2`, s.household, v.Name, v.Query)
+	if err != nil {
+		return fmt.Errorf("error updating view '%v': %w", v.Name, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify view '%v' was updated: %w", v.Name, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: view '%v'", ErrNotFound, v.Name)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteView(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM VIEWS WHERE HOUSEHOLD_ID = $1 AND NAME = $2`, s.household, name)
+	if err != nil {
+		return fmt.Errorf("error deleting view '%v': %w", name, err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to verify view '%v' was deleted: %w", name, err)
+	} else if rows == 0 {
+		return fmt.Errorf("%w: view '%v'", ErrNotFound, name)
+	}
+	return nil
+}
@@ -1,7 +1,10 @@
 import requests
 import json
+import os
 
 _url = "http://localhost:4000/txns"
+# API token created with `txns token create`.
+_headers = {"Authorization": "Bearer {}".format(os.environ["TXNS_API_TOKEN"])}
 
 
 def download():
@@ -17,7 +20,7 @@ def download():
     }
     print("#{}: Requesting txns startId={}, limit={}".format(
         iter, nextId, limit))
-    resp = requests.get(_url, params=params)
+    resp = requests.get(_url, params=params, headers=_headers)
     jsonResp = resp.json()
     nextId = jsonResp.get("nextId")
     respTxns = jsonResp.get("txns")
@@ -26,6 +29,7 @@ def download():
       break
     print("#{}: Received {} txns.".format(iter, len(respTxns)))
     iter += 1
+    hasMore = jsonResp.get("hasMore")
     for t in respTxns:
       tid = int(t["id"])
       if prevTxnId and tid <= prevTxnId:
@@ -34,6 +38,8 @@ def download():
             .format(prevTxnId, tid))
       prevTxnId = tid
       txns.append(t)
+    if not hasMore:
+      break
   outfile = "data/all.json"
   with open(outfile, "w") as ofp:
     json.dump(txns, ofp)
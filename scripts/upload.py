@@ -1,9 +1,12 @@
 import pandas as pd
 import requests
 import json
+import os
 from datetime import datetime
 
 _upload_url = "http://localhost:4000/txns"
+# API token created with `txns token create`.
+_headers = {"Authorization": "Bearer {}".format(os.environ["TXNS_API_TOKEN"])}
 _ollama_url = "http://localhost:11434/api/embed"
 
 
@@ -20,6 +23,7 @@ def _upload_df(df: pd.DataFrame, source: str):
   df = df.sort_values(by='Date', ascending=True)
   for date, desc, amount in zip(df["Date"], df["Description"], df["Amount"]):
     resp = requests.post(_upload_url,
+                         headers=_headers,
                          json={
                              "date": date,
                              "description": desc,